@@ -0,0 +1,26 @@
+package client
+
+import (
+	"back/openapi"
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestGeneratedClientIsUpToDate(t *testing.T) {
+	doc, err := openapi.Parse(openapi.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := openapi.GenerateClient(doc, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("zz_generated.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("zz_generated.go is out of date with openapi.json; run go generate ./client")
+	}
+}
@@ -0,0 +1,989 @@
+// Code generated by cmd/openapi-client from openapi/openapi.json; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type APIError struct {
+	// Stable machine-readable error code.
+	Code string `json:"code"`
+	// Extra context for some codes, e.g. the missing permission.
+	Details map[string]any     `json:"details,omitempty"`
+	Graph   *GraphErrorDetails `json:"graph,omitempty"`
+	// Human-readable description; may change.
+	Message string `json:"message"`
+	// Matches the X-Request-ID response header.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type APIKey struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	ID         string     `json:"id"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Name       string     `json:"name"`
+	// First characters of the key, for identification.
+	Prefix    string     `json:"prefix"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Role      string     `json:"role"`
+	TenantID  string     `json:"tenant_id"`
+}
+
+type APIKeyList struct {
+	Count   int      `json:"count"`
+	Keys    []APIKey `json:"keys"`
+	Success bool     `json:"success"`
+}
+
+// Accounts keyed by WABA ID.
+type AccountExport map[string]BusinessAccount
+
+type AccountList struct {
+	Accounts []BusinessAccount `json:"accounts"`
+	Count    int               `json:"count"`
+	Success  bool              `json:"success"`
+}
+
+type AccountResponse struct {
+	Account BusinessAccount `json:"account"`
+	Success bool            `json:"success"`
+}
+
+type AuditChange struct {
+	// New value; secrets are redacted.
+	After any `json:"after,omitempty"`
+	// Previous value; secrets are redacted.
+	Before any `json:"before,omitempty"`
+}
+
+type AuditEntry struct {
+	Action string `json:"action"`
+	// API key ID, or "system".
+	ActorID    string                 `json:"actor_id"`
+	ActorName  string                 `json:"actor_name,omitempty"`
+	At         time.Time              `json:"at"`
+	Changes    map[string]AuditChange `json:"changes,omitempty"`
+	Hash       string                 `json:"hash"`
+	IP         string                 `json:"ip,omitempty"`
+	PrevHash   string                 `json:"prev_hash"`
+	RequestID  string                 `json:"request_id,omitempty"`
+	Seq        int64                  `json:"seq"`
+	TargetID   string                 `json:"target_id"`
+	TargetType string                 `json:"target_type"`
+	TenantID   string                 `json:"tenant_id"`
+}
+
+type AuditList struct {
+	ChainError string       `json:"chain_error,omitempty"`
+	ChainValid bool         `json:"chain_valid"`
+	Count      int          `json:"count"`
+	Entries    []AuditEntry `json:"entries"`
+	Success    bool         `json:"success"`
+}
+
+type AuthCodeRequest struct {
+	// Meta app the frontend ran Embedded Signup with. Defaults to the default app.
+	AppID string `json:"app_id,omitempty"`
+	// Code from the embedded signup FB.login response.
+	AuthorizationCode string         `json:"authorization_code"`
+	BusinessID        string         `json:"business_id,omitempty"`
+	ClientInfo        map[string]any `json:"client_info,omitempty"`
+	// Embedded Signup configuration ID, used to pick the app when app_id is not sent.
+	ConfigID      string `json:"config_id,omitempty"`
+	PhoneNumberID string `json:"phone_number_id,omitempty"`
+	RedirectURI   string `json:"redirect_uri,omitempty"`
+	// WABA ID from the embedded signup message event.
+	WABAID string `json:"waba_id,omitempty"`
+}
+
+type AuthorizationDenial struct {
+	At          time.Time `json:"at"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Permission  string    `json:"permission"`
+	PrincipalID string    `json:"principal_id"`
+	Role        string    `json:"role"`
+	TenantID    string    `json:"tenant_id"`
+}
+
+// Identifies the running binary.
+type BuildInfo struct {
+	// VCS revision, suffixed -dirty for modified checkouts
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"go_version"`
+	// Release version, "dev" for untagged builds
+	Version string `json:"version"`
+}
+
+type BulkSendRequest struct {
+	// What to do when the recipients exceed the remaining messaging limit.
+	OnLimit string `json:"on_limit,omitempty"`
+	// Sender; defaults to the account's first phone number.
+	PhoneNumberID string `json:"phone_number_id,omitempty"`
+	// Send through the outbound queue instead of within the request.
+	Queue *bool  `json:"queue,omitempty"`
+	Text  string `json:"text"`
+	// Recipient phone numbers, at most 1000, or 100 without queue. Repeats are sent once.
+	To []string `json:"to"`
+}
+
+type BulkSendResponse struct {
+	Capacity MessagingCapacity `json:"capacity"`
+	// Recipients over the messaging limit; not sent.
+	Deferred      []string         `json:"deferred"`
+	Failed        []BulkSendResult `json:"failed"`
+	PhoneNumberID string           `json:"phone_number_id"`
+	// With queue, the queued messages instead of sent and failed.
+	Queued  []OutboundMessage `json:"queued,omitempty"`
+	Sent    []BulkSendResult  `json:"sent"`
+	Success bool              `json:"success"`
+}
+
+type BulkSendResult struct {
+	Graph *GraphErrorDetails `json:"graph,omitempty"`
+	// WhatsApp message ID, for sent messages.
+	MessageID string `json:"message_id,omitempty"`
+	To        string `json:"to"`
+}
+
+type BusinessAccount struct {
+	// Only returned to callers with the view_tokens permission.
+	AccessToken string `json:"access_token,omitempty"`
+	// Meta app the account was onboarded through.
+	AppID        string         `json:"app_id,omitempty"`
+	BusinessName string         `json:"business_name"`
+	CreatedAt    time.Time      `json:"created_at"`
+	ID           string         `json:"id"`
+	Metadata     map[string]any `json:"metadata,omitempty"`
+	// The token could not be refreshed; the business must redo Embedded Signup. An account.reauth_required event is published when this is set.
+	NeedsReauth   bool                  `json:"needs_reauth"`
+	PhoneNumbers  []BusinessPhoneNumber `json:"phone_numbers"`
+	ReauthReason  string                `json:"reauth_reason,omitempty"`
+	SetupComplete bool                  `json:"setup_complete"`
+	TenantID      string                `json:"tenant_id"`
+	// Absent for tokens that do not expire. Tokens expiring within TOKEN_REFRESH_WINDOW are refreshed in the background.
+	TokenExpiresAt *time.Time `json:"token_expires_at,omitempty"`
+	// Last background refresh of the access token.
+	TokenRefreshedAt *time.Time `json:"token_refreshed_at,omitempty"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	WABAID           string     `json:"waba_id"`
+	WebhooksEnabled  bool       `json:"webhooks_enabled"`
+}
+
+// Kept current by a periodic sync with Meta and by phone_number_quality_update webhooks.
+type BusinessPhoneNumber struct {
+	DisplayName string `json:"display_name"`
+	ID          string `json:"id"`
+	IsVerified  bool   `json:"is_verified"`
+	// Business-initiated conversations allowed per 24 hours, e.g. TIER_1K.
+	MessagingLimitTier string `json:"messaging_limit_tier,omitempty"`
+	// Display name review status.
+	NameStatus  string `json:"name_status,omitempty"`
+	PhoneNumber string `json:"phone_number"`
+	// CLOUD_API, ON_PREMISE or NOT_APPLICABLE.
+	PlatformType  string `json:"platform_type,omitempty"`
+	QualityRating string `json:"quality_rating"`
+	Status        string `json:"status"`
+	// Cloud API throughput level: STANDARD, HIGH or NOT_APPLICABLE.
+	Throughput string `json:"throughput,omitempty"`
+}
+
+type BusinessSetupResponse struct {
+	BusinessInfo *BusinessAccount `json:"business_info,omitempty"`
+	Message      string           `json:"message,omitempty"`
+	NextSteps    []string         `json:"next_steps,omitempty"`
+	SetupStatus  string           `json:"setup_status,omitempty"`
+	Success      bool             `json:"success"`
+	TokenInfo    map[string]any   `json:"token_info,omitempty"`
+}
+
+type CapacityPoint struct {
+	At        time.Time `json:"at"`
+	Remaining int       `json:"remaining"`
+}
+
+type CapacityResponse struct {
+	Capacity MessagingCapacity `json:"capacity"`
+	Success  bool              `json:"success"`
+}
+
+type ComponentHealth struct {
+	// Whether a failure makes the server unavailable rather than degraded
+	Critical   bool   `json:"critical"`
+	DurationMS int64  `json:"duration_ms"`
+	Message    string `json:"message,omitempty"`
+	Status     string `json:"status"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+	// Defaults to read_only; may not outrank the caller.
+	Role string `json:"role,omitempty"`
+}
+
+type CreateAPIKeyResponse struct {
+	// The key itself, shown only once.
+	APIKey  string `json:"api_key"`
+	Key     APIKey `json:"key"`
+	Success bool   `json:"success"`
+}
+
+type CreateTenantRequest struct {
+	Name string `json:"name"`
+}
+
+type CreateTenantResponse struct {
+	// The tenant's initial owner key, shown only once.
+	APIKey  string `json:"api_key"`
+	Key     APIKey `json:"key"`
+	Success bool   `json:"success"`
+	Tenant  Tenant `json:"tenant"`
+}
+
+type DeleteAccountResponse struct {
+	Success bool `json:"success"`
+	// False when the account was force-deleted without unsubscribing.
+	Unsubscribed bool `json:"unsubscribed"`
+}
+
+type DeliveryList struct {
+	Count      int                  `json:"count"`
+	Deliveries []ForwardingDelivery `json:"deliveries"`
+	Success    bool                 `json:"success"`
+}
+
+type DenialList struct {
+	Count   int                   `json:"count"`
+	Denials []AuthorizationDenial `json:"denials"`
+	Success bool                  `json:"success"`
+}
+
+// Envelope of every failed request. See ERRORS.md for the codes.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+	// Always false.
+	Success bool `json:"success"`
+}
+
+type ForwardingDelivery struct {
+	Attempt        int       `json:"attempt"`
+	AttemptedAt    time.Time `json:"attempted_at"`
+	DurationMS     int64     `json:"duration_ms"`
+	Error          string    `json:"error,omitempty"`
+	EventID        string    `json:"event_id"`
+	EventType      string    `json:"event_type"`
+	ID             string    `json:"id"`
+	StatusCode     int       `json:"status_code,omitempty"`
+	SubscriptionID string    `json:"subscription_id"`
+	Success        bool      `json:"success"`
+}
+
+type ForwardingSubscription struct {
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	CreatedAt           time.Time `json:"created_at"`
+	DisabledReason      string    `json:"disabled_reason,omitempty"`
+	Enabled             bool      `json:"enabled"`
+	EventTypes          []string  `json:"event_types,omitempty"`
+	ID                  string    `json:"id"`
+	// Signing secret, only returned on creation.
+	Secret    string    `json:"secret,omitempty"`
+	TargetURL string    `json:"target_url"`
+	TenantID  string    `json:"tenant_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+	WABAIDs   []string  `json:"waba_ids,omitempty"`
+}
+
+type ForwardingSubscriptionRequest struct {
+	// Updates only.
+	Enabled *bool `json:"enabled,omitempty"`
+	// Empty means all; "message.*" style prefixes allowed.
+	EventTypes []string `json:"event_types,omitempty"`
+	TargetURL  string   `json:"target_url"`
+	// Empty means all WABAs.
+	WABAIDs []string `json:"waba_ids,omitempty"`
+}
+
+// Safe fields of the upstream Graph API error, when the failure came from Meta.
+type GraphErrorDetails struct {
+	Code         int    `json:"code,omitempty"`
+	ErrorSubcode int    `json:"error_subcode,omitempty"`
+	FbtraceID    string `json:"fbtrace_id,omitempty"`
+	// HTTP status of the Graph response.
+	Status int    `json:"status"`
+	Type   string `json:"type,omitempty"`
+}
+
+type HealthResponse struct {
+	Build     BuildInfo `json:"build"`
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// A phone number's headroom under its messaging limit tier.
+type MessagingCapacity struct {
+	// Customers per rolling 24 hours; 0 when unlimited.
+	Limit int `json:"limit"`
+	// Tier as last reported by Meta, e.g. TIER_1K. Absent until reported; TIER_250 is assumed meanwhile.
+	MessagingLimitTier string `json:"messaging_limit_tier,omitempty"`
+	// Sent through a bulk send, no status webhook received yet.
+	Pending       int    `json:"pending"`
+	PhoneNumberID string `json:"phone_number_id"`
+	// Remaining capacity at each of the next 24 hours, counting only conversations open now.
+	Projection []CapacityPoint `json:"projection,omitempty"`
+	Remaining  int             `json:"remaining"`
+	Unlimited  bool            `json:"unlimited"`
+	// Business-initiated conversations open in the window, including pending ones.
+	Used int `json:"used"`
+}
+
+type OutboundMessage struct {
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	// Latest status webhook once sent: sent, delivered, read or failed.
+	DeliveryStatus string `json:"delivery_status,omitempty"`
+	// Why the last attempt failed.
+	Error string `json:"error,omitempty"`
+	// Graph or Cloud API code of the last failure.
+	ErrorCode int    `json:"error_code,omitempty"`
+	ID        string `json:"id"`
+	// WhatsApp message ID once Meta accepted the message.
+	MessageID string `json:"message_id,omitempty"`
+	// When a throttled message is retried.
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	PhoneNumberID string     `json:"phone_number_id"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	Status        string     `json:"status"`
+	TenantID      string     `json:"tenant_id"`
+	Text          string     `json:"text"`
+	To            string     `json:"to"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	WABAID        string     `json:"waba_id"`
+}
+
+type PhoneNumberChange struct {
+	After     string    `json:"after"`
+	Before    string    `json:"before"`
+	ChangedAt time.Time `json:"changed_at"`
+	// Changed BusinessPhoneNumber field. Numbers added to or removed from the WABA are a change of phone_number from or to "".
+	Field         string `json:"field"`
+	PhoneNumberID string `json:"phone_number_id"`
+	Source        string `json:"source"`
+}
+
+type PhoneNumberHistory struct {
+	Changes       []PhoneNumberChange `json:"changes"`
+	Count         int                 `json:"count"`
+	PhoneNumberID string              `json:"phone_number_id"`
+	Success       bool                `json:"success"`
+}
+
+type PhoneNumberList struct {
+	Count        int                   `json:"count"`
+	PhoneNumbers []BusinessPhoneNumber `json:"phone_numbers"`
+	Success      bool                  `json:"success"`
+}
+
+type QueuedMessageResponse struct {
+	Message OutboundMessage `json:"message"`
+	Success bool            `json:"success"`
+}
+
+type ReadinessResponse struct {
+	Build BuildInfo `json:"build"`
+	// Results by check name: storage, forwarding_queue, outbound_queue, config, graph_api
+	Checks    map[string]ComponentHealth `json:"checks"`
+	Status    string                     `json:"status"`
+	Timestamp time.Time                  `json:"timestamp"`
+}
+
+type RejectedWebhook struct {
+	Reason     string    `json:"reason"`
+	ReceivedAt time.Time `json:"received_at"`
+	// Body size in bytes.
+	Size int `json:"size"`
+}
+
+type RejectedWebhookList struct {
+	Count    int               `json:"count"`
+	Rejected []RejectedWebhook `json:"rejected"`
+	Success  bool              `json:"success"`
+}
+
+type SendMessageRequest struct {
+	// Sender; defaults to the account's first phone number.
+	PhoneNumberID string `json:"phone_number_id,omitempty"`
+	Text          string `json:"text"`
+	// Recipient phone number.
+	To string `json:"to"`
+}
+
+type SendMessageResponse struct {
+	// WhatsApp message ID, as used in status webhooks.
+	MessageID     string `json:"message_id"`
+	PhoneNumberID string `json:"phone_number_id"`
+	Success       bool   `json:"success"`
+}
+
+type SessionResponse struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Success   bool      `json:"success"`
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+}
+
+type SubscriptionList struct {
+	Count         int                      `json:"count"`
+	Subscriptions []ForwardingSubscription `json:"subscriptions"`
+	Success       bool                     `json:"success"`
+}
+
+type SubscriptionResponse struct {
+	Subscription ForwardingSubscription `json:"subscription"`
+	Success      bool                   `json:"success"`
+}
+
+type SuccessResponse struct {
+	Success bool `json:"success"`
+}
+
+type TemplateQualityScore struct {
+	Score string `json:"score"`
+}
+
+type TemplatesResponse struct {
+	Success   bool               `json:"success"`
+	Templates []WhatsAppTemplate `json:"templates,omitempty"`
+	TokenInfo map[string]any     `json:"token_info,omitempty"`
+}
+
+type Tenant struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+}
+
+type TenantList struct {
+	Count   int      `json:"count"`
+	Success bool     `json:"success"`
+	Tenants []Tenant `json:"tenants"`
+}
+
+type WebhookEventList struct {
+	Count   int                  `json:"count"`
+	Events  []WebhookEventRecord `json:"events"`
+	Success bool                 `json:"success"`
+}
+
+type WebhookEventRecord struct {
+	// Meta app whose secret signed the delivery.
+	AppID string `json:"app_id,omitempty"`
+	// Raw payload exactly as received.
+	Body           string     `json:"body"`
+	Error          string     `json:"error,omitempty"`
+	Fields         []string   `json:"fields,omitempty"`
+	ID             string     `json:"id"`
+	LastReplayedAt *time.Time `json:"last_replayed_at,omitempty"`
+	Object         string     `json:"object,omitempty"`
+	Outcome        string     `json:"outcome"`
+	PhoneNumberIDs []string   `json:"phone_number_ids,omitempty"`
+	ReceivedAt     time.Time  `json:"received_at"`
+	ReplayCount    int        `json:"replay_count"`
+	SignatureValid bool       `json:"signature_valid"`
+	TenantID       string     `json:"tenant_id,omitempty"`
+	WABAIDs        []string   `json:"waba_ids,omitempty"`
+}
+
+type WebhookEventReplay struct {
+	Event WebhookEventRecord `json:"event"`
+	// Whether the replayed event processed successfully.
+	Success bool `json:"success"`
+}
+
+// Meta webhook notification, see the WhatsApp Cloud API webhook reference.
+type WebhookPayload map[string]any
+
+type WhatsAppTemplate struct {
+	Category     string                `json:"category"`
+	ID           string                `json:"id"`
+	Language     string                `json:"language"`
+	Name         string                `json:"name"`
+	QualityScore *TemplateQualityScore `json:"quality_score,omitempty"`
+	Status       string                `json:"status"`
+}
+
+// CompleteEmbeddedSignup calls POST /api/whatsapp/setup: complete embedded signup.
+// Requires the onboard_accounts permission.
+func (c *Client) CompleteEmbeddedSignup(ctx context.Context, body *AuthCodeRequest) (*BusinessSetupResponse, error) {
+	path := "/api/whatsapp/setup"
+	var out BusinessSetupResponse
+	if err := c.do(ctx, "POST", path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateAPIKey calls POST /api/auth/keys: create an API key.
+// Requires the manage_api_keys permission.
+func (c *Client) CreateAPIKey(ctx context.Context, body *CreateAPIKeyRequest) (*CreateAPIKeyResponse, error) {
+	path := "/api/auth/keys"
+	var out CreateAPIKeyResponse
+	if err := c.do(ctx, "POST", path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateSession calls POST /api/auth/session: exchange a credential for a session token.
+func (c *Client) CreateSession(ctx context.Context) (*SessionResponse, error) {
+	path := "/api/auth/session"
+	var out SessionResponse
+	if err := c.do(ctx, "POST", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateSubscription calls POST /api/forwarding/subscriptions: create a forwarding subscription.
+// Requires the manage_webhooks permission.
+func (c *Client) CreateSubscription(ctx context.Context, body *ForwardingSubscriptionRequest) (*SubscriptionResponse, error) {
+	path := "/api/forwarding/subscriptions"
+	var out SubscriptionResponse
+	if err := c.do(ctx, "POST", path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateTenant calls POST /api/tenants: create a tenant and its first owner key (platform tenant only).
+// Requires the manage_api_keys permission.
+func (c *Client) CreateTenant(ctx context.Context, body *CreateTenantRequest) (*CreateTenantResponse, error) {
+	path := "/api/tenants"
+	var out CreateTenantResponse
+	if err := c.do(ctx, "POST", path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAccountParams are the optional query parameters of DeleteAccount.
+type DeleteAccountParams struct {
+	// Delete even if Meta rejects the webhook unsubscribe.
+	Force bool
+}
+
+func (p *DeleteAccountParams) values() url.Values {
+	q := url.Values{}
+	if p.Force {
+		q.Set("force", "true")
+	}
+	return q
+}
+
+// DeleteAccount calls DELETE /api/business/accounts/{wabaID}: offboard an account.
+// Requires the delete_accounts permission.
+func (c *Client) DeleteAccount(ctx context.Context, wabaID string, params *DeleteAccountParams) (*DeleteAccountResponse, error) {
+	path := "/api/business/accounts/" + url.PathEscape(wabaID)
+	var query url.Values
+	if params != nil {
+		query = params.values()
+	}
+	var out DeleteAccountResponse
+	if err := c.do(ctx, "DELETE", path, query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteSubscription calls DELETE /api/forwarding/subscriptions/{id}: delete a forwarding subscription.
+// Requires the manage_webhooks permission.
+func (c *Client) DeleteSubscription(ctx context.Context, id string) (*SuccessResponse, error) {
+	path := "/api/forwarding/subscriptions/" + url.PathEscape(id)
+	var out SuccessResponse
+	if err := c.do(ctx, "DELETE", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ExportAccounts calls GET /api/business/export: export the tenant's accounts.
+// Requires the export_data permission.
+func (c *Client) ExportAccounts(ctx context.Context) (*AccountExport, error) {
+	path := "/api/business/export"
+	var out AccountExport
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAccount calls GET /api/business/accounts/{wabaID}: get an account.
+// Requires the read_accounts permission.
+func (c *Client) GetAccount(ctx context.Context, wabaID string) (*AccountResponse, error) {
+	path := "/api/business/accounts/" + url.PathEscape(wabaID)
+	var out AccountResponse
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetHealth calls GET /health: liveness check (alias of /healthz).
+func (c *Client) GetHealth(ctx context.Context) (*HealthResponse, error) {
+	path := "/health"
+	var out HealthResponse
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetLiveness calls GET /healthz: liveness check.
+func (c *Client) GetLiveness(ctx context.Context) (*HealthResponse, error) {
+	path := "/healthz"
+	var out HealthResponse
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPhoneNumberCapacity calls GET /api/business/accounts/{wabaID}/phone-numbers/{phoneNumberID}/capacity: show a phone number's remaining messaging capacity.
+// Requires the read_accounts permission.
+func (c *Client) GetPhoneNumberCapacity(ctx context.Context, wabaID string, phoneNumberID string) (*CapacityResponse, error) {
+	path := "/api/business/accounts/" + url.PathEscape(wabaID) + "/phone-numbers/" + url.PathEscape(phoneNumberID) + "/capacity"
+	var out CapacityResponse
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPhoneNumberHistory calls GET /api/business/accounts/{wabaID}/phone-numbers/{phoneNumberID}/history: list recorded changes of a phone number.
+// Requires the read_accounts permission.
+func (c *Client) GetPhoneNumberHistory(ctx context.Context, wabaID string, phoneNumberID string) (*PhoneNumberHistory, error) {
+	path := "/api/business/accounts/" + url.PathEscape(wabaID) + "/phone-numbers/" + url.PathEscape(phoneNumberID) + "/history"
+	var out PhoneNumberHistory
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetQueuedMessage calls GET /api/business/accounts/{wabaID}/messages/queue/{messageID}: show a queued message's status.
+// Requires the read_accounts permission.
+func (c *Client) GetQueuedMessage(ctx context.Context, wabaID string, messageID string) (*QueuedMessageResponse, error) {
+	path := "/api/business/accounts/" + url.PathEscape(wabaID) + "/messages/queue/" + url.PathEscape(messageID)
+	var out QueuedMessageResponse
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetReadiness calls GET /readyz: readiness check.
+func (c *Client) GetReadiness(ctx context.Context) (*ReadinessResponse, error) {
+	path := "/readyz"
+	var out ReadinessResponse
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSubscription calls GET /api/forwarding/subscriptions/{id}: get a forwarding subscription.
+// Requires the read_accounts permission.
+func (c *Client) GetSubscription(ctx context.Context, id string) (*SubscriptionResponse, error) {
+	path := "/api/forwarding/subscriptions/" + url.PathEscape(id)
+	var out SubscriptionResponse
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListAPIKeys calls GET /api/auth/keys: list API keys.
+// Requires the manage_api_keys permission.
+func (c *Client) ListAPIKeys(ctx context.Context) (*APIKeyList, error) {
+	path := "/api/auth/keys"
+	var out APIKeyList
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListAccounts calls GET /api/business/accounts: list onboarded accounts.
+// Requires the read_accounts permission.
+func (c *Client) ListAccounts(ctx context.Context) (*AccountList, error) {
+	path := "/api/business/accounts"
+	var out AccountList
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListAuditEntriesParams are the optional query parameters of ListAuditEntries.
+type ListAuditEntriesParams struct {
+	// Filter by actor.
+	ActorID string
+	// Filter by action, e.g. account.deleted.
+	Action string
+	// Filter by target type.
+	TargetType string
+	// Filter by target ID.
+	TargetID string
+	// RFC 3339 time or Unix seconds.
+	Since string
+	// RFC 3339 time or Unix seconds.
+	Until string
+	// Maximum results, default 100.
+	Limit int
+}
+
+func (p *ListAuditEntriesParams) values() url.Values {
+	q := url.Values{}
+	if p.ActorID != "" {
+		q.Set("actor_id", p.ActorID)
+	}
+	if p.Action != "" {
+		q.Set("action", p.Action)
+	}
+	if p.TargetType != "" {
+		q.Set("target_type", p.TargetType)
+	}
+	if p.TargetID != "" {
+		q.Set("target_id", p.TargetID)
+	}
+	if p.Since != "" {
+		q.Set("since", p.Since)
+	}
+	if p.Until != "" {
+		q.Set("until", p.Until)
+	}
+	if p.Limit != 0 {
+		q.Set("limit", strconv.Itoa(p.Limit))
+	}
+	return q
+}
+
+// ListAuditEntries calls GET /api/audit: search the audit log.
+// Requires the view_audit permission.
+func (c *Client) ListAuditEntries(ctx context.Context, params *ListAuditEntriesParams) (*AuditList, error) {
+	path := "/api/audit"
+	var query url.Values
+	if params != nil {
+		query = params.values()
+	}
+	var out AuditList
+	if err := c.do(ctx, "GET", path, query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDeliveries calls GET /api/forwarding/subscriptions/{id}/deliveries: list recent delivery attempts.
+// Requires the read_accounts permission.
+func (c *Client) ListDeliveries(ctx context.Context, id string) (*DeliveryList, error) {
+	path := "/api/forwarding/subscriptions/" + url.PathEscape(id) + "/deliveries"
+	var out DeliveryList
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDenials calls GET /api/auth/denials: list recent authorization denials.
+// Requires the view_audit permission.
+func (c *Client) ListDenials(ctx context.Context) (*DenialList, error) {
+	path := "/api/auth/denials"
+	var out DenialList
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListPhoneNumbers calls GET /api/business/accounts/{wabaID}/phone-numbers: list an account's phone numbers.
+// Requires the read_accounts permission.
+func (c *Client) ListPhoneNumbers(ctx context.Context, wabaID string) (*PhoneNumberList, error) {
+	path := "/api/business/accounts/" + url.PathEscape(wabaID) + "/phone-numbers"
+	var out PhoneNumberList
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListRejectedWebhooks calls GET /api/webhooks/rejected: list webhook deliveries rejected for an invalid signature (platform tenant only).
+// Requires the read_accounts permission.
+func (c *Client) ListRejectedWebhooks(ctx context.Context) (*RejectedWebhookList, error) {
+	path := "/api/webhooks/rejected"
+	var out RejectedWebhookList
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListSubscriptions calls GET /api/forwarding/subscriptions: list forwarding subscriptions.
+// Requires the read_accounts permission.
+func (c *Client) ListSubscriptions(ctx context.Context) (*SubscriptionList, error) {
+	path := "/api/forwarding/subscriptions"
+	var out SubscriptionList
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListTemplates calls POST /api/whatsapp/templates: list a WABA's message templates.
+// Requires the manage_templates permission.
+func (c *Client) ListTemplates(ctx context.Context, body *AuthCodeRequest) (*TemplatesResponse, error) {
+	path := "/api/whatsapp/templates"
+	var out TemplatesResponse
+	if err := c.do(ctx, "POST", path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListTenants calls GET /api/tenants: list tenants (platform tenant only).
+// Requires the manage_api_keys permission.
+func (c *Client) ListTenants(ctx context.Context) (*TenantList, error) {
+	path := "/api/tenants"
+	var out TenantList
+	if err := c.do(ctx, "GET", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListWebhookEventsParams are the optional query parameters of ListWebhookEvents.
+type ListWebhookEventsParams struct {
+	// Filter by WABA ID.
+	WABAID string
+	// Filter by phone number ID.
+	PhoneNumberID string
+	// Filter by webhook field, e.g. messages.
+	Field string
+	// Filter by processing outcome.
+	Outcome string
+	// RFC 3339 time or Unix seconds.
+	Since string
+	// RFC 3339 time or Unix seconds.
+	Until string
+	// Maximum results, default 100.
+	Limit int
+}
+
+func (p *ListWebhookEventsParams) values() url.Values {
+	q := url.Values{}
+	if p.WABAID != "" {
+		q.Set("waba_id", p.WABAID)
+	}
+	if p.PhoneNumberID != "" {
+		q.Set("phone_number_id", p.PhoneNumberID)
+	}
+	if p.Field != "" {
+		q.Set("field", p.Field)
+	}
+	if p.Outcome != "" {
+		q.Set("outcome", p.Outcome)
+	}
+	if p.Since != "" {
+		q.Set("since", p.Since)
+	}
+	if p.Until != "" {
+		q.Set("until", p.Until)
+	}
+	if p.Limit != 0 {
+		q.Set("limit", strconv.Itoa(p.Limit))
+	}
+	return q
+}
+
+// ListWebhookEvents calls GET /api/webhooks/events: search archived webhook deliveries.
+// Requires the read_accounts permission.
+func (c *Client) ListWebhookEvents(ctx context.Context, params *ListWebhookEventsParams) (*WebhookEventList, error) {
+	path := "/api/webhooks/events"
+	var query url.Values
+	if params != nil {
+		query = params.values()
+	}
+	var out WebhookEventList
+	if err := c.do(ctx, "GET", path, query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// QueueMessage calls POST /api/business/accounts/{wabaID}/messages/queue: queue a text message.
+// Requires the send_messages permission.
+func (c *Client) QueueMessage(ctx context.Context, wabaID string, body *SendMessageRequest) (*QueuedMessageResponse, error) {
+	path := "/api/business/accounts/" + url.PathEscape(wabaID) + "/messages/queue"
+	var out QueuedMessageResponse
+	if err := c.do(ctx, "POST", path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ReplayWebhookEvent calls POST /api/webhooks/events/{id}/replay: reprocess an archived webhook delivery.
+// Requires the manage_webhooks permission.
+func (c *Client) ReplayWebhookEvent(ctx context.Context, id string) (*WebhookEventReplay, error) {
+	path := "/api/webhooks/events/" + url.PathEscape(id) + "/replay"
+	var out WebhookEventReplay
+	if err := c.do(ctx, "POST", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeAPIKey calls DELETE /api/auth/keys/{id}: revoke an API key.
+// Requires the manage_api_keys permission.
+func (c *Client) RevokeAPIKey(ctx context.Context, id string) (*SuccessResponse, error) {
+	path := "/api/auth/keys/" + url.PathEscape(id)
+	var out SuccessResponse
+	if err := c.do(ctx, "DELETE", path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SendBulkMessages calls POST /api/business/accounts/{wabaID}/messages/bulk: send a text message to many recipients within the messaging limit.
+// Requires the send_messages permission.
+func (c *Client) SendBulkMessages(ctx context.Context, wabaID string, body *BulkSendRequest) (*BulkSendResponse, error) {
+	path := "/api/business/accounts/" + url.PathEscape(wabaID) + "/messages/bulk"
+	var out BulkSendResponse
+	if err := c.do(ctx, "POST", path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SendMessage calls POST /api/business/accounts/{wabaID}/messages: send a text message.
+// Requires the send_messages permission.
+func (c *Client) SendMessage(ctx context.Context, wabaID string, body *SendMessageRequest) (*SendMessageResponse, error) {
+	path := "/api/business/accounts/" + url.PathEscape(wabaID) + "/messages"
+	var out SendMessageResponse
+	if err := c.do(ctx, "POST", path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateSubscription calls PUT /api/forwarding/subscriptions/{id}: update a forwarding subscription.
+// Requires the manage_webhooks permission.
+func (c *Client) UpdateSubscription(ctx context.Context, id string, body *ForwardingSubscriptionRequest) (*SubscriptionResponse, error) {
+	path := "/api/forwarding/subscriptions/" + url.PathEscape(id)
+	var out SubscriptionResponse
+	if err := c.do(ctx, "PUT", path, nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
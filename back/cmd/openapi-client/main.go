@@ -0,0 +1,30 @@
+// Command openapi-client regenerates the typed Go client in package client
+// from openapi/openapi.json. It is run through go generate:
+//
+//	go generate ./client
+package main
+
+import (
+	"back/openapi"
+	"flag"
+	"log"
+	"os"
+)
+
+func main() {
+	out := flag.String("out", "zz_generated.go", "file to write the generated client to")
+	pkg := flag.String("package", "client", "package name of the generated file")
+	flag.Parse()
+
+	doc, err := openapi.Parse(openapi.Spec)
+	if err != nil {
+		log.Fatalf("Invalid openapi.json: %v", err)
+	}
+	src, err := openapi.GenerateClient(doc, *pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,64 @@
+// Command secrets creates and inspects encrypted secrets files for
+// SECRETS_PROVIDER=encrypted_file. Plain files are JSON objects of secret
+// names to values, e.g. {"FACEBOOK_APP_SECRET": "..."}. The passphrase is
+// SECRETS_FILE_KEY, taken from the environment, .env or config file.
+//
+//	secrets -encrypt < secrets.json > secrets.enc
+//	secrets -decrypt < secrets.enc
+package main
+
+import (
+	"back/config"
+	"back/services"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+func main() {
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var (
+		encrypt = flag.Bool("encrypt", false, "encrypt a JSON object of secrets read from stdin")
+		decrypt = flag.Bool("decrypt", false, "decrypt a secrets file read from stdin")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -encrypt|-decrypt < input > output\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *encrypt == *decrypt {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if config.IsPlaceholder(cfg.SecretsFileKey) {
+		log.Fatal("SECRETS_FILE_KEY is not set")
+	}
+
+	input, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var output []byte
+	if *encrypt {
+		var secrets map[string]string
+		if err := json.Unmarshal(input, &secrets); err != nil {
+			log.Fatalf("input is not a JSON object of strings: %v", err)
+		}
+		output, err = services.EncryptSecretsFile(cfg.SecretsFileKey, secrets)
+	} else {
+		var secrets map[string]string
+		if secrets, err = services.DecryptSecretsFile(cfg.SecretsFileKey, input); err == nil {
+			output, err = json.MarshalIndent(secrets, "", "  ")
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Stdout.Write(append(output, '\n'))
+}
@@ -0,0 +1,154 @@
+// Command webhooksim sends simulated, signed WhatsApp webhook events to a
+// locally running backend, or replays recorded raw payloads from a file.
+//
+//	webhooksim -list
+//	webhooksim message.text status.delivered
+//	webhooksim -all -record events.jsonl
+//	webhooksim -replay events.jsonl
+package main
+
+import (
+	"back/config"
+	"back/services"
+	"back/webhooksim"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defaults := webhooksim.DefaultParams()
+	provider, err := services.NewSecretProvider(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	appSecret := services.NewSecrets(provider, cfg.SecretValue).Get("FACEBOOK_APP_SECRET")
+
+	var (
+		target       = flag.String("url", "http://localhost:"+cfg.ServerPort+"/api/whatsapp/webhooks", "webhook endpoint to POST to")
+		secret       = flag.String("secret", appSecret, "app secret used for X-Hub-Signature-256")
+		wabaID       = flag.String("waba", defaults.WABAID, "WABA ID placed in entry[].id")
+		phoneID      = flag.String("phone-number-id", defaults.PhoneNumberID, "business phone_number_id")
+		displayPhone = flag.String("display-phone", defaults.DisplayPhoneNumber, "business display phone number")
+		from         = flag.String("from", defaults.From, "customer wa_id for inbound messages")
+		list         = flag.Bool("list", false, "list event types and exit")
+		all          = flag.Bool("all", false, "send every event type")
+		replay       = flag.String("replay", "", "replay raw payloads from a JSON array or JSON Lines file")
+		record       = flag.String("record", "", "append every generated payload to this JSON Lines file")
+		printOnly    = flag.Bool("print", false, "print payloads instead of sending them")
+		badSignature = flag.Bool("bad-signature", false, "sign with the wrong secret")
+		interval     = flag.Duration("interval", 0, "delay between deliveries")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [event-type...]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *list {
+		for _, e := range webhooksim.EventTypes() {
+			fmt.Printf("%-34s %-32s %s\n", e.Name, e.Field, e.Description)
+		}
+		return
+	}
+
+	sender := &webhooksim.Sender{URL: *target, AppSecret: *secret, BadSignature: *badSignature}
+
+	if *replay != "" {
+		payloads, err := webhooksim.ReadRecorded(*replay)
+		if err != nil {
+			log.Fatal(err)
+		}
+		failures := 0
+		for i, body := range payloads {
+			if !deliver(sender, fmt.Sprintf("payload %d", i+1), body, *printOnly) {
+				failures++
+			}
+			time.Sleep(*interval)
+		}
+		fmt.Printf("Replayed %d payloads, %d failed\n", len(payloads), failures)
+		if failures > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var events []webhooksim.EventType
+	if *all {
+		events = webhooksim.EventTypes()
+	}
+	for _, name := range flag.Args() {
+		e, ok := webhooksim.Lookup(name)
+		if !ok {
+			log.Fatalf("unknown event type %q (use -list)", name)
+		}
+		events = append(events, e)
+	}
+	if len(events) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var recorder *os.File
+	if *record != "" {
+		f, err := os.OpenFile(*record, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("open record file: %v", err)
+		}
+		defer f.Close()
+		recorder = f
+	}
+
+	params := webhooksim.Params{
+		WABAID:             *wabaID,
+		PhoneNumberID:      *phoneID,
+		DisplayPhoneNumber: *displayPhone,
+		From:               *from,
+		ContactName:        defaults.ContactName,
+	}
+
+	failures := 0
+	for i, e := range events {
+		params.Now = time.Now()
+		body, err := e.Body(params, i+1)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if recorder != nil {
+			recorder.Write(append(body, '\n'))
+		}
+		if !deliver(sender, e.Name, body, *printOnly) {
+			failures++
+		}
+		time.Sleep(*interval)
+	}
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
+
+// deliver sends or prints one payload and reports whether it succeeded.
+func deliver(sender *webhooksim.Sender, label string, body []byte, printOnly bool) bool {
+	if printOnly {
+		fmt.Printf("# %s\n%s\n", label, body)
+		return true
+	}
+	res, err := sender.Send(body)
+	if err != nil {
+		fmt.Printf("✗ %s: %v\n", label, err)
+		return false
+	}
+	if res.Status < 200 || res.Status >= 300 {
+		fmt.Printf("✗ %s: HTTP %d %s\n", label, res.Status, strings.TrimSpace(res.Body))
+		return false
+	}
+	fmt.Printf("✓ %s: HTTP %d\n", label, res.Status)
+	return true
+}
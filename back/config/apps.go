@@ -0,0 +1,123 @@
+package config
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultAppName names the app configured with the FACEBOOK_* settings.
+const DefaultAppName = "default"
+
+// MetaApp is one Meta app businesses can onboard through. Besides the
+// default app, a deployment may run more (per region or product), listed in
+// META_APPS and configured with META_APP_<NAME>_* settings.
+type MetaApp struct {
+	Name               string
+	AppID              string
+	AppSecret          string // Token exchange and webhook signatures
+	ConfigID           string // Embedded Signup configuration ID
+	RedirectURI        string // OAuth redirect used when the frontend sends none
+	WebhookVerifyToken string
+}
+
+var appNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// settings binds the app's fields to META_APP_<NAME>_* keys.
+func (a *MetaApp) settings() []setting {
+	prefix := a.keyPrefix()
+	return []setting{
+		{prefix + "APP_ID", "Meta app ID", false, (*stringValue)(&a.AppID)},
+		{prefix + "APP_SECRET", "Meta app secret", true, (*stringValue)(&a.AppSecret)},
+		{prefix + "CONFIG_ID", "Embedded Signup configuration ID", false, (*stringValue)(&a.ConfigID)},
+		{prefix + "REDIRECT_URI", "OAuth redirect URI for token exchange", false, (*stringValue)(&a.RedirectURI)},
+		{prefix + "WEBHOOK_VERIFY_TOKEN", "token Meta echoes when verifying the webhook", true, (*stringValue)(&a.WebhookVerifyToken)},
+	}
+}
+
+func (a MetaApp) keyPrefix() string {
+	return "META_APP_" + strings.ToUpper(a.Name) + "_"
+}
+
+// SecretKey names the setting holding the app secret, which is also the
+// secret's name in a secrets provider.
+func (a MetaApp) SecretKey() string {
+	if a.Name == DefaultAppName {
+		return "FACEBOOK_APP_SECRET"
+	}
+	return a.keyPrefix() + "APP_SECRET"
+}
+
+// VerifyTokenKey names the setting and secret holding the webhook verify
+// token.
+func (a MetaApp) VerifyTokenKey() string {
+	if a.Name == DefaultAppName {
+		return "WEBHOOK_VERIFY_TOKEN"
+	}
+	return a.keyPrefix() + "WEBHOOK_VERIFY_TOKEN"
+}
+
+// MetaApps lists every configured app, the default one first.
+func (c *Config) MetaApps() []MetaApp {
+	apps := []MetaApp{{
+		Name:               DefaultAppName,
+		AppID:              c.FacebookAppID,
+		AppSecret:          c.FacebookAppSecret,
+		ConfigID:           c.FacebookConfigID,
+		RedirectURI:        c.FacebookRedirectURI,
+		WebhookVerifyToken: c.WebhookVerifyToken,
+	}}
+	return append(apps, c.Apps...)
+}
+
+// FindMetaApp returns the app with the given app ID or, failing that, the
+// given Embedded Signup configuration ID. With neither it returns the
+// default app.
+func (c *Config) FindMetaApp(appID, configID string) (MetaApp, bool) {
+	apps := c.MetaApps()
+	if appID == "" && configID == "" {
+		return apps[0], true
+	}
+	for _, app := range apps {
+		if (appID != "" && app.AppID == appID) || (appID == "" && app.ConfigID == configID) {
+			return app, true
+		}
+	}
+	return MetaApp{}, false
+}
+
+// validateApps checks the additional apps and that no two apps share a
+// name, an app ID or a configuration ID, which would make routing ambiguous.
+func (c *Config) validateApps(fail func(format string, args ...any)) {
+	for _, app := range c.Apps {
+		key := app.keyPrefix()
+		if !appNamePattern.MatchString(app.Name) || app.Name == DefaultAppName {
+			fail("META_APPS: invalid app name %q (lower-case letters, digits and _, not %q)", app.Name, DefaultAppName)
+			continue
+		}
+		if isPlaceholder(app.AppID) {
+			fail("%sAPP_ID is not set", key)
+		}
+		if app.RedirectURI != "" {
+			if err := checkURL(app.RedirectURI, false); err != nil {
+				fail("%sREDIRECT_URI: %v", key, err)
+			}
+		}
+	}
+
+	seen := map[string]string{}
+	unique := func(kind, value, app string) {
+		if value == "" {
+			return
+		}
+		if other, ok := seen[kind+value]; ok {
+			fail("apps %q and %q have the same %s", other, app, kind)
+			return
+		}
+		seen[kind+value] = app
+	}
+	for _, app := range c.MetaApps() {
+		unique("name", app.Name, app.Name)
+		unique("app ID", app.AppID, app.Name)
+		unique("configuration ID", app.ConfigID, app.Name)
+	}
+}
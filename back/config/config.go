@@ -1,41 +1,376 @@
 package config
 
 import (
-	"log"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	FacebookAppID       string
 	FacebookAppSecret   string
-	FacebookRedirectURI string // <-- NEW: OAuth redirect used in token exchange
+	FacebookRedirectURI string // OAuth redirect used in token exchange
+	FacebookConfigID    string // Embedded Signup configuration ID
 	ServerPort          string
 	WebhookVerifyToken  string
-	WebhookCallbackURL  string // WhatsApp webhook callback (keep separate from OAuth)
-	AllowedOrigins      []string
+	WebhookCallbackURL  string   // WhatsApp webhook callback (keep separate from OAuth)
+	ClientURL           string   // Frontend origin, always allowed by CORS
+	AllowedOrigins      []string // CORS origins or https://*.domain patterns, including ClientURL
+	GraphAPIBaseURL     string   // Graph API host, overridable to point at a fake server
+	WebhookArchiveLimit int      // Max raw webhook bodies kept for search/replay
+	// Outbound forwarding of webhook events to our own systems
+	ForwardingMaxAttempts  int // Delivery attempts per event, including the first
+	ForwardingDisableAfter int // Consecutive failed events before a subscription is disabled
+	EventStreamBacklog     int // Events kept for SSE clients resuming with Last-Event-ID
+	// Allow forwarding targets on loopback, private and link-local
+	// addresses, e.g. a receiver on the same host in development
+	ForwardingAllowPrivateTargets bool
+	// Outbound WhatsApp message queue
+	OutboundQueueFile   string // Journal keeping queued messages across restarts; empty keeps them in memory only
+	OutboundMaxAttempts int    // Send attempts per message, including the first
+	// Authentication of the backend's own API
+	AuthSigningKey      string        // HMAC key for session tokens
+	AuthSessionTTL      time.Duration // Lifetime of issued session tokens
+	AuthBootstrapAPIKey string        // Optional initial API key ("wak_...")
+	TrustProxyHeaders   bool          // Take client IPs from X-Forwarded-For (only behind a proxy that sets it)
+	// CORS for browser clients of the API
+	CORSAllowCredentials bool
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSExposedHeaders   []string
+	CORSMaxAge           time.Duration // Preflight cache lifetime
+	CORSPublicPaths      []string      // Path prefixes any origin may read, without credentials
+	CORSExcludedPaths    []string      // Path prefixes that never get CORS headers
+	// HTTP server limits
+	HTTPReadTimeout       time.Duration // Whole request, including the body
+	HTTPReadHeaderTimeout time.Duration
+	HTTPWriteTimeout      time.Duration // Disabled per request for event streams
+	HTTPIdleTimeout       time.Duration // Keep-alive connections
+	HTTPMaxHeaderBytes    int
+	HTTPMaxBodyBytes      int64
+	ShutdownTimeout       time.Duration // Time to drain requests and queues on SIGTERM
+	// Native TLS, enabled when both files are set
+	TLSCertFile       string        // PEM certificate chain
+	TLSKeyFile        string        // PEM private key
+	TLSReloadInterval time.Duration // How often the files are checked for a rotated certificate
+	HTTPRedirectPort  string        // Plain HTTP port redirecting to HTTPS; empty disables it
+	// Readiness checks
+	ReadinessMaxQueueBacklog int  // Queued deliveries above which the server reports not ready
+	ReadinessCheckGraph      bool // Also require the Graph API to be reachable (non-critical)
+	// Logging
+	LogLevel         string // debug, info, warn or error
+	LogFormat        string // text or json
+	LogSensitiveData bool   // Log tokens, phone numbers and message content unmasked (debugging only)
+	// Where secrets come from; see services.NewSecretProvider
+	SecretsProvider        string        // env, dir or encrypted_file
+	SecretsDir             string        // One file per secret, named after its setting
+	SecretsFile            string        // AES-GCM encrypted JSON object of secrets
+	SecretsFileKey         string        // Passphrase for SecretsFile
+	SecretsRefreshInterval time.Duration // How often secrets are re-read to pick up rotation
+	// Encryption of stored access tokens, read through the secrets provider
+	TokenEncryptionKey         string
+	TokenEncryptionKeyPrevious string // Still accepted for decryption after a rotation
+	// Background jobs keeping business accounts current
+	TokenRefreshInterval time.Duration // How often expiring tokens are looked for; 0 disables refresh
+	TokenRefreshWindow   time.Duration // Tokens expiring within this are refreshed
+	PhoneSyncInterval    time.Duration // How often phone numbers are re-fetched from Meta; 0 disables
+	// Meta apps besides the default FACEBOOK_* one
+	AppNames []string  // META_APPS
+	Apps     []MetaApp // Filled in by Load from META_APP_<NAME>_* settings
+	// Set by -print-config: print the effective configuration and exit
+	PrintConfig bool
 }
 
-func Load() *Config {
-	cfg := &Config{
-		FacebookAppID:       getEnv("FACEBOOK_APP_ID", "your_facebook_appid_here"),
-		FacebookAppSecret:   getEnv("FACEBOOK_APP_SECRET", "your_app_secret_hrer"),
-		FacebookRedirectURI: getEnv("FACEBOOK_REDIRECT_URI", "https://482e8d84cfc0.ngrok-free.app"), 
-		ServerPort:          getEnv("SERVER_PORT", "8081"),
-		WebhookVerifyToken:  getEnv("WEBHOOK_VERIFY_TOKEN", ""),
-		WebhookCallbackURL:  getEnv("WEBHOOK_CALLBACK_URL", "https://482e8d84cfc0.ngrok-free.app/api/whatsapp/webhooks"),
-		AllowedOrigins:      []string{getEnv("CLIENT_URL", "http://localhost:3001"), "https://482e8d84cfc0.ngrok-free.app"}, // ← Updated port
+// defaults are the settings used when no file, environment variable or flag
+// overrides them. Credentials and public URLs have no usable default.
+func defaults() *Config {
+	return &Config{
+		ServerPort:               "8081",
+		ClientURL:                "http://localhost:3001",
+		GraphAPIBaseURL:          "https://graph.facebook.com",
+		WebhookArchiveLimit:      10000,
+		ForwardingMaxAttempts:    5,
+		ForwardingDisableAfter:   10,
+		EventStreamBacklog:       1000,
+		OutboundMaxAttempts:      10,
+		AuthSessionTTL:           12 * time.Hour,
+		CORSAllowedMethods:       []string{"GET", "POST", "PUT", "DELETE"},
+		CORSAllowedHeaders:       []string{"Content-Type", "Authorization", "X-Requested-With", "X-API-Key", "Last-Event-ID"},
+		CORSExposedHeaders:       []string{"X-Request-ID"},
+		CORSMaxAge:               10 * time.Minute,
+		CORSPublicPaths:          []string{"/health", "/readyz", "/api/openapi.json"},
+		CORSExcludedPaths:        []string{"/api/whatsapp/webhooks"}, // Meta calls it server to server
+		HTTPReadTimeout:          15 * time.Second,
+		HTTPReadHeaderTimeout:    5 * time.Second,
+		HTTPWriteTimeout:         30 * time.Second,
+		HTTPIdleTimeout:          120 * time.Second,
+		HTTPMaxHeaderBytes:       64 << 10,
+		HTTPMaxBodyBytes:         1 << 20,
+		ShutdownTimeout:          30 * time.Second,
+		TLSReloadInterval:        time.Minute,
+		SecretsProvider:          "env",
+		SecretsDir:               "/run/secrets",
+		SecretsRefreshInterval:   5 * time.Minute,
+		TokenRefreshInterval:     time.Hour,
+		TokenRefreshWindow:       7 * 24 * time.Hour,
+		PhoneSyncInterval:        15 * time.Minute,
+		ReadinessMaxQueueBacklog: 1000,
+		LogLevel:                 "info",
+		LogFormat:                "text",
+	}
+}
+
+// Load builds the configuration from, in increasing precedence: defaults,
+// the config file (-config or CONFIG_FILE), the .env file, the process
+// environment and command line flags. Values that do not parse are errors;
+// whether the result is usable is up to Validate.
+func Load(args []string) (*Config, error) {
+	cfg := defaults()
+	settings := cfg.settings()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := fs.String("config", "", "YAML or TOML config file (env CONFIG_FILE)")
+	envFile := fs.String("env-file", ".env", "file of KEY=value lines loaded beneath the process environment")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective configuration with secrets redacted and exit")
+	flags := map[string]string{}
+	for _, s := range settings {
+		_, isBool := s.value.(*boolValue)
+		fs.Var(&flagRecorder{key: s.key, values: flags, isBool: isBool}, s.flagName(), s.usage+" (env "+s.key+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	envFileSet := false
+	fs.Visit(func(f *flag.Flag) { envFileSet = envFileSet || f.Name == "env-file" })
+	dotEnv, err := readDotEnv(*envFile)
+	if errors.Is(err, os.ErrNotExist) && !envFileSet {
+		dotEnv, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	env := func(key string) string {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+		return dotEnv[key]
+	}
+
+	var problems []error
+	if *configFile == "" {
+		*configFile = env("CONFIG_FILE")
+	}
+	fileValues := map[string]string{}
+	if *configFile != "" {
+		if fileValues, err = readConfigFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+	// apply sets each setting from the file, then the environment, then
+	// flags, consuming the file keys it uses
+	apply := func(settings []setting) {
+		for _, s := range settings {
+			layers := []struct {
+				source string
+				value  string
+				ok     bool
+			}{
+				{*configFile + ": " + s.fileKey(), fileValues[s.fileKey()], hasKey(fileValues, s.fileKey())},
+				// Empty variables, like the blanks in .env, leave the value alone
+				{s.key, env(s.key), env(s.key) != ""},
+				{"-" + s.flagName(), flags[s.key], hasKey(flags, s.key)},
+			}
+			delete(fileValues, s.fileKey())
+			for _, layer := range layers {
+				if !layer.ok {
+					continue
+				}
+				if err := s.value.Set(layer.value); err != nil {
+					problems = append(problems, fmt.Errorf("%s: %w", layer.source, err))
+				}
+			}
+		}
+	}
+	apply(settings)
+
+	// Additional apps are only known once META_APPS is
+	cfg.Apps = nil
+	for _, name := range cfg.AppNames {
+		cfg.Apps = append(cfg.Apps, MetaApp{Name: name})
+	}
+	for i := range cfg.Apps {
+		apply(cfg.Apps[i].settings())
+	}
+	for key := range fileValues {
+		problems = append(problems, fmt.Errorf("%s: unknown setting %q", *configFile, key))
+	}
+	if err := errors.Join(problems...); err != nil {
+		return nil, err
 	}
 
-	if cfg.FacebookAppID == "" || cfg.FacebookAppSecret == "" {
-		log.Fatal("FACEBOOK_APP_ID and FACEBOOK_APP_SECRET are required")
+	if cfg.ClientURL != "" && !contains(cfg.AllowedOrigins, cfg.ClientURL) {
+		cfg.AllowedOrigins = append([]string{cfg.ClientURL}, cfg.AllowedOrigins...)
 	}
+	if cfg.AuthSigningKey == "" {
+		// Sessions will not survive a restart
+		key := make([]byte, 32)
+		rand.Read(key)
+		cfg.AuthSigningKey = hex.EncodeToString(key)
+		slog.Warn("AUTH_SIGNING_KEY not set, using a random per-process key")
+	}
+	return cfg, nil
+}
+
+// flagRecorder holds a flag's raw value until the layers beneath it have
+// been applied.
+type flagRecorder struct {
+	key    string
+	values map[string]string
+	isBool bool
+}
+
+func (f *flagRecorder) Set(s string) error { f.values[f.key] = s; return nil }
+func (f *flagRecorder) String() string     { return "" }
+func (f *flagRecorder) IsBoolFlag() bool   { return f.isBool }
 
-	return cfg
+func hasKey(m map[string]string, key string) bool {
+	_, ok := m[key]
+	return ok
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// Validate reports settings the server cannot work correctly without, all
+// at once. main refuses to start on an error; readiness reports the same.
+func (c *Config) Validate() error {
+	var problems []error
+	fail := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+	if isPlaceholder(c.FacebookAppID) {
+		fail("FACEBOOK_APP_ID is not set")
+	}
+	c.validateSecrets(fail)
+	c.validateApps(fail)
+	if c.WebhookCallbackURL != "" {
+		if err := checkURL(c.WebhookCallbackURL, true); err != nil {
+			fail("WEBHOOK_CALLBACK_URL: %v", err)
+		}
+	}
+	if c.GraphAPIBaseURL != "" {
+		if err := checkURL(c.GraphAPIBaseURL, false); err != nil {
+			fail("GRAPH_API_BASE_URL: %v", err)
+		}
+	}
+	if c.FacebookRedirectURI != "" {
+		if err := checkURL(c.FacebookRedirectURI, false); err != nil {
+			fail("FACEBOOK_REDIRECT_URI: %v", err)
+		}
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			if c.CORSAllowCredentials {
+				fail("CORS origin \"*\" cannot be combined with CORS_ALLOW_CREDENTIALS")
+			}
+			continue
+		}
+		if err := checkURL(origin, false); err != nil {
+			fail("CORS origin %q: %v", origin, err)
+		}
 	}
-	return defaultValue
+	for _, path := range append(c.CORSPublicPaths, c.CORSExcludedPaths...) {
+		if !strings.HasPrefix(path, "/") {
+			fail("CORS path %q must start with /", path)
+		}
+	}
+	if c.ServerPort != "" && !validPort(c.ServerPort) {
+		fail("SERVER_PORT %q is not a port number", c.ServerPort)
+	}
+	if c.HTTPRedirectPort != "" && (!validPort(c.HTTPRedirectPort) || c.HTTPRedirectPort == c.ServerPort) {
+		fail("HTTP_REDIRECT_PORT %q must be a port number other than SERVER_PORT", c.HTTPRedirectPort)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		fail("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.HTTPRedirectPort != "" && !c.TLSEnabled() {
+		fail("HTTP_REDIRECT_PORT requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if c.TLSReloadInterval < 0 {
+		fail("TLS_RELOAD_INTERVAL must not be negative")
+	}
+	if c.TokenRefreshInterval < 0 {
+		fail("TOKEN_REFRESH_INTERVAL must not be negative")
+	}
+	if c.TokenRefreshInterval > 0 && c.TokenRefreshWindow <= c.TokenRefreshInterval {
+		// Otherwise a token could expire between two runs
+		fail("TOKEN_REFRESH_WINDOW must be longer than TOKEN_REFRESH_INTERVAL")
+	}
+	if c.PhoneSyncInterval < 0 {
+		fail("PHONE_SYNC_INTERVAL must not be negative")
+	}
+	if c.OutboundMaxAttempts < 1 || c.OutboundMaxAttempts > 100 {
+		fail("OUTBOUND_MAX_ATTEMPTS must be between 1 and 100")
+	}
+	if c.AuthSessionTTL <= 0 {
+		fail("AUTH_SESSION_TTL must be positive")
+	}
+	switch strings.ToLower(c.LogLevel) {
+	case "", "debug", "info", "warn", "error":
+	default:
+		fail("LOG_LEVEL %q is not debug, info, warn or error", c.LogLevel)
+	}
+	switch strings.ToLower(c.LogFormat) {
+	case "", "text", "json":
+	default:
+		fail("LOG_FORMAT %q is not text or json", c.LogFormat)
+	}
+	return errors.Join(problems...)
+}
+
+// isPlaceholder reports values that only mark where a real one belongs,
+// like the "your_..._here" samples in .env or a secret copied from
+// -print-config output.
+func isPlaceholder(v string) bool {
+	return v == "" || v == redacted || strings.HasPrefix(strings.ToLower(v), "your_")
+}
+
+func checkURL(raw string, requireHTTPS bool) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New("must be an absolute http(s) URL")
+	}
+	if requireHTTPS && u.Scheme != "https" {
+		return errors.New("must use https")
+	}
+	return nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// TLSEnabled reports whether the server terminates TLS itself rather than
+// relying on a proxy or tunnel in front of it.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
 }
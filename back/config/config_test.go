@@ -0,0 +1,237 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+# comment
+facebook:
+  app_id: "from-file"
+  app_secret: 'file # secret'
+server_port: 9000   # trailing comment
+log_level: warn
+allowed_origins:
+  - https://a.example
+  - "https://b.example"
+`)
+	dotEnv := writeFile(t, ".env", "export SERVER_PORT=9001\nLOG_LEVEL=\"error\"\nAUTH_SESSION_TTL=1h\n")
+	t.Setenv("LOG_LEVEL", "debug")
+
+	cfg, err := Load([]string{"-config", file, "-env-file", dotEnv, "-auth-session-ttl", "2h", "-trust-proxy-headers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := map[string][2]string{
+		"file app id":        {cfg.FacebookAppID, "from-file"},
+		"quoted hash":        {cfg.FacebookAppSecret, "file # secret"},
+		".env over file":     {cfg.ServerPort, "9001"},
+		"env over .env":      {cfg.LogLevel, "debug"},
+		"default":            {cfg.LogFormat, "text"},
+		"client url first":   {strings.Join(cfg.AllowedOrigins, " "), "http://localhost:3001 https://a.example https://b.example"},
+		"flag over .env":     {cfg.AuthSessionTTL.String(), (2 * time.Hour).String()},
+		"no ngrok callbacks": {cfg.WebhookCallbackURL, ""},
+	}
+	for name, c := range checks {
+		if c[0] != c[1] {
+			t.Errorf("%s: got %q, want %q", name, c[0], c[1])
+		}
+	}
+	if !cfg.TrustProxyHeaders {
+		t.Error("boolean flag without a value not applied")
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	file := writeFile(t, "config.toml", `
+http_max_body_bytes = 2048
+[webhook]
+verify_token = "tok"
+callback_url = "https://example.test/hook"
+[allowed]
+origins = ["https://a.example", 'https://b.example']
+`)
+	cfg, err := Load([]string{"-config", file, "-env-file", writeFile(t, ".env", "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HTTPMaxBodyBytes != 2048 || cfg.WebhookVerifyToken != "tok" || cfg.WebhookCallbackURL != "https://example.test/hook" || len(cfg.AllowedOrigins) != 3 {
+		t.Errorf("cfg = %+v", cfg)
+	}
+}
+
+func TestLoadRejectsBadValues(t *testing.T) {
+	file := writeFile(t, "config.yaml", "server_prot: 9000\nhttp_read_timeout: soon\n")
+	t.Setenv("WEBHOOK_ARCHIVE_LIMIT", "lots")
+	_, err := Load([]string{"-config", file, "-env-file", writeFile(t, ".env", "")})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{`unknown setting "server_prot"`, "http_read_timeout", "WEBHOOK_ARCHIVE_LIMIT"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+
+	if _, err := Load([]string{"-env-file", "/nonexistent/.env"}); err == nil {
+		t.Error("expected an error for an explicit missing -env-file")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		cfg := defaults()
+		cfg.FacebookAppID = "1234"
+		cfg.FacebookAppSecret = "secret"
+		cfg.WebhookVerifyToken = "token"
+		cfg.WebhookCallbackURL = "https://example.test/api/whatsapp/webhooks"
+		cfg.AllowedOrigins = []string{cfg.ClientURL}
+		return cfg
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+
+	cases := map[string]func(c *Config){
+		"FACEBOOK_APP_ID":       func(c *Config) { c.FacebookAppID = "your_facebook_appid_here" },
+		"FACEBOOK_APP_SECRET":   func(c *Config) { c.FacebookAppSecret = redacted },
+		"WEBHOOK_VERIFY_TOKEN":  func(c *Config) { c.WebhookVerifyToken = "" },
+		"WEBHOOK_CALLBACK_URL":  func(c *Config) { c.WebhookCallbackURL = "http://example.test/hook" },
+		"GRAPH_API_BASE_URL":    func(c *Config) { c.GraphAPIBaseURL = "graph.facebook.com" },
+		"CORS origin":           func(c *Config) { c.AllowedOrigins = append(c.AllowedOrigins, "localhost:3000") },
+		"SERVER_PORT":           func(c *Config) { c.ServerPort = "http" },
+		"TLS_CERT_FILE":         func(c *Config) { c.TLSCertFile = "cert.pem" },
+		"HTTP_REDIRECT_PORT":    func(c *Config) { c.HTTPRedirectPort = "8080" },
+		"TLS_RELOAD_INTERVAL":   func(c *Config) { c.TLSReloadInterval = -time.Minute },
+		"LOG_FORMAT":            func(c *Config) { c.LogFormat = "xml" },
+		"AUTH_SESSION_TTL":      func(c *Config) { c.AuthSessionTTL = 0 },
+		"OUTBOUND_MAX_ATTEMPTS": func(c *Config) { c.OutboundMaxAttempts = 0 },
+		"FACEBOOK_REDIRECT_URI": func(c *Config) { c.FacebookRedirectURI = "::" },
+		"SECRETS_PROVIDER":      func(c *Config) { c.SecretsProvider = "vault" },
+		"SECRETS_FILE_KEY":      func(c *Config) { c.SecretsProvider, c.SecretsFile = SecretsFromEncryptedFile, "secrets.enc" },
+	}
+	for want, mutate := range cases {
+		cfg := valid()
+		mutate(cfg)
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v", want, err)
+		}
+	}
+
+	cfg := valid()
+	cfg.OutboundMaxAttempts = 1000
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "OUTBOUND_MAX_ATTEMPTS") {
+		t.Errorf("OUTBOUND_MAX_ATTEMPTS over the limit: error %v", err)
+	}
+
+	// Without webhooks the verify token is not needed
+	cfg = valid()
+	cfg.WebhookCallbackURL, cfg.WebhookVerifyToken = "", ""
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("webhooks disabled: %v", err)
+	}
+
+	// Mounted secrets are checked at startup, not from the configuration
+	cfg = valid()
+	cfg.SecretsProvider, cfg.FacebookAppSecret, cfg.WebhookVerifyToken = SecretsFromDir, "", ""
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("secrets from a directory: %v", err)
+	}
+}
+
+func TestPrintRedactsSecretsAndRoundTrips(t *testing.T) {
+	cfg := defaults()
+	cfg.FacebookAppID = "1234"
+	cfg.FacebookAppSecret = "super-secret"
+	cfg.AllowedOrigins = []string{"https://a.example", "https://b.example"}
+
+	var out strings.Builder
+	cfg.Print(&out)
+	if strings.Contains(out.String(), "super-secret") || !strings.Contains(out.String(), `facebook_app_secret: "[REDACTED]"`) {
+		t.Errorf("secret not redacted:\n%s", out.String())
+	}
+
+	values, err := parseYAML(out.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["facebook_app_id"] != "1234" || values["allowed_origins"] != "https://a.example,https://b.example" || values["http_idle_timeout"] != "2m0s" {
+		t.Errorf("printed config does not parse back: %v", values)
+	}
+}
+
+func TestLoadMetaApps(t *testing.T) {
+	file := writeFile(t, "config.toml", `
+facebook_app_id = "1000"
+facebook_config_id = "cfg-default"
+meta_apps = ["emea", "us"]
+[meta_app.emea]
+app_id = "2000"
+config_id = "cfg-emea"
+`)
+	t.Setenv("META_APP_US_APP_ID", "3000")
+	cfg, err := Load([]string{"-config", file, "-env-file", writeFile(t, ".env", "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apps := cfg.MetaApps()
+	if len(apps) != 3 || apps[0].Name != DefaultAppName || apps[1].AppID != "2000" || apps[2].AppID != "3000" {
+		t.Fatalf("apps = %+v", apps)
+	}
+
+	for _, tc := range []struct{ appID, configID, want string }{
+		{"", "", DefaultAppName},
+		{"2000", "", "emea"},
+		{"", "cfg-emea", "emea"},
+		{"3000", "cfg-emea", "us"},
+	} {
+		if app, ok := cfg.FindMetaApp(tc.appID, tc.configID); !ok || app.Name != tc.want {
+			t.Errorf("FindMetaApp(%q, %q) = %q, %v; want %q", tc.appID, tc.configID, app.Name, ok, tc.want)
+		}
+	}
+	if _, ok := cfg.FindMetaApp("9999", ""); ok {
+		t.Error("unknown app ID matched")
+	}
+
+	var out strings.Builder
+	cfg.Print(&out)
+	if !strings.Contains(out.String(), `meta_app_emea_config_id: "cfg-emea"`) {
+		t.Errorf("app settings not printed:\n%s", out.String())
+	}
+
+	// A typo in an app's settings is an unknown key, like any other
+	bad := writeFile(t, "config.yaml", "meta_apps: [emea]\nmeta_app_emae:\n  app_id: 2000\n")
+	if _, err := Load([]string{"-config", bad, "-env-file", writeFile(t, ".env", "")}); err == nil || !strings.Contains(err.Error(), "meta_app_emae_app_id") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestValidateMetaApps(t *testing.T) {
+	cfg := defaults()
+	cfg.FacebookAppID, cfg.FacebookAppSecret = "1000", "secret"
+	cfg.Apps = []MetaApp{
+		{Name: "emea", AppID: "1000", AppSecret: "secret-2"},
+		{Name: "Bad Name", AppID: "3000", AppSecret: "secret-3"},
+		{Name: "us", AppID: "4000"},
+	}
+	err := cfg.Validate()
+	for _, want := range []string{`"default" and "emea" have the same app ID`, `invalid app name "Bad Name"`, "META_APP_US_APP_SECRET"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v does not mention %s", err, want)
+		}
+	}
+}
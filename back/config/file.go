@@ -0,0 +1,234 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The config file and .env parsers understand the subset those files need:
+// flat keys, one level of nesting (YAML mappings, TOML tables) joined to the
+// key with "_", scalars, quoted strings and lists on one line or as YAML
+// "- item" blocks. Lists are returned comma separated.
+
+// readConfigFile parses a YAML (.yaml, .yml) or TOML (.toml) file into
+// file keys and raw values.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]string
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		values, err = parseYAML(string(data))
+	case ".toml":
+		values, err = parseTOML(string(data))
+	default:
+		return nil, fmt.Errorf("%s: unsupported config format %q (want .yaml, .yml or .toml)", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+func parseYAML(data string) (map[string]string, error) {
+	values := map[string]string{}
+	lists := map[string][]string{}
+	block := "" // key of the mapping or list the indented lines belong to
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		text := strings.TrimSpace(line)
+		if text == "" || text == "---" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			key, raw, ok := strings.Cut(text, ":")
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected key: value", i+1)
+			}
+			key, raw = normalizeKey(key), strings.TrimSpace(raw)
+			if raw == "" {
+				block = key
+				values[key] = ""
+				continue
+			}
+			block = ""
+			v, err := parseValue(raw)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			values[key] = v
+			continue
+		}
+
+		if block == "" {
+			return nil, fmt.Errorf("line %d: unexpected indentation", i+1)
+		}
+		if item, ok := strings.CutPrefix(text, "-"); ok {
+			v, err := parseValue(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			lists[block] = append(lists[block], v)
+			continue
+		}
+		key, raw, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value or - item", i+1)
+		}
+		v, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		delete(values, block) // a mapping, not a value of its own
+		values[block+"_"+normalizeKey(key)] = v
+	}
+	for key, items := range lists {
+		values[key] = strings.Join(items, ",")
+	}
+	return values, nil
+}
+
+func parseTOML(data string) (map[string]string, error) {
+	values := map[string]string{}
+	prefix := ""
+	for i, line := range strings.Split(data, "\n") {
+		text := strings.TrimSpace(stripComment(line))
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") || strings.HasPrefix(text, "[[") {
+				return nil, fmt.Errorf("line %d: unsupported table header %s", i+1, text)
+			}
+			prefix = normalizeKey(text[1:len(text)-1]) + "_"
+			continue
+		}
+		key, raw, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		v, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		values[prefix+normalizeKey(key)] = v
+	}
+	return values, nil
+}
+
+// readDotEnv parses KEY=value lines, optionally prefixed with "export".
+func readDotEnv(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		text := strings.TrimSpace(stripComment(line))
+		if text == "" {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+		key, raw, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: line %d: expected KEY=value", path, i+1)
+		}
+		v, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", path, i+1, err)
+		}
+		values[strings.TrimSpace(key)] = v
+	}
+	return values, nil
+}
+
+func normalizeKey(key string) string {
+	key = strings.Trim(strings.TrimSpace(key), `"'`)
+	return strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToLower(key))
+}
+
+// parseValue unquotes a scalar or flattens an inline list.
+func parseValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	switch raw[0] {
+	case '[':
+		if !strings.HasSuffix(raw, "]") {
+			return "", errors.New("unterminated list")
+		}
+		var items []string
+		for _, item := range splitOutsideQuotes(raw[1:len(raw)-1], ',') {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			v, err := parseValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, v)
+		}
+		return strings.Join(items, ","), nil
+	case '"':
+		v, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted string %s", raw)
+		}
+		return v, nil
+	case '\'':
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("invalid quoted string %s", raw)
+		}
+		return strings.ReplaceAll(raw[1:len(raw)-1], "''", "'"), nil
+	}
+	return raw, nil
+}
+
+// stripComment drops a # comment that starts the line or follows
+// whitespace, outside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,72 @@
+package config
+
+// Secret providers other than env hold secrets outside the configuration, so
+// these are only known once the provider has been read.
+const (
+	SecretsFromEnv           = "env"
+	SecretsFromDir           = "dir"
+	SecretsFromEncryptedFile = "encrypted_file"
+)
+
+// SecretsExternal reports whether secrets are held outside the
+// configuration, by a provider other than env.
+func (c *Config) SecretsExternal() bool {
+	return c.SecretsProvider != "" && c.SecretsProvider != SecretsFromEnv
+}
+
+// RequiredSecrets names the secrets the server cannot run without: every
+// app's secret and, when webhooks are enabled, its verify token.
+func (c *Config) RequiredSecrets() []string {
+	var names []string
+	for _, app := range c.MetaApps() {
+		names = append(names, app.SecretKey())
+		if c.WebhookCallbackURL != "" {
+			names = append(names, app.VerifyTokenKey())
+		}
+	}
+	return names
+}
+
+// SecretValue returns the configured value of the named secret setting, or
+// "" for unknown names and settings that are not secret.
+func (c *Config) SecretValue(name string) string {
+	settings := c.settings()
+	for i := range c.Apps {
+		settings = append(settings, c.Apps[i].settings()...)
+	}
+	for _, s := range settings {
+		if s.key == name && s.secret {
+			return s.value.String()
+		}
+	}
+	return ""
+}
+
+// IsPlaceholder reports secret values that only mark where a real one
+// belongs; providers use it to treat them as missing.
+func IsPlaceholder(v string) bool { return isPlaceholder(v) }
+
+func (c *Config) validateSecrets(fail func(format string, args ...any)) {
+	switch c.SecretsProvider {
+	case "", SecretsFromEnv:
+		// Secrets are part of the configuration, so check them now
+		for _, name := range c.RequiredSecrets() {
+			if isPlaceholder(c.SecretValue(name)) {
+				fail("%s is not set", name)
+			}
+		}
+	case SecretsFromDir:
+		if c.SecretsDir == "" {
+			fail("SECRETS_DIR is required with SECRETS_PROVIDER=dir")
+		}
+	case SecretsFromEncryptedFile:
+		if c.SecretsFile == "" || isPlaceholder(c.SecretsFileKey) {
+			fail("SECRETS_FILE and SECRETS_FILE_KEY are required with SECRETS_PROVIDER=encrypted_file")
+		}
+	default:
+		fail("SECRETS_PROVIDER %q is not env, dir or encrypted_file", c.SecretsProvider)
+	}
+	if c.SecretsRefreshInterval < 0 {
+		fail("SECRETS_REFRESH_INTERVAL must not be negative")
+	}
+}
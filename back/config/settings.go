@@ -0,0 +1,195 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting is one configurable field. Its environment variable name is the
+// canonical key; file keys and flag names are derived from it.
+type setting struct {
+	key    string
+	usage  string
+	secret bool // redacted by Print
+	value  value
+}
+
+// value is a flag.Value bound to a Config field.
+type value interface {
+	Set(string) error
+	String() string
+}
+
+// fileKey is the key used in config files: FACEBOOK_APP_ID -> facebook_app_id.
+func (s setting) fileKey() string { return strings.ToLower(s.key) }
+
+// flagName is the command line flag: FACEBOOK_APP_ID -> -facebook-app-id.
+func (s setting) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(s.key), "_", "-")
+}
+
+// settings binds every configurable field of c.
+func (c *Config) settings() []setting {
+	return []setting{
+		{"FACEBOOK_APP_ID", "Meta app ID", false, (*stringValue)(&c.FacebookAppID)},
+		{"FACEBOOK_APP_SECRET", "Meta app secret, also used to verify webhook signatures", true, (*stringValue)(&c.FacebookAppSecret)},
+		{"FACEBOOK_REDIRECT_URI", "OAuth redirect URI for token exchange", false, (*stringValue)(&c.FacebookRedirectURI)},
+		{"FACEBOOK_CONFIG_ID", "Embedded Signup configuration ID", false, (*stringValue)(&c.FacebookConfigID)},
+		{"META_APPS", "names of additional Meta apps, each configured with META_APP_<NAME>_* settings", false, (*listValue)(&c.AppNames)},
+		{"SERVER_PORT", "port to listen on", false, (*stringValue)(&c.ServerPort)},
+		{"WEBHOOK_VERIFY_TOKEN", "token Meta echoes when verifying the webhook", true, (*stringValue)(&c.WebhookVerifyToken)},
+		{"WEBHOOK_CALLBACK_URL", "public HTTPS URL of the webhook endpoint; empty disables webhook subscription", false, (*stringValue)(&c.WebhookCallbackURL)},
+		{"CLIENT_URL", "frontend origin allowed by CORS", false, (*stringValue)(&c.ClientURL)},
+		{"ALLOWED_ORIGINS", "additional CORS origins or https://*.domain patterns, comma separated", false, (*listValue)(&c.AllowedOrigins)},
+		{"CORS_ALLOW_CREDENTIALS", "let browsers send cookies and credentials cross-origin", false, (*boolValue)(&c.CORSAllowCredentials)},
+		{"CORS_ALLOWED_METHODS", "methods allowed in preflight responses", false, (*listValue)(&c.CORSAllowedMethods)},
+		{"CORS_ALLOWED_HEADERS", "request headers allowed in preflight responses", false, (*listValue)(&c.CORSAllowedHeaders)},
+		{"CORS_EXPOSED_HEADERS", "response headers readable by browser clients", false, (*listValue)(&c.CORSExposedHeaders)},
+		{"CORS_MAX_AGE", "how long browsers may cache a preflight", false, (*durationValue)(&c.CORSMaxAge)},
+		{"CORS_PUBLIC_PATHS", "path prefixes any origin may read without credentials", false, (*listValue)(&c.CORSPublicPaths)},
+		{"CORS_EXCLUDED_PATHS", "path prefixes that never get CORS headers", false, (*listValue)(&c.CORSExcludedPaths)},
+		{"GRAPH_API_BASE_URL", "Graph API host", false, (*stringValue)(&c.GraphAPIBaseURL)},
+		{"WEBHOOK_ARCHIVE_LIMIT", "raw webhook bodies kept for search and replay", false, (*intValue)(&c.WebhookArchiveLimit)},
+		{"FORWARDING_MAX_ATTEMPTS", "delivery attempts per forwarded event", false, (*intValue)(&c.ForwardingMaxAttempts)},
+		{"FORWARDING_DISABLE_AFTER", "consecutive failed events before a subscription is disabled", false, (*intValue)(&c.ForwardingDisableAfter)},
+		{"FORWARDING_ALLOW_PRIVATE_TARGETS", "allow forwarding to loopback, private and link-local addresses", false, (*boolValue)(&c.ForwardingAllowPrivateTargets)},
+		{"EVENT_STREAM_BACKLOG", "events kept for resuming event streams", false, (*intValue)(&c.EventStreamBacklog)},
+		{"OUTBOUND_QUEUE_FILE", "file keeping queued outbound messages across restarts; empty keeps them in memory only", false, (*stringValue)(&c.OutboundQueueFile)},
+		{"OUTBOUND_MAX_ATTEMPTS", "send attempts per queued outbound message", false, (*intValue)(&c.OutboundMaxAttempts)},
+		{"AUTH_SIGNING_KEY", "HMAC key for session tokens; random per process when empty", true, (*stringValue)(&c.AuthSigningKey)},
+		{"AUTH_SESSION_TTL", "lifetime of session tokens", false, (*durationValue)(&c.AuthSessionTTL)},
+		{"AUTH_BOOTSTRAP_API_KEY", "initial owner API key (wak_...)", true, (*stringValue)(&c.AuthBootstrapAPIKey)},
+		{"TRUST_PROXY_HEADERS", "take client IPs from X-Forwarded-For", false, (*boolValue)(&c.TrustProxyHeaders)},
+		{"HTTP_READ_TIMEOUT", "time to read a whole request", false, (*durationValue)(&c.HTTPReadTimeout)},
+		{"HTTP_READ_HEADER_TIMEOUT", "time to read request headers", false, (*durationValue)(&c.HTTPReadHeaderTimeout)},
+		{"HTTP_WRITE_TIMEOUT", "time to write a response", false, (*durationValue)(&c.HTTPWriteTimeout)},
+		{"HTTP_IDLE_TIMEOUT", "keep-alive idle timeout", false, (*durationValue)(&c.HTTPIdleTimeout)},
+		{"HTTP_MAX_HEADER_BYTES", "maximum request header size", false, (*intValue)(&c.HTTPMaxHeaderBytes)},
+		{"HTTP_MAX_BODY_BYTES", "maximum request body size", false, (*int64Value)(&c.HTTPMaxBodyBytes)},
+		{"SHUTDOWN_TIMEOUT", "time to drain requests and queues on shutdown", false, (*durationValue)(&c.ShutdownTimeout)},
+		{"TLS_CERT_FILE", "PEM certificate chain; serves HTTPS when set with TLS_KEY_FILE", false, (*stringValue)(&c.TLSCertFile)},
+		{"TLS_KEY_FILE", "PEM private key", false, (*stringValue)(&c.TLSKeyFile)},
+		{"TLS_RELOAD_INTERVAL", "how often certificate files are checked for changes", false, (*durationValue)(&c.TLSReloadInterval)},
+		{"HTTP_REDIRECT_PORT", "plain HTTP port redirecting to HTTPS", false, (*stringValue)(&c.HTTPRedirectPort)},
+		{"SECRETS_PROVIDER", "where secrets are read from: env, dir or encrypted_file", false, (*stringValue)(&c.SecretsProvider)},
+		{"SECRETS_DIR", "directory of mounted secret files, one per secret named like its setting", false, (*stringValue)(&c.SecretsDir)},
+		{"SECRETS_FILE", "encrypted secrets file (see cmd/secrets)", false, (*stringValue)(&c.SecretsFile)},
+		{"SECRETS_FILE_KEY", "passphrase for SECRETS_FILE", true, (*stringValue)(&c.SecretsFileKey)},
+		{"SECRETS_REFRESH_INTERVAL", "how often secrets are re-read to pick up rotation", false, (*durationValue)(&c.SecretsRefreshInterval)},
+		{"TOKEN_ENCRYPTION_KEY", "key encrypting stored access tokens; tokens are stored in plain text when empty", true, (*stringValue)(&c.TokenEncryptionKey)},
+		{"TOKEN_ENCRYPTION_KEY_PREVIOUS", "previous TOKEN_ENCRYPTION_KEY, still accepted for decryption", true, (*stringValue)(&c.TokenEncryptionKeyPrevious)},
+		{"TOKEN_REFRESH_INTERVAL", "how often business access tokens are checked for expiry; 0 disables refresh", false, (*durationValue)(&c.TokenRefreshInterval)},
+		{"TOKEN_REFRESH_WINDOW", "refresh access tokens expiring within this", false, (*durationValue)(&c.TokenRefreshWindow)},
+		{"PHONE_SYNC_INTERVAL", "how often phone number status, quality and limits are re-fetched from Meta; 0 disables", false, (*durationValue)(&c.PhoneSyncInterval)},
+		{"READY_MAX_QUEUE_BACKLOG", "queued deliveries above which /readyz fails", false, (*intValue)(&c.ReadinessMaxQueueBacklog)},
+		{"READY_CHECK_GRAPH", "also probe Graph API reachability in /readyz", false, (*boolValue)(&c.ReadinessCheckGraph)},
+		{"LOG_LEVEL", "debug, info, warn or error", false, (*stringValue)(&c.LogLevel)},
+		{"LOG_FORMAT", "text or json", false, (*stringValue)(&c.LogFormat)},
+		{"LOG_SENSITIVE_DATA", "log tokens, phone numbers and message content unmasked", false, (*boolValue)(&c.LogSensitiveData)},
+	}
+}
+
+// Print writes the configuration in config file syntax, with secrets
+// redacted, so the output can be saved and edited as a config file.
+func (c *Config) Print(w io.Writer) {
+	fmt.Fprintln(w, "# Effective configuration; secrets are redacted")
+	settings := c.settings()
+	for i := range c.Apps {
+		settings = append(settings, c.Apps[i].settings()...)
+	}
+	for _, s := range settings {
+		v := yamlValue(s.value)
+		if s.secret && s.value.String() != "" {
+			v = strconv.Quote(redacted)
+		}
+		fmt.Fprintf(w, "%s: %s\n", s.fileKey(), v)
+	}
+}
+
+const redacted = "[REDACTED]"
+
+func yamlValue(v value) string {
+	switch v := v.(type) {
+	case *listValue:
+		quoted := make([]string, len(*v))
+		for i, item := range *v {
+			quoted[i] = strconv.Quote(item)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	case *stringValue:
+		return strconv.Quote(v.String())
+	default:
+		return v.String()
+	}
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type int64Value int64
+
+func (v *int64Value) Set(s string) error {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", s)
+	}
+	*v = int64Value(n)
+	return nil
+}
+func (v *int64Value) String() string { return strconv.FormatInt(int64(*v), 10) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a boolean", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration (e.g. 30s, 12h)", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+// listValue is set from a comma separated string; config files may also use
+// a list.
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+func (v *listValue) String() string { return strings.Join(*v, ",") }
@@ -0,0 +1,730 @@
+// Package fakegraph provides an in-process fake of the parts of the Meta Graph
+// API used by this backend, for integration tests and local development.
+//
+// The fake is state-driven: tests seed auth codes, businesses, WABAs, phone
+// numbers and templates, point config.Config.GraphAPIBaseURL at Server.URL and
+// then inspect what the backend did (subscriptions, sent messages, uploaded
+// media). Any route can be scripted to fail with a Graph-style error envelope.
+package fakegraph
+
+import (
+	"back/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Route identifies an emulated Graph endpoint for failure scripting.
+type Route string
+
+const (
+	RouteOAuth           Route = "oauth"
+	RouteMe              Route = "me"
+	RouteBusinesses      Route = "businesses"
+	RoutePhoneNumbers    Route = "phone_numbers"
+	RouteSubscribedApps  Route = "subscribed_apps"
+	RouteBusinessProfile Route = "business_profile"
+	RouteMessages        Route = "messages"
+	RouteTemplates       Route = "templates"
+	RouteMedia           Route = "media"
+)
+
+// Failure is a scripted Graph error returned instead of the normal response.
+type Failure struct {
+	Status  int    // HTTP status, defaults to 400
+	Code    int    // Graph error code, e.g. 190, 131048
+	Subcode int    // Graph error_subcode
+	Type    string // Graph error type, defaults to OAuthException
+	Message string
+	Times   int // number of requests to fail; 0 fails until cleared
+}
+
+// Request is a recorded call to the fake.
+type Request struct {
+	Route  Route
+	Method string
+	Path   string
+	Token  string
+	Body   []byte
+}
+
+// Message is an outbound message accepted by the messages endpoint.
+type Message struct {
+	ID            string
+	PhoneNumberID string
+	To            string
+	Type          string
+	Payload       map[string]interface{}
+}
+
+// Media is an uploaded media object.
+type Media struct {
+	ID            string
+	PhoneNumberID string
+	MimeType      string
+	Data          []byte
+}
+
+type waba struct {
+	phoneNumbers   []models.FacebookPhoneNumber
+	templates      []models.WhatsAppTemplate
+	subscribed     bool
+	subscribedWith []string
+}
+
+// Server is a fake Graph API backed by httptest.Server.
+type Server struct {
+	*httptest.Server
+
+	AppID     string
+	AppSecret string
+	// PageSize controls pagination of list endpoints when the caller does not
+	// pass a smaller limit.
+	PageSize int
+
+	mu         sync.Mutex
+	apps       map[string]string // additional app ID -> secret
+	codes      map[string]string // auth code -> access token
+	codeApps   map[string]string // auth code -> app ID it was issued to
+	tokens     map[string]bool
+	businesses map[string][]models.FacebookBusinessAccount // token -> businesses
+	wabas      map[string]*waba
+	profiles   map[string]map[string]interface{} // phone number ID -> profile
+	messages   []Message
+	media      map[string]*Media
+	failures   map[Route]*Failure
+	requests   []Request
+	seq        int
+}
+
+// New starts a fake Graph API server. Callers must Close it.
+func New() *Server {
+	s := &Server{
+		AppID:      "fake-app-id",
+		AppSecret:  "fake-app-secret",
+		PageSize:   25,
+		apps:       make(map[string]string),
+		codes:      make(map[string]string),
+		codeApps:   make(map[string]string),
+		tokens:     make(map[string]bool),
+		businesses: make(map[string][]models.FacebookBusinessAccount),
+		wabas:      make(map[string]*waba),
+		profiles:   make(map[string]map[string]interface{}),
+		media:      make(map[string]*Media),
+		failures:   make(map[Route]*Failure),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{version}/oauth/access_token", s.handleOAuth)
+	mux.HandleFunc("GET /{version}/me", s.handleMe)
+	mux.HandleFunc("GET /{version}/me/businesses", s.handleBusinesses)
+	mux.HandleFunc("GET /{version}/{waba}/phone_numbers", s.handlePhoneNumbers)
+	mux.HandleFunc("GET /{version}/{waba}/subscribed_apps", s.handleSubscribedApps)
+	mux.HandleFunc("POST /{version}/{waba}/subscribed_apps", s.handleSubscribedApps)
+	mux.HandleFunc("DELETE /{version}/{waba}/subscribed_apps", s.handleSubscribedApps)
+	mux.HandleFunc("GET /{version}/{phone}/whatsapp_business_profile", s.handleBusinessProfile)
+	mux.HandleFunc("POST /{version}/{phone}/messages", s.handleMessages)
+	mux.HandleFunc("GET /{version}/{waba}/message_templates", s.handleListTemplates)
+	mux.HandleFunc("POST /{version}/{waba}/message_templates", s.handleCreateTemplate)
+	mux.HandleFunc("POST /{version}/{phone}/media", s.handleUploadMedia)
+	mux.HandleFunc("GET /{version}/{media}", s.handleGetMedia)
+	mux.HandleFunc("DELETE /{version}/{media}", s.handleDeleteMedia)
+	mux.HandleFunc("GET /media/{media}/download", s.handleDownloadMedia)
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AddAuthCode makes code exchangeable for a freshly issued access token,
+// which is returned.
+func (s *Server) AddAuthCode(code string) string {
+	token := s.IssueToken()
+	s.mu.Lock()
+	s.codes[code] = token
+	s.mu.Unlock()
+	return token
+}
+
+// AddApp lets a second Meta app exchange codes issued to it.
+func (s *Server) AddApp(appID, appSecret string) {
+	s.mu.Lock()
+	s.apps[appID] = appSecret
+	s.mu.Unlock()
+}
+
+// AddAppAuthCode is AddAuthCode for a code only appID may exchange.
+func (s *Server) AddAppAuthCode(code, appID string) string {
+	token := s.AddAuthCode(code)
+	s.mu.Lock()
+	s.codeApps[code] = appID
+	s.mu.Unlock()
+	return token
+}
+
+// IssueToken registers and returns a new valid access token.
+func (s *Server) IssueToken() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	token := "EAAG" + hex.EncodeToString(b)
+	s.mu.Lock()
+	s.tokens[token] = true
+	s.mu.Unlock()
+	return token
+}
+
+// RevokeToken makes token fail with OAuthException code 190.
+func (s *Server) RevokeToken(token string) {
+	s.mu.Lock()
+	delete(s.tokens, token)
+	s.mu.Unlock()
+}
+
+// AddBusiness lists a business under /me/businesses for token.
+func (s *Server) AddBusiness(token string, business models.FacebookBusinessAccount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.businesses[token] = append(s.businesses[token], business)
+}
+
+// AddPhoneNumber registers a phone number on a WABA, creating the WABA if needed.
+func (s *Server) AddPhoneNumber(wabaID string, phone models.FacebookPhoneNumber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.waba(wabaID).phoneNumbers = append(s.waba(wabaID).phoneNumbers, phone)
+}
+
+// UpdatePhoneNumber replaces the phone number with phone's ID on a WABA.
+func (s *Server) UpdatePhoneNumber(wabaID string, phone models.FacebookPhoneNumber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	numbers := s.waba(wabaID).phoneNumbers
+	for i := range numbers {
+		if numbers[i].ID == phone.ID {
+			numbers[i] = phone
+		}
+	}
+}
+
+// AddTemplate registers a message template on a WABA.
+func (s *Server) AddTemplate(wabaID string, template models.WhatsAppTemplate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.waba(wabaID).templates = append(s.waba(wabaID).templates, template)
+}
+
+// SetBusinessProfile sets the whatsapp_business_profile of a phone number.
+func (s *Server) SetBusinessProfile(phoneNumberID string, profile map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profiles[phoneNumberID] = profile
+}
+
+// Fail scripts route to return f until f.Times requests have failed, or
+// until ClearFailure when Times is zero.
+func (s *Server) Fail(route Route, f Failure) {
+	if f.Status == 0 {
+		f.Status = http.StatusBadRequest
+	}
+	if f.Type == "" {
+		f.Type = "OAuthException"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[route] = &f
+}
+
+// ClearFailure removes any scripted failure for route.
+func (s *Server) ClearFailure(route Route) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, route)
+}
+
+// Subscribed reports whether the app is subscribed to the WABA and the
+// fields it subscribed with.
+func (s *Server) Subscribed(wabaID string) (bool, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.wabas[wabaID]
+	if !ok {
+		return false, nil
+	}
+	return w.subscribed, append([]string(nil), w.subscribedWith...)
+}
+
+// Messages returns all messages accepted so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Templates returns the templates currently registered on a WABA.
+func (s *Server) Templates(wabaID string) []models.WhatsAppTemplate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w, ok := s.wabas[wabaID]; ok {
+		return append([]models.WhatsAppTemplate(nil), w.templates...)
+	}
+	return nil
+}
+
+// Media returns an uploaded media object by ID.
+func (s *Server) Media(id string) (*Media, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.media[id]
+	return m, ok
+}
+
+// Requests returns every request received, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestCount returns how many requests hit route.
+func (s *Server) RequestCount(route Route) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, r := range s.requests {
+		if r.Route == route {
+			n++
+		}
+	}
+	return n
+}
+
+// waba returns the named WABA, creating it. Callers hold s.mu.
+func (s *Server) waba(id string) *waba {
+	w, ok := s.wabas[id]
+	if !ok {
+		w = &waba{}
+		s.wabas[id] = w
+	}
+	return w
+}
+
+func (s *Server) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s%d", prefix, s.seq)
+}
+
+// begin records the request, then applies scripted failures and token
+// checks. It returns the caller's token and false if a response was written.
+func (s *Server) begin(w http.ResponseWriter, r *http.Request, route Route, authenticated bool) (string, []byte, bool) {
+	body, _ := io.ReadAll(r.Body)
+	token := r.URL.Query().Get("access_token")
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimPrefix(h, "Bearer ")
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Route: route, Method: r.Method, Path: r.URL.Path, Token: token, Body: body})
+	if f, ok := s.failures[route]; ok {
+		failure := *f
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				delete(s.failures, route)
+			}
+		}
+		s.mu.Unlock()
+		writeError(w, failure.Status, failure.Type, failure.Code, failure.Subcode, failure.Message)
+		return "", nil, false
+	}
+	valid := s.tokens[token]
+	s.mu.Unlock()
+
+	if authenticated && !valid {
+		writeError(w, http.StatusUnauthorized, "OAuthException", 190, 0, "Invalid OAuth access token.")
+		return "", nil, false
+	}
+	return token, body, true
+}
+
+func (s *Server) handleOAuth(w http.ResponseWriter, r *http.Request) {
+	_, body, ok := s.begin(w, r, RouteOAuth, false)
+	if !ok {
+		return
+	}
+	r.Body = io.NopCloser(strings.NewReader(string(body)))
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "OAuthException", 100, 0, "Malformed form body")
+		return
+	}
+	clientID, code := r.PostForm.Get("client_id"), r.PostForm.Get("code")
+	if r.PostForm.Get("grant_type") == "fb_exchange_token" {
+		s.extendToken(w, clientID, r.PostForm.Get("client_secret"), r.PostForm.Get("fb_exchange_token"))
+		return
+	}
+	s.mu.Lock()
+	secret, known := s.appSecret(clientID)
+	issuedTo, bound := s.codeApps[code]
+	if bound && issuedTo != clientID {
+		known = false
+	}
+	token, ok := s.codes[code]
+	if ok && known && secret == r.PostForm.Get("client_secret") {
+		delete(s.codes, code)
+	}
+	s.mu.Unlock()
+	if !known || secret != r.PostForm.Get("client_secret") {
+		writeError(w, http.StatusBadRequest, "OAuthException", 1, 0, "Error validating client secret.")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusBadRequest, "OAuthException", 100, 36009, "This authorization code has been used.")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.FacebookTokenResponse{
+		AccessToken: token,
+		TokenType:   "bearer",
+		ExpiresIn:   5183944,
+	})
+}
+
+// extendToken answers grant_type=fb_exchange_token with a new token that
+// sees the same businesses. The old token stays valid, as on Meta.
+func (s *Server) extendToken(w http.ResponseWriter, clientID, clientSecret, token string) {
+	s.mu.Lock()
+	secret, known := s.appSecret(clientID)
+	valid := s.tokens[token]
+	s.mu.Unlock()
+	if !known || secret != clientSecret {
+		writeError(w, http.StatusBadRequest, "OAuthException", 1, 0, "Error validating client secret.")
+		return
+	}
+	if !valid {
+		writeError(w, http.StatusBadRequest, "OAuthException", 190, 463, "Error validating access token: Session has expired.")
+		return
+	}
+	fresh := s.IssueToken()
+	s.mu.Lock()
+	s.businesses[fresh] = append([]models.FacebookBusinessAccount(nil), s.businesses[token]...)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, models.FacebookTokenResponse{
+		AccessToken: fresh,
+		TokenType:   "bearer",
+		ExpiresIn:   5183944,
+	})
+}
+
+// appSecret returns the secret of the default or an added app. Callers
+// hold s.mu.
+func (s *Server) appSecret(appID string) (string, bool) {
+	if appID == s.AppID {
+		return s.AppSecret, true
+	}
+	secret, known := s.apps[appID]
+	return secret, known
+}
+
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := s.begin(w, r, RouteMe, true); !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": "10000000001", "name": "Fake User"})
+}
+
+func (s *Server) handleBusinesses(w http.ResponseWriter, r *http.Request) {
+	token, _, ok := s.begin(w, r, RouteBusinesses, true)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	data := append([]models.FacebookBusinessAccount{}, s.businesses[token]...)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func (s *Server) handlePhoneNumbers(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := s.begin(w, r, RoutePhoneNumbers, true); !ok {
+		return
+	}
+	s.mu.Lock()
+	wb, exists := s.wabas[r.PathValue("waba")]
+	var data []models.FacebookPhoneNumber
+	if exists {
+		data = append([]models.FacebookPhoneNumber{}, wb.phoneNumbers...)
+	}
+	s.mu.Unlock()
+	if !exists {
+		writeUnknownObject(w, r.PathValue("waba"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func (s *Server) handleSubscribedApps(w http.ResponseWriter, r *http.Request) {
+	_, body, ok := s.begin(w, r, RouteSubscribedApps, true)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wb, exists := s.wabas[r.PathValue("waba")]
+	if !exists {
+		writeUnknownObject(w, r.PathValue("waba"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			SubscribedFields []string `json:"subscribed_fields"`
+		}
+		_ = json.Unmarshal(body, &req)
+		wb.subscribed = true
+		wb.subscribedWith = req.SubscribedFields
+		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+	case http.MethodDelete:
+		wb.subscribed = false
+		wb.subscribedWith = nil
+		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+	default:
+		data := []map[string]interface{}{}
+		if wb.subscribed {
+			data = append(data, map[string]interface{}{
+				"whatsapp_business_api_data": map[string]string{"id": s.AppID, "name": "Fake App"},
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+	}
+}
+
+func (s *Server) handleBusinessProfile(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := s.begin(w, r, RouteBusinessProfile, true); !ok {
+		return
+	}
+	s.mu.Lock()
+	profile, exists := s.profiles[r.PathValue("phone")]
+	s.mu.Unlock()
+	data := []map[string]interface{}{}
+	if exists {
+		data = append(data, profile)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
+	_, body, ok := s.begin(w, r, RouteMessages, true)
+	if !ok {
+		return
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeError(w, http.StatusBadRequest, "OAuthException", 100, 0, "Invalid parameter")
+		return
+	}
+	to, _ := payload["to"].(string)
+	msgType, _ := payload["type"].(string)
+	if payload["messaging_product"] != "whatsapp" || to == "" {
+		writeError(w, http.StatusBadRequest, "OAuthException", 100, 0, "(#100) Invalid parameter")
+		return
+	}
+
+	s.mu.Lock()
+	id := s.nextID("wamid.FAKE")
+	s.messages = append(s.messages, Message{
+		ID:            id,
+		PhoneNumberID: r.PathValue("phone"),
+		To:            to,
+		Type:          msgType,
+		Payload:       payload,
+	})
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"contacts":          []map[string]string{{"input": to, "wa_id": strings.TrimPrefix(to, "+")}},
+		"messages":          []map[string]string{{"id": id}},
+	})
+}
+
+func (s *Server) handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := s.begin(w, r, RouteTemplates, true); !ok {
+		return
+	}
+	limit := s.PageSize
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l < limit {
+		limit = l
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("after"))
+
+	s.mu.Lock()
+	var all []models.WhatsAppTemplate
+	if wb, ok := s.wabas[r.PathValue("waba")]; ok {
+		all = append(all, wb.templates...)
+	}
+	s.mu.Unlock()
+
+	if offset > len(all) {
+		offset = len(all)
+	}
+	end := offset + limit
+	if end > len(all) {
+		end = len(all)
+	}
+	resp := map[string]interface{}{"data": all[offset:end]}
+	if end < len(all) {
+		q := r.URL.Query()
+		q.Set("after", strconv.Itoa(end))
+		resp["paging"] = map[string]string{"next": s.URL + r.URL.Path + "?" + q.Encode()}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	_, body, ok := s.begin(w, r, RouteTemplates, true)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name     string `json:"name"`
+		Language string `json:"language"`
+		Category string `json:"category"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.Name == "" || req.Language == "" {
+		writeError(w, http.StatusBadRequest, "OAuthException", 100, 0, "(#100) Invalid parameter")
+		return
+	}
+
+	s.mu.Lock()
+	id := s.nextID("tmpl_")
+	s.waba(r.PathValue("waba")).templates = append(s.waba(r.PathValue("waba")).templates, models.WhatsAppTemplate{
+		ID:       id,
+		Name:     req.Name,
+		Language: req.Language,
+		Category: req.Category,
+		Status:   "PENDING",
+	})
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{"id": id, "status": "PENDING", "category": req.Category})
+}
+
+func (s *Server) handleUploadMedia(w http.ResponseWriter, r *http.Request) {
+	_, body, ok := s.begin(w, r, RouteMedia, true)
+	if !ok {
+		return
+	}
+	r.Body = io.NopCloser(strings.NewReader(string(body)))
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, "OAuthException", 100, 0, "(#100) Param file must be a file upload")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "OAuthException", 100, 0, "(#100) Param file must be a file upload")
+		return
+	}
+	defer file.Close()
+	data, _ := io.ReadAll(file)
+
+	mimeType := r.FormValue("type")
+	if mimeType == "" {
+		mimeType = header.Header.Get("Content-Type")
+	}
+
+	s.mu.Lock()
+	id := s.nextID("media_")
+	s.media[id] = &Media{ID: id, PhoneNumberID: r.PathValue("phone"), MimeType: mimeType, Data: data}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{"id": id})
+}
+
+func (s *Server) handleGetMedia(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := s.begin(w, r, RouteMedia, true); !ok {
+		return
+	}
+	s.mu.Lock()
+	m, exists := s.media[r.PathValue("media")]
+	s.mu.Unlock()
+	if !exists {
+		writeUnknownObject(w, r.PathValue("media"))
+		return
+	}
+	sum := sha256.Sum256(m.Data)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"id":                m.ID,
+		"url":               s.URL + "/media/" + m.ID + "/download",
+		"mime_type":         m.MimeType,
+		"sha256":            hex.EncodeToString(sum[:]),
+		"file_size":         len(m.Data),
+	})
+}
+
+func (s *Server) handleDeleteMedia(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := s.begin(w, r, RouteMedia, true); !ok {
+		return
+	}
+	s.mu.Lock()
+	_, exists := s.media[r.PathValue("media")]
+	delete(s.media, r.PathValue("media"))
+	s.mu.Unlock()
+	if !exists {
+		writeUnknownObject(w, r.PathValue("media"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+func (s *Server) handleDownloadMedia(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := s.begin(w, r, RouteMedia, true); !ok {
+		return
+	}
+	s.mu.Lock()
+	m, exists := s.media[r.PathValue("media")]
+	s.mu.Unlock()
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", m.MimeType)
+	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	w.Write(m.Data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, errType string, code, subcode int, message string) {
+	var e struct {
+		Error struct {
+			Message      string `json:"message"`
+			Type         string `json:"type"`
+			Code         int    `json:"code"`
+			ErrorSubcode int    `json:"error_subcode,omitempty"`
+			FbTraceID    string `json:"fbtrace_id"`
+		} `json:"error"`
+	}
+	e.Error.Message = message
+	e.Error.Type = errType
+	e.Error.Code = code
+	e.Error.ErrorSubcode = subcode
+	e.Error.FbTraceID = "AFakeTraceID"
+	writeJSON(w, status, e)
+}
+
+func writeUnknownObject(w http.ResponseWriter, id string) {
+	writeError(w, http.StatusBadRequest, "GraphMethodException", 100, 33,
+		fmt.Sprintf("Unsupported get request. Object with ID '%s' does not exist", id))
+}
@@ -0,0 +1,90 @@
+package fakegraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+func TestMediaRoundTrip(t *testing.T) {
+	s := New()
+	defer s.Close()
+	token := s.IssueToken()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("messaging_product", "whatsapp")
+	mw.WriteField("type", "image/png")
+	fw, _ := mw.CreateFormFile("file", "logo.png")
+	fw.Write([]byte("png-bytes"))
+	mw.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL+"/v23.0/pn-1/media", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	var uploaded struct {
+		ID string `json:"id"`
+	}
+	doJSON(t, req, http.StatusOK, &uploaded)
+
+	req, _ = http.NewRequest(http.MethodGet, s.URL+"/v23.0/"+uploaded.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	var info struct {
+		URL      string `json:"url"`
+		MimeType string `json:"mime_type"`
+	}
+	doJSON(t, req, http.StatusOK, &info)
+	if info.MimeType != "image/png" {
+		t.Errorf("mime_type = %q", info.MimeType)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, info.URL, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "png-bytes" {
+		t.Errorf("downloaded %q", data)
+	}
+}
+
+func TestFailureTimes(t *testing.T) {
+	s := New()
+	defer s.Close()
+	token := s.IssueToken()
+	s.Fail(RouteMe, Failure{Status: http.StatusServiceUnavailable, Code: 2, Message: "unavailable", Times: 2})
+
+	for i, want := range []int{503, 503, 200} {
+		req, _ := http.NewRequest(http.MethodGet, s.URL+"/v19.0/me?access_token="+token, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("request %d: status %d, want %d", i, resp.StatusCode, want)
+		}
+	}
+}
+
+func doJSON(t *testing.T, req *http.Request, status int, out interface{}) {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: status %d, body %s", req.Method, req.URL.Path, resp.StatusCode, b)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"back/models"
+	"back/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+type APIKeyHandler struct {
+	auth  *services.AuthService
+	authz *services.Authorizer
+	audit *services.AuditLog
+}
+
+func NewAPIKeyHandler(auth *services.AuthService, authz *services.Authorizer, audit *services.AuditLog) *APIKeyHandler {
+	return &APIKeyHandler{auth: auth, authz: authz, audit: audit}
+}
+
+// GET /api/auth/keys
+func (h *APIKeyHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.auth.ListAPIKeys(tenantID(r))
+	if err != nil {
+		writeError(w, r, ErrInternal, "Failed to fetch API keys")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"keys":    keys,
+		"count":   len(keys),
+	})
+}
+
+// POST /api/auth/keys
+// New keys default to read_only and may not outrank the caller's own key.
+func (h *APIKeyHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string      `json:"name"`
+		Role models.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeError(w, r, ErrInvalidRequest, "Key name is required")
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleReadOnly
+	}
+	if !services.ValidRole(req.Role) {
+		writeError(w, r, ErrInvalidRequest, "Unknown role")
+		return
+	}
+	if principal := services.PrincipalFromContext(r.Context()); principal == nil || !services.RoleAtMost(req.Role, principal.Role) {
+		writeError(w, r, ErrForbidden, "Cannot create a key with a higher role than your own")
+		return
+	}
+	raw, key, err := h.auth.CreateAPIKey(tenantID(r), req.Name, req.Role)
+	if err != nil {
+		writeError(w, r, ErrInternal, "Failed to create API key")
+		return
+	}
+	h.audit.Record(r.Context(), tenantID(r), models.AuditAPIKeyCreated, "api_key", key.ID, nil, key)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"key":     key,
+		"api_key": raw, // Shown once; only the hash is stored
+	})
+}
+
+// DELETE /api/auth/keys/{id}
+// As with creation, keys that outrank the caller's own cannot be revoked.
+func (h *APIKeyHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	principal := services.PrincipalFromContext(r.Context())
+	if principal == nil {
+		writeError(w, r, ErrForbidden, "Cannot revoke API keys without a role")
+		return
+	}
+	err := h.auth.RevokeAPIKey(tenantID(r), id, principal.Role)
+	if errors.Is(err, services.ErrRoleTooHigh) {
+		writeError(w, r, ErrForbidden, "Cannot revoke a key with a higher role than your own")
+		return
+	}
+	if err != nil {
+		writeError(w, r, ErrAPIKeyNotFound, "API key not found")
+		return
+	}
+	h.audit.Record(r.Context(), tenantID(r), models.AuditAPIKeyRevoked, "api_key", id,
+		map[string]interface{}{"revoked": false}, map[string]interface{}{"revoked": true})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// POST /api/auth/session
+// Exchanges the caller's credential for a short-lived session token.
+func (h *APIKeyHandler) CreateSession(w http.ResponseWriter, r *http.Request) {
+	principal := services.PrincipalFromContext(r.Context())
+	token, expires, err := h.auth.IssueSessionToken(principal)
+	if err != nil {
+		writeError(w, r, ErrInternal, "Failed to issue session token")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_at": expires.Format(time.RFC3339),
+	})
+}
+
+// GET /api/auth/denials
+// Requests refused by the authorization layer, newest first.
+func (h *APIKeyHandler) ListDenials(w http.ResponseWriter, r *http.Request) {
+	denials := h.authz.Denials(tenantID(r))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"denials": denials,
+		"count":   len(denials),
+	})
+}
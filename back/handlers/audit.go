@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"back/services"
+	"net/http"
+	"strconv"
+)
+
+type AuditHandler struct {
+	audit *services.AuditLog
+}
+
+func NewAuditHandler(audit *services.AuditLog) *AuditHandler {
+	return &AuditHandler{audit: audit}
+}
+
+// GET /api/audit?actor_id=&action=&target_type=&target_id=&since=&until=&limit=
+// Returns the caller's tenant entries, newest first, and whether the hash
+// chain over the whole log still verifies.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := services.AuditFilter{
+		TenantID:   tenantID(r),
+		ActorID:    q.Get("actor_id"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+		Limit:      100,
+	}
+	var err error
+	if filter.Since, err = parseTimeParam(q.Get("since")); err != nil {
+		writeError(w, r, ErrInvalidRequest, "Invalid since: "+err.Error())
+		return
+	}
+	if filter.Until, err = parseTimeParam(q.Get("until")); err != nil {
+		writeError(w, r, ErrInvalidRequest, "Invalid until: "+err.Error())
+		return
+	}
+	if l := q.Get("limit"); l != "" {
+		if filter.Limit, err = strconv.Atoi(l); err != nil || filter.Limit < 1 {
+			writeError(w, r, ErrInvalidRequest, "Invalid limit")
+			return
+		}
+	}
+
+	entries := h.audit.List(filter)
+	resp := map[string]interface{}{
+		"success":     true,
+		"entries":     entries,
+		"count":       len(entries),
+		"chain_valid": true,
+	}
+	if err := h.audit.Verify(); err != nil {
+		resp["chain_valid"] = false
+		resp["chain_error"] = err.Error()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
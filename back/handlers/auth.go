@@ -1,90 +1,92 @@
 package handlers
 
 import (
+	"back/config"
 	"back/models"
 	"back/services"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 )
 
 type AuthHandler struct {
+	config   *config.Config
 	facebook *services.FacebookService
 	whatsapp *services.WhatsAppService
 	storage  *services.StorageService
+	authz    *services.Authorizer
+	metrics  *services.Metrics
 }
 
-func NewAuthHandler(facebook *services.FacebookService, whatsapp *services.WhatsAppService, storage *services.StorageService) *AuthHandler {
+func NewAuthHandler(cfg *config.Config, facebook *services.FacebookService, whatsapp *services.WhatsAppService, storage *services.StorageService, authz *services.Authorizer, metrics *services.Metrics) *AuthHandler {
 	return &AuthHandler{
+		config:   cfg,
 		facebook: facebook,
 		whatsapp: whatsapp,
 		storage:  storage,
+		authz:    authz,
+		metrics:  metrics,
 	}
 }
 
 func (h *AuthHandler) HandleEmbeddedSignup(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var req models.AuthCodeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, ErrInvalidRequest, "Invalid request body")
 		return
 	}
 
 	if req.AuthorizationCode == "" {
-		h.sendError(w, "Authorization code is required", http.StatusBadRequest)
+		writeError(w, r, ErrInvalidRequest, "Authorization code is required")
 		return
 	}
 
-	// IMPORTANT: Use the redirect_uri from the request if provided, otherwise use config default
+	// The code can only be exchanged by the app that issued it
+	app, ok := findMetaApp(w, r, h.config, &req)
+	if !ok {
+		return
+	}
+
+	// Use the redirect_uri from the request if provided, otherwise the app's.
+	// It must match exactly what's in the Facebook app settings.
 	redirectURI := req.RedirectURI
 	if redirectURI == "" {
-		// For WhatsApp Embedded Signup, we need to use the configured redirect URI
-		// This should match exactly what's in your Facebook app settings
-		redirectURI = "https://c6c766eee161.ngrok-free.app" // Use your actual ngrok URL
+		redirectURI = app.RedirectURI
 	}
 
 	// Step 1: Exchange authorization code for access token
-	log.Printf("Step 1: Exchanging authorization code for access token with redirect_uri=%q", redirectURI)
-	tokenResp, err := h.facebook.ExchangeToken(req.AuthorizationCode, redirectURI)
+	ctx := r.Context()
+	slog.DebugContext(ctx, "signup: exchanging authorization code", "app", app.Name, "redirect_uri", redirectURI)
+	tokenResp, err := h.facebook.ExchangeToken(ctx, app, req.AuthorizationCode, redirectURI)
+	h.metrics.SignupStep("token_exchange", err == nil)
 	if err != nil {
-		h.sendError(w, fmt.Sprintf("Token exchange failed: %v", err), http.StatusBadRequest)
+		writeGraphError(w, r, ErrTokenExchangeFailed, "Token exchange failed", err)
 		return
 	}
 
-	// Log token details (remove in production)
-	log.Printf("✅ Token exchange successful!")
-	log.Printf("📄 Token details: AccessToken length=%d, TokenType=%s, ExpiresIn=%d",
-		len(tokenResp.AccessToken), tokenResp.TokenType, tokenResp.ExpiresIn)
-	log.Printf("🔑 Access Token (first 20 chars): %s...", tokenResp.AccessToken[:20])
+	slog.DebugContext(ctx, "signup: token exchanged", "token_type", tokenResp.TokenType, "expires_in", tokenResp.ExpiresIn)
 
 	// Step 2: Get business accounts
-	log.Printf("Step 2: Fetching business accounts")
-	businesses, err := h.facebook.GetBusinessAccounts(tokenResp.AccessToken)
+	businesses, err := h.facebook.GetBusinessAccounts(ctx, tokenResp.AccessToken)
+	h.metrics.SignupStep("business_accounts", err == nil)
 	if err != nil {
-		h.sendError(w, fmt.Sprintf("Failed to fetch business accounts: %v", err), http.StatusInternalServerError)
+		writeGraphError(w, r, ErrGraphRequestFailed, "Failed to fetch business accounts", err)
 		return
 	}
 
-	log.Printf("📊 Found %d business accounts", len(businesses))
-	for i, business := range businesses {
-		log.Printf("  Business %d: ID=%s, Name=%s, VerificationStatus=%s",
-			i+1, business.ID, business.Name, business.VerificationStatus)
-	}
+	slog.DebugContext(ctx, "signup: fetched business accounts", "count", len(businesses))
 
 	if len(businesses) == 0 {
-		log.Printf("⚠️ No business accounts found via standard endpoint")
-		log.Printf("ℹ️ This is normal for WhatsApp Embedded Signup - WABA is created but may not appear in /me/businesses immediately")
+		// Normal for Embedded Signup: the WABA is created but may not appear
+		// in /me/businesses immediately
 
 		// For embedded signup, we should get the WABA ID from the frontend message event
 		// Check if the frontend provided WABA details
 		if req.WABAID != "" {
-			log.Printf("✅ Using WABA ID from frontend message event: %s", req.WABAID)
+			slog.DebugContext(ctx, "signup: using WABA ID from frontend message event", "waba_id", req.WABAID)
 
 			// Create a virtual business account with the provided WABA ID
 			businesses = []models.FacebookBusinessAccount{
@@ -95,65 +97,66 @@ func (h *AuthHandler) HandleEmbeddedSignup(w http.ResponseWriter, r *http.Reques
 				},
 			}
 		} else {
-			h.sendError(w, "No WhatsApp Business Accounts found and no WABA ID provided. Please ensure you completed the embedded signup flow and check browser console for the message event with WABA details.", http.StatusNotFound)
+			h.metrics.SignupStep("waba_lookup", false)
+			writeError(w, r, ErrWABANotFound, "No WhatsApp Business Accounts found and no WABA ID provided. Please ensure you completed the embedded signup flow and check browser console for the message event with WABA details.")
 			return
 		}
 	}
 
 	// Step 3: Process first business account
-	log.Printf("Step 3: Processing business account: %s", businesses[0].ID)
 	business := businesses[0]
 
 	// Step 4: Get phone numbers for the business
-	log.Printf("Step 4: Fetching phone numbers for WABA: %s", business.ID)
-	phoneNumbers, err := h.facebook.GetPhoneNumbers(tokenResp.AccessToken, business.ID)
+	phoneNumbers, err := h.facebook.GetPhoneNumbers(ctx, tokenResp.AccessToken, business.ID)
+	h.metrics.SignupStep("phone_numbers", err == nil && len(phoneNumbers) > 0)
 	if err != nil {
-		h.sendError(w, fmt.Sprintf("Failed to fetch phone numbers: %v", err), http.StatusInternalServerError)
+		// An unknown WABA ID (e.g. a bad one from the frontend) is a 404, not an outage
+		fallback := ErrGraphRequestFailed
+		var graphErr *services.GraphError
+		if errors.As(err, &graphErr) && graphErr.ObjectNotFound() {
+			fallback = ErrWABANotFound
+		}
+		writeGraphError(w, r, fallback, "Failed to fetch phone numbers", err)
 		return
 	}
 
 	if len(phoneNumbers) == 0 {
-		h.sendError(w, "No phone numbers found for this business account", http.StatusNotFound)
+		writeError(w, r, ErrPhoneNumbersNotFound, "No phone numbers found for this business account")
 		return
 	}
 
 	// Step 5: Setup webhooks
-	log.Printf("Step 5: Setting up webhooks for WABA: %s", business.ID)
 	webhooksEnabled := true
-	if err := h.whatsapp.SetupWebhooks(tokenResp.AccessToken, business.ID); err != nil {
-		log.Printf("Warning: Failed to setup webhooks: %v", err)
+	err = h.whatsapp.SetupWebhooks(ctx, tokenResp.AccessToken, business.ID)
+	h.metrics.SignupStep("webhooks", err == nil)
+	if err != nil {
+		slog.WarnContext(ctx, "signup: failed to set up webhooks", "waba_id", business.ID, "error", err)
 		webhooksEnabled = false
 	}
 
 	// Step 6: Get business profile information
-	log.Printf("Step 6: Fetching business profile")
-	profile, err := h.whatsapp.GetBusinessProfile(tokenResp.AccessToken, phoneNumbers[0].ID)
+	profile, err := h.whatsapp.GetBusinessProfile(ctx, tokenResp.AccessToken, phoneNumbers[0].ID)
+	h.metrics.SignupStep("business_profile", err == nil)
 	if err != nil {
-		log.Printf("Warning: Failed to get business profile: %v", err)
+		slog.WarnContext(ctx, "signup: failed to get business profile", "phone_number_id", phoneNumbers[0].ID, "error", err)
 		profile = map[string]interface{}{}
 	}
 
 	// Step 7: Create business account record
-	log.Printf("Step 7: Creating business account record")
 	businessPhoneNumbers := make([]models.BusinessPhoneNumber, 0, len(phoneNumbers))
 	for _, phone := range phoneNumbers {
-		businessPhoneNumbers = append(businessPhoneNumbers, models.BusinessPhoneNumber{
-			ID:            phone.ID,
-			PhoneNumber:   phone.DisplayPhoneNumber,
-			DisplayName:   phone.VerifiedName,
-			Status:        phone.Status,
-			QualityRating: phone.QualityRating,
-			IsVerified:    phone.CodeVerificationStatus == "VERIFIED",
-		})
+		businessPhoneNumbers = append(businessPhoneNumbers, services.PhoneNumberFromGraph(phone))
 	}
 
 	account := &models.BusinessAccount{
 		ID:              fmt.Sprintf("ba_%d", time.Now().Unix()),
+		TenantID:        tenantID(r),
 		WABAID:          business.ID,
+		AppID:           app.AppID,
 		BusinessName:    business.Name,
 		PhoneNumbers:    businessPhoneNumbers,
-		AccessToken:     tokenResp.AccessToken, // Encrypt in production
-		TokenExpiresAt:  time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+		AccessToken:     tokenResp.AccessToken, // Encrypted at rest when TOKEN_ENCRYPTION_KEY is set
+		TokenExpiresAt:  services.TokenExpiry(time.Now(), tokenResp.ExpiresIn),
 		WebhooksEnabled: webhooksEnabled,
 		SetupComplete:   true,
 		CreatedAt:       time.Now(),
@@ -162,14 +165,21 @@ func (h *AuthHandler) HandleEmbeddedSignup(w http.ResponseWriter, r *http.Reques
 			"verification_status": business.VerificationStatus,
 			"profile_info":        profile,
 			"setup_source":        "embedded_signup",
+			"meta_app":            app.Name,
 			"redirect_uri":        redirectURI, // Store the redirect URI used
 		},
 	}
 
 	// Step 8: Save to storage
-	log.Printf("Step 8: Saving business account to storage")
-	if err := h.storage.SaveBusinessAccount(account); err != nil {
-		h.sendError(w, fmt.Sprintf("Failed to save business account: %v", err), http.StatusInternalServerError)
+	err = h.storage.SaveBusinessAccount(ctx, account)
+	h.metrics.SignupStep("save", err == nil)
+	if err != nil {
+		if errors.Is(err, services.ErrAccountClaimed) {
+			writeError(w, r, ErrAccountClaimed, "This WhatsApp Business Account is already connected to another tenant")
+			return
+		}
+		slog.ErrorContext(ctx, "signup: failed to save business account", "waba_id", business.ID, "error", err)
+		writeError(w, r, ErrInternal, "Failed to save business account")
 		return
 	}
 
@@ -184,18 +194,18 @@ func (h *AuthHandler) HandleEmbeddedSignup(w http.ResponseWriter, r *http.Reques
 		nextSteps = append(nextSteps, "Manual webhook configuration may be required")
 	}
 
-	// Step 10: Send success response with token details
-	log.Printf("Step 10: Setup completed successfully for WABA: %s", business.ID)
+	// Step 10: Send success response with token details; the token itself
+	// only goes to callers who may view tokens
+	slog.InfoContext(ctx, "signup completed", "app", app.Name, "waba_id", business.ID, "phone_numbers", len(businessPhoneNumbers), "webhooks_enabled", webhooksEnabled)
 	response := models.BusinessSetupResponse{
 		Success:      true,
 		Message:      "WhatsApp Business Account setup completed successfully",
-		BusinessInfo: account,
+		BusinessInfo: visibleAccount(r, h.authz, account),
 		SetupStatus:  "complete",
 		NextSteps:    nextSteps,
 		TokenInfo: map[string]interface{}{
 			"access_token_length":  len(tokenResp.AccessToken),
-			"access_token_preview": tokenResp.AccessToken,
-			"full_access_token":    tokenResp.AccessToken, // Full token for debugging
+			"access_token_preview": tokenPreview(tokenResp.AccessToken),
 			"token_type":           tokenResp.TokenType,
 			"expires_in":           tokenResp.ExpiresIn,
 			"token_created_at":     time.Now().Format(time.RFC3339),
@@ -206,11 +216,21 @@ func (h *AuthHandler) HandleEmbeddedSignup(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(response)
 }
 
-func (h *AuthHandler) sendError(w http.ResponseWriter, message string, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(models.BusinessSetupResponse{
-		Success: false,
-		Error:   message,
-	})
+// tokenPreview shows just enough of an access token to tell tokens apart.
+func tokenPreview(token string) string {
+	if len(token) < 24 {
+		return "..."
+	}
+	return token[:8] + "..." + token[len(token)-4:]
+}
+
+// findMetaApp resolves the app named by the request's app_id or config_id,
+// or the default app when it names none.
+func findMetaApp(w http.ResponseWriter, r *http.Request, cfg *config.Config, req *models.AuthCodeRequest) (config.MetaApp, bool) {
+	app, ok := cfg.FindMetaApp(req.AppID, req.ConfigID)
+	if !ok {
+		writeErrorDetails(w, r, ErrUnknownApp, "No Meta app is configured with this app_id or config_id",
+			map[string]any{"app_id": req.AppID, "config_id": req.ConfigID})
+	}
+	return app, ok
 }
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"back/config"
+	"back/fakegraph"
+	"back/models"
+	"back/services"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type signupFixture struct {
+	graph   *fakegraph.Server
+	storage *services.StorageService
+	handler *AuthHandler
+}
+
+func newSignupFixture(t *testing.T) *signupFixture {
+	t.Helper()
+	graph := fakegraph.New()
+	t.Cleanup(graph.Close)
+
+	cfg := &config.Config{
+		FacebookAppID:      graph.AppID,
+		FacebookAppSecret:  graph.AppSecret,
+		WebhookCallbackURL: "https://example.test/api/whatsapp/webhooks",
+		GraphAPIBaseURL:    graph.URL,
+		Apps:               []config.MetaApp{{Name: "emea", AppID: "emea-app-id", AppSecret: "emea-secret", ConfigID: "cfg-emea"}},
+	}
+	graph.AddApp("emea-app-id", "emea-secret")
+	fb := services.NewFacebookService(cfg, nil, nil)
+	wa := services.NewWhatsAppService(cfg, fb, nil)
+	storage := services.NewStorageService(services.NewAuditLog())
+
+	return &signupFixture{
+		graph:   graph,
+		storage: storage,
+		handler: NewAuthHandler(cfg, fb, wa, storage, services.NewAuthorizer(), nil),
+	}
+}
+
+func (f *signupFixture) post(t *testing.T, req models.AuthCodeRequest) (*httptest.ResponseRecorder, models.BusinessSetupResponse) {
+	t.Helper()
+	return f.postAs(t, req, models.RoleOwner)
+}
+
+func (f *signupFixture) postAs(t *testing.T, req models.AuthCodeRequest, role models.Role) (*httptest.ResponseRecorder, models.BusinessSetupResponse) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	f.handler.HandleEmbeddedSignup(rec, asRole(httptest.NewRequest(http.MethodPost, "/api/whatsapp/setup", bytes.NewReader(body)), role))
+
+	var resp models.BusinessSetupResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+	}
+	return rec, resp
+}
+
+func TestEmbeddedSignup(t *testing.T) {
+	f := newSignupFixture(t)
+	token := f.graph.AddAuthCode("code-1")
+	f.graph.AddBusiness(token, models.FacebookBusinessAccount{ID: "waba-1", Name: "Acme", VerificationStatus: "verified"})
+	f.graph.AddPhoneNumber("waba-1", models.FacebookPhoneNumber{
+		ID: "pn-1", DisplayPhoneNumber: "+1 555 0100", VerifiedName: "Acme", Status: "CONNECTED",
+		QualityRating: "GREEN", CodeVerificationStatus: "VERIFIED",
+	})
+	f.graph.SetBusinessProfile("pn-1", map[string]interface{}{"about": "Hi"})
+
+	rec, resp := f.post(t, models.AuthCodeRequest{AuthorizationCode: "code-1"})
+	if rec.Code != http.StatusOK || !resp.Success {
+		t.Fatalf("status %d, response %+v", rec.Code, resp)
+	}
+	if resp.BusinessInfo == nil || !resp.BusinessInfo.WebhooksEnabled {
+		t.Errorf("business info = %+v", resp.BusinessInfo)
+	}
+	if subscribed, _ := f.graph.Subscribed("waba-1"); !subscribed {
+		t.Error("app not subscribed to WABA")
+	}
+
+	account, err := f.storage.GetBusinessAccount(models.DefaultTenantID, "waba-1")
+	if err != nil {
+		t.Fatalf("account not stored: %v", err)
+	}
+	if account.AccessToken != token {
+		t.Error("stored access token does not match issued token")
+	}
+	if len(account.PhoneNumbers) != 1 || !account.PhoneNumbers[0].IsVerified {
+		t.Errorf("phone numbers = %+v", account.PhoneNumbers)
+	}
+}
+
+func TestEmbeddedSignupShowsTokenOnlyToOwners(t *testing.T) {
+	f := newSignupFixture(t)
+	for role, wantToken := range map[models.Role]bool{models.RoleOwner: true, models.RoleAdmin: false} {
+		code := "code-" + string(role)
+		token := f.graph.AddAuthCode(code)
+		f.graph.AddPhoneNumber("waba-"+string(role), models.FacebookPhoneNumber{ID: "pn-" + string(role)})
+
+		rec, resp := f.postAs(t, models.AuthCodeRequest{AuthorizationCode: code, WABAID: "waba-" + string(role)}, role)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, body %s", role, rec.Code, rec.Body.String())
+		}
+		if got := resp.BusinessInfo.AccessToken == token; got != wantToken {
+			t.Errorf("%s: business_info.access_token = %q", role, resp.BusinessInfo.AccessToken)
+		}
+		if _, ok := resp.TokenInfo["full_access_token"]; ok {
+			t.Errorf("%s: token_info has full_access_token", role)
+		}
+		if preview := resp.TokenInfo["access_token_preview"]; preview != token[:8]+"..."+token[len(token)-4:] {
+			t.Errorf("%s: access_token_preview = %v", role, preview)
+		}
+		if strings.Contains(rec.Body.String(), token) != wantToken {
+			t.Errorf("%s: token in response body = %v, want %v", role, !wantToken, wantToken)
+		}
+	}
+}
+
+func TestEmbeddedSignupUsesFrontendWABAID(t *testing.T) {
+	f := newSignupFixture(t)
+	f.graph.AddAuthCode("code-1")
+	f.graph.AddPhoneNumber("waba-2", models.FacebookPhoneNumber{ID: "pn-2"})
+
+	rec, resp := f.post(t, models.AuthCodeRequest{AuthorizationCode: "code-1", WABAID: "waba-2"})
+	if rec.Code != http.StatusOK || !resp.Success {
+		t.Fatalf("status %d, response %+v", rec.Code, resp)
+	}
+	if _, err := f.storage.GetBusinessAccount(models.DefaultTenantID, "waba-2"); err != nil {
+		t.Errorf("account not stored: %v", err)
+	}
+}
+
+func TestEmbeddedSignupNoWABA(t *testing.T) {
+	f := newSignupFixture(t)
+	f.graph.AddAuthCode("code-1")
+
+	rec, _ := f.post(t, models.AuthCodeRequest{AuthorizationCode: "code-1"})
+	expectError(t, rec, ErrWABANotFound)
+}
+
+func TestEmbeddedSignupUnknownFrontendWABAID(t *testing.T) {
+	f := newSignupFixture(t)
+	f.graph.AddAuthCode("code-1")
+
+	rec, _ := f.post(t, models.AuthCodeRequest{AuthorizationCode: "code-1", WABAID: "waba-missing"})
+	resp := expectError(t, rec, ErrWABANotFound)
+	if resp.Error.Graph == nil || resp.Error.Graph.Code != 100 || resp.Error.Graph.Subcode != 33 {
+		t.Errorf("graph details = %+v", resp.Error.Graph)
+	}
+}
+
+func TestEmbeddedSignupTokenExchangeFails(t *testing.T) {
+	f := newSignupFixture(t)
+
+	rec, _ := f.post(t, models.AuthCodeRequest{AuthorizationCode: "unknown"})
+	expectError(t, rec, ErrTokenExchangeFailed)
+	accounts, _ := f.storage.ListBusinessAccounts(models.DefaultTenantID)
+	if len(accounts) != 0 {
+		t.Errorf("stored %d accounts after failed signup", len(accounts))
+	}
+}
+
+func TestEmbeddedSignupPhoneNumbersFail(t *testing.T) {
+	f := newSignupFixture(t)
+	token := f.graph.AddAuthCode("code-1")
+	f.graph.AddBusiness(token, models.FacebookBusinessAccount{ID: "waba-1"})
+	f.graph.AddPhoneNumber("waba-1", models.FacebookPhoneNumber{ID: "pn-1"})
+	f.graph.Fail(fakegraph.RoutePhoneNumbers, fakegraph.Failure{Status: 500, Code: 2, Type: "OAuthException", Message: "Service temporarily unavailable"})
+
+	rec, _ := f.post(t, models.AuthCodeRequest{AuthorizationCode: "code-1"})
+	expectError(t, rec, ErrGraphRequestFailed)
+}
+
+func TestEmbeddedSignupRateLimited(t *testing.T) {
+	f := newSignupFixture(t)
+	token := f.graph.AddAuthCode("code-1")
+	f.graph.AddBusiness(token, models.FacebookBusinessAccount{ID: "waba-1"})
+	f.graph.AddPhoneNumber("waba-1", models.FacebookPhoneNumber{ID: "pn-1"})
+	f.graph.Fail(fakegraph.RoutePhoneNumbers, fakegraph.Failure{Status: 400, Code: 80004, Type: "OAuthException", Message: "Too many calls to this WhatsApp Business account"})
+
+	rec, _ := f.post(t, models.AuthCodeRequest{AuthorizationCode: "code-1"})
+	resp := expectError(t, rec, ErrGraphRateLimited)
+	if resp.Error.Graph == nil || resp.Error.Graph.Code != 80004 {
+		t.Errorf("graph details = %+v", resp.Error.Graph)
+	}
+}
+
+func TestEmbeddedSignupWebhookSubscriptionFails(t *testing.T) {
+	f := newSignupFixture(t)
+	token := f.graph.AddAuthCode("code-1")
+	f.graph.AddBusiness(token, models.FacebookBusinessAccount{ID: "waba-1"})
+	f.graph.AddPhoneNumber("waba-1", models.FacebookPhoneNumber{ID: "pn-1"})
+	f.graph.Fail(fakegraph.RouteSubscribedApps, fakegraph.Failure{Status: 403, Code: 200, Message: "Permissions error"})
+
+	rec, resp := f.post(t, models.AuthCodeRequest{AuthorizationCode: "code-1"})
+	if rec.Code != http.StatusOK || !resp.Success {
+		t.Fatalf("status %d, response %+v", rec.Code, resp)
+	}
+	if resp.BusinessInfo.WebhooksEnabled {
+		t.Error("webhooks_enabled should be false when subscription fails")
+	}
+}
+
+func TestEmbeddedSignupRoutesToApp(t *testing.T) {
+	f := newSignupFixture(t)
+	f.graph.AddAppAuthCode("code-1", "emea-app-id")
+	f.graph.AddAppAuthCode("code-2", "emea-app-id")
+	f.graph.AddPhoneNumber("waba-1", models.FacebookPhoneNumber{ID: "pn-1"})
+	f.graph.AddPhoneNumber("waba-2", models.FacebookPhoneNumber{ID: "pn-2"})
+
+	// The default app cannot exchange a code issued to another app
+	rec, _ := f.post(t, models.AuthCodeRequest{AuthorizationCode: "code-1", WABAID: "waba-1"})
+	expectError(t, rec, ErrTokenExchangeFailed)
+
+	for code, req := range map[string]models.AuthCodeRequest{
+		"waba-1": {AuthorizationCode: "code-1", WABAID: "waba-1", AppID: "emea-app-id"},
+		"waba-2": {AuthorizationCode: "code-2", WABAID: "waba-2", ConfigID: "cfg-emea"},
+	} {
+		rec, resp := f.post(t, req)
+		if rec.Code != http.StatusOK || !resp.Success {
+			t.Fatalf("%s: status %d, response %+v", code, rec.Code, resp)
+		}
+		account, err := f.storage.GetBusinessAccount(models.DefaultTenantID, req.WABAID)
+		if err != nil || account.AppID != "emea-app-id" {
+			t.Errorf("%s: account %+v, %v", code, account, err)
+		}
+	}
+
+	rec, _ = f.post(t, models.AuthCodeRequest{AuthorizationCode: "code-3", AppID: "unknown-app"})
+	expectError(t, rec, ErrUnknownApp)
+}
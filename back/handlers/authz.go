@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"back/models"
+	"back/services"
+	"net/http"
+)
+
+// RequirePermission allows the request only if the authenticated principal
+// holds permission. It must run inside RequireAuth.
+func RequirePermission(authz *services.Authorizer, permission models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(w, r, authz, permission) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// authorize checks the caller and, when denied, records the attempt and
+// writes a 403. It reports whether the handler may continue.
+func authorize(w http.ResponseWriter, r *http.Request, authz *services.Authorizer, permission models.Permission) bool {
+	principal := services.PrincipalFromContext(r.Context())
+	if err := authz.Authorize(principal, permission, r.Method, r.URL.Path); err != nil {
+		writeErrorDetails(w, r, ErrForbidden, "Permission denied", map[string]any{"permission": permission})
+		return false
+	}
+	return true
+}
@@ -1,79 +1,434 @@
 package handlers
 
 import (
+	"back/models"
 	"back/services"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
+)
+
+// Recipients of one bulk send. Without queue the sends run one after
+// another within the request, so far fewer are allowed.
+const (
+	maxBulkRecipients     = 1000
+	maxSyncBulkRecipients = 100
 )
 
 type BusinessHandler struct {
-	storage *services.StorageService
+	storage  *services.StorageService
+	whatsapp *services.WhatsAppService
+	limits   *services.MessagingLimits
+	outbound *services.OutboundQueue
+	authz    *services.Authorizer
+	audit    *services.AuditLog
+	metrics  *services.Metrics
 }
 
-func NewBusinessHandler(storage *services.StorageService) *BusinessHandler {
+func NewBusinessHandler(storage *services.StorageService, whatsapp *services.WhatsAppService, limits *services.MessagingLimits, outbound *services.OutboundQueue, authz *services.Authorizer, audit *services.AuditLog, metrics *services.Metrics) *BusinessHandler {
 	return &BusinessHandler{
-		storage: storage,
+		storage:  storage,
+		whatsapp: whatsapp,
+		limits:   limits,
+		outbound: outbound,
+		authz:    authz,
+		audit:    audit,
+		metrics:  metrics,
 	}
 }
 
+// GET /api/business/accounts
 func (h *BusinessHandler) ListAccounts(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !authorize(w, r, h.authz, models.PermissionReadAccounts) {
 		return
 	}
 
-	accounts, err := h.storage.ListBusinessAccounts()
+	accounts, err := h.storage.ListBusinessAccounts(tenantID(r))
 	if err != nil {
-		http.Error(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		writeError(w, r, ErrInternal, "Failed to fetch accounts")
 		return
 	}
+	for i, account := range accounts {
+		accounts[i] = visibleAccount(r, h.authz, account)
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success":  true,
 		"accounts": accounts,
 		"count":    len(accounts),
 	})
 }
 
+// GET /api/business/accounts/{wabaID}
 func (h *BusinessHandler) GetAccount(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !authorize(w, r, h.authz, models.PermissionReadAccounts) {
 		return
 	}
 
-	wabaID := r.URL.Query().Get("waba_id")
-	if wabaID == "" {
-		http.Error(w, "WABA ID is required", http.StatusBadRequest)
+	account, err := h.storage.GetBusinessAccount(tenantID(r), r.PathValue("wabaID"))
+	if err != nil {
+		writeError(w, r, ErrAccountNotFound, "Account not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"account": visibleAccount(r, h.authz, account),
+	})
+}
+
+// GET /api/business/accounts/{wabaID}/phone-numbers
+// Phone numbers as last synced from Meta.
+func (h *BusinessHandler) ListPhoneNumbers(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, h.authz, models.PermissionReadAccounts) {
 		return
 	}
 
-	account, err := h.storage.GetBusinessAccount(wabaID)
+	account, err := h.storage.GetBusinessAccount(tenantID(r), r.PathValue("wabaID"))
 	if err != nil {
-		http.Error(w, "Account not found", http.StatusNotFound)
+		writeError(w, r, ErrAccountNotFound, "Account not found")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"account": account,
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"phone_numbers": account.PhoneNumbers,
+		"count":         len(account.PhoneNumbers),
+	})
+}
+
+// GET /api/business/accounts/{wabaID}/phone-numbers/{phoneNumberID}/history
+// Recorded changes of a phone number's status, quality rating, messaging
+// limit and other fields, oldest first.
+func (h *BusinessHandler) PhoneNumberHistory(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, h.authz, models.PermissionReadAccounts) {
+		return
+	}
+
+	wabaID, phoneNumberID := r.PathValue("wabaID"), r.PathValue("phoneNumberID")
+	if _, err := h.storage.GetBusinessAccount(tenantID(r), wabaID); err != nil {
+		writeError(w, r, ErrAccountNotFound, "Account not found")
+		return
+	}
+	changes, err := h.storage.PhoneNumberHistory(tenantID(r), wabaID, phoneNumberID)
+	if err != nil {
+		writeError(w, r, ErrPhoneNumberNotFound, "Phone number not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":         true,
+		"phone_number_id": phoneNumberID,
+		"changes":         changes,
+		"count":           len(changes),
+	})
+}
+
+// GET /api/business/accounts/{wabaID}/phone-numbers/{phoneNumberID}/capacity
+// Business-initiated conversations the number may still open under its
+// messaging limit tier, and how that recovers over the next 24 hours.
+func (h *BusinessHandler) PhoneNumberCapacity(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, h.authz, models.PermissionReadAccounts) {
+		return
+	}
+
+	account, err := h.storage.GetBusinessAccount(tenantID(r), r.PathValue("wabaID"))
+	if err != nil {
+		writeError(w, r, ErrAccountNotFound, "Account not found")
+		return
+	}
+	phone, ok := findPhoneNumber(account, r.PathValue("phoneNumberID"))
+	if !ok {
+		writeError(w, r, ErrPhoneNumberNotFound, "Phone number not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"capacity": h.limits.Capacity(phone),
+	})
+}
+
+// DELETE /api/business/accounts/{wabaID}?force=true
+// Unsubscribes our app from the WABA's webhooks, then removes the account.
+// If Graph rejects the unsubscribe (e.g. the token was revoked) the account
+// is kept unless force is set.
+func (h *BusinessHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, h.authz, models.PermissionDeleteAccounts) {
+		return
+	}
+
+	wabaID := r.PathValue("wabaID")
+	account, err := h.storage.GetBusinessAccount(tenantID(r), wabaID)
+	if err != nil {
+		writeError(w, r, ErrAccountNotFound, "Account not found")
+		return
+	}
+
+	unsubscribed := true
+	if err := h.whatsapp.UnsubscribeWebhooks(r.Context(), account.AccessToken, wabaID); err != nil {
+		if r.URL.Query().Get("force") != "true" {
+			writeGraphError(w, r, ErrWebhookUnsubscribe, "Failed to unsubscribe app from WABA", err)
+			return
+		}
+		slog.WarnContext(r.Context(), "deleting WABA without unsubscribing", "waba_id", wabaID, "error", err)
+		unsubscribed = false
+	}
+
+	if err := h.storage.DeleteBusinessAccount(r.Context(), tenantID(r), wabaID); err != nil {
+		writeError(w, r, ErrAccountNotFound, "Account not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"unsubscribed": unsubscribed,
+	})
+}
+
+// POST /api/business/accounts/{wabaID}/messages
+// Sends a text message from one of the account's phone numbers, by default
+// the first one recorded at onboarding.
+func (h *BusinessHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, h.authz, models.PermissionSendMessages) {
+		return
+	}
+
+	account, err := h.storage.GetBusinessAccount(tenantID(r), r.PathValue("wabaID"))
+	if err != nil {
+		writeError(w, r, ErrAccountNotFound, "Account not found")
+		return
+	}
+
+	req, _, ok := decodeSendMessage(w, r, account)
+	if !ok {
+		return
+	}
+
+	messageID, err := h.whatsapp.SendTextMessage(r.Context(), account.AccessToken, req.PhoneNumberID, req.To, req.Text)
+	if err != nil {
+		h.metrics.OutboundMessage("send_error")
+		writeGraphError(w, r, ErrGraphRequestFailed, "Failed to send message", err)
+		return
+	}
+	h.metrics.OutboundMessage("accepted")
+
+	writeJSON(w, http.StatusOK, models.SendMessageResponse{
+		Success:       true,
+		MessageID:     messageID,
+		PhoneNumberID: req.PhoneNumberID,
 	})
 }
 
+// POST /api/business/accounts/{wabaID}/messages/queue
+// Queues a text message, like SendMessage, to be sent in the background at
+// the phone number's throughput and retried while Meta throttles it. Poll
+// the returned message for its status.
+func (h *BusinessHandler) QueueMessage(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, h.authz, models.PermissionSendMessages) {
+		return
+	}
+
+	account, err := h.storage.GetBusinessAccount(tenantID(r), r.PathValue("wabaID"))
+	if err != nil {
+		writeError(w, r, ErrAccountNotFound, "Account not found")
+		return
+	}
+	req, phone, ok := decodeSendMessage(w, r, account)
+	if !ok {
+		return
+	}
+
+	msg := h.outbound.Enqueue(account, phone, req.To, req.Text, false)
+	writeJSON(w, http.StatusAccepted, models.QueuedMessageResponse{Success: true, Message: msg})
+}
+
+// GET /api/business/accounts/{wabaID}/messages/queue/{messageID}
+func (h *BusinessHandler) GetQueuedMessage(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, h.authz, models.PermissionReadAccounts) {
+		return
+	}
+
+	msg, err := h.outbound.Get(tenantID(r), r.PathValue("wabaID"), r.PathValue("messageID"))
+	if err != nil {
+		writeError(w, r, ErrQueuedMessageNotFound, "Queued message not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.QueuedMessageResponse{Success: true, Message: msg})
+}
+
+// POST /api/business/accounts/{wabaID}/messages/bulk
+// Sends a text message to many recipients within the sending number's
+// messaging limit. Recipients that would open a conversation beyond the
+// tier's remaining capacity fail the whole request, or with on_limit
+// "throttle" are returned as deferred and not sent. With queue the admitted
+// messages go to the outbound queue instead of being sent within the
+// request.
+func (h *BusinessHandler) SendBulkMessages(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, h.authz, models.PermissionSendMessages) {
+		return
+	}
+
+	account, err := h.storage.GetBusinessAccount(tenantID(r), r.PathValue("wabaID"))
+	if err != nil {
+		writeError(w, r, ErrAccountNotFound, "Account not found")
+		return
+	}
+
+	var req models.BulkSendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, ErrInvalidRequest, "Invalid request body")
+		return
+	}
+	if len(req.To) == 0 || req.Text == "" {
+		writeError(w, r, ErrInvalidRequest, "to and text are required")
+		return
+	}
+	if len(req.To) > maxBulkRecipients {
+		writeError(w, r, ErrInvalidRequest, fmt.Sprintf("at most %d recipients per bulk send", maxBulkRecipients))
+		return
+	}
+	if req.OnLimit == "" {
+		req.OnLimit = models.BulkOnLimitReject
+	}
+	if req.OnLimit != models.BulkOnLimitReject && req.OnLimit != models.BulkOnLimitThrottle {
+		writeError(w, r, ErrInvalidRequest, "on_limit must be reject or throttle")
+		return
+	}
+	if req.PhoneNumberID == "" && len(account.PhoneNumbers) > 0 {
+		req.PhoneNumberID = account.PhoneNumbers[0].ID
+	}
+	phone, ok := findPhoneNumber(account, req.PhoneNumberID)
+	if !ok {
+		writeError(w, r, ErrInvalidRequest, "phone_number_id does not belong to this account")
+		return
+	}
+
+	recipients := services.DistinctRecipients(req.To)
+	if len(recipients) == 0 {
+		writeError(w, r, ErrInvalidRequest, "to has no phone numbers")
+		return
+	}
+	if !req.Queue && len(recipients) > maxSyncBulkRecipients {
+		writeError(w, r, ErrInvalidRequest, fmt.Sprintf("at most %d recipients per bulk send without queue", maxSyncBulkRecipients))
+		return
+	}
+	admitted, deferred := h.limits.Reserve(phone, recipients, req.OnLimit == models.BulkOnLimitThrottle)
+	if len(deferred) > 0 && req.OnLimit == models.BulkOnLimitReject {
+		writeErrorDetails(w, r, ErrMessagingLimit, fmt.Sprintf("Sending to %d recipients would exceed the messaging limit", len(recipients)),
+			map[string]any{"capacity": h.limits.Capacity(phone)})
+		return
+	}
+
+	resp := models.BulkSendResponse{
+		Success:       true,
+		PhoneNumberID: phone.ID,
+		Sent:          []models.BulkSendResult{},
+		Failed:        []models.BulkSendResult{},
+		Deferred:      deferred,
+	}
+	for range deferred {
+		h.metrics.OutboundMessage("deferred")
+	}
+	if req.Queue {
+		for _, to := range admitted {
+			resp.Queued = append(resp.Queued, h.outbound.Enqueue(account, phone, to, req.Text, true))
+		}
+		resp.Capacity = h.limits.Capacity(phone)
+		writeJSON(w, http.StatusAccepted, resp)
+		return
+	}
+
+	// The sends can outlast the server's write timeout, and a caller that
+	// loses the response cannot tell which recipients were sent
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	for i, to := range admitted {
+		messageID, err := h.whatsapp.SendTextMessage(r.Context(), account.AccessToken, phone.ID, to, req.Text)
+		if err != nil {
+			h.metrics.OutboundMessage("send_error")
+			h.limits.Release(phone.ID, to)
+			resp.Failed = append(resp.Failed, models.BulkSendResult{To: to, Graph: graphErrorDetails(err)})
+			var graphErr *services.GraphError
+			if r.Context().Err() != nil || (errors.As(err, &graphErr) && (graphErr.RateLimited() || graphErr.TokenInvalid())) {
+				// Every remaining send would fail the same way
+				slog.WarnContext(r.Context(), "bulk send stopped", "phone_number_id", phone.ID, "unsent", len(admitted)-i-1, "error", err)
+				for _, rest := range admitted[i+1:] {
+					h.limits.Release(phone.ID, rest)
+					resp.Failed = append(resp.Failed, models.BulkSendResult{To: rest, Graph: graphErrorDetails(err)})
+				}
+				break
+			}
+			continue
+		}
+		h.metrics.OutboundMessage("accepted")
+		resp.Sent = append(resp.Sent, models.BulkSendResult{To: to, MessageID: messageID})
+	}
+	resp.Capacity = h.limits.Capacity(phone)
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// decodeSendMessage reads a single message send, defaulting to the
+// account's first phone number. It writes the error response when the
+// request is invalid.
+func decodeSendMessage(w http.ResponseWriter, r *http.Request, account *models.BusinessAccount) (models.SendMessageRequest, models.BusinessPhoneNumber, bool) {
+	var req models.SendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, ErrInvalidRequest, "Invalid request body")
+		return req, models.BusinessPhoneNumber{}, false
+	}
+	if req.To == "" || req.Text == "" {
+		writeError(w, r, ErrInvalidRequest, "to and text are required")
+		return req, models.BusinessPhoneNumber{}, false
+	}
+	if req.PhoneNumberID == "" && len(account.PhoneNumbers) > 0 {
+		req.PhoneNumberID = account.PhoneNumbers[0].ID
+	}
+	phone, ok := findPhoneNumber(account, req.PhoneNumberID)
+	if !ok {
+		writeError(w, r, ErrInvalidRequest, "phone_number_id does not belong to this account")
+	}
+	return req, phone, ok
+}
+
+func findPhoneNumber(account *models.BusinessAccount, phoneNumberID string) (models.BusinessPhoneNumber, bool) {
+	for _, phone := range account.PhoneNumbers {
+		if phone.ID == phoneNumberID {
+			return phone, true
+		}
+	}
+	return models.BusinessPhoneNumber{}, false
+}
+
+// GET /api/business/export
 func (h *BusinessHandler) ExportData(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !authorize(w, r, h.authz, models.PermissionExportData) {
 		return
 	}
 
-	data, err := h.storage.ExportData()
+	withTokens := h.authz.Can(services.PrincipalFromContext(r.Context()), models.PermissionViewTokens)
+	data, err := h.storage.ExportData(tenantID(r), withTokens)
 	if err != nil {
-		http.Error(w, "Failed to export data", http.StatusInternalServerError)
+		writeError(w, r, ErrInternal, "Failed to export data")
 		return
 	}
+	h.audit.Record(r.Context(), tenantID(r), models.AuditDataExported, "tenant", tenantID(r), nil,
+		map[string]interface{}{"with_tokens": withTokens})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Disposition", "attachment; filename=whatsapp_accounts.json")
 	w.Write([]byte(data))
 }
+
+// visibleAccount strips the access token unless the caller may view tokens.
+func visibleAccount(r *http.Request, authz *services.Authorizer, account *models.BusinessAccount) *models.BusinessAccount {
+	if authz.Can(services.PrincipalFromContext(r.Context()), models.PermissionViewTokens) {
+		return account
+	}
+	redacted := *account
+	redacted.AccessToken = ""
+	return &redacted
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"back/config"
+	"back/fakegraph"
+	"back/models"
+	"back/services"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type businessFixture struct {
+	graph    *fakegraph.Server
+	token    string
+	authz    *services.Authorizer
+	storage  *services.StorageService
+	outbound *services.OutboundQueue
+	handler  *BusinessHandler
+}
+
+func newBusinessFixture(t *testing.T) *businessFixture {
+	t.Helper()
+	graph := fakegraph.New()
+	t.Cleanup(graph.Close)
+	token := graph.IssueToken()
+	graph.AddPhoneNumber("waba-1", models.FacebookPhoneNumber{ID: "pn-1", DisplayPhoneNumber: "+1 555 0100"})
+
+	cfg := &config.Config{
+		FacebookAppID:       graph.AppID,
+		FacebookAppSecret:   graph.AppSecret,
+		WebhookCallbackURL:  "https://example.test/api/whatsapp/webhooks",
+		GraphAPIBaseURL:     graph.URL,
+		OutboundMaxAttempts: 3,
+	}
+	wa := services.NewWhatsAppService(cfg, services.NewFacebookService(cfg, nil, nil), nil)
+	if err := wa.SetupWebhooks(context.Background(), token, "waba-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := services.NewStorageService(services.NewAuditLog())
+	storage.SaveBusinessAccount(context.Background(), &models.BusinessAccount{
+		TenantID:     models.DefaultTenantID,
+		WABAID:       "waba-1",
+		AccessToken:  token,
+		PhoneNumbers: []models.BusinessPhoneNumber{{ID: "pn-1", PhoneNumber: "+1 555 0100"}},
+	})
+	authz := services.NewAuthorizer()
+	limits := services.NewMessagingLimits()
+	outbound, err := services.NewOutboundQueue(cfg, wa, storage, limits, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &businessFixture{
+		graph:    graph,
+		token:    token,
+		authz:    authz,
+		storage:  storage,
+		outbound: outbound,
+		handler:  NewBusinessHandler(storage, wa, limits, outbound, authz, services.NewAuditLog(), nil),
+	}
+}
+
+func accountRequest(method, path, wabaID string, role models.Role) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	req.SetPathValue("wabaID", wabaID)
+	return asRole(req, role)
+}
+
+func asRole(req *http.Request, role models.Role) *http.Request {
+	return req.WithContext(services.WithPrincipal(req.Context(), &models.Principal{
+		ID:       "key_" + string(role),
+		TenantID: models.DefaultTenantID,
+		Role:     role,
+	}))
+}
+
+func TestBusinessHandlerRedactsTokensByRole(t *testing.T) {
+	h := newBusinessFixture(t).handler
+
+	for role, wantToken := range map[models.Role]bool{models.RoleOwner: true, models.RoleAdmin: false, models.RoleReadOnly: false} {
+		rec := httptest.NewRecorder()
+		h.GetAccount(rec, accountRequest(http.MethodGet, "/api/business/accounts/waba-1", "waba-1", role))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", role, rec.Code)
+		}
+		var resp struct {
+			Account models.BusinessAccount `json:"account"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if got := resp.Account.AccessToken != ""; got != wantToken {
+			t.Errorf("%s: token visible = %v, want %v", role, got, wantToken)
+		}
+	}
+}
+
+func TestBusinessHandlerOmitsUnsetTokenTimes(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newBusinessFixture(t).handler.GetAccount(rec, accountRequest(http.MethodGet, "/api/business/accounts/waba-1", "waba-1", models.RoleOwner))
+	for _, field := range []string{"token_expires_at", "token_refreshed_at"} {
+		if strings.Contains(rec.Body.String(), field) {
+			t.Errorf("response has %s for a token that never expires: %s", field, rec.Body.String())
+		}
+	}
+}
+
+func TestBusinessHandlerExportRequiresPermission(t *testing.T) {
+	f := newBusinessFixture(t)
+	h, authz := f.handler, f.authz
+
+	rec := httptest.NewRecorder()
+	h.ExportData(rec, asRole(httptest.NewRequest(http.MethodGet, "/api/business/export", nil), models.RoleAgent))
+	expectError(t, rec, ErrForbidden)
+	if denials := authz.Denials(models.DefaultTenantID); len(denials) != 1 || denials[0].Permission != models.PermissionExportData {
+		t.Errorf("denials = %+v", denials)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ExportData(rec, asRole(httptest.NewRequest(http.MethodGet, "/api/business/export", nil), models.RoleAdmin))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin export: status %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), f.token) {
+		t.Error("admin export contains the access token")
+	}
+}
+
+func TestBusinessHandlerPhoneNumbers(t *testing.T) {
+	h := newBusinessFixture(t).handler
+
+	rec := httptest.NewRecorder()
+	h.ListPhoneNumbers(rec, accountRequest(http.MethodGet, "/api/business/accounts/waba-1/phone-numbers", "waba-1", models.RoleReadOnly))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"pn-1"`) {
+		t.Errorf("status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ListPhoneNumbers(rec, accountRequest(http.MethodGet, "/api/business/accounts/waba-2/phone-numbers", "waba-2", models.RoleReadOnly))
+	expectError(t, rec, ErrAccountNotFound)
+}
+
+func TestBusinessHandlerDeleteUnsubscribesApp(t *testing.T) {
+	f := newBusinessFixture(t)
+
+	rec := httptest.NewRecorder()
+	f.handler.DeleteAccount(rec, accountRequest(http.MethodDelete, "/api/business/accounts/waba-1", "waba-1", models.RoleAdmin))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("admin delete: status %d, want 403", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	f.handler.DeleteAccount(rec, accountRequest(http.MethodDelete, "/api/business/accounts/waba-1", "waba-1", models.RoleOwner))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("owner delete: status %d %s", rec.Code, rec.Body.String())
+	}
+	if subscribed, _ := f.graph.Subscribed("waba-1"); subscribed {
+		t.Error("app still subscribed to the WABA")
+	}
+
+	rec = httptest.NewRecorder()
+	f.handler.GetAccount(rec, accountRequest(http.MethodGet, "/api/business/accounts/waba-1", "waba-1", models.RoleOwner))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("deleted account still readable: status %d", rec.Code)
+	}
+}
+
+func TestBusinessHandlerDeleteKeepsAccountWhenUnsubscribeFails(t *testing.T) {
+	f := newBusinessFixture(t)
+	f.graph.RevokeToken(f.token)
+
+	rec := httptest.NewRecorder()
+	f.handler.DeleteAccount(rec, accountRequest(http.MethodDelete, "/api/business/accounts/waba-1", "waba-1", models.RoleOwner))
+	// Revoked tokens are reported as such so the client can re-authenticate
+	if resp := expectError(t, rec, ErrGraphTokenInvalid); resp.Error.Graph == nil || resp.Error.Graph.Code != 190 {
+		t.Fatalf("graph details = %+v", resp.Error.Graph)
+	}
+
+	rec = httptest.NewRecorder()
+	f.handler.DeleteAccount(rec, accountRequest(http.MethodDelete, "/api/business/accounts/waba-1?force=true", "waba-1", models.RoleOwner))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"unsubscribed":false`) {
+		t.Errorf("forced delete: status %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func bulkRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/business/accounts/waba-1/messages/bulk", strings.NewReader(body))
+	req.SetPathValue("wabaID", "waba-1")
+	return asRole(req, models.RoleAgent)
+}
+
+func TestBusinessHandlerBulkSendRespectsMessagingLimit(t *testing.T) {
+	f := newBusinessFixture(t)
+	f.storage.UpdateBusinessAccount(context.Background(), models.DefaultTenantID, "waba-1", func(account *models.BusinessAccount) error {
+		account.PhoneNumbers[0].MessagingLimitTier = "TIER_50"
+		return nil
+	})
+	recipients := make([]string, 51)
+	for i := range recipients {
+		recipients[i] = fmt.Sprintf("1555%04d", i)
+	}
+	to, _ := json.Marshal(recipients)
+
+	rec := httptest.NewRecorder()
+	f.handler.SendBulkMessages(rec, bulkRequest(`{"text": "Sale!", "to": `+string(to)+`}`))
+	if resp := expectError(t, rec, ErrMessagingLimit); resp.Error.Details["capacity"] == nil {
+		t.Errorf("details = %+v", resp.Error.Details)
+	}
+	if n := f.graph.RequestCount(fakegraph.RouteMessages); n != 0 {
+		t.Fatalf("rejected bulk send made %d requests", n)
+	}
+
+	rec = httptest.NewRecorder()
+	f.handler.SendBulkMessages(rec, bulkRequest(`{"text": "Sale!", "on_limit": "throttle", "to": `+string(to)+`}`))
+	var resp models.BulkSendResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Sent) != 50 || len(resp.Deferred) != 1 || resp.Deferred[0] != recipients[50] {
+		t.Fatalf("status %d, sent %d, deferred %v", rec.Code, len(resp.Sent), resp.Deferred)
+	}
+	if resp.Capacity.Remaining != 0 || resp.Capacity.Pending != 50 {
+		t.Errorf("capacity = %+v", resp.Capacity)
+	}
+}
+
+func TestBusinessHandlerBulkSendStopsOnRevokedToken(t *testing.T) {
+	f := newBusinessFixture(t)
+	f.graph.RevokeToken(f.token)
+
+	rec := httptest.NewRecorder()
+	f.handler.SendBulkMessages(rec, bulkRequest(`{"text": "Sale!", "to": ["15550001", "15550002", "15550003"]}`))
+	var resp models.BulkSendResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Failed) != 3 || resp.Failed[2].Graph == nil || resp.Failed[2].Graph.Code != 190 {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+	}
+	if n := f.graph.RequestCount(fakegraph.RouteMessages); n != 1 {
+		t.Errorf("messages requests = %d, want 1", n)
+	}
+	if resp.Capacity.Used != 0 {
+		t.Errorf("failed sends still hold capacity: %+v", resp.Capacity)
+	}
+}
+
+func TestBusinessHandlerQueuedMessage(t *testing.T) {
+	f := newBusinessFixture(t)
+
+	req := asRole(httptest.NewRequest(http.MethodPost, "/api/business/accounts/waba-1/messages/queue",
+		strings.NewReader(`{"to": "15550001", "text": "Hello"}`)), models.RoleAgent)
+	req.SetPathValue("wabaID", "waba-1")
+	rec := httptest.NewRecorder()
+	f.handler.QueueMessage(rec, req)
+	var queued models.QueuedMessageResponse
+	json.Unmarshal(rec.Body.Bytes(), &queued)
+	if rec.Code != http.StatusAccepted || queued.Message.Status != models.OutboundQueued || queued.Message.PhoneNumberID != "pn-1" {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go f.outbound.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		f.outbound.Shutdown(context.Background())
+	})
+
+	get := func(wabaID string) *httptest.ResponseRecorder {
+		req := accountRequest(http.MethodGet, "/api/business/accounts/"+wabaID+"/messages/queue/"+queued.Message.ID, wabaID, models.RoleReadOnly)
+		req.SetPathValue("messageID", queued.Message.ID)
+		rec := httptest.NewRecorder()
+		f.handler.GetQueuedMessage(rec, req)
+		return rec
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := get("waba-1")
+		var resp models.QueuedMessageResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+		}
+		if resp.Message.Status == models.OutboundSent {
+			if resp.Message.MessageID == "" || resp.Message.Attempts != 1 {
+				t.Errorf("sent message = %+v", resp.Message)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("message still %s", resp.Message.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	expectError(t, get("waba-2"), ErrQueuedMessageNotFound)
+}
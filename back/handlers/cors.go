@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy says which browser origins may call a set of routes and how.
+type CORSPolicy struct {
+	// Exact origins ("https://app.example.com"), wildcard subdomain patterns
+	// ("https://*.example.com", which does not match the bare domain) or "*"
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration // How long browsers may cache a preflight
+}
+
+// CORSRoute applies a policy to every path starting with Prefix. A nil
+// Policy excludes the paths from CORS entirely.
+type CORSRoute struct {
+	Prefix string
+	Policy *CORSPolicy
+}
+
+// CORS answers preflight requests and adds CORS headers to responses. The
+// route with the longest matching prefix wins; other paths use fallback.
+// Disallowed origins get no CORS headers, so browsers block the response.
+func CORS(fallback *CORSPolicy, routes []CORSRoute, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policy, matched := fallback, ""
+		for _, route := range routes {
+			if strings.HasPrefix(r.URL.Path, route.Prefix) && len(route.Prefix) > len(matched) {
+				policy, matched = route.Policy, route.Prefix
+			}
+		}
+		if policy == nil {
+			next(w, r)
+			return
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		header := w.Header()
+		// Responses differ per origin, so caches must key on it
+		header.Add("Vary", "Origin")
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && policy.allows(origin)
+		if allowed {
+			if policy.AllowCredentials || !policy.allowsAny() {
+				header.Set("Access-Control-Allow-Origin", origin)
+			} else {
+				header.Set("Access-Control-Allow-Origin", "*")
+			}
+			if policy.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			if allowed && len(policy.ExposedHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+			}
+			next(w, r)
+			return
+		}
+
+		if allowed {
+			header.Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+			header.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+			if policy.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (p *CORSPolicy) allowsAny() bool {
+	for _, pattern := range p.AllowedOrigins {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CORSPolicy) allows(origin string) bool {
+	for _, pattern := range p.AllowedOrigins {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin reports whether origin matches an exact origin, "*" or a
+// "scheme://*.domain" pattern. Ports must match exactly.
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" || strings.EqualFold(pattern, origin) {
+		return true
+	}
+	scheme, domain, ok := strings.Cut(pattern, "://*.")
+	if !ok {
+		return false
+	}
+	originScheme, host, ok := strings.Cut(origin, "://")
+	if !ok || !strings.EqualFold(scheme, originScheme) {
+		return false
+	}
+	sub, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(domain))
+	return ok && sub != "" && !strings.ContainsAny(sub, "/:@")
+}
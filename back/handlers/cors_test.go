@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	cases := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "https://app.example.com:8443", false},
+		{"https://*.example.com", "https://a.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "http://a.example.com", false},
+		{"https://*.example.com", "https://a.example.com:8443", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com:8443", "https://a.example.com:8443", true},
+		{"*", "https://anything.test", true},
+	}
+	for _, tc := range cases {
+		if got := matchOrigin(tc.pattern, tc.origin); got != tc.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tc.pattern, tc.origin, got, tc.want)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	api := &CORSPolicy{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Authorization"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	public := &CORSPolicy{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}}
+	reached := false
+	h := CORS(api, []CORSRoute{{Prefix: "/healthz", Policy: public}, {Prefix: "/api/whatsapp/webhooks"}},
+		func(w http.ResponseWriter, r *http.Request) { reached = true })
+
+	do := func(method, path, origin string, preflight bool) *httptest.ResponseRecorder {
+		reached = false
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodOptions, "/api/business/accounts", "https://app.example.com", true)
+	if rec.Code != http.StatusNoContent || reached {
+		t.Fatalf("preflight: status %d, reached handler %v", rec.Code, reached)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "Authorization",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("preflight %s = %q, want %q", header, got, want)
+		}
+	}
+	if vary := rec.Header().Values("Vary"); len(vary) != 3 || vary[0] != "Origin" {
+		t.Errorf("preflight Vary = %v", vary)
+	}
+
+	rec = do(http.MethodGet, "/api/business/accounts", "https://app.example.com", false)
+	if !reached || rec.Header().Get("Access-Control-Expose-Headers") != "X-Request-ID" || rec.Header().Get("Vary") != "Origin" {
+		t.Errorf("simple request: reached %v, headers %v", reached, rec.Header())
+	}
+
+	rec = do(http.MethodOptions, "/api/business/accounts", "https://evil.test", true)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" || rec.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("disallowed origin got CORS headers: %v", rec.Header())
+	}
+
+	rec = do(http.MethodGet, "/healthz", "https://evil.test", false)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "*" || rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("public route headers: %v", rec.Header())
+	}
+
+	rec = do(http.MethodOptions, "/api/whatsapp/webhooks", "https://app.example.com", true)
+	if !reached || len(rec.Header()) != 0 {
+		t.Errorf("excluded route: reached %v, headers %v", reached, rec.Header())
+	}
+}
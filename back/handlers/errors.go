@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"back/models"
+	"back/services"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// ErrorCode is a machine-readable API error and the HTTP status it is sent
+// with. Codes are part of the API contract: never rename one, and document
+// new ones in ERRORS.md.
+type ErrorCode struct {
+	Code   string
+	Status int
+}
+
+var (
+	ErrInvalidRequest        = ErrorCode{"invalid_request", http.StatusBadRequest}
+	ErrInvalidJSON           = ErrorCode{"invalid_json", http.StatusBadRequest}
+	ErrUnknownApp            = ErrorCode{"unknown_app", http.StatusBadRequest}
+	ErrUnauthenticated       = ErrorCode{"unauthenticated", http.StatusUnauthorized}
+	ErrInvalidSignature      = ErrorCode{"invalid_signature", http.StatusUnauthorized}
+	ErrForbidden             = ErrorCode{"forbidden", http.StatusForbidden}
+	ErrVerificationFailed    = ErrorCode{"verification_failed", http.StatusForbidden}
+	ErrNotFound              = ErrorCode{"not_found", http.StatusNotFound}
+	ErrAccountNotFound       = ErrorCode{"account_not_found", http.StatusNotFound}
+	ErrSubscriptionNotFound  = ErrorCode{"subscription_not_found", http.StatusNotFound}
+	ErrAPIKeyNotFound        = ErrorCode{"api_key_not_found", http.StatusNotFound}
+	ErrWebhookEventNotFound  = ErrorCode{"webhook_event_not_found", http.StatusNotFound}
+	ErrWABANotFound          = ErrorCode{"waba_not_found", http.StatusNotFound}
+	ErrPhoneNumbersNotFound  = ErrorCode{"phone_numbers_not_found", http.StatusNotFound}
+	ErrPhoneNumberNotFound   = ErrorCode{"phone_number_not_found", http.StatusNotFound}
+	ErrQueuedMessageNotFound = ErrorCode{"queued_message_not_found", http.StatusNotFound}
+	ErrMethodNotAllowed      = ErrorCode{"method_not_allowed", http.StatusMethodNotAllowed}
+	ErrAccountClaimed        = ErrorCode{"account_claimed", http.StatusConflict}
+	ErrReplayRejected        = ErrorCode{"replay_rejected", http.StatusConflict}
+	ErrRequestTooLarge       = ErrorCode{"request_too_large", http.StatusRequestEntityTooLarge}
+	ErrMessagingLimit        = ErrorCode{"messaging_limit_exceeded", http.StatusTooManyRequests}
+	ErrTokenExchangeFailed   = ErrorCode{"token_exchange_failed", http.StatusBadRequest}
+	ErrGraphRateLimited      = ErrorCode{"graph_rate_limited", http.StatusTooManyRequests}
+	ErrGraphTokenInvalid     = ErrorCode{"graph_token_invalid", http.StatusBadGateway}
+	ErrGraphRequestFailed    = ErrorCode{"graph_request_failed", http.StatusBadGateway}
+	ErrWebhookUnsubscribe    = ErrorCode{"webhook_unsubscribe_failed", http.StatusBadGateway}
+	ErrInternal              = ErrorCode{"internal_error", http.StatusInternalServerError}
+)
+
+// ErrorCodes lists every code the API can return.
+var ErrorCodes = []ErrorCode{
+	ErrInvalidRequest, ErrInvalidJSON, ErrUnknownApp, ErrUnauthenticated, ErrInvalidSignature,
+	ErrForbidden, ErrVerificationFailed, ErrNotFound, ErrAccountNotFound,
+	ErrSubscriptionNotFound, ErrAPIKeyNotFound, ErrWebhookEventNotFound,
+	ErrWABANotFound, ErrPhoneNumbersNotFound, ErrPhoneNumberNotFound, ErrQueuedMessageNotFound, ErrMethodNotAllowed,
+	ErrAccountClaimed, ErrReplayRejected, ErrRequestTooLarge, ErrMessagingLimit, ErrTokenExchangeFailed,
+	ErrGraphRateLimited, ErrGraphTokenInvalid, ErrGraphRequestFailed,
+	ErrWebhookUnsubscribe, ErrInternal,
+}
+
+// writeError sends the standard error envelope, tagged with the request ID.
+func writeError(w http.ResponseWriter, r *http.Request, code ErrorCode, message string) {
+	writeErrorBody(w, r, code, models.APIError{Message: message})
+}
+
+// writeErrorDetails is writeError with extra structured context.
+func writeErrorDetails(w http.ResponseWriter, r *http.Request, code ErrorCode, message string, details map[string]any) {
+	writeErrorBody(w, r, code, models.APIError{Message: message, Details: details})
+}
+
+// writeGraphError reports a failed Graph API call. Throttling and revoked
+// tokens get their own codes so clients can back off or re-authenticate;
+// anything else is sent as fallback. The full error is only logged.
+func writeGraphError(w http.ResponseWriter, r *http.Request, fallback ErrorCode, message string, err error) {
+	slog.WarnContext(r.Context(), "graph request failed", "operation", message, "error", err)
+
+	apiErr := models.APIError{Message: message, Graph: graphErrorDetails(err)}
+	code := fallback
+	var graphErr *services.GraphError
+	if errors.As(err, &graphErr) {
+		switch {
+		case graphErr.RateLimited():
+			code = ErrGraphRateLimited
+		case graphErr.TokenInvalid() && fallback != ErrTokenExchangeFailed:
+			code = ErrGraphTokenInvalid
+		}
+	}
+	writeErrorBody(w, r, code, apiErr)
+}
+
+// graphErrorDetails is the part of a Graph error that is safe to return, or
+// nil if err did not come from Graph.
+func graphErrorDetails(err error) *models.GraphErrorDetails {
+	var graphErr *services.GraphError
+	if !errors.As(err, &graphErr) {
+		return nil
+	}
+	return &models.GraphErrorDetails{
+		Status:    graphErr.Status,
+		Type:      graphErr.Type,
+		Code:      graphErr.Code,
+		Subcode:   graphErr.Subcode,
+		FBTraceID: graphErr.FBTraceID,
+	}
+}
+
+func writeErrorBody(w http.ResponseWriter, r *http.Request, code ErrorCode, apiErr models.APIError) {
+	apiErr.Code = code.Code
+	apiErr.RequestID = services.RequestInfoFromContext(r.Context()).ID
+	writeJSON(w, code.Status, models.ErrorResponse{Success: false, Error: apiErr})
+}
+
+// WithJSONErrors answers requests that match no route with the error
+// envelope instead of the mux's plain-text 404 and 405 pages. The mux still
+// decides which applies, so the Allow header on 405s is preserved.
+func WithJSONErrors(mux *http.ServeMux) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		capture := &statusCapture{header: http.Header{}}
+		h.ServeHTTP(capture, r)
+		switch capture.status {
+		case http.StatusNotFound:
+			writeError(w, r, ErrNotFound, "No route for "+r.URL.Path)
+		case http.StatusMethodNotAllowed:
+			w.Header().Set("Allow", capture.header.Get("Allow"))
+			writeError(w, r, ErrMethodNotAllowed, r.Method+" is not supported for "+r.URL.Path)
+		default:
+			// Redirects from path cleaning pass through untouched.
+			mux.ServeHTTP(w, r)
+		}
+	}
+}
+
+// statusCapture records the status and headers of a response it discards.
+type statusCapture struct {
+	header http.Header
+	status int
+}
+
+func (c *statusCapture) Header() http.Header { return c.header }
+
+func (c *statusCapture) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *statusCapture) Write(b []byte) (int, error) {
+	c.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
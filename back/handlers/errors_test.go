@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"back/models"
+	"back/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// expectError checks rec holds the error envelope for code.
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, code ErrorCode) models.ErrorResponse {
+	t.Helper()
+	var resp models.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode error response %q: %v", rec.Body.String(), err)
+	}
+	if rec.Code != code.Status || resp.Success || resp.Error.Code != code.Code || resp.Error.Message == "" {
+		t.Errorf("want %s (%d), got status %d, body %s", code.Code, code.Status, rec.Code, rec.Body.String())
+	}
+	return resp
+}
+
+func TestErrorCodesAreDocumented(t *testing.T) {
+	doc, err := os.ReadFile("../ERRORS.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range ErrorCodes {
+		if seen[code.Code] {
+			t.Errorf("duplicate code %s", code.Code)
+		}
+		seen[code.Code] = true
+		if !strings.Contains(string(doc), "`"+code.Code+"`") {
+			t.Errorf("%s is not documented in ERRORS.md", code.Code)
+		}
+	}
+}
+
+func TestErrorEnvelopeIncludesRequestID(t *testing.T) {
+	handler := WithRequestInfo(false, func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, ErrAccountNotFound, "Account not found")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api/business/accounts/x", nil)
+	req.Header.Set(RequestIDHeader, "trace-123")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	resp := expectError(t, rec, ErrAccountNotFound)
+	if resp.Error.RequestID != "trace-123" {
+		t.Errorf("request_id = %q", resp.Error.RequestID)
+	}
+}
+
+func TestGraphErrorMapping(t *testing.T) {
+	cases := []struct {
+		err  error
+		want ErrorCode
+	}{
+		{&services.GraphError{Status: 400, Code: 131056}, ErrGraphRateLimited},
+		{&services.GraphError{Status: 401, Code: 190}, ErrGraphTokenInvalid},
+		{&services.GraphError{Status: 500, Code: 2}, ErrGraphRequestFailed},
+		{http.ErrHandlerTimeout, ErrGraphRequestFailed},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		writeGraphError(rec, httptest.NewRequest(http.MethodGet, "/", nil), ErrGraphRequestFailed, "Graph call failed", c.err)
+		expectError(t, rec, c.want)
+	}
+}
+
+func TestUnmatchedRoutesUseEnvelope(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/things", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+	})
+	handler := WithJSONErrors(mux)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/nope", nil))
+	expectError(t, rec, ErrNotFound)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/api/things", nil))
+	expectError(t, rec, ErrMethodNotAllowed)
+	if allow := rec.Header().Get("Allow"); !strings.Contains(allow, http.MethodGet) {
+		t.Errorf("Allow = %q", allow)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/things", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("matched route: status %d", rec.Code)
+	}
+}
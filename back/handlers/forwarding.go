@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"back/models"
+	"back/services"
+	"encoding/json"
+	"net/http"
+)
+
+type ForwardingHandler struct {
+	forwarding *services.ForwardingService
+	audit      *services.AuditLog
+}
+
+func NewForwardingHandler(forwarding *services.ForwardingService, audit *services.AuditLog) *ForwardingHandler {
+	return &ForwardingHandler{forwarding: forwarding, audit: audit}
+}
+
+type forwardingSubscriptionRequest struct {
+	TargetURL  string   `json:"target_url"`
+	EventTypes []string `json:"event_types"`
+	WABAIDs    []string `json:"waba_ids"`
+	Enabled    *bool    `json:"enabled,omitempty"`
+}
+
+// GET /api/forwarding/subscriptions
+func (h *ForwardingHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.forwarding.ListSubscriptions(tenantID(r))
+	if err != nil {
+		writeError(w, r, ErrInternal, "Failed to fetch subscriptions")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"subscriptions": subs,
+		"count":         len(subs),
+	})
+}
+
+// POST /api/forwarding/subscriptions
+func (h *ForwardingHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var req forwardingSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, ErrInvalidRequest, "Invalid request body")
+		return
+	}
+	sub, err := h.forwarding.CreateSubscription(&models.ForwardingSubscription{
+		TenantID:   tenantID(r),
+		TargetURL:  req.TargetURL,
+		EventTypes: req.EventTypes,
+		WABAIDs:    req.WABAIDs,
+	})
+	if err != nil {
+		writeError(w, r, ErrInvalidRequest, err.Error())
+		return
+	}
+	h.audit.Record(r.Context(), tenantID(r), models.AuditSubscriptionCreated, "forwarding_subscription", sub.ID, nil, sub)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"success":      true,
+		"subscription": sub,
+	})
+}
+
+// GET /api/forwarding/subscriptions/{id}
+func (h *ForwardingHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.forwarding.GetSubscription(tenantID(r), r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, ErrSubscriptionNotFound, "Subscription not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "subscription": sub})
+}
+
+// PUT /api/forwarding/subscriptions/{id}
+func (h *ForwardingHandler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	tenant := tenantID(r)
+
+	current, err := h.forwarding.GetSubscription(tenant, id)
+	if err != nil {
+		writeError(w, r, ErrSubscriptionNotFound, "Subscription not found")
+		return
+	}
+	var req forwardingSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, ErrInvalidRequest, "Invalid request body")
+		return
+	}
+	enabled := current.Enabled
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	sub, err := h.forwarding.UpdateSubscription(tenant, id, &models.ForwardingSubscription{
+		TargetURL:  req.TargetURL,
+		EventTypes: req.EventTypes,
+		WABAIDs:    req.WABAIDs,
+		Enabled:    enabled,
+	})
+	if err != nil {
+		writeError(w, r, ErrInvalidRequest, err.Error())
+		return
+	}
+	h.audit.Record(r.Context(), tenant, models.AuditSubscriptionUpdated, "forwarding_subscription", id, current, sub)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "subscription": sub})
+}
+
+// DELETE /api/forwarding/subscriptions/{id}
+func (h *ForwardingHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	tenant := tenantID(r)
+
+	current, err := h.forwarding.GetSubscription(tenant, id)
+	if err != nil {
+		writeError(w, r, ErrSubscriptionNotFound, "Subscription not found")
+		return
+	}
+	if err := h.forwarding.DeleteSubscription(tenant, id); err != nil {
+		writeError(w, r, ErrSubscriptionNotFound, "Subscription not found")
+		return
+	}
+	h.audit.Record(r.Context(), tenant, models.AuditSubscriptionDeleted, "forwarding_subscription", id, current, nil)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// GET /api/forwarding/subscriptions/{id}/deliveries
+func (h *ForwardingHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := h.forwarding.Deliveries(tenantID(r), r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, ErrSubscriptionNotFound, "Subscription not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"back/models"
+	"back/services"
+	"net/http"
+)
+
+type HealthHandler struct {
+	health *services.HealthService
+}
+
+func NewHealthHandler(health *services.HealthService) *HealthHandler {
+	return &HealthHandler{health: health}
+}
+
+// GET /healthz (and the older GET /health)
+// Liveness: the process is up and serving. Dependencies are not checked, so
+// orchestrators do not restart the server over an outage elsewhere.
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.health.Liveness())
+}
+
+// GET /readyz
+// Readiness: 503 while a critical check fails so load balancers stop
+// routing traffic here. Degraded still answers 200.
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	resp := h.health.Readiness(r.Context())
+	status := http.StatusOK
+	if resp.Status == models.HealthUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
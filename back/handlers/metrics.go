@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"back/services"
+	"log/slog"
+	"net/http"
+)
+
+// ServeMetrics exposes metrics in the Prometheus text format.
+// GET /metrics
+func ServeMetrics(metrics *services.Metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := metrics.WritePrometheus(w); err != nil {
+			slog.WarnContext(r.Context(), "failed to write metrics", "error", err)
+		}
+	}
+}
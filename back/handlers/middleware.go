@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"back/models"
+	"back/services"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// WithRequestInfo assigns each request an ID, echoed in X-Request-ID, and
+// records it with the client IP in the request context. A well-formed
+// incoming X-Request-ID is kept so IDs can be traced across proxies.
+// The trace ID of a valid W3C traceparent header is kept as well, so log
+// lines can be joined with the caller's traces.
+// X-Forwarded-For is only trusted when trustProxy is set.
+func WithRequestInfo(trustProxy bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		info := services.RequestInfo{
+			ID:      id,
+			IP:      clientIP(r, trustProxy),
+			TraceID: traceIDFromHeader(r.Header.Get("traceparent")),
+		}
+		if info.TraceID == "" {
+			info.TraceID = newTraceID()
+		}
+		next(w, r.WithContext(services.WithRequestInfo(r.Context(), info)))
+	}
+}
+
+// LimitBody rejects request bodies larger than max bytes. Declared lengths
+// are refused up front; chunked bodies fail when read past the limit.
+func LimitBody(max int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if max <= 0 {
+			next(w, r)
+			return
+		}
+		if r.ContentLength > max {
+			// The unread body would otherwise be parsed as the next request
+			w.Header().Set("Connection", "close")
+			writeError(w, r, ErrRequestTooLarge, fmt.Sprintf("Request body exceeds %d bytes", max))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		next(w, r)
+	}
+}
+
+// LogRequests writes one access log line per request. Only the path is
+// logged: query strings may carry access_token. Server errors are logged at
+// error level, client errors at warn.
+func LogRequests(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case rec.status >= 400:
+			level = slog.LevelWarn
+		}
+		slog.Log(r.Context(), level, "http request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"ip", services.RequestInfoFromContext(r.Context()).IP)
+	}
+}
+
+// responseRecorder records the status and size of a response it passes on.
+// Unwrap lets http.ResponseController reach the underlying writer, which
+// event streams need for flushing.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *responseRecorder) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *responseRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func newRequestID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "req_" + hex.EncodeToString(b)
+}
+
+func newTraceID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// traceIDFromHeader extracts the trace ID from a version 00 traceparent
+// ("00-<32 hex trace ID>-<16 hex span ID>-<2 hex flags>").
+func traceIDFromHeader(traceparent string) string {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ""
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil || parts[1] != strings.ToLower(parts[1]) {
+		return ""
+	}
+	if parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	return parts[1]
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RequireAuth rejects requests without a valid API key or session token and
+// attaches the authenticated principal to the request context. Credentials
+// are read from "Authorization: Bearer", X-API-Key, or, on the event stream
+// only, the access_token query parameter, since EventSource clients cannot
+// set headers. Elsewhere it would only leak keys into URLs and logs.
+func RequireAuth(auth *services.AuthService, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := auth.Authenticate(credentialFromRequest(r))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeError(w, r, ErrUnauthenticated, "Authentication required")
+			return
+		}
+		next(w, r.WithContext(services.WithPrincipal(r.Context(), principal)))
+	}
+}
+
+func credentialFromRequest(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if r.Method == http.MethodGet && r.URL.Path == eventStreamPath {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// tenantID returns the tenant of the authenticated caller. Requests that
+// never passed RequireAuth act on the default tenant.
+func tenantID(r *http.Request) string {
+	if principal := services.PrincipalFromContext(r.Context()); principal != nil && principal.TenantID != "" {
+		return principal.TenantID
+	}
+	return models.DefaultTenantID
+}
+
+// RedirectToHTTPS answers every plain HTTP request with a permanent redirect
+// to the same URL on the HTTPS port. 308 keeps the method and body, so
+// webhook POSTs sent to the wrong scheme are not turned into GETs.
+func RedirectToHTTPS(httpsPort string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"back/config"
+	"back/models"
+	"back/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequireAuth(t *testing.T) {
+	auth, _ := services.NewAuthService(&config.Config{AuthSigningKey: strings.Repeat("k", 32), AuthSessionTTL: time.Hour})
+	raw, key, _ := auth.CreateAPIKey(models.DefaultTenantID, "test", models.RoleAdmin)
+
+	var seen string
+	protected := RequireAuth(auth, func(w http.ResponseWriter, r *http.Request) {
+		seen = services.PrincipalFromContext(r.Context()).ID
+	})
+
+	cases := []struct {
+		name   string
+		setup  func(r *http.Request)
+		status int
+	}{
+		{"missing", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"wrong key", func(r *http.Request) { r.Header.Set("Authorization", "Bearer wak_nope") }, http.StatusUnauthorized},
+		{"bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+raw) }, http.StatusOK},
+		{"x-api-key", func(r *http.Request) { r.Header.Set("X-API-Key", raw) }, http.StatusOK},
+		{"query", func(r *http.Request) { r.URL.RawQuery = "access_token=" + raw }, http.StatusUnauthorized},
+		{"query on the event stream", func(r *http.Request) { r.URL.Path, r.URL.RawQuery = "/api/events/stream", "access_token="+raw }, http.StatusOK},
+		{"query on a mutation", func(r *http.Request) { r.Method, r.URL.RawQuery = http.MethodPost, "access_token="+raw }, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		seen = ""
+		req := httptest.NewRequest(http.MethodGet, "/api/business/accounts", nil)
+		tc.setup(req)
+		rec := httptest.NewRecorder()
+		protected(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.name, rec.Code, tc.status)
+		}
+		if tc.status == http.StatusOK && seen != key.ID {
+			t.Errorf("%s: principal %q not attached", tc.name, seen)
+		}
+	}
+}
+
+func TestTraceIDFromHeader(t *testing.T) {
+	cases := map[string]string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": "",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01": "",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": "",
+		"garbage": "",
+		"":        "",
+	}
+	for header, want := range cases {
+		if got := traceIDFromHeader(header); got != want {
+			t.Errorf("traceIDFromHeader(%q) = %q, want %q", header, got, want)
+		}
+	}
+
+	var info services.RequestInfo
+	handler := WithRequestInfo(false, func(w http.ResponseWriter, r *http.Request) {
+		info = services.RequestInfoFromContext(r.Context())
+	})
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	handler(httptest.NewRecorder(), req)
+	if len(info.TraceID) != 32 {
+		t.Errorf("no trace ID generated: %+v", info)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	cases := []struct {
+		port, url, want string
+	}{
+		{"8443", "http://example.test:8080/api/whatsapp/webhooks?a=1", "https://example.test:8443/api/whatsapp/webhooks?a=1"},
+		{"443", "http://example.test/healthz", "https://example.test/healthz"},
+		{"8443", "http://[::1]:8080/", "https://[::1]:8443/"},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		RedirectToHTTPS(tc.port)(rec, httptest.NewRequest(http.MethodPost, tc.url, nil))
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != tc.want {
+			t.Errorf("%s: status %d, location %q, want %q", tc.url, rec.Code, rec.Header().Get("Location"), tc.want)
+		}
+	}
+}
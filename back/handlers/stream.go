@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"back/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const streamHeartbeatInterval = 25 * time.Second
+
+// eventStreamPath is the one route accepting the access_token query parameter.
+const eventStreamPath = "/api/events/stream"
+
+type StreamHandler struct {
+	stream *services.EventStream
+}
+
+func NewStreamHandler(stream *services.EventStream) *StreamHandler {
+	return &StreamHandler{stream: stream}
+}
+
+// GET /api/events/stream?waba_id=&types=
+// Server-Sent Events. Each event carries its sequence as the SSE id, so
+// browsers resume automatically via Last-Event-ID after a reconnect.
+func (h *StreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	filter := newStreamFilter(r)
+	filter.tenantID = tenantID(r)
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var lastSeq uint64
+	if lastID != "" {
+		var err error
+		if lastSeq, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+			writeError(w, r, ErrInvalidRequest, "Invalid Last-Event-ID")
+			return
+		}
+	}
+
+	// The stream outlives the server's write timeout by design
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	missed, gap, events, cancel := h.stream.Subscribe(lastSeq)
+	defer cancel()
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if gap {
+		// Tell the client to refetch state over REST; some events are gone
+		fmt.Fprint(w, "event: stream.gap\ndata: {}\n\n")
+	}
+	for _, se := range missed {
+		if filter.matches(se) {
+			writeStreamEvent(w, se)
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case se, ok := <-events:
+			if !ok {
+				// Fell too far behind or the server is shutting down; the
+				// client reconnects with Last-Event-ID
+				return
+			}
+			if !filter.matches(se) {
+				continue
+			}
+			writeStreamEvent(w, se)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, se services.StreamEvent) {
+	data, _ := json.Marshal(se.Event)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", se.Seq, se.Event.Type, data)
+}
+
+type streamFilter struct {
+	tenantID string
+	wabaIDs  map[string]bool
+	types    []string
+}
+
+// newStreamFilter reads repeated or comma-separated waba_id and types params.
+// Types accept "prefix.*" wildcards.
+func newStreamFilter(r *http.Request) streamFilter {
+	f := streamFilter{wabaIDs: map[string]bool{}}
+	for _, v := range r.URL.Query()["waba_id"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				f.wabaIDs[id] = true
+			}
+		}
+	}
+	for _, v := range r.URL.Query()["types"] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				f.types = append(f.types, t)
+			}
+		}
+	}
+	return f
+}
+
+func (f streamFilter) matches(se services.StreamEvent) bool {
+	if se.Event.TenantID != f.tenantID {
+		return false
+	}
+	if len(f.wabaIDs) > 0 && !f.wabaIDs[se.Event.WABAID] {
+		return false
+	}
+	if len(f.types) == 0 {
+		return true
+	}
+	for _, t := range f.types {
+		if services.EventTypeMatches(t, se.Event.Type) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"back/models"
+	"back/services"
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readSSE returns the next n events as "id|event" pairs.
+func readSSE(t *testing.T, r *bufio.Reader, n int) []string {
+	t.Helper()
+	var out []string
+	var id, event string
+	for len(out) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v (got %v)", err, out)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case line == "" && event != "":
+			out = append(out, id+"|"+event)
+			id, event = "", ""
+		}
+	}
+	return out
+}
+
+func openStream(t *testing.T, url, lastEventID string) *bufio.Reader {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type = %q", ct)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func waitForClients(t *testing.T, stream *services.EventStream, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); stream.Clients() < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d stream clients connected", stream.Clients())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEventStreamFiltersAndResumes(t *testing.T) {
+	stream := services.NewEventStream(100)
+	srv := httptest.NewServer(http.HandlerFunc(NewStreamHandler(stream).Stream))
+	t.Cleanup(srv.Close)
+
+	live := openStream(t, srv.URL+"?waba_id=waba-1&types=message.*", "")
+	waitForClients(t, stream, 1)
+
+	stream.HandleEvent(models.Event{ID: "e1", TenantID: models.DefaultTenantID, Type: models.EventMessageReceived, WABAID: "waba-1"})
+	stream.HandleEvent(models.Event{ID: "e2", TenantID: models.DefaultTenantID, Type: models.EventMessageReceived, WABAID: "waba-2"})
+	stream.HandleEvent(models.Event{ID: "e3", TenantID: models.DefaultTenantID, Type: models.EventTemplateStatus, WABAID: "waba-1"})
+	stream.HandleEvent(models.Event{ID: "e4", TenantID: models.DefaultTenantID, Type: models.EventMessageStatus, WABAID: "waba-1"})
+
+	got := readSSE(t, live, 2)
+	if got[0] != "1|message.received" || got[1] != "4|message.status" {
+		t.Errorf("live events = %v", got)
+	}
+
+	resumed := openStream(t, srv.URL, "2")
+	if got := readSSE(t, resumed, 2); got[0] != "3|template.status" || got[1] != "4|message.status" {
+		t.Errorf("resumed events = %v", got)
+	}
+}
+
+func TestEventStreamReportsGap(t *testing.T) {
+	stream := services.NewEventStream(2)
+	for i := 0; i < 5; i++ {
+		stream.HandleEvent(models.Event{TenantID: models.DefaultTenantID, Type: models.EventAccountAlert})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(NewStreamHandler(stream).Stream))
+	t.Cleanup(srv.Close)
+
+	got := readSSE(t, openStream(t, srv.URL, "1"), 3)
+	if got[0] != "|stream.gap" || got[1] != "4|account.alert" || got[2] != "5|account.alert" {
+		t.Errorf("events = %v", got)
+	}
+}
+
+func TestEventStreamReportsGapForUnknownID(t *testing.T) {
+	// An ID from before a restart is ahead of the new process's sequence
+	stream := services.NewEventStream(100)
+	stream.HandleEvent(models.Event{TenantID: models.DefaultTenantID, Type: models.EventAccountAlert})
+	srv := httptest.NewServer(http.HandlerFunc(NewStreamHandler(stream).Stream))
+	t.Cleanup(srv.Close)
+
+	resumed := openStream(t, srv.URL, "42")
+	waitForClients(t, stream, 1)
+	stream.HandleEvent(models.Event{TenantID: models.DefaultTenantID, Type: models.EventAccountAlert})
+	if got := readSSE(t, resumed, 2); got[0] != "|stream.gap" || got[1] != "2|account.alert" {
+		t.Errorf("events = %v", got)
+	}
+}
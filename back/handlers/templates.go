@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"back/config"
 	"back/models"
 	"back/services"
 	"encoding/json"
@@ -9,48 +10,49 @@ import (
 )
 
 type TemplatesHandler struct {
+	config   *config.Config
 	facebook *services.FacebookService
 	whatsapp *services.WhatsAppService
 }
 
-func NewTemplatesHandler(fb *services.FacebookService, wa *services.WhatsAppService) *TemplatesHandler {
-	return &TemplatesHandler{facebook: fb, whatsapp: wa}
+func NewTemplatesHandler(cfg *config.Config, fb *services.FacebookService, wa *services.WhatsAppService) *TemplatesHandler {
+	return &TemplatesHandler{config: cfg, facebook: fb, whatsapp: wa}
 }
 
 // POST /api/whatsapp/templates
-// Body: { authorization_code, redirect_uri?, waba_id (required) }
+// Body: { authorization_code, redirect_uri?, waba_id (required), app_id?, config_id? }
 func (h *TemplatesHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var req models.AuthCodeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeTemplatesError(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, ErrInvalidRequest, "Invalid request body")
 		return
 	}
 	if req.AuthorizationCode == "" {
-		writeTemplatesError(w, "Authorization code is required", http.StatusBadRequest)
+		writeError(w, r, ErrInvalidRequest, "Authorization code is required")
 		return
 	}
 	if req.WABAID == "" {
-		writeTemplatesError(w, "WABA ID is required", http.StatusBadRequest)
+		writeError(w, r, ErrInvalidRequest, "WABA ID is required")
+		return
+	}
+
+	app, ok := findMetaApp(w, r, h.config, &req)
+	if !ok {
 		return
 	}
 
 	// 1) Exchange code -> token
 	redirectURI := req.RedirectURI // may be empty (supports embedded signup)
-	tokenResp, err := h.facebook.ExchangeToken(req.AuthorizationCode, redirectURI)
+	tokenResp, err := h.facebook.ExchangeToken(r.Context(), app, req.AuthorizationCode, redirectURI)
 	if err != nil {
-		writeTemplatesError(w, "Token exchange failed: "+err.Error(), http.StatusBadRequest)
+		writeGraphError(w, r, ErrTokenExchangeFailed, "Token exchange failed", err)
 		return
 	}
 
 	// 2) Fetch templates (only)
-	templates, err := h.whatsapp.ListTemplates(tokenResp.AccessToken, req.WABAID)
+	templates, err := h.whatsapp.ListTemplates(r.Context(), tokenResp.AccessToken, req.WABAID)
 	if err != nil {
-		writeTemplatesError(w, "Failed to fetch templates: "+err.Error(), http.StatusBadGateway)
+		writeGraphError(w, r, ErrGraphRequestFailed, "Failed to fetch templates", err)
 		return
 	}
 
@@ -61,8 +63,7 @@ func (h *TemplatesHandler) ListTemplates(w http.ResponseWriter, r *http.Request)
 		TokenInfo: map[string]any{
 			"token_type":           tokenResp.TokenType,
 			"access_token_length":  len(tokenResp.AccessToken),
-			"access_token_preview": tokenResp.AccessToken,
-			"full_access_token":    tokenResp.AccessToken, // keep if you want to show it
+			"access_token_preview": tokenPreview(tokenResp.AccessToken),
 			"expires_in":           tokenResp.ExpiresIn,
 			"token_created_at":     time.Now().Format(time.RFC3339),
 		},
@@ -70,12 +71,3 @@ func (h *TemplatesHandler) ListTemplates(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
-
-func writeTemplatesError(w http.ResponseWriter, msg string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	_ = json.NewEncoder(w).Encode(models.TemplatesResponse{
-		Success: false,
-		Error:   msg,
-	})
-}
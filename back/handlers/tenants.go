@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"back/models"
+	"back/services"
+	"encoding/json"
+	"net/http"
+)
+
+type TenantHandler struct {
+	tenants *services.TenantService
+	auth    *services.AuthService
+	audit   *services.AuditLog
+}
+
+func NewTenantHandler(tenants *services.TenantService, auth *services.AuthService, audit *services.AuditLog) *TenantHandler {
+	return &TenantHandler{tenants: tenants, auth: auth, audit: audit}
+}
+
+// GET /api/tenants
+func (h *TenantHandler) ListTenants(w http.ResponseWriter, r *http.Request) {
+	if !platformCaller(w, r) {
+		return
+	}
+
+	tenants, err := h.tenants.ListTenants()
+	if err != nil {
+		writeError(w, r, ErrInternal, "Failed to fetch tenants")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"tenants": tenants,
+		"count":   len(tenants),
+	})
+}
+
+// POST /api/tenants
+// Creating a tenant also issues its first API key, with the owner role, so
+// only owners may do it.
+func (h *TenantHandler) CreateTenant(w http.ResponseWriter, r *http.Request) {
+	if !platformCaller(w, r) {
+		return
+	}
+	if principal := services.PrincipalFromContext(r.Context()); principal == nil || principal.Role != models.RoleOwner {
+		writeError(w, r, ErrForbidden, "Only owners can create tenants")
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeError(w, r, ErrInvalidRequest, "Tenant name is required")
+		return
+	}
+	tenant, err := h.tenants.CreateTenant(req.Name)
+	if err != nil {
+		writeError(w, r, ErrInvalidRequest, err.Error())
+		return
+	}
+	raw, key, err := h.auth.CreateAPIKey(tenant.ID, "initial", models.RoleOwner)
+	if err != nil {
+		writeError(w, r, ErrInternal, "Failed to create API key")
+		return
+	}
+	h.audit.Record(r.Context(), tenantID(r), models.AuditTenantCreated, "tenant", tenant.ID, nil, tenant)
+	h.audit.Record(r.Context(), tenant.ID, models.AuditAPIKeyCreated, "api_key", key.ID, nil, key)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"tenant":  tenant,
+		"key":     key,
+		"api_key": raw, // Shown once; only the hash is stored
+	})
+}
+
+// platformCaller allows only callers from the default (platform) tenant to
+// manage tenants.
+func platformCaller(w http.ResponseWriter, r *http.Request) bool {
+	if tenantID(r) != models.DefaultTenantID {
+		writeError(w, r, ErrForbidden, "Only the platform tenant can manage tenants")
+		return false
+	}
+	return true
+}
@@ -3,72 +3,116 @@ package handlers
 import (
 	"back/config"
 	"back/models"
+	"back/services"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type WebhookHandler struct {
-	config *config.Config
+	config  *config.Config
+	secrets *services.Secrets
+	archive *services.WebhookArchive
+	events  *services.EventBus
+	storage *services.StorageService
+	audit   *services.AuditLog
+	metrics *services.Metrics
 }
 
-func NewWebhookHandler(cfg *config.Config) *WebhookHandler {
+// NewWebhookHandler reads app secrets and verify tokens through secrets;
+// with nil it uses the configured values.
+func NewWebhookHandler(cfg *config.Config, secrets *services.Secrets, archive *services.WebhookArchive, events *services.EventBus, storage *services.StorageService, audit *services.AuditLog, metrics *services.Metrics) *WebhookHandler {
 	return &WebhookHandler{
-		config: cfg,
+		config:  cfg,
+		secrets: secrets,
+		archive: archive,
+		events:  events,
+		storage: storage,
+		audit:   audit,
+		metrics: metrics,
 	}
 }
 
-func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		h.verifyWebhook(w, r)
-	case http.MethodPost:
-		h.handleWebhookEvent(w, r)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
-}
-
-func (h *WebhookHandler) verifyWebhook(w http.ResponseWriter, r *http.Request) {
+// GET /api/whatsapp/webhooks
+// Meta's subscription verification handshake.
+func (h *WebhookHandler) VerifyWebhook(w http.ResponseWriter, r *http.Request) {
 	mode := r.URL.Query().Get("hub.mode")
 	token := r.URL.Query().Get("hub.verify_token")
 	challenge := r.URL.Query().Get("hub.challenge")
 
-	log.Printf("Webhook verification: mode=%s, token=%s", mode, token)
-
-	if mode == "subscribe" && token == h.config.WebhookVerifyToken {
-		log.Printf("Webhook verified successfully")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(challenge))
-		return
+	// Every app's subscription calls the same endpoint
+	for _, app := range h.config.MetaApps() {
+		app = h.secrets.App(app)
+		if mode == "subscribe" && token != "" && token == app.WebhookVerifyToken {
+			slog.InfoContext(r.Context(), "webhook subscription verified", "app", app.Name)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(challenge))
+			return
+		}
 	}
 
-	log.Printf("Webhook verification failed")
-	w.WriteHeader(http.StatusForbidden)
+	slog.WarnContext(r.Context(), "webhook verification failed", "mode", mode)
+	writeError(w, r, ErrVerificationFailed, "Webhook verification failed")
 }
 
-func (h *WebhookHandler) handleWebhookEvent(w http.ResponseWriter, r *http.Request) {
+// POST /api/whatsapp/webhooks
+func (h *WebhookHandler) ReceiveWebhook(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Failed to read webhook body: %v", err)
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "failed to read webhook body", "error", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, r, ErrRequestTooLarge, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, r, ErrInvalidRequest, "Failed to read request body")
+		return
+	}
+
+	app, signed := h.signingApp(r.Header.Get(services.SignatureHeader), body)
+	if !signed {
+		// Anyone can post here, so only metadata is kept, apart from the archive
+		slog.WarnContext(r.Context(), "rejected webhook with invalid signature", "size", len(body))
+		h.metrics.WebhookSignatureFailure()
+		h.archive.Reject(models.RejectedWebhook{ReceivedAt: time.Now(), Size: len(body), Reason: models.WebhookOutcomeInvalidSignature})
+		writeError(w, r, ErrInvalidSignature, "Invalid "+services.SignatureHeader)
 		return
 	}
 
+	// Archive every signed body before acting on it so it can be inspected or replayed later
+	record := &models.WebhookEventRecord{
+		AppID:          app.AppID,
+		ReceivedAt:     time.Now(),
+		SignatureValid: true,
+		Body:           string(body),
+	}
+	h.archive.Save(record)
+
 	var event models.WebhookEvent
 	if err := json.Unmarshal(body, &event); err != nil {
-		log.Printf("Failed to parse webhook event: %v", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "failed to parse webhook event", "webhook_event_id", record.ID, "error", err)
+		record.Outcome = models.WebhookOutcomeInvalidJSON
+		record.Error = err.Error()
+		h.archive.Update(record)
+		writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 		return
 	}
 
-	log.Printf("Received webhook event: object=%s, entries=%d", event.Object, len(event.Entry))
-
-	// Process webhook events
+	// Counted here rather than in processAndRecord so replays are not counted twice
+	for _, normalized := range h.processAndRecord(r.Context(), record, &event) {
+		h.metrics.WebhookEvent(normalized.Field, normalized.Type)
+	}
 	for _, entry := range event.Entry {
 		for _, change := range entry.Changes {
-			h.processWebhookChange(entry.ID, change)
+			for _, status := range change.Value.Statuses {
+				h.metrics.OutboundMessage(status.Status)
+			}
 		}
 	}
 
@@ -76,56 +120,103 @@ func (h *WebhookHandler) handleWebhookEvent(w http.ResponseWriter, r *http.Reque
 	w.Write([]byte("OK"))
 }
 
-func (h *WebhookHandler) processWebhookChange(entryID string, change struct {
-	Value struct {
-		MessagingProduct string `json:"messaging_product"`
-		Metadata         struct {
-			DisplayPhoneNumber string `json:"display_phone_number"`
-			PhoneNumberID      string `json:"phone_number_id"`
-		} `json:"metadata"`
-		Messages []struct {
-			ID        string `json:"id"`
-			From      string `json:"from"`
-			Timestamp string `json:"timestamp"`
-			Type      string `json:"type"`
-			Text      struct {
-				Body string `json:"body"`
-			} `json:"text,omitempty"`
-		} `json:"messages,omitempty"`
-		Statuses []struct {
-			ID          string `json:"id"`
-			RecipientID string `json:"recipient_id"`
-			Status      string `json:"status"`
-			Timestamp   string `json:"timestamp"`
-		} `json:"statuses,omitempty"`
-	} `json:"value"`
-	Field string `json:"field"`
-}) {
-	log.Printf("Processing change: field=%s, phone_number_id=%s",
-		change.Field, change.Value.Metadata.PhoneNumberID)
+// signingApp finds the app whose secret produced signature. Meta signs each
+// app's deliveries with that app's secret, so this is what routes a
+// delivery to its app.
+func (h *WebhookHandler) signingApp(signature string, body []byte) (config.MetaApp, bool) {
+	for _, app := range h.config.MetaApps() {
+		app = h.secrets.App(app)
+		if app.AppSecret != "" && services.ValidWebhookSignature(app.AppSecret, signature, body) {
+			return app, true
+		}
+	}
+	return config.MetaApp{}, false
+}
+
+// processAndRecord runs event processing and stores the outcome on record.
+// It returns the normalized events published, if any.
+func (h *WebhookHandler) processAndRecord(ctx context.Context, record *models.WebhookEventRecord, event *models.WebhookEvent) []models.Event {
+	indexWebhookRecord(record, event)
+	record.TenantID = h.resolveTenant(event)
+
+	if err := h.processWebhookEvent(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "failed to process webhook", "webhook_event_id", record.ID, "error", err)
+		record.Outcome = models.WebhookOutcomeFailed
+		record.Error = err.Error()
+		h.archive.Update(record)
+		return nil
+	}
+
+	// Hand normalized events to internal listeners (forwarding, ...)
+	normalized, err := services.NormalizeWebhook([]byte(record.Body))
+	if err != nil {
+		record.Outcome = models.WebhookOutcomeFailed
+		record.Error = err.Error()
+		h.archive.Update(record)
+		return nil
+	}
+	for i := range normalized {
+		normalized[i].TenantID = h.tenantFor(normalized[i].WABAID, normalized[i].PhoneNumberID)
+		normalized[i].AppID = record.AppID
+	}
+	h.events.Publish(normalized...)
+
+	record.Outcome = models.WebhookOutcomeProcessed
+	record.Error = ""
+	h.archive.Update(record)
+	return normalized
+}
+
+// resolveTenant picks the tenant owning the first phone number or WABA in
+// event. Events for numbers no tenant has onboarded go to the default tenant.
+func (h *WebhookHandler) resolveTenant(event *models.WebhookEvent) string {
+	for _, entry := range event.Entry {
+		for _, change := range entry.Changes {
+			return h.tenantFor(entry.ID, change.Value.Metadata.PhoneNumberID)
+		}
+		return h.tenantFor(entry.ID, "")
+	}
+	return models.DefaultTenantID
+}
+
+func (h *WebhookHandler) tenantFor(wabaID, phoneNumberID string) string {
+	if tenant, ok := h.storage.ResolveTenant(wabaID, phoneNumberID); ok {
+		return tenant
+	}
+	return models.DefaultTenantID
+}
+
+func (h *WebhookHandler) processWebhookEvent(ctx context.Context, event *models.WebhookEvent) error {
+	slog.DebugContext(ctx, "received webhook event", "object", event.Object, "entries", len(event.Entry))
+
+	// Process webhook events
+	for _, entry := range event.Entry {
+		for _, change := range entry.Changes {
+			if err := h.processWebhookChange(ctx, entry.ID, change); err != nil {
+				return fmt.Errorf("entry %s field %s: %w", entry.ID, change.Field, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (h *WebhookHandler) processWebhookChange(ctx context.Context, entryID string, change models.WebhookChange) error {
+	slog.DebugContext(ctx, "processing webhook change", "field", change.Field, "phone_number_id", change.Value.Metadata.PhoneNumberID)
 
 	// Handle incoming messages
 	for _, message := range change.Value.Messages {
-		h.handleIncomingMessage(change.Value.Metadata.PhoneNumberID, message)
+		h.handleIncomingMessage(ctx, change.Value.Metadata.PhoneNumberID, message)
 	}
 
 	// Handle message statuses
 	for _, status := range change.Value.Statuses {
-		h.handleMessageStatus(change.Value.Metadata.PhoneNumberID, status)
+		h.handleMessageStatus(ctx, change.Value.Metadata.PhoneNumberID, status)
 	}
+	return nil
 }
 
-func (h *WebhookHandler) handleIncomingMessage(phoneNumberID string, message struct {
-	ID        string `json:"id"`
-	From      string `json:"from"`
-	Timestamp string `json:"timestamp"`
-	Type      string `json:"type"`
-	Text      struct {
-		Body string `json:"body"`
-	} `json:"text,omitempty"`
-}) {
-	log.Printf("Incoming message: id=%s, from=%s, type=%s, body=%s",
-		message.ID, message.From, message.Type, message.Text.Body)
+func (h *WebhookHandler) handleIncomingMessage(ctx context.Context, phoneNumberID string, message models.WebhookMessage) {
+	slog.InfoContext(ctx, "incoming message", "message_id", message.ID, "from", message.From, "type", message.Type, "body", message.Text.Body)
 
 	// TODO: Implement your message handling logic
 	// Examples:
@@ -135,14 +226,8 @@ func (h *WebhookHandler) handleIncomingMessage(phoneNumberID string, message str
 	// - Process commands or keywords
 }
 
-func (h *WebhookHandler) handleMessageStatus(phoneNumberID string, status struct {
-	ID          string `json:"id"`
-	RecipientID string `json:"recipient_id"`
-	Status      string `json:"status"`
-	Timestamp   string `json:"timestamp"`
-}) {
-	log.Printf("Message status update: id=%s, recipient=%s, status=%s",
-		status.ID, status.RecipientID, status.Status)
+func (h *WebhookHandler) handleMessageStatus(ctx context.Context, phoneNumberID string, status models.WebhookStatus) {
+	slog.InfoContext(ctx, "message status update", "message_id", status.ID, "recipient_id", status.RecipientID, "status", status.Status)
 
 	// TODO: Implement your status handling logic
 	// Examples:
@@ -150,3 +235,130 @@ func (h *WebhookHandler) handleMessageStatus(phoneNumberID string, status struct
 	// - Trigger notifications
 	// - Update analytics
 }
+
+// GET /api/webhooks/events?waba_id=&phone_number_id=&field=&outcome=&since=&until=&limit=
+func (h *WebhookHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := services.WebhookEventFilter{
+		TenantID:      tenantID(r),
+		WABAID:        q.Get("waba_id"),
+		PhoneNumberID: q.Get("phone_number_id"),
+		Field:         q.Get("field"),
+		Outcome:       q.Get("outcome"),
+		Limit:         100,
+	}
+	var err error
+	if filter.Since, err = parseTimeParam(q.Get("since")); err != nil {
+		writeError(w, r, ErrInvalidRequest, "Invalid since: "+err.Error())
+		return
+	}
+	if filter.Until, err = parseTimeParam(q.Get("until")); err != nil {
+		writeError(w, r, ErrInvalidRequest, "Invalid until: "+err.Error())
+		return
+	}
+	if l := q.Get("limit"); l != "" {
+		if filter.Limit, err = strconv.Atoi(l); err != nil || filter.Limit < 1 {
+			writeError(w, r, ErrInvalidRequest, "Invalid limit")
+			return
+		}
+	}
+
+	events, err := h.archive.Search(filter)
+	if err != nil {
+		writeError(w, r, ErrInternal, "Failed to search webhook events")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"events":  events,
+		"count":   len(events),
+	})
+}
+
+// GET /api/webhooks/rejected
+// Deliveries refused for an invalid signature, newest first. They cannot be
+// attributed to a tenant, so only the platform tenant sees them.
+func (h *WebhookHandler) ListRejected(w http.ResponseWriter, r *http.Request) {
+	if !platformCaller(w, r) {
+		return
+	}
+	rejected := h.archive.Rejected()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"rejected": rejected,
+		"count":    len(rejected),
+	})
+}
+
+// POST /api/webhooks/events/{id}/replay
+func (h *WebhookHandler) ReplayEvent(w http.ResponseWriter, r *http.Request) {
+	record, err := h.archive.Get(r.PathValue("id"))
+	if err != nil || record.TenantID != tenantID(r) {
+		writeError(w, r, ErrWebhookEventNotFound, "Webhook event not found")
+		return
+	}
+	if !record.SignatureValid {
+		writeError(w, r, ErrReplayRejected, "Refusing to replay an event with an invalid signature")
+		return
+	}
+
+	var event models.WebhookEvent
+	if err := json.Unmarshal([]byte(record.Body), &event); err != nil {
+		writeError(w, r, ErrReplayRejected, "Archived body is not valid JSON")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "replaying webhook event", "webhook_event_id", record.ID)
+	if record, err = h.archive.RecordReplay(record.ID, time.Now()); err != nil {
+		// Evicted since it was read
+		writeError(w, r, ErrWebhookEventNotFound, "Webhook event not found")
+		return
+	}
+	h.processAndRecord(r.Context(), record, &event)
+	h.audit.Record(r.Context(), tenantID(r), models.AuditWebhookEventReplayed, "webhook_event", record.ID, nil,
+		map[string]interface{}{"replay_count": record.ReplayCount, "outcome": record.Outcome})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": record.Outcome == models.WebhookOutcomeProcessed,
+		"event":   record,
+	})
+}
+
+// indexWebhookRecord copies the searchable identifiers out of event.
+func indexWebhookRecord(record *models.WebhookEventRecord, event *models.WebhookEvent) {
+	record.Object = event.Object
+	record.WABAIDs, record.PhoneNumberIDs, record.Fields = nil, nil, nil
+	for _, entry := range event.Entry {
+		record.WABAIDs = appendUnique(record.WABAIDs, entry.ID)
+		for _, change := range entry.Changes {
+			record.Fields = appendUnique(record.Fields, change.Field)
+			record.PhoneNumberIDs = appendUnique(record.PhoneNumberIDs, change.Value.Metadata.PhoneNumberID)
+		}
+	}
+}
+
+func appendUnique(values []string, v string) []string {
+	if v == "" {
+		return values
+	}
+	for _, existing := range values {
+		if existing == v {
+			return values
+		}
+	}
+	return append(values, v)
+}
+
+// parseTimeParam accepts RFC 3339 or Unix seconds; empty means unset.
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
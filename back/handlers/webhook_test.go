@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"back/config"
+	"back/models"
+	"back/services"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testAppSecret = "fake-app-secret"
+
+func newTestWebhookHandler() *WebhookHandler {
+	return NewWebhookHandler(&config.Config{
+		FacebookAppID:      "default-app-id",
+		FacebookAppSecret:  testAppSecret,
+		WebhookVerifyToken: "verify-token",
+		Apps: []config.MetaApp{
+			{Name: "emea", AppID: "emea-app-id", AppSecret: "emea-secret", WebhookVerifyToken: "emea-verify-token"},
+		},
+	}, nil, services.NewWebhookArchive(100), services.NewEventBus(), services.NewStorageService(services.NewAuditLog()), services.NewAuditLog(), nil)
+}
+
+func signedWebhookRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/whatsapp/webhooks", strings.NewReader(body))
+	req.Header.Set(services.SignatureHeader, services.SignWebhookPayload(testAppSecret, []byte(body)))
+	return req
+}
+
+func TestWebhookVerification(t *testing.T) {
+	h := newTestWebhookHandler()
+
+	rec := httptest.NewRecorder()
+	h.VerifyWebhook(rec, httptest.NewRequest(http.MethodGet,
+		"/api/whatsapp/webhooks?hub.mode=subscribe&hub.verify_token=verify-token&hub.challenge=1158201444", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "1158201444" {
+		t.Errorf("status %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.VerifyWebhook(rec, httptest.NewRequest(http.MethodGet,
+		"/api/whatsapp/webhooks?hub.mode=subscribe&hub.verify_token=wrong&hub.challenge=1158201444", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
+
+const testWebhookPayload = `{
+  "object": "whatsapp_business_account",
+  "entry": [{
+    "id": "waba-1",
+    "time": 1700000000,
+    "changes": [{
+      "field": "messages",
+      "value": {
+        "messaging_product": "whatsapp",
+        "metadata": {"display_phone_number": "15550100", "phone_number_id": "pn-1"},
+        "messages": [{"id": "wamid.1", "from": "15550199", "timestamp": "1700000000", "type": "text", "text": {"body": "hello"}}],
+        "statuses": [{"id": "wamid.0", "recipient_id": "15550199", "status": "delivered", "timestamp": "1700000000"}]
+      }
+    }]
+  }]
+}`
+
+func TestWebhookRoutedBySigningApp(t *testing.T) {
+	h := newTestWebhookHandler()
+	var published []models.Event
+	h.events.Subscribe(func(e models.Event) { published = append(published, e) })
+
+	rec := httptest.NewRecorder()
+	h.VerifyWebhook(rec, httptest.NewRequest(http.MethodGet,
+		"/api/whatsapp/webhooks?hub.mode=subscribe&hub.verify_token=emea-verify-token&hub.challenge=42", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("second app's verify token: status %d", rec.Code)
+	}
+
+	for secret, appID := range map[string]string{testAppSecret: "default-app-id", "emea-secret": "emea-app-id"} {
+		published = nil
+		req := httptest.NewRequest(http.MethodPost, "/api/whatsapp/webhooks", strings.NewReader(testWebhookPayload))
+		req.Header.Set(services.SignatureHeader, services.SignWebhookPayload(secret, []byte(testWebhookPayload)))
+		rec := httptest.NewRecorder()
+		h.ReceiveWebhook(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", appID, rec.Code)
+		}
+		events, _ := h.archive.Search(services.WebhookEventFilter{})
+		if events[0].AppID != appID {
+			t.Errorf("archived app %q, want %q", events[0].AppID, appID)
+		}
+		if len(published) == 0 || published[0].AppID != appID {
+			t.Errorf("published %+v, want app %q", published, appID)
+		}
+	}
+}
+
+func TestWebhookEvent(t *testing.T) {
+	h := newTestWebhookHandler()
+
+	rec := httptest.NewRecorder()
+	h.ReceiveWebhook(rec, signedWebhookRequest(testWebhookPayload))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d", rec.Code)
+	}
+}
+
+func TestWebhookEventInvalidSignature(t *testing.T) {
+	h := newTestWebhookHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/whatsapp/webhooks", strings.NewReader(testWebhookPayload))
+	req.Header.Set(services.SignatureHeader, services.SignWebhookPayload("wrong", []byte(testWebhookPayload)))
+	rec := httptest.NewRecorder()
+	h.ReceiveWebhook(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+
+	if events, _ := h.archive.Search(services.WebhookEventFilter{}); len(events) != 0 {
+		t.Errorf("archived = %+v", events)
+	}
+	rejected := h.archive.Rejected()
+	if len(rejected) != 1 || rejected[0].Size != len(testWebhookPayload) || rejected[0].Reason != models.WebhookOutcomeInvalidSignature {
+		t.Errorf("rejected = %+v", rejected)
+	}
+}
+
+func TestWebhookEventArchiveSearchAndReplay(t *testing.T) {
+	h := newTestWebhookHandler()
+	h.ReceiveWebhook(httptest.NewRecorder(), signedWebhookRequest(testWebhookPayload))
+	h.ReceiveWebhook(httptest.NewRecorder(), signedWebhookRequest(`{"object":"whatsapp_business_account","entry":[{"id":"waba-2","changes":[{"field":"account_alerts","value":{}}]}]}`))
+
+	list := func(query string) []models.WebhookEventRecord {
+		rec := httptest.NewRecorder()
+		h.ListEvents(rec, httptest.NewRequest(http.MethodGet, "/api/webhooks/events"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list %q: status %d %s", query, rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Events []models.WebhookEventRecord `json:"events"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp.Events
+	}
+
+	if got := list(""); len(got) != 2 {
+		t.Fatalf("got %d events, want 2", len(got))
+	}
+	byPhone := list("?phone_number_id=pn-1")
+	if len(byPhone) != 1 || byPhone[0].Body != testWebhookPayload || byPhone[0].Outcome != models.WebhookOutcomeProcessed {
+		t.Errorf("phone_number_id filter = %+v", byPhone)
+	}
+	if got := list("?waba_id=waba-2&field=account_alerts"); len(got) != 1 {
+		t.Errorf("waba_id+field filter returned %d events", len(got))
+	}
+	if got := list("?since=2000-01-01T00:00:00Z&until=2001-01-01T00:00:00Z"); len(got) != 0 {
+		t.Errorf("time range filter returned %d events", len(got))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/events/"+byPhone[0].ID+"/replay", nil)
+	req.SetPathValue("id", byPhone[0].ID)
+	rec := httptest.NewRecorder()
+	h.ReplayEvent(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("replay status %d %s", rec.Code, rec.Body.String())
+	}
+	replayed, _ := h.archive.Get(byPhone[0].ID)
+	if replayed.ReplayCount != 1 || replayed.LastReplayedAt == nil {
+		t.Errorf("replayed record = %+v", replayed)
+	}
+
+	// Concurrent replays each count once
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/webhooks/events/"+byPhone[0].ID+"/replay", nil)
+			req.SetPathValue("id", byPhone[0].ID)
+			h.ReplayEvent(httptest.NewRecorder(), req)
+		})
+	}
+	wg.Wait()
+	if replayed, _ := h.archive.Get(byPhone[0].ID); replayed.ReplayCount != 11 {
+		t.Errorf("replay count after concurrent replays = %d, want 11", replayed.ReplayCount)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/webhooks/events/missing/replay", nil)
+	req.SetPathValue("id", "missing")
+	rec = httptest.NewRecorder()
+	h.ReplayEvent(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("replay missing: status %d", rec.Code)
+	}
+}
+
+func TestWebhookEventInvalidJSON(t *testing.T) {
+	h := newTestWebhookHandler()
+
+	rec := httptest.NewRecorder()
+	h.ReceiveWebhook(rec, signedWebhookRequest("{"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestWebhookEventRoutedToOwningTenant(t *testing.T) {
+	h := newTestWebhookHandler()
+	h.storage.SaveBusinessAccount(context.Background(), &models.BusinessAccount{
+		TenantID:     "tenant-a",
+		WABAID:       "waba-1",
+		PhoneNumbers: []models.BusinessPhoneNumber{{ID: "pn-1"}},
+	})
+	var published []models.Event
+	h.events.Subscribe(func(e models.Event) { published = append(published, e) })
+
+	h.ReceiveWebhook(httptest.NewRecorder(), signedWebhookRequest(testWebhookPayload))
+	h.ReceiveWebhook(httptest.NewRecorder(), signedWebhookRequest(`{"object":"whatsapp_business_account","entry":[{"id":"waba-unknown","changes":[{"field":"account_alerts","value":{}}]}]}`))
+
+	for _, e := range published {
+		want := "tenant-a"
+		if e.WABAID == "waba-unknown" {
+			want = models.DefaultTenantID
+		}
+		if e.TenantID != want {
+			t.Errorf("event %s %s: tenant %q, want %q", e.Type, e.WABAID, e.TenantID, want)
+		}
+	}
+
+	asTenant := func(tenant string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/api/webhooks/events", nil)
+		return req.WithContext(services.WithPrincipal(req.Context(), &models.Principal{ID: "key", TenantID: tenant}))
+	}
+	for tenant, want := range map[string]int{"tenant-a": 1, models.DefaultTenantID: 1, "tenant-b": 0} {
+		rec := httptest.NewRecorder()
+		h.ListEvents(rec, asTenant(tenant))
+		var resp struct {
+			Count int `json:"count"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if resp.Count != want {
+			t.Errorf("tenant %s sees %d events, want %d", tenant, resp.Count, want)
+		}
+	}
+}
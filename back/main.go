@@ -3,80 +3,428 @@ package main
 import (
 	"back/config"
 	"back/handlers"
+	"back/models"
+	"back/openapi"
 	"back/services"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-func enableCORS(next http.HandlerFunc, allowedOrigins []string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-
-		// Check if origin is allowed
-		allowed := false
-		for _, allowedOrigin := range allowedOrigins {
-			if origin == allowedOrigin {
-				allowed = true
-				break
-			}
+// corsPolicies builds the API's CORS policy and its per-route exceptions:
+// public read-only paths open to any origin, and excluded paths such as the
+// Meta webhook, which browsers have no business calling.
+func corsPolicies(cfg *config.Config) (*handlers.CORSPolicy, []handlers.CORSRoute) {
+	api := &handlers.CORSPolicy{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		ExposedHeaders:   cfg.CORSExposedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	}
+	public := &handlers.CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{http.MethodGet},
+		AllowedHeaders: cfg.CORSAllowedHeaders,
+		ExposedHeaders: cfg.CORSExposedHeaders,
+		MaxAge:         cfg.CORSMaxAge,
+	}
+	var routes []handlers.CORSRoute
+	for _, prefix := range cfg.CORSPublicPaths {
+		routes = append(routes, handlers.CORSRoute{Prefix: prefix, Policy: public})
+	}
+	for _, prefix := range cfg.CORSExcludedPaths {
+		routes = append(routes, handlers.CORSRoute{Prefix: prefix})
+	}
+	return api, routes
+}
+
+// bootstrapAPIKey registers AUTH_BOOTSTRAP_API_KEY as an owner key of the
+// default tenant, or generates one when it is not set, so a fresh deployment
+// can create its own keys and tenants.
+func bootstrapAPIKey(auth *services.AuthService, cfg *config.Config) {
+	if cfg.AuthBootstrapAPIKey != "" {
+		if _, err := auth.ImportAPIKey(models.DefaultTenantID, "bootstrap", models.RoleOwner, cfg.AuthBootstrapAPIKey); err != nil {
+			fatal("invalid AUTH_BOOTSTRAP_API_KEY", "error", err)
 		}
+		return
+	}
+
+	raw, _, err := auth.CreateAPIKey(models.DefaultTenantID, "bootstrap", models.RoleOwner)
+	if err != nil {
+		fatal("failed to generate bootstrap API key", "error", err)
+	}
+	// Printed rather than logged: the log redacts API keys
+	fmt.Fprintf(os.Stderr, "No AUTH_BOOTSTRAP_API_KEY set, generated one for this process: %s\n", raw)
+}
+
+// version is stamped at build time: go build -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
+// server is the fully wired application.
+type server struct {
+	handler http.Handler
+	routes  []string // registered mux patterns, checked against the OpenAPI spec in tests
+
+	// Background work drained on shutdown
+	events     *services.EventStream
+	forwarding *services.ForwardingService
+	outbound   *services.OutboundQueue
+
+	certs   *services.CertReloader // nil unless TLS is enabled
+	secrets *services.Secrets      // refreshed in the background for rotation
+	tokens  *services.TokenRefresher
+	phones  *services.PhoneNumberSync
+}
+
+func newServer(cfg *config.Config) *server {
+	// Initialize services
+	metrics := services.NewMetrics()
+	secretProvider, err := services.NewSecretProvider(cfg)
+	if err != nil {
+		fatal("failed to initialize secrets", "error", err)
+	}
+	secrets := services.NewSecrets(secretProvider, cfg.SecretValue)
+	facebookService := services.NewFacebookService(cfg, secrets, metrics)
+	auditLog := services.NewAuditLog()
+	storageService := services.NewStorageService(auditLog)
+	// Tokens start being encrypted once a key appears, even on rotation
+	tokenCipher := services.NewTokenCipher(secrets)
+	storageService.EncryptTokensWith(tokenCipher)
+	if !tokenCipher.Enabled() {
+		slog.Warn("TOKEN_ENCRYPTION_KEY not set, access tokens are stored unencrypted")
+	}
+	tenantService := services.NewTenantService()
+	whatsappService := services.NewWhatsAppService(cfg, facebookService, metrics)
+	webhookArchive := services.NewWebhookArchive(cfg.WebhookArchiveLimit)
+	eventBus := services.NewEventBus()
+	forwardingService := services.NewForwardingService(cfg)
+	eventBus.Subscribe(forwardingService.HandleEvent)
+	metrics.RegisterQueue("forwarding", forwardingService.QueueDepth)
+	eventStream := services.NewEventStream(cfg.EventStreamBacklog)
+	eventBus.Subscribe(eventStream.HandleEvent)
+	tokenRefresher := services.NewTokenRefresher(cfg, facebookService, storageService, eventBus, metrics)
+	phoneSync := services.NewPhoneNumberSync(facebookService, storageService, eventBus, metrics)
+	eventBus.Subscribe(phoneSync.HandleEvent)
+	messagingLimits := services.NewMessagingLimits()
+	eventBus.Subscribe(messagingLimits.HandleEvent)
+	outboundQueue, err := services.NewOutboundQueue(cfg, whatsappService, storageService, messagingLimits, metrics)
+	if err != nil {
+		fatal("failed to initialize outbound queue", "error", err)
+	}
+	eventBus.Subscribe(outboundQueue.HandleEvent)
+	metrics.RegisterQueue("outbound", outboundQueue.QueueDepth)
+	authService, err := services.NewAuthService(cfg)
+	if err != nil {
+		fatal("failed to initialize authentication", "error", err)
+	}
+	bootstrapAPIKey(authService, cfg)
+	authorizer := services.NewAuthorizer()
 
-		if allowed {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
+	healthService := services.NewHealthService(services.ReadBuildInfo(version))
+	healthService.AddCheck("storage", true, storageService.Ping)
+	healthService.AddCheck("forwarding_queue", true,
+		services.QueueBacklogCheck("forwarding", forwardingService.QueueDepth, cfg.ReadinessMaxQueueBacklog))
+	// Non-critical: queued sends wait rather than fail
+	healthService.AddCheck("outbound_queue", false, func(ctx context.Context) error {
+		return errors.Join(outboundQueue.Ping(ctx),
+			services.QueueBacklogCheck("outbound", outboundQueue.QueueDepth, cfg.ReadinessMaxQueueBacklog)(ctx))
+	})
+	healthService.AddCheck("config", true, func(context.Context) error { return cfg.Validate() })
+	if cfg.SecretsExternal() {
+		// The config check covers secrets held in the configuration
+		healthService.AddCheck("secrets", true, func(context.Context) error { return secrets.Check(cfg.RequiredSecrets()...) })
+	}
+	if cfg.ReadinessCheckGraph {
+		healthService.AddCheck("graph_api", false, facebookService.Ping)
+	}
+	var certs *services.CertReloader
+	if cfg.TLSEnabled() {
+		if certs, err = services.NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+			fatal("failed to load TLS certificate", "error", err)
 		}
+		healthService.AddCheck("tls_certificate", false, certs.ExpiryCheck(14*24*time.Hour))
+	}
+
+	// Initialize handlers
+	authHandler := handlers.NewAuthHandler(cfg, facebookService, whatsappService, storageService, authorizer, metrics)
+	businessHandler := handlers.NewBusinessHandler(storageService, whatsappService, messagingLimits, outboundQueue, authorizer, auditLog, metrics)
+	webhookHandler := handlers.NewWebhookHandler(cfg, secrets, webhookArchive, eventBus, storageService, auditLog, metrics)
+	forwardingHandler := handlers.NewForwardingHandler(forwardingService, auditLog)
+	streamHandler := handlers.NewStreamHandler(eventStream)
+	apiKeyHandler := handlers.NewAPIKeyHandler(authService, authorizer, auditLog)
+	tenantHandler := handlers.NewTenantHandler(tenantService, authService, auditLog)
+	auditHandler := handlers.NewAuditHandler(auditLog)
+	templatesHandler := handlers.NewTemplatesHandler(cfg, facebookService, whatsappService)
+	healthHandler := handlers.NewHealthHandler(healthService)
 
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	// Routes use method-qualified patterns, so the mux itself answers
+	// unsupported methods with 405 and an Allow header; WithJSONErrors turns
+	// those and 404s into the standard error envelope. CORS and request IDs
+	// wrap the whole mux so preflights and 405s get them too.
+	mux := http.NewServeMux()
+	var routes []string
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.HandleFunc(pattern, h)
+		routes = append(routes, pattern)
+	}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+	// Authenticated API routes; only health checks, metrics, the API spec
+	// and the Meta webhook are public. BusinessHandler checks its permissions itself.
+	authed := func(next http.HandlerFunc) http.HandlerFunc {
+		return handlers.RequireAuth(authService, next)
+	}
+	api := func(permission models.Permission, next http.HandlerFunc) http.HandlerFunc {
+		return authed(handlers.RequirePermission(authorizer, permission, next))
+	}
+
+	handle("GET /health", healthHandler.Liveness)
+	handle("GET /healthz", healthHandler.Liveness)
+	handle("GET /readyz", healthHandler.Readiness)
+
+	handle("GET /metrics", handlers.ServeMetrics(metrics))
+	handle("GET /api/openapi.json", openapi.ServeSpec)
+	handle("POST /api/whatsapp/setup", api(models.PermissionOnboardAccounts, authHandler.HandleEmbeddedSignup))
+	handle("POST /api/whatsapp/templates", api(models.PermissionManageTemplates, templatesHandler.ListTemplates))
+	handle("GET /api/whatsapp/webhooks", webhookHandler.VerifyWebhook)
+	handle("POST /api/whatsapp/webhooks", webhookHandler.ReceiveWebhook)
+
+	handle("GET /api/business/accounts", authed(businessHandler.ListAccounts))
+	handle("GET /api/business/accounts/{wabaID}", authed(businessHandler.GetAccount))
+	handle("DELETE /api/business/accounts/{wabaID}", authed(businessHandler.DeleteAccount))
+	handle("GET /api/business/accounts/{wabaID}/phone-numbers", authed(businessHandler.ListPhoneNumbers))
+	handle("GET /api/business/accounts/{wabaID}/phone-numbers/{phoneNumberID}/history", authed(businessHandler.PhoneNumberHistory))
+	handle("GET /api/business/accounts/{wabaID}/phone-numbers/{phoneNumberID}/capacity", authed(businessHandler.PhoneNumberCapacity))
+	handle("POST /api/business/accounts/{wabaID}/messages", authed(businessHandler.SendMessage))
+	handle("POST /api/business/accounts/{wabaID}/messages/bulk", authed(businessHandler.SendBulkMessages))
+	handle("POST /api/business/accounts/{wabaID}/messages/queue", authed(businessHandler.QueueMessage))
+	handle("GET /api/business/accounts/{wabaID}/messages/queue/{messageID}", authed(businessHandler.GetQueuedMessage))
+	handle("GET /api/business/export", authed(businessHandler.ExportData))
+
+	handle("GET /api/webhooks/events", api(models.PermissionReadAccounts, webhookHandler.ListEvents))
+	handle("POST /api/webhooks/events/{id}/replay", api(models.PermissionManageWebhooks, webhookHandler.ReplayEvent))
+	handle("GET /api/webhooks/rejected", api(models.PermissionReadAccounts, webhookHandler.ListRejected))
+	handle("GET /api/events/stream", api(models.PermissionReadAccounts, streamHandler.Stream))
+
+	handle("GET /api/forwarding/subscriptions", api(models.PermissionReadAccounts, forwardingHandler.ListSubscriptions))
+	handle("POST /api/forwarding/subscriptions", api(models.PermissionManageWebhooks, forwardingHandler.CreateSubscription))
+	handle("GET /api/forwarding/subscriptions/{id}", api(models.PermissionReadAccounts, forwardingHandler.GetSubscription))
+	handle("PUT /api/forwarding/subscriptions/{id}", api(models.PermissionManageWebhooks, forwardingHandler.UpdateSubscription))
+	handle("DELETE /api/forwarding/subscriptions/{id}", api(models.PermissionManageWebhooks, forwardingHandler.DeleteSubscription))
+	handle("GET /api/forwarding/subscriptions/{id}/deliveries", api(models.PermissionReadAccounts, forwardingHandler.ListDeliveries))
+
+	handle("GET /api/auth/keys", api(models.PermissionManageAPIKeys, apiKeyHandler.ListKeys))
+	handle("POST /api/auth/keys", api(models.PermissionManageAPIKeys, apiKeyHandler.CreateKey))
+	handle("DELETE /api/auth/keys/{id}", api(models.PermissionManageAPIKeys, apiKeyHandler.RevokeKey))
+	handle("POST /api/auth/session", authed(apiKeyHandler.CreateSession))
+	handle("GET /api/auth/denials", api(models.PermissionViewAudit, apiKeyHandler.ListDenials))
+	handle("GET /api/audit", api(models.PermissionViewAudit, auditHandler.List))
+	handle("GET /api/tenants", api(models.PermissionManageAPIKeys, tenantHandler.ListTenants))
+	handle("POST /api/tenants", api(models.PermissionManageAPIKeys, tenantHandler.CreateTenant))
+
+	handler := handlers.LimitBody(cfg.HTTPMaxBodyBytes, handlers.WithJSONErrors(mux))
+	cors, corsRoutes := corsPolicies(cfg)
+	return &server{
+		handler:    handlers.CORS(cors, corsRoutes, handlers.WithRequestInfo(cfg.TrustProxyHeaders, handlers.LogRequests(handler))),
+		routes:     routes,
+		events:     eventStream,
+		forwarding: forwardingService,
+		outbound:   outboundQueue,
+		certs:      certs,
+		secrets:    secrets,
+		tokens:     tokenRefresher,
+		phones:     phoneSync,
+	}
+}
+
+// httpServer wraps the application in an http.Server with the configured
+// timeouts and limits. Event streams are closed as soon as shutdown starts,
+// since they would otherwise never finish.
+func (s *server) httpServer(cfg *config.Config) *http.Server {
+	hs := &http.Server{
+		Addr:              ":" + cfg.ServerPort,
+		Handler:           s.handler,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	if s.certs != nil {
+		hs.TLSConfig = &tls.Config{
+			GetCertificate: s.certs.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
 		}
+	}
+	hs.RegisterOnShutdown(s.events.Close)
+	return hs
+}
+
+// redirectServer listens for plain HTTP on HTTP_REDIRECT_PORT and sends
+// every request to the HTTPS port.
+func redirectServer(cfg *config.Config) *http.Server {
+	return &http.Server{
+		Addr:              ":" + cfg.HTTPRedirectPort,
+		Handler:           handlers.RedirectToHTTPS(cfg.ServerPort),
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
 
-		next(w, r)
+// listenAndServe serves hs over TLS when a certificate is configured.
+func (s *server) listenAndServe(hs *http.Server) error {
+	if s.certs != nil {
+		// The certificate comes from TLSConfig.GetCertificate
+		return hs.ListenAndServeTLS("", "")
+	}
+	return hs.ListenAndServe()
+}
+
+// shutdown stops accepting connections, waits for in-flight requests on
+// every server, then for queued forwarding deliveries and outbound sends in
+// flight, all within ctx. A failed step does not skip the ones after it.
+func (s *server) shutdown(ctx context.Context, servers ...*http.Server) error {
+	var problems []error
+	for _, hs := range servers {
+		if err := hs.Shutdown(ctx); err != nil {
+			problems = append(problems, fmt.Errorf("drain requests on %s: %w", hs.Addr, err))
+		}
 	}
+	if err := s.forwarding.Shutdown(ctx); err != nil {
+		problems = append(problems, fmt.Errorf("drain forwarding queue: %w", err))
+	}
+	if err := s.outbound.Shutdown(ctx); err != nil {
+		problems = append(problems, fmt.Errorf("drain outbound queue: %w", err))
+	}
+	return errors.Join(problems...)
 }
 
 func main() {
 	// Load configuration
-	cfg := config.Load()
-
-	// Initialize services
-	facebookService := services.NewFacebookService(cfg)
-	storageService := services.NewStorageService()
-	whatsappService := services.NewWhatsAppService(cfg, facebookService)
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("invalid configuration", "error", err)
+	}
+	if cfg.PrintConfig {
+		cfg.Print(os.Stdout)
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "configuration is invalid:\n%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	logger, err := services.NewLogger(os.Stderr, cfg)
+	if err != nil {
+		fatal("invalid logging configuration", "error", err)
+	}
+	slog.SetDefault(logger)
+	if err := cfg.Validate(); err != nil {
+		fatal("invalid configuration", "error", err)
+	}
 
-	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(facebookService, whatsappService, storageService)
-	businessHandler := handlers.NewBusinessHandler(storageService)
-	webhookHandler := handlers.NewWebhookHandler(cfg)
-
-	// Routes with CORS
-	http.HandleFunc("/health", enableCORS(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, `{"status":"ok","timestamp":"%s"}`,
-			fmt.Sprintf("%d", 1234567890))
-	}, cfg.AllowedOrigins))
-
-	http.HandleFunc("/api/whatsapp/setup", enableCORS(authHandler.HandleEmbeddedSignup, cfg.AllowedOrigins))
-	http.HandleFunc("/api/business/accounts", enableCORS(businessHandler.ListAccounts, cfg.AllowedOrigins))
-	http.HandleFunc("/api/business/account", enableCORS(businessHandler.GetAccount, cfg.AllowedOrigins))
-	http.HandleFunc("/api/business/export", enableCORS(businessHandler.ExportData, cfg.AllowedOrigins))
-	http.HandleFunc("/api/whatsapp/webhooks", enableCORS(webhookHandler.HandleWebhook, cfg.AllowedOrigins))
+	srv := newServer(cfg)
+	// Validate can only check secrets held in the configuration itself
+	if err := srv.secrets.Check(cfg.RequiredSecrets()...); err != nil {
+		fatal("required secrets are missing", "provider", cfg.SecretsProvider, "error", err)
+	}
 
 	// Start server
-	fmt.Printf("🚀 WhatsApp Server starting on port %s\n", cfg.ServerPort)
-	fmt.Printf("📡 Health check: http://localhost:%s/health\n", cfg.ServerPort)
-	fmt.Printf("🔗 Embedded signup: http://localhost:%s/api/whatsapp/setup\n", cfg.ServerPort)
-	fmt.Printf("📞 Webhook endpoint: http://localhost:%s/api/whatsapp/webhooks\n", cfg.ServerPort)
+	base := "http://localhost:" + cfg.ServerPort
+	if cfg.TLSEnabled() {
+		base = "https://localhost:" + cfg.ServerPort
+	}
+	slog.Info("server starting",
+		"port", cfg.ServerPort,
+		"tls", cfg.TLSEnabled(),
+		"version", version,
+		"readiness", base+"/readyz",
+		"embedded_signup", base+"/api/whatsapp/setup",
+		"webhook_endpoint", base+"/api/whatsapp/webhooks")
 
 	if cfg.WebhookCallbackURL != "" {
-		fmt.Printf("🔔 Webhook callback URL: %s\n", cfg.WebhookCallbackURL)
+		slog.Info("webhook callback configured", "url", cfg.WebhookCallbackURL)
 	} else {
-		fmt.Printf("⚠️  Webhook callback URL not configured - webhooks will not work\n")
+		slog.Warn("webhook callback URL not configured, webhooks will not work")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	hs := srv.httpServer(cfg)
+	servers := []*http.Server{hs}
+	serveErr := make(chan error, 2)
+	go func() { serveErr <- srv.listenAndServe(hs) }()
+	go srv.secrets.Run(ctx, cfg.SecretsRefreshInterval)
+	go srv.tokens.Run(ctx, cfg.TokenRefreshInterval)
+	go srv.phones.Run(ctx, cfg.PhoneSyncInterval)
+	go srv.outbound.Run(ctx)
+
+	if srv.certs != nil {
+		go srv.certs.Watch(ctx, cfg.TLSReloadInterval)
+		go reloadOnHangup(ctx, srv.certs)
+		if cfg.HTTPRedirectPort != "" {
+			redirect := redirectServer(cfg)
+			servers = append(servers, redirect)
+			go func() { serveErr <- redirect.ListenAndServe() }()
+			slog.Info("redirecting HTTP to HTTPS", "port", cfg.HTTPRedirectPort)
+		}
+	}
+
+	select {
+	case err := <-serveErr:
+		fatal("server stopped", "error", err)
+	case <-ctx.Done():
 	}
+	stop() // a second signal exits immediately
+
+	slog.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.shutdown(shutdownCtx, servers...); err != nil {
+		fatal("shutdown incomplete", "error", err)
+	}
+	slog.Info("shutdown complete")
+}
+
+// reloadOnHangup reloads the TLS certificate on SIGHUP, for rotations that
+// should not wait for the next poll.
+func reloadOnHangup(ctx context.Context, certs *services.CertReloader) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+		if err := certs.Reload(); err != nil {
+			slog.Error("TLS certificate reload failed, keeping the current certificate", "error", err)
+			continue
+		}
+		slog.Info("TLS certificate reloaded", "not_after", certs.NotAfter())
+	}
+}
 
-	log.Fatal(http.ListenAndServe(":"+cfg.ServerPort, nil))
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,691 @@
+package main
+
+import (
+	"back/client"
+	"back/config"
+	"back/fakegraph"
+	"back/models"
+	"back/openapi"
+	"back/services"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testAPIKey = "wak_test_0123456789abcdefghijklmnop"
+
+// specHarness runs the fully wired server against the fake Graph API and
+// checks every response against the OpenAPI document.
+type specHarness struct {
+	t       *testing.T
+	doc     *openapi.Document
+	graph   *fakegraph.Server
+	cfg     *config.Config
+	srv     *server
+	url     string
+	covered map[string]bool // "METHOD /spec/path" of operations exercised
+}
+
+func newSpecHarness(t *testing.T) *specHarness {
+	t.Helper()
+	doc, err := openapi.Parse(openapi.Spec)
+	if err != nil {
+		t.Fatalf("parse openapi.json: %v", err)
+	}
+	graph := fakegraph.New()
+	t.Cleanup(graph.Close)
+
+	cfg := &config.Config{
+		FacebookAppID:       graph.AppID,
+		FacebookAppSecret:   graph.AppSecret,
+		WebhookVerifyToken:  "verify-me",
+		WebhookCallbackURL:  "https://example.test/api/whatsapp/webhooks",
+		GraphAPIBaseURL:     graph.URL,
+		WebhookArchiveLimit: 100,
+		EventStreamBacklog:  100,
+		OutboundMaxAttempts: 3,
+		AuthSigningKey:      strings.Repeat("k", 32),
+		AuthSessionTTL:      time.Hour,
+		AuthBootstrapAPIKey: testAPIKey,
+	}
+	srv := newServer(cfg)
+	ts := httptest.NewServer(srv.handler)
+	t.Cleanup(ts.Close)
+
+	return &specHarness{t: t, doc: doc, graph: graph, cfg: cfg, srv: srv, url: ts.URL, covered: map[string]bool{}}
+}
+
+// call sends a request to path, which must match the documented specPath,
+// and validates the response status and body against the operation.
+func (h *specHarness) call(method, specPath, path, key string, body interface{}, header http.Header) (int, interface{}) {
+	h.t.Helper()
+	op, ok := h.doc.Paths[specPath][strings.ToLower(method)]
+	if !ok {
+		h.t.Fatalf("%s %s is not documented", method, specPath)
+	}
+	h.covered[method+" "+specPath] = true
+
+	var reader io.Reader
+	if raw, ok := body.([]byte); ok {
+		reader = bytes.NewReader(raw)
+	} else if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req, _ := http.NewRequest(method, h.url+path, reader)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+
+	documented, ok := op.Responses[fmt.Sprint(resp.StatusCode)]
+	if !ok {
+		h.t.Errorf("%s %s: status %d is not documented (body %s)", method, path, resp.StatusCode, data)
+		return resp.StatusCode, nil
+	}
+	contentType := strings.Split(resp.Header.Get("Content-Type"), ";")[0]
+	media, ok := documented.Content[contentType]
+	if !ok {
+		h.t.Errorf("%s %s: %d response has undocumented content type %q", method, path, resp.StatusCode, contentType)
+		return resp.StatusCode, nil
+	}
+	if contentType != "application/json" {
+		return resp.StatusCode, string(data)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		h.t.Errorf("%s %s: invalid JSON %s", method, path, data)
+		return resp.StatusCode, nil
+	}
+	for _, problem := range validateSchema(h.doc, media.Schema, decoded, "body") {
+		h.t.Errorf("%s %s (%d): %s", method, path, resp.StatusCode, problem)
+	}
+	return resp.StatusCode, decoded
+}
+
+// validateSchema reports where value does not match schema. Objects with
+// listed properties must not carry undocumented fields.
+func validateSchema(doc *openapi.Document, schema *openapi.Schema, value interface{}, at string) []string {
+	s := doc.Resolve(schema)
+	if s == nil {
+		return []string{at + ": unresolvable $ref " + schema.Ref}
+	}
+	if value == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return []string{at + ": null but not nullable"}
+	}
+
+	var problems []string
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: want object, got %T", at, value)}
+		}
+		for _, r := range s.Required {
+			if _, ok := obj[r]; !ok {
+				problems = append(problems, at+"."+r+": required field missing")
+			}
+		}
+		for k, v := range obj {
+			switch prop, values := s.Properties[k], s.MapValues(); {
+			case prop != nil:
+				problems = append(problems, validateSchema(doc, prop, v, at+"."+k)...)
+			case values != nil:
+				problems = append(problems, validateSchema(doc, values, v, at+"."+k)...)
+			case len(s.Properties) > 0 && !s.AllowsAdditional():
+				problems = append(problems, at+"."+k+": undocumented field")
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: want array, got %T", at, value)}
+		}
+		for i, item := range items {
+			problems = append(problems, validateSchema(doc, s.Items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: want string, got %T", at, value)}
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				problems = append(problems, at+": not a date-time: "+str)
+			}
+		}
+		if len(s.Enum) > 0 && !contains(s.Enum, str) {
+			problems = append(problems, fmt.Sprintf("%s: %q not in %v", at, str, s.Enum))
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			return []string{fmt.Sprintf("%s: want %s, got %T", at, s.Type, value)}
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			problems = append(problems, fmt.Sprintf("%s: %v is not an integer", at, n))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s: want boolean, got %T", at, value)}
+		}
+	}
+	return problems
+}
+
+func contains(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
+
+// operations lists every documented operation as "METHOD /path".
+func operations(doc *openapi.Document) []string {
+	var ops []string
+	for path, methods := range doc.Paths {
+		for method := range methods {
+			ops = append(ops, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	h := newSpecHarness(t)
+
+	documented := map[string]bool{}
+	for _, op := range operations(h.doc) {
+		documented[op] = true
+	}
+	registered := map[string]bool{}
+	for _, route := range h.srv.routes {
+		registered[route] = true
+		if !documented[route] {
+			t.Errorf("route %s is not in openapi.json", route)
+		}
+	}
+	for op := range documented {
+		if !registered[op] {
+			t.Errorf("openapi.json documents %s, which is not registered", op)
+		}
+	}
+
+	ids := map[string]bool{}
+	for path, methods := range h.doc.Paths {
+		for method, op := range methods {
+			if op.OperationID == "" || ids[op.OperationID] {
+				t.Errorf("%s %s: missing or duplicate operationId %q", method, path, op.OperationID)
+			}
+			ids[op.OperationID] = true
+		}
+	}
+}
+
+func TestOpenAPISpecSecurityMatchesHandlers(t *testing.T) {
+	h := newSpecHarness(t)
+
+	// A read-only key shows which operations enforce a stronger permission
+	_, created := h.call("POST", "/api/auth/keys", "/api/auth/keys", testAPIKey,
+		map[string]string{"name": "reader", "role": string(models.RoleReadOnly)}, nil)
+	readOnlyKey := created.(map[string]interface{})["api_key"].(string)
+	authz := services.NewAuthorizer()
+	reader := &models.Principal{TenantID: models.DefaultTenantID, Role: models.RoleReadOnly}
+
+	for path, methods := range h.doc.Paths {
+		for method, op := range methods {
+			method = strings.ToUpper(method)
+			if method == "GET" && path == "/api/events/stream" {
+				continue // would block; covered by the 401/403 of the wrapper it shares
+			}
+			concrete := strings.NewReplacer("{wabaID}", "waba-x", "{id}", "x").Replace(path)
+
+			status, body := h.call(method, path, concrete, "", []byte("{}"), nil)
+			code := errorCode(body)
+			if op.Public() && code == "unauthenticated" {
+				t.Errorf("%s %s is documented as public but requires credentials", method, path)
+			}
+			if !op.Public() && (status != http.StatusUnauthorized || code != "unauthenticated") {
+				t.Errorf("%s %s without credentials: status %d code %q, want 401 unauthenticated", method, path, status, code)
+			}
+
+			if op.Public() || op.Permission == "" || authz.Can(reader, models.Permission(op.Permission)) {
+				continue
+			}
+			status, body = h.call(method, path, concrete, readOnlyKey, []byte("{}"), nil)
+			if status != http.StatusForbidden || errorCode(body) != "forbidden" {
+				t.Errorf("%s %s as read_only: status %d, want 403 for x-permission %s", method, path, status, op.Permission)
+			}
+		}
+	}
+}
+
+func errorCode(body interface{}) string {
+	envelope, _ := body.(map[string]interface{})
+	apiErr, _ := envelope["error"].(map[string]interface{})
+	code, _ := apiErr["code"].(string)
+	return code
+}
+
+// TestOpenAPIResponsesMatchHandlers walks through every operation with real
+// data and validates each response against its documented schema.
+func TestOpenAPIResponsesMatchHandlers(t *testing.T) {
+	h := newSpecHarness(t)
+	key := testAPIKey
+
+	token := h.graph.AddAuthCode("code-1")
+	h.graph.AddBusiness(token, models.FacebookBusinessAccount{ID: "waba-1", Name: "Acme", VerificationStatus: "verified"})
+	h.graph.AddPhoneNumber("waba-1", models.FacebookPhoneNumber{ID: "pn-1", DisplayPhoneNumber: "+1 555 0100", VerifiedName: "Acme", Status: "CONNECTED"})
+	h.graph.AddTemplate("waba-1", models.WhatsAppTemplate{ID: "tpl-1", Name: "welcome", Language: "en_US", Status: "APPROVED", Category: "UTILITY"})
+	h.graph.AddAuthCode("code-2")
+
+	expect := func(want, got int, what string) {
+		t.Helper()
+		if got != want {
+			t.Fatalf("%s: status %d, want %d", what, got, want)
+		}
+	}
+
+	status, _ := h.call("GET", "/health", "/health", "", nil, nil)
+	expect(200, status, "health")
+	status, _ = h.call("GET", "/healthz", "/healthz", "", nil, nil)
+	expect(200, status, "liveness")
+	status, ready := h.call("GET", "/readyz", "/readyz", "", nil, nil)
+	expect(200, status, "readiness")
+	if checks := ready.(map[string]interface{})["checks"].(map[string]interface{}); len(checks) != 4 {
+		t.Errorf("readiness checks = %v, want storage, forwarding_queue, outbound_queue and config", checks)
+	}
+	status, _ = h.call("GET", "/api/openapi.json", "/api/openapi.json", "", nil, nil)
+	expect(200, status, "openapi.json")
+
+	status, _ = h.call("POST", "/api/whatsapp/setup", "/api/whatsapp/setup", key, map[string]string{"authorization_code": "code-1"}, nil)
+	expect(200, status, "setup")
+	status, _ = h.call("POST", "/api/whatsapp/setup", "/api/whatsapp/setup", key, map[string]string{"authorization_code": "code-1"}, nil)
+	expect(400, status, "setup with a used code")
+	status, templates := h.call("POST", "/api/whatsapp/templates", "/api/whatsapp/templates", key, map[string]string{"authorization_code": "code-2", "waba_id": "waba-1"}, nil)
+	expect(200, status, "templates")
+	if tokenInfo, _ := templates.(map[string]any)["token_info"].(map[string]any); tokenInfo["full_access_token"] != nil {
+		t.Error("templates response carries the full access token")
+	}
+
+	status, _ = h.call("GET", "/api/business/accounts", "/api/business/accounts", key, nil, nil)
+	expect(200, status, "list accounts")
+	status, _ = h.call("GET", "/api/business/accounts/{wabaID}", "/api/business/accounts/waba-1", key, nil, nil)
+	expect(200, status, "get account")
+	status, _ = h.call("GET", "/api/business/accounts/{wabaID}", "/api/business/accounts/waba-missing", key, nil, nil)
+	expect(404, status, "get missing account")
+	status, _ = h.call("GET", "/api/business/accounts/{wabaID}/phone-numbers", "/api/business/accounts/waba-1/phone-numbers", key, nil, nil)
+	expect(200, status, "phone numbers")
+	status, _ = h.call("GET", "/api/business/accounts/{wabaID}/phone-numbers/{phoneNumberID}/history", "/api/business/accounts/waba-1/phone-numbers/pn-1/history", key, nil, nil)
+	expect(200, status, "phone number history")
+	status, _ = h.call("GET", "/api/business/accounts/{wabaID}/phone-numbers/{phoneNumberID}/history", "/api/business/accounts/waba-1/phone-numbers/pn-missing/history", key, nil, nil)
+	expect(404, status, "history of a missing phone number")
+	status, _ = h.call("GET", "/api/business/accounts/{wabaID}/phone-numbers/{phoneNumberID}/capacity", "/api/business/accounts/waba-1/phone-numbers/pn-1/capacity", key, nil, nil)
+	expect(200, status, "phone number capacity")
+	status, _ = h.call("GET", "/api/business/accounts/{wabaID}/phone-numbers/{phoneNumberID}/capacity", "/api/business/accounts/waba-1/phone-numbers/pn-missing/capacity", key, nil, nil)
+	expect(404, status, "capacity of a missing phone number")
+	status, _ = h.call("POST", "/api/business/accounts/{wabaID}/messages", "/api/business/accounts/waba-1/messages", key, map[string]string{"to": "15550100", "text": "Hello"}, nil)
+	expect(200, status, "send message")
+	status, _ = h.call("POST", "/api/business/accounts/{wabaID}/messages", "/api/business/accounts/waba-1/messages", key, map[string]string{"to": "15550100"}, nil)
+	expect(400, status, "send message without text")
+	status, _ = h.call("POST", "/api/business/accounts/{wabaID}/messages/bulk", "/api/business/accounts/waba-1/messages/bulk", key, map[string]any{"to": []string{"15550101", "15550102"}, "text": "Hello", "on_limit": "throttle"}, nil)
+	expect(200, status, "bulk send")
+	status, _ = h.call("POST", "/api/business/accounts/{wabaID}/messages/bulk", "/api/business/accounts/waba-1/messages/bulk", key, map[string]any{"to": []string{"15550101"}, "text": "Hello", "on_limit": "later"}, nil)
+	expect(400, status, "bulk send with an unknown on_limit")
+	manyRecipients := make([]string, 300)
+	for i := range manyRecipients {
+		manyRecipients[i] = fmt.Sprintf("1555%07d", i)
+	}
+	status, _ = h.call("POST", "/api/business/accounts/{wabaID}/messages/bulk", "/api/business/accounts/waba-1/messages/bulk", key, map[string]any{"to": manyRecipients, "text": "Hello", "queue": true}, nil)
+	expect(429, status, "bulk send over the messaging limit")
+	status, _ = h.call("POST", "/api/business/accounts/{wabaID}/messages/bulk", "/api/business/accounts/waba-1/messages/bulk", key, map[string]any{"to": manyRecipients, "text": "Hello"}, nil)
+	expect(400, status, "large bulk send without queue")
+	status, _ = h.call("POST", "/api/business/accounts/{wabaID}/messages/bulk", "/api/business/accounts/waba-1/messages/bulk", key, map[string]any{"to": []string{"15550103"}, "text": "Hello", "queue": true}, nil)
+	expect(202, status, "queued bulk send")
+	status, queued := h.call("POST", "/api/business/accounts/{wabaID}/messages/queue", "/api/business/accounts/waba-1/messages/queue", key, map[string]string{"to": "15550104", "text": "Hello"}, nil)
+	expect(202, status, "queue message")
+	status, _ = h.call("POST", "/api/business/accounts/{wabaID}/messages/queue", "/api/business/accounts/waba-1/messages/queue", key, map[string]string{"to": "15550104", "phone_number_id": "pn-other", "text": "Hello"}, nil)
+	expect(400, status, "queue message from another account's number")
+	status, _ = h.call("POST", "/api/business/accounts/{wabaID}/messages/queue", "/api/business/accounts/waba-missing/messages/queue", key, map[string]string{"to": "15550104", "text": "Hello"}, nil)
+	expect(404, status, "queue message for a missing account")
+	queuedID, _ := queued.(map[string]any)["message"].(map[string]any)["id"].(string)
+	status, _ = h.call("GET", "/api/business/accounts/{wabaID}/messages/queue/{messageID}", "/api/business/accounts/waba-1/messages/queue/"+queuedID, key, nil, nil)
+	expect(200, status, "queued message")
+	status, _ = h.call("GET", "/api/business/accounts/{wabaID}/messages/queue/{messageID}", "/api/business/accounts/waba-1/messages/queue/out_missing", key, nil, nil)
+	expect(404, status, "missing queued message")
+	status, _ = h.call("GET", "/api/business/export", "/api/business/export", key, nil, nil)
+	expect(200, status, "export")
+
+	// Meta's side of the webhook
+	status, _ = h.call("GET", "/api/whatsapp/webhooks", "/api/whatsapp/webhooks?hub.mode=subscribe&hub.verify_token=verify-me&hub.challenge=42", "", nil, nil)
+	expect(200, status, "verify webhook")
+	status, _ = h.call("GET", "/api/whatsapp/webhooks", "/api/whatsapp/webhooks?hub.mode=subscribe&hub.verify_token=wrong", "", nil, nil)
+	expect(403, status, "verify webhook with wrong token")
+	payload := []byte(`{"object":"whatsapp_business_account","entry":[{"id":"waba-1","changes":[{"field":"messages","value":{"messaging_product":"whatsapp","metadata":{"phone_number_id":"pn-1"},"statuses":[{"id":"wamid.1","status":"delivered","timestamp":"1700000000","recipient_id":"15550100"}]}}]}]}`)
+	signed := http.Header{services.SignatureHeader: {services.SignWebhookPayload(h.cfg.FacebookAppSecret, payload)}}
+	status, _ = h.call("POST", "/api/whatsapp/webhooks", "/api/whatsapp/webhooks", "", payload, signed)
+	expect(200, status, "receive webhook")
+	status, _ = h.call("POST", "/api/whatsapp/webhooks", "/api/whatsapp/webhooks", "", payload, nil)
+	expect(401, status, "receive unsigned webhook")
+
+	status, events := h.call("GET", "/api/webhooks/events", "/api/webhooks/events?field=messages", key, nil, nil)
+	expect(200, status, "list webhook events")
+	eventID := events.(map[string]interface{})["events"].([]interface{})[0].(map[string]interface{})["id"].(string)
+	status, _ = h.call("POST", "/api/webhooks/events/{id}/replay", "/api/webhooks/events/"+eventID+"/replay", key, nil, nil)
+	expect(200, status, "replay webhook event")
+	status, _ = h.call("GET", "/api/webhooks/events", "/api/webhooks/events?limit=zero", key, nil, nil)
+	expect(400, status, "list webhook events with a bad limit")
+
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer sink.Close()
+	status, sub := h.call("POST", "/api/forwarding/subscriptions", "/api/forwarding/subscriptions", key, map[string]interface{}{"target_url": sink.URL}, nil)
+	expect(201, status, "create subscription")
+	subPath := "/api/forwarding/subscriptions/" + sub.(map[string]interface{})["subscription"].(map[string]interface{})["id"].(string)
+	status, _ = h.call("GET", "/api/forwarding/subscriptions", "/api/forwarding/subscriptions", key, nil, nil)
+	expect(200, status, "list subscriptions")
+	status, _ = h.call("GET", "/api/forwarding/subscriptions/{id}", subPath, key, nil, nil)
+	expect(200, status, "get subscription")
+	status, _ = h.call("PUT", "/api/forwarding/subscriptions/{id}", subPath, key, map[string]interface{}{"target_url": sink.URL, "enabled": false}, nil)
+	expect(200, status, "update subscription")
+	status, _ = h.call("GET", "/api/forwarding/subscriptions/{id}/deliveries", subPath+"/deliveries", key, nil, nil)
+	expect(200, status, "list deliveries")
+	status, _ = h.call("DELETE", "/api/forwarding/subscriptions/{id}", subPath, key, nil, nil)
+	expect(200, status, "delete subscription")
+	status, _ = h.call("GET", "/api/forwarding/subscriptions/{id}", subPath, key, nil, nil)
+	expect(404, status, "get deleted subscription")
+
+	status, created := h.call("POST", "/api/auth/keys", "/api/auth/keys", key, map[string]string{"name": "agent", "role": "agent"}, nil)
+	expect(201, status, "create key")
+	agent := created.(map[string]interface{})
+	status, _ = h.call("POST", "/api/auth/keys", "/api/auth/keys", agent["api_key"].(string), map[string]string{"name": "x"}, nil)
+	expect(403, status, "agent creates key")
+	status, _ = h.call("GET", "/api/auth/keys", "/api/auth/keys", key, nil, nil)
+	expect(200, status, "list keys")
+	status, _ = h.call("POST", "/api/auth/session", "/api/auth/session", key, nil, nil)
+	expect(200, status, "create session")
+	status, _ = h.call("GET", "/api/auth/denials", "/api/auth/denials", key, nil, nil)
+	expect(200, status, "list denials")
+	status, _ = h.call("DELETE", "/api/auth/keys/{id}", "/api/auth/keys/"+agent["key"].(map[string]interface{})["id"].(string), key, nil, nil)
+	expect(200, status, "revoke key")
+	status, _ = h.call("DELETE", "/api/auth/keys/{id}", "/api/auth/keys/key_missing", key, nil, nil)
+	expect(404, status, "revoke missing key")
+	_, created = h.call("POST", "/api/auth/keys", "/api/auth/keys", key, map[string]string{"name": "admin", "role": "admin"}, nil)
+	admin := created.(map[string]interface{})["api_key"].(string)
+	_, created = h.call("POST", "/api/auth/keys", "/api/auth/keys", key, map[string]string{"name": "owner", "role": "owner"}, nil)
+	ownerKeyPath := "/api/auth/keys/" + created.(map[string]interface{})["key"].(map[string]interface{})["id"].(string)
+	status, _ = h.call("DELETE", "/api/auth/keys/{id}", ownerKeyPath, admin, nil, nil)
+	expect(403, status, "admin revokes an owner key")
+
+	status, _ = h.call("POST", "/api/tenants", "/api/tenants", admin, map[string]string{"name": "Globex"}, nil)
+	expect(403, status, "admin creates tenant")
+	status, _ = h.call("POST", "/api/tenants", "/api/tenants", key, map[string]string{"name": "Globex"}, nil)
+	expect(201, status, "create tenant")
+	status, _ = h.call("GET", "/api/tenants", "/api/tenants", key, nil, nil)
+	expect(200, status, "list tenants")
+	status, tenant := h.call("POST", "/api/tenants", "/api/tenants", key, map[string]string{"name": "Initech"}, nil)
+	expect(201, status, "create second tenant")
+	tenantKey := tenant.(map[string]interface{})["api_key"].(string)
+	status, _ = h.call("GET", "/api/webhooks/rejected", "/api/webhooks/rejected", key, nil, nil)
+	expect(200, status, "list rejected webhooks")
+	status, _ = h.call("GET", "/api/webhooks/rejected", "/api/webhooks/rejected", tenantKey, nil, nil)
+	expect(403, status, "list rejected webhooks from another tenant")
+	status, _ = h.call("GET", "/api/audit", "/api/audit", key, nil, nil)
+	expect(200, status, "audit log")
+
+	status, _ = h.call("DELETE", "/api/business/accounts/{wabaID}", "/api/business/accounts/waba-1", key, nil, nil)
+	expect(200, status, "delete account")
+
+	// By now every metric family has seen traffic
+	status, body := h.call("GET", "/metrics", "/metrics", "", nil, nil)
+	expect(200, status, "metrics")
+	for _, series := range []string{
+		`whatsapp_signup_steps_total{step="save",outcome="success"} 1`,
+		`whatsapp_signup_steps_total{step="token_exchange",outcome="failure"} 1`,
+		`whatsapp_webhook_events_total{field="messages",type="message.status"} 1`,
+		`whatsapp_webhook_signature_failures_total 1`,
+		`whatsapp_graph_request_duration_seconds_count{method="POST",endpoint="oauth/access_token"}`,
+		`whatsapp_graph_errors_total{method="POST",endpoint="oauth/access_token",code="100"} 2`,
+		`whatsapp_outbound_messages_total{status="accepted"} 3`,
+		`whatsapp_outbound_messages_total{status="delivered"} 1`,
+		`whatsapp_outbound_messages_total{status="queued"} 2`,
+		`whatsapp_queue_depth{queue="forwarding"}`,
+		`whatsapp_queue_depth{queue="outbound"} 2`,
+	} {
+		if !strings.Contains(body.(string), series) {
+			t.Errorf("metrics missing %s:\n%s", series, body)
+		}
+	}
+
+	// The event stream never ends, so only its headers are checked
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", h.url+"/api/events/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.doc.Paths["/api/events/stream"]["get"].Responses["200"].Content[resp.Header.Get("Content-Type")]; !ok || resp.StatusCode != 200 {
+		t.Errorf("event stream: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	cancel()
+	resp.Body.Close()
+	h.covered["GET /api/events/stream"] = true
+
+	for _, op := range operations(h.doc) {
+		if !h.covered[op] {
+			t.Errorf("%s is documented but not exercised by this test", op)
+		}
+	}
+}
+
+func TestGeneratedClient(t *testing.T) {
+	h := newSpecHarness(t)
+	token := h.graph.AddAuthCode("code-1")
+	h.graph.AddBusiness(token, models.FacebookBusinessAccount{ID: "waba-1", Name: "Acme"})
+	h.graph.AddPhoneNumber("waba-1", models.FacebookPhoneNumber{ID: "pn-1"})
+
+	c := client.New(h.url, testAPIKey)
+	ctx := context.Background()
+
+	setup, err := c.CompleteEmbeddedSignup(ctx, &client.AuthCodeRequest{AuthorizationCode: "code-1"})
+	if err != nil || !setup.Success || setup.BusinessInfo.WABAID != "waba-1" {
+		t.Fatalf("signup: %+v, %v", setup, err)
+	}
+
+	accounts, err := c.ListAccounts(ctx)
+	if err != nil || accounts.Count != 1 || accounts.Accounts[0].PhoneNumbers[0].ID != "pn-1" {
+		t.Fatalf("accounts: %+v, %v", accounts, err)
+	}
+
+	sent, err := c.SendMessage(ctx, "waba-1", &client.SendMessageRequest{To: "15550100", Text: "Hello"})
+	if err != nil || !strings.HasPrefix(sent.MessageID, "wamid.") {
+		t.Fatalf("send: %+v, %v", sent, err)
+	}
+
+	_, err = c.GetAccount(ctx, "waba-missing")
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 || apiErr.Code != "account_not_found" || apiErr.RequestID == "" {
+		t.Fatalf("missing account: %v", err)
+	}
+
+	audit, err := c.ListAuditEntries(ctx, &client.ListAuditEntriesParams{Action: models.AuditAccountCreated, Limit: 5})
+	if err != nil || audit.Count != 1 || !audit.ChainValid {
+		t.Fatalf("audit: %+v, %v", audit, err)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	graph := fakegraph.New()
+	cfg := &config.Config{
+		FacebookAppID:       graph.AppID,
+		FacebookAppSecret:   graph.AppSecret,
+		WebhookCallbackURL:  "https://example.test/api/whatsapp/webhooks",
+		GraphAPIBaseURL:     graph.URL,
+		OutboundMaxAttempts: 3,
+		AuthSigningKey:      strings.Repeat("k", 32),
+		AuthSessionTTL:      time.Hour,
+		AuthBootstrapAPIKey: testAPIKey,
+		ReadinessCheckGraph: true,
+	}
+	ts := httptest.NewServer(newServer(cfg).handler)
+	defer ts.Close()
+
+	readyz := func() (int, models.ReadinessResponse) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body models.ReadinessResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	// Missing webhook verify token is a critical config problem
+	status, body := readyz()
+	if status != http.StatusServiceUnavailable || body.Status != models.HealthUnavailable {
+		t.Fatalf("status %d %q, want 503 unavailable", status, body.Status)
+	}
+	if c := body.Checks["config"]; c.Status != models.HealthFail || !strings.Contains(c.Message, "WEBHOOK_VERIFY_TOKEN") {
+		t.Errorf("config check = %+v", c)
+	}
+	if body.Checks["graph_api"].Status != models.HealthOK || body.Build.Version != version {
+		t.Errorf("graph_api = %+v, build = %+v", body.Checks["graph_api"], body.Build)
+	}
+
+	// An unreachable Graph API only degrades readiness
+	cfg.WebhookVerifyToken = "verify-me"
+	graph.Close()
+	status, body = readyz()
+	if status != http.StatusOK || body.Status != models.HealthDegraded || body.Checks["graph_api"].Status != models.HealthFail {
+		t.Errorf("status %d %q, graph_api %+v; want 200 degraded", status, body.Status, body.Checks["graph_api"])
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	cfg := &config.Config{
+		FacebookAppID:                 graph.AppID,
+		FacebookAppSecret:             graph.AppSecret,
+		GraphAPIBaseURL:               graph.URL,
+		EventStreamBacklog:            10,
+		ForwardingMaxAttempts:         1,
+		ForwardingAllowPrivateTargets: true,
+		AuthSigningKey:                strings.Repeat("k", 32),
+		AuthSessionTTL:                time.Hour,
+		AuthBootstrapAPIKey:           testAPIKey,
+		HTTPWriteTimeout:              200 * time.Millisecond,
+		HTTPMaxBodyBytes:              4096,
+	}
+	srv := newServer(cfg)
+	hs := srv.httpServer(cfg)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go hs.Serve(ln)
+	base := "http://" + ln.Addr().String()
+	api := client.New(base, testAPIKey)
+
+	// A slow forwarding target: shutdown must wait for the delivery
+	var delivered atomic.Int32
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		delivered.Add(1)
+	}))
+	defer sink.Close()
+	if _, err := api.CreateSubscription(context.Background(), &client.ForwardingSubscriptionRequest{TargetURL: sink.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", base+"/api/events/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stream.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	// Outlive the write timeout before the first event
+	time.Sleep(2 * cfg.HTTPWriteTimeout)
+	payload := []byte(`{"object":"whatsapp_business_account","entry":[{"id":"waba-1","changes":[{"field":"messages","value":{"metadata":{"phone_number_id":"pn-1"},"statuses":[{"id":"wamid.1","status":"sent","timestamp":"1700000000","recipient_id":"15550100"}]}}]}]}`)
+	// Connections the transport dialed but never used stay StateNew, which
+	// Shutdown waits on for seconds; keep every post on its own connection
+	poster := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	post := func(body []byte) *http.Response {
+		req, _ := http.NewRequest("POST", base+"/api/whatsapp/webhooks", bytes.NewReader(body))
+		req.Header.Set(services.SignatureHeader, services.SignWebhookPayload(cfg.FacebookAppSecret, body))
+		resp, err := poster.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := post(payload); resp.StatusCode != http.StatusOK {
+		t.Fatalf("webhook status %d", resp.StatusCode)
+	}
+	if resp := post(bytes.Repeat([]byte(" "), 5000)); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized webhook status %d, want 413", resp.StatusCode)
+	}
+
+	sawEvent := false
+	for line := range lines {
+		if line == "event: message.status" {
+			sawEvent = true
+			break
+		}
+	}
+	if !sawEvent {
+		t.Fatal("event stream ended before the event arrived")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.shutdown(ctx, hs); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if delivered.Load() != 1 {
+		t.Errorf("shutdown returned before the queued delivery finished")
+	}
+	for range lines {
+		// The stream must end rather than block shutdown
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Request/Response models for API endpoints
 type AuthCodeRequest struct {
@@ -9,6 +12,8 @@ type AuthCodeRequest struct {
 	WABAID            string                 `json:"waba_id,omitempty"`         // From frontend message event
 	PhoneNumberID     string                 `json:"phone_number_id,omitempty"` // From frontend message event
 	BusinessID        string                 `json:"business_id,omitempty"`     // From frontend message event
+	AppID             string                 `json:"app_id,omitempty"`          // Meta app the frontend ran Embedded Signup with
+	ConfigID          string                 `json:"config_id,omitempty"`       // Or its Embedded Signup configuration ID
 	ClientInfo        map[string]interface{} `json:"client_info,omitempty"`
 }
 
@@ -26,22 +31,37 @@ type FacebookBusinessAccount struct {
 }
 
 type FacebookPhoneNumber struct {
-	ID                     string `json:"id"`
-	DisplayPhoneNumber     string `json:"display_phone_number"`
-	VerifiedName           string `json:"verified_name"`
-	QualityRating          string `json:"quality_rating"`
-	Status                 string `json:"status"`
-	CodeVerificationStatus string `json:"code_verification_status"`
+	ID                     string             `json:"id"`
+	DisplayPhoneNumber     string             `json:"display_phone_number"`
+	VerifiedName           string             `json:"verified_name"`
+	QualityRating          string             `json:"quality_rating"`
+	Status                 string             `json:"status"`
+	CodeVerificationStatus string             `json:"code_verification_status"`
+	MessagingLimitTier     string             `json:"messaging_limit_tier"` // TIER_250, TIER_1K, ... TIER_UNLIMITED
+	Throughput             FacebookThroughput `json:"throughput"`
+	NameStatus             string             `json:"name_status"`   // Display name review, e.g. APPROVED
+	PlatformType           string             `json:"platform_type"` // CLOUD_API, ON_PREMISE or NOT_APPLICABLE
+}
+
+type FacebookThroughput struct {
+	Level string `json:"level"` // STANDARD, HIGH or NOT_APPLICABLE
 }
 
 // Business account storage model
 type BusinessAccount struct {
-	ID              string                 `json:"id"`
-	WABAID          string                 `json:"waba_id"`
-	BusinessName    string                 `json:"business_name"`
-	PhoneNumbers    []BusinessPhoneNumber  `json:"phone_numbers"`
-	AccessToken     string                 `json:"access_token,omitempty"` // Don't send in API responses
-	TokenExpiresAt  time.Time              `json:"token_expires_at,omitempty"`
+	ID               string                `json:"id"`
+	TenantID         string                `json:"tenant_id"`
+	WABAID           string                `json:"waba_id"`
+	AppID            string                `json:"app_id,omitempty"` // Meta app the account onboarded through
+	BusinessName     string                `json:"business_name"`
+	PhoneNumbers     []BusinessPhoneNumber `json:"phone_numbers"`
+	AccessToken      string                `json:"access_token,omitempty"`    // Don't send in API responses
+	TokenExpiresAt   time.Time             `json:"token_expires_at,omitzero"` // Zero for tokens that do not expire
+	TokenRefreshedAt time.Time             `json:"token_refreshed_at,omitzero"`
+	// Set when the token can no longer be refreshed; the business must redo
+	// Embedded Signup, which replaces the account and clears it
+	NeedsReauth     bool                   `json:"needs_reauth"`
+	ReauthReason    string                 `json:"reauth_reason,omitempty"`
 	WebhooksEnabled bool                   `json:"webhooks_enabled"`
 	SetupComplete   bool                   `json:"setup_complete"`
 	CreatedAt       time.Time              `json:"created_at"`
@@ -56,53 +76,247 @@ type BusinessPhoneNumber struct {
 	Status        string `json:"status"`
 	QualityRating string `json:"quality_rating"`
 	IsVerified    bool   `json:"is_verified"`
+	// Kept current by the phone number sync; see PhoneNumberChange
+	MessagingLimitTier string `json:"messaging_limit_tier,omitempty"`
+	Throughput         string `json:"throughput,omitempty"`
+	NameStatus         string `json:"name_status,omitempty"`
+	PlatformType       string `json:"platform_type,omitempty"`
+}
+
+// PhoneNumberChange is a recorded change of one status field of a phone
+// number, found by the periodic sync or reported by a webhook.
+type PhoneNumberChange struct {
+	PhoneNumberID string    `json:"phone_number_id"`
+	Field         string    `json:"field"` // JSON name of the BusinessPhoneNumber field
+	Before        string    `json:"before"`
+	After         string    `json:"after"`
+	Source        string    `json:"source"` // sync or webhook
+	ChangedAt     time.Time `json:"changed_at"`
 }
 
+// Sources of phone number changes
+const (
+	PhoneChangeSync    = "sync"
+	PhoneChangeWebhook = "webhook"
+)
+
 // API Response models
+
+// ErrorResponse is the body of every failed API request.
+type ErrorResponse struct {
+	Success bool     `json:"success"` // always false
+	Error   APIError `json:"error"`
+}
+
+// APIError carries a stable machine-readable code (see ERRORS.md) and, when
+// the failure came from Meta, the safe parts of the Graph API error.
+type APIError struct {
+	Code      string             `json:"code"`
+	Message   string             `json:"message"`
+	RequestID string             `json:"request_id,omitempty"`
+	Graph     *GraphErrorDetails `json:"graph,omitempty"`
+	Details   map[string]any     `json:"details,omitempty"`
+}
+
+// GraphErrorDetails are the upstream Graph API error fields we pass through.
+// Meta's message text is omitted since it can echo tokens or app details.
+type GraphErrorDetails struct {
+	Status    int    `json:"status"`
+	Type      string `json:"type,omitempty"`
+	Code      int    `json:"code,omitempty"`
+	Subcode   int    `json:"error_subcode,omitempty"`
+	FBTraceID string `json:"fbtrace_id,omitempty"`
+}
+
 type BusinessSetupResponse struct {
 	Success      bool                   `json:"success"`
 	Message      string                 `json:"message,omitempty"`
-	Error        string                 `json:"error,omitempty"`
 	BusinessInfo *BusinessAccount       `json:"business_info,omitempty"`
 	SetupStatus  string                 `json:"setup_status,omitempty"`
 	NextSteps    []string               `json:"next_steps,omitempty"`
 	TokenInfo    map[string]interface{} `json:"token_info,omitempty"` // Token details for frontend display
 }
 
+// Outbound messages
+type SendMessageRequest struct {
+	PhoneNumberID string `json:"phone_number_id,omitempty"` // Defaults to the account's first number
+	To            string `json:"to"`
+	Text          string `json:"text"`
+}
+
+type SendMessageResponse struct {
+	Success       bool   `json:"success"`
+	MessageID     string `json:"message_id"` // WhatsApp message ID ("wamid..."), as used in status webhooks
+	PhoneNumberID string `json:"phone_number_id"`
+}
+
+// Bulk sends open business-initiated conversations, which count against the
+// sending number's messaging limit tier.
+type BulkSendRequest struct {
+	PhoneNumberID string   `json:"phone_number_id,omitempty"` // Defaults to the account's first number
+	To            []string `json:"to"`
+	Text          string   `json:"text"`
+	OnLimit       string   `json:"on_limit,omitempty"` // BulkOnLimitReject (default) or BulkOnLimitThrottle
+	Queue         bool     `json:"queue,omitempty"`    // Send through the outbound queue instead of within the request
+}
+
+// What a bulk send does when its recipients exceed the remaining capacity
+const (
+	BulkOnLimitReject   = "reject"   // Send nothing
+	BulkOnLimitThrottle = "throttle" // Send what fits, defer the rest
+)
+
+type BulkSendResponse struct {
+	Success       bool              `json:"success"`
+	PhoneNumberID string            `json:"phone_number_id"`
+	Sent          []BulkSendResult  `json:"sent"`
+	Failed        []BulkSendResult  `json:"failed"`
+	Deferred      []string          `json:"deferred"`         // Over the messaging limit, not sent
+	Queued        []OutboundMessage `json:"queued,omitempty"` // With queue, instead of sent and failed
+	Capacity      MessagingCapacity `json:"capacity"`
+}
+
+type BulkSendResult struct {
+	To        string             `json:"to"`
+	MessageID string             `json:"message_id,omitempty"`
+	Graph     *GraphErrorDetails `json:"graph,omitempty"` // Why Meta refused the message
+}
+
+// MessagingCapacity is a phone number's headroom under its messaging limit
+// tier: customers it may still open business-initiated conversations with
+// in the rolling 24 hour window.
+type MessagingCapacity struct {
+	PhoneNumberID      string          `json:"phone_number_id"`
+	MessagingLimitTier string          `json:"messaging_limit_tier,omitempty"` // Empty until Meta reports it; TIER_250 is assumed
+	Unlimited          bool            `json:"unlimited"`
+	Limit              int             `json:"limit"`   // 0 when unlimited
+	Used               int             `json:"used"`    // Conversations open in the window, including pending ones
+	Pending            int             `json:"pending"` // Sent by us, no status webhook yet
+	Remaining          int             `json:"remaining"`
+	Projection         []CapacityPoint `json:"projection,omitempty"` // Hourly, as open conversations expire
+}
+
+type CapacityPoint struct {
+	At        time.Time `json:"at"`
+	Remaining int       `json:"remaining"`
+}
+
+// OutboundMessage is a message in the outbound queue. Messages are sent per
+// phone number at its throughput, retried when Meta throttles them, and kept
+// for status lookups after they are sent or fail.
+type OutboundMessage struct {
+	ID             string    `json:"id"`
+	TenantID       string    `json:"tenant_id"`
+	WABAID         string    `json:"waba_id"`
+	PhoneNumberID  string    `json:"phone_number_id"`
+	To             string    `json:"to"`
+	Text           string    `json:"text"`
+	Status         string    `json:"status"`                    // queued, sending, sent or failed
+	DeliveryStatus string    `json:"delivery_status,omitempty"` // Latest status webhook once sent: sent, delivered, read or failed
+	MessageID      string    `json:"message_id,omitempty"`      // WhatsApp message ID once Meta accepted it
+	Attempts       int       `json:"attempts"`
+	ErrorCode      int       `json:"error_code,omitempty"` // Graph or Cloud API code of the last failure
+	Error          string    `json:"error,omitempty"`      // Why the last attempt failed
+	NextAttemptAt  time.Time `json:"next_attempt_at,omitzero"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	SentAt         time.Time `json:"sent_at,omitzero"`
+	Reserved       bool      `json:"-"` // Holds messaging limit capacity, given back if it fails
+}
+
+type QueuedMessageResponse struct {
+	Success bool            `json:"success"`
+	Message OutboundMessage `json:"message"`
+}
+
+// Outbound message statuses
+const (
+	OutboundQueued  = "queued"
+	OutboundSending = "sending"
+	OutboundSent    = "sent"
+	OutboundFailed  = "failed"
+)
+
 // Webhook models
 type WebhookEvent struct {
-	Object string `json:"object"`
-	Entry  []struct {
-		ID      string `json:"id"`
-		Time    int64  `json:"time"`
-		Changes []struct {
-			Value struct {
-				MessagingProduct string `json:"messaging_product"`
-				Metadata         struct {
-					DisplayPhoneNumber string `json:"display_phone_number"`
-					PhoneNumberID      string `json:"phone_number_id"`
-				} `json:"metadata"`
-				Messages []struct {
-					ID        string `json:"id"`
-					From      string `json:"from"`
-					Timestamp string `json:"timestamp"`
-					Type      string `json:"type"`
-					Text      struct {
-						Body string `json:"body"`
-					} `json:"text,omitempty"`
-				} `json:"messages,omitempty"`
-				Statuses []struct {
-					ID          string `json:"id"`
-					RecipientID string `json:"recipient_id"`
-					Status      string `json:"status"`
-					Timestamp   string `json:"timestamp"`
-				} `json:"statuses,omitempty"`
-			} `json:"value"`
-			Field string `json:"field"`
-		} `json:"changes"`
-	} `json:"entry"`
+	Object string         `json:"object"`
+	Entry  []WebhookEntry `json:"entry"`
+}
+
+type WebhookEntry struct {
+	ID      string          `json:"id"`
+	Time    int64           `json:"time"`
+	Changes []WebhookChange `json:"changes"`
+}
+
+type WebhookChange struct {
+	Value WebhookValue `json:"value"`
+	Field string       `json:"field"`
+}
+
+type WebhookValue struct {
+	MessagingProduct string           `json:"messaging_product"`
+	Metadata         WebhookMetadata  `json:"metadata"`
+	Messages         []WebhookMessage `json:"messages,omitempty"`
+	Statuses         []WebhookStatus  `json:"statuses,omitempty"`
+}
+
+type WebhookMetadata struct {
+	DisplayPhoneNumber string `json:"display_phone_number"`
+	PhoneNumberID      string `json:"phone_number_id"`
+}
+
+type WebhookMessage struct {
+	ID        string `json:"id"`
+	From      string `json:"from"`
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Text      struct {
+		Body string `json:"body"`
+	} `json:"text,omitempty"`
 }
 
+type WebhookStatus struct {
+	ID          string `json:"id"`
+	RecipientID string `json:"recipient_id"`
+	Status      string `json:"status"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// Raw webhook archive
+type WebhookEventRecord struct {
+	ID             string     `json:"id"`
+	TenantID       string     `json:"tenant_id,omitempty"` // Owner resolved from phone_number_id/WABA
+	AppID          string     `json:"app_id,omitempty"`    // Meta app whose secret signed the delivery
+	ReceivedAt     time.Time  `json:"received_at"`
+	SignatureValid bool       `json:"signature_valid"`
+	Object         string     `json:"object,omitempty"`
+	WABAIDs        []string   `json:"waba_ids,omitempty"`
+	PhoneNumberIDs []string   `json:"phone_number_ids,omitempty"`
+	Fields         []string   `json:"fields,omitempty"`
+	Outcome        string     `json:"outcome"`
+	Error          string     `json:"error,omitempty"`
+	ReplayCount    int        `json:"replay_count"`
+	LastReplayedAt *time.Time `json:"last_replayed_at,omitempty"`
+	Body           string     `json:"body"` // raw payload exactly as received
+}
+
+// RejectedWebhook is what is kept of a delivery whose signature did not
+// verify. The body is dropped so unsigned requests cannot fill the archive.
+type RejectedWebhook struct {
+	ReceivedAt time.Time `json:"received_at"`
+	Size       int       `json:"size"` // Body bytes
+	Reason     string    `json:"reason"`
+}
+
+// Webhook processing outcomes
+const (
+	WebhookOutcomeProcessed        = "processed"
+	WebhookOutcomeFailed           = "failed"
+	WebhookOutcomeInvalidJSON      = "invalid_json"
+	WebhookOutcomeInvalidSignature = "invalid_signature"
+)
+
 // WhatsApp Message Templates
 type WhatsAppTemplate struct {
 	ID           string `json:"id"`
@@ -117,7 +331,216 @@ type WhatsAppTemplate struct {
 
 type TemplatesResponse struct {
 	Success   bool               `json:"success"`
-	Error     string             `json:"error,omitempty"`
 	Templates []WhatsAppTemplate `json:"templates,omitempty"`
 	TokenInfo map[string]any     `json:"token_info,omitempty"`
 }
+
+// Normalized event derived from a webhook change, consumed by forwarding
+// subscriptions and other internal listeners.
+type Event struct {
+	ID            string          `json:"id"` // stable across replays of the same payload
+	Type          string          `json:"type"`
+	TenantID      string          `json:"tenant_id"`
+	AppID         string          `json:"app_id,omitempty"` // Meta app that delivered the webhook
+	WABAID        string          `json:"waba_id,omitempty"`
+	PhoneNumberID string          `json:"phone_number_id,omitempty"`
+	Field         string          `json:"field"` // Webhook field; empty for events the backend generates
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Normalized event types
+const (
+	EventMessageReceived    = "message.received"
+	EventMessageStatus      = "message.status"
+	EventTemplateStatus     = "template.status"
+	EventTemplateQuality    = "template.quality"
+	EventTemplateCategory   = "template.category"
+	EventAccountAlert       = "account.alert"
+	EventAccountUpdate      = "account.update"
+	EventAccountReview      = "account.review"
+	EventPhoneNumberQuality = "phone_number.quality"
+	EventPhoneNumberName    = "phone_number.name"
+	EventBusinessCapability = "business.capability"
+	EventSecurity           = "security"
+	// Generated by the backend rather than by a webhook
+	EventTokenExpiring      = "account.token_expiring"
+	EventTokenRefreshed     = "account.token_refreshed"
+	EventReauthRequired     = "account.reauth_required"
+	EventPhoneNumberUpdated = "phone_number.updated"
+)
+
+// Outbound webhook forwarding
+type ForwardingSubscription struct {
+	ID                  string    `json:"id"`
+	TenantID            string    `json:"tenant_id"`
+	TargetURL           string    `json:"target_url"`
+	Secret              string    `json:"secret,omitempty"`      // Only returned on creation
+	EventTypes          []string  `json:"event_types,omitempty"` // Empty = all; "message.*" style prefixes allowed
+	WABAIDs             []string  `json:"waba_ids,omitempty"`    // Empty = all WABAs
+	Enabled             bool      `json:"enabled"`
+	DisabledReason      string    `json:"disabled_reason,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+type ForwardingDelivery struct {
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscription_id"`
+	EventID        string    `json:"event_id"`
+	EventType      string    `json:"event_type"`
+	Attempt        int       `json:"attempt"`
+	Success        bool      `json:"success"`
+	StatusCode     int       `json:"status_code,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	DurationMS     int64     `json:"duration_ms"`
+	AttemptedAt    time.Time `json:"attempted_at"`
+}
+
+// API authentication
+type APIKey struct {
+	ID         string     `json:"id"`
+	TenantID   string     `json:"tenant_id"`
+	Name       string     `json:"name"`
+	Role       Role       `json:"role"`
+	Prefix     string     `json:"prefix"` // First characters of the key, for identification
+	Hash       string     `json:"-"`      // SHA-256 of the full key; the key itself is never stored
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Principal is the authenticated caller of an API request.
+type Principal struct {
+	ID       string `json:"id"` // API key ID the request or session derives from
+	Name     string `json:"name"`
+	TenantID string `json:"tenant_id"`
+	Role     Role   `json:"role"`
+	AuthType string `json:"auth_type"` // "api_key" or "session"
+}
+
+// Tenants own WABAs, API keys and forwarding subscriptions. Webhook events
+// for WABAs nobody has onboarded are routed to DefaultTenantID, which is
+// also the platform operator's tenant.
+type Tenant struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const DefaultTenantID = "default"
+
+// Role is an API key's level of access within its tenant.
+type Role string
+
+const (
+	RoleOwner    Role = "owner"
+	RoleAdmin    Role = "admin"
+	RoleAgent    Role = "agent"
+	RoleReadOnly Role = "read_only"
+)
+
+// Permission names an action checked by the authorization layer.
+type Permission string
+
+const (
+	PermissionReadAccounts    Permission = "read_accounts"
+	PermissionOnboardAccounts Permission = "onboard_accounts"
+	PermissionExportData      Permission = "export_data"
+	PermissionDeleteAccounts  Permission = "delete_accounts"
+	PermissionViewTokens      Permission = "view_tokens"
+	PermissionSendMessages    Permission = "send_messages"
+	PermissionManageTemplates Permission = "manage_templates"
+	PermissionManageWebhooks  Permission = "manage_webhooks"
+	PermissionManageAPIKeys   Permission = "manage_api_keys"
+	PermissionViewAudit       Permission = "view_audit"
+)
+
+// AuthorizationDenial records a request refused for lack of a permission.
+type AuthorizationDenial struct {
+	At          time.Time  `json:"at"`
+	PrincipalID string     `json:"principal_id"`
+	TenantID    string     `json:"tenant_id"`
+	Role        Role       `json:"role"`
+	Permission  Permission `json:"permission"`
+	Method      string     `json:"method"`
+	Path        string     `json:"path"`
+}
+
+// AuditEntry is one record in the append-only audit log. Hash covers every
+// other field including PrevHash, chaining each entry to the one before it.
+type AuditEntry struct {
+	Seq        int64                  `json:"seq"`
+	At         time.Time              `json:"at"`
+	TenantID   string                 `json:"tenant_id"`
+	ActorID    string                 `json:"actor_id"` // API key ID, or "system"
+	ActorName  string                 `json:"actor_name,omitempty"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   string                 `json:"target_id"`
+	Changes    map[string]AuditChange `json:"changes,omitempty"`
+	RequestID  string                 `json:"request_id,omitempty"`
+	IP         string                 `json:"ip,omitempty"`
+	PrevHash   string                 `json:"prev_hash"`
+	Hash       string                 `json:"hash"`
+}
+
+// AuditChange is a field's value before and after a mutation. Secret values
+// are replaced with a placeholder.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Audit actions
+const (
+	AuditAccountCreated       = "account.created"
+	AuditAccountUpdated       = "account.updated"
+	AuditAccountDeleted       = "account.deleted"
+	AuditDataExported         = "data.exported"
+	AuditAPIKeyCreated        = "api_key.created"
+	AuditAPIKeyRevoked        = "api_key.revoked"
+	AuditTenantCreated        = "tenant.created"
+	AuditSubscriptionCreated  = "forwarding_subscription.created"
+	AuditSubscriptionUpdated  = "forwarding_subscription.updated"
+	AuditSubscriptionDeleted  = "forwarding_subscription.deleted"
+	AuditWebhookEventReplayed = "webhook_event.replayed"
+)
+
+// Health and readiness
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+type HealthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Build     BuildInfo `json:"build"`
+}
+
+// ReadinessResponse reports each dependency check. Status is "ok",
+// "degraded" when only non-critical checks fail, or "unavailable".
+type ReadinessResponse struct {
+	Status    string                     `json:"status"`
+	Timestamp time.Time                  `json:"timestamp"`
+	Build     BuildInfo                  `json:"build"`
+	Checks    map[string]ComponentHealth `json:"checks"`
+}
+
+type ComponentHealth struct {
+	Status     string `json:"status"` // "ok" or "fail"
+	Critical   bool   `json:"critical"`
+	Message    string `json:"message,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Health statuses
+const (
+	HealthOK          = "ok"
+	HealthFail        = "fail"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+)
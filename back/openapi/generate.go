@@ -0,0 +1,318 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// initialisms are spelled this way when they appear as a word of a name.
+var initialisms = map[string]string{
+	"api": "API", "id": "ID", "ids": "IDs", "ip": "IP", "json": "JSON",
+	"ms": "MS", "uri": "URI", "url": "URL", "waba": "WABA",
+}
+
+// GenerateClient renders Go types for every component schema and a Client
+// method for every operation whose success response is a JSON schema
+// reference. Operations with other bodies (webhook callbacks, SSE) are
+// left to hand-written code.
+func GenerateClient(doc *Document, pkg string) ([]byte, error) {
+	g := &generator{doc: doc, imports: map[string]bool{}}
+	g.types()
+	g.operations()
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by cmd/openapi-client from openapi/openapi.json; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	if len(g.imports) > 0 {
+		imports := make([]string, 0, len(g.imports))
+		for imp := range g.imports {
+			imports = append(imports, imp)
+		}
+		sort.Strings(imports)
+		out.WriteString("import (\n")
+		for _, imp := range imports {
+			fmt.Fprintf(&out, "\t%q\n", imp)
+		}
+		out.WriteString(")\n\n")
+	}
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated client: %w\n%s", err, out.String())
+	}
+	return src, nil
+}
+
+type generator struct {
+	doc     *Document
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) types() {
+	for _, name := range sortedKeys(g.doc.Components.Schemas) {
+		s := g.doc.Components.Schemas[name]
+		writeComment(&g.buf, "", s.Description)
+		if len(s.Properties) == 0 {
+			g.printf("type %s %s\n\n", name, g.goType(s, true))
+			continue
+		}
+
+		required := map[string]bool{}
+		for _, r := range s.Required {
+			required[r] = true
+		}
+		g.printf("type %s struct {\n", name)
+		for _, prop := range sortedKeys(s.Properties) {
+			ps := s.Properties[prop]
+			tag := prop
+			if !required[prop] {
+				tag += ",omitempty"
+			}
+			writeComment(&g.buf, "\t", ps.Description)
+			g.printf("\t%s %s `json:%q`\n", goName(prop), g.goType(ps, required[prop]), tag)
+		}
+		g.printf("}\n\n")
+	}
+}
+
+// goType maps a schema to a Go type. Optional objects, times and booleans
+// become pointers so that unset is distinguishable from the zero value.
+func (g *generator) goType(s *Schema, required bool) string {
+	ptr := ""
+	if !required {
+		ptr = "*"
+	}
+	if s.Ref != "" {
+		target := g.doc.Resolve(s)
+		if target != nil && len(target.Properties) > 0 {
+			return ptr + s.RefName()
+		}
+		return s.RefName()
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			g.imports["time"] = true
+			return ptr + "time.Time"
+		}
+		return "string"
+	case "integer":
+		if s.Format == "int64" {
+			return "int64"
+		}
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean":
+		return ptr + "bool"
+	case "array":
+		return "[]" + g.goType(s.Items, true)
+	case "object":
+		if values := s.MapValues(); values != nil {
+			return "map[string]" + g.goType(values, true)
+		}
+		return "map[string]any"
+	}
+	return "any"
+}
+
+func (g *generator) operations() {
+	type op struct {
+		method, path string
+		Operation
+	}
+	var ops []op
+	for path, methods := range g.doc.Paths {
+		for method, o := range methods {
+			ops = append(ops, op{strings.ToUpper(method), path, o})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].OperationID < ops[j].OperationID })
+
+	for _, o := range ops {
+		result := successSchema(o.Operation)
+		if result == nil || result.Ref == "" {
+			continue
+		}
+		g.operation(o.method, o.path, o.Operation, result.RefName())
+	}
+}
+
+func (g *generator) operation(method, path string, o Operation, result string) {
+	name := exported(o.OperationID)
+	g.imports["context"] = true
+
+	var query []Parameter
+	args := []string{"ctx context.Context"}
+	for _, p := range o.Parameters {
+		switch p.In {
+		case "path":
+			args = append(args, lowerFirst(goName(p.Name))+" string")
+		case "query":
+			query = append(query, p)
+		}
+	}
+	body := ""
+	if o.RequestBody != nil {
+		if mt, ok := o.RequestBody.Content["application/json"]; ok && mt.Schema.Ref != "" {
+			body = mt.Schema.RefName()
+			args = append(args, "body *"+body)
+		}
+	}
+	if len(query) > 0 {
+		g.queryParams(name, query)
+		args = append(args, "params *"+name+"Params")
+	}
+
+	summary := o.Summary
+	if summary != "" {
+		summary = ": " + lowerFirst(summary)
+	}
+	g.printf("// %s calls %s %s%s.\n", name, method, path, summary)
+	if o.Permission != "" {
+		g.printf("// Requires the %s permission.\n", o.Permission)
+	}
+	g.printf("func (c *Client) %s(%s) (*%s, error) {\n", name, strings.Join(args, ", "), result)
+	g.printf("\tpath := %s\n", g.pathExpr(path))
+
+	queryArg := "nil"
+	if len(query) > 0 {
+		g.imports["net/url"] = true
+		queryArg = "query"
+		g.printf("\tvar query url.Values\n\tif params != nil {\n\t\tquery = params.values()\n\t}\n")
+	}
+	bodyArg := "nil"
+	if body != "" {
+		bodyArg = "body"
+	}
+	g.printf("\tvar out %s\n", result)
+	g.printf("\tif err := c.do(ctx, %q, path, %s, %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n", method, queryArg, bodyArg)
+	g.printf("\treturn &out, nil\n}\n\n")
+}
+
+func (g *generator) queryParams(op string, params []Parameter) {
+	g.printf("// %sParams are the optional query parameters of %s.\n", op, op)
+	g.printf("type %sParams struct {\n", op)
+	for _, p := range params {
+		writeComment(&g.buf, "\t", p.Description)
+		g.printf("\t%s %s\n", goName(p.Name), g.goType(p.Schema, true))
+	}
+	g.printf("}\n\n")
+
+	g.printf("func (p *%sParams) values() url.Values {\n\tq := url.Values{}\n", op)
+	for _, p := range params {
+		field := "p." + goName(p.Name)
+		switch p.Schema.Type {
+		case "integer":
+			g.imports["strconv"] = true
+			g.printf("\tif %s != 0 {\n\t\tq.Set(%q, strconv.Itoa(%s))\n\t}\n", field, p.Name, field)
+		case "boolean":
+			g.printf("\tif %s {\n\t\tq.Set(%q, \"true\")\n\t}\n", field, p.Name)
+		default:
+			g.printf("\tif %s != \"\" {\n\t\tq.Set(%q, %s)\n\t}\n", field, p.Name, field)
+		}
+	}
+	g.printf("\treturn q\n}\n\n")
+}
+
+// pathExpr turns "/a/{id}/b" into a Go expression escaping each parameter.
+func (g *generator) pathExpr(path string) string {
+	var parts []string
+	for path != "" {
+		open := strings.Index(path, "{")
+		if open < 0 {
+			parts = append(parts, fmt.Sprintf("%q", path))
+			break
+		}
+		end := strings.Index(path, "}")
+		if open > 0 {
+			parts = append(parts, fmt.Sprintf("%q", path[:open]))
+		}
+		g.imports["net/url"] = true
+		parts = append(parts, "url.PathEscape("+lowerFirst(goName(path[open+1:end]))+")")
+		path = path[end+1:]
+	}
+	return strings.Join(parts, " + ")
+}
+
+// successSchema returns the JSON schema of the operation's first 2xx response.
+func successSchema(o Operation) *Schema {
+	for _, status := range sortedKeys(o.Responses) {
+		if !strings.HasPrefix(status, "2") {
+			continue
+		}
+		if mt, ok := o.Responses[status].Content["application/json"]; ok {
+			return mt.Schema
+		}
+		return nil
+	}
+	return nil
+}
+
+// goName converts snake_case, dotted or camelCase names to exported Go names.
+func goName(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '.' || r == '-' })
+	var b strings.Builder
+	for _, w := range words {
+		if initialism, ok := initialisms[strings.ToLower(w)]; ok {
+			b.WriteString(initialism)
+			continue
+		}
+		b.WriteString(exported(w))
+	}
+	return b.String()
+}
+
+func exported(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// lowerFirst lower-cases a leading word, keeping initialisms whole
+// ("WABAID" -> "wabaID", "ID" -> "id").
+func lowerFirst(s string) string {
+	r := []rune(s)
+	n := 0
+	for n < len(r) && unicode.IsUpper(r[n]) {
+		n++
+	}
+	switch {
+	case n == 0:
+		return s
+	case n == len(r):
+		return strings.ToLower(s)
+	case n > 1:
+		n-- // the last capital starts the next word
+	}
+	return strings.ToLower(string(r[:n])) + string(r[n:])
+}
+
+func writeComment(buf *bytes.Buffer, indent, text string) {
+	if text == "" {
+		return
+	}
+	fmt.Fprintf(buf, "%s// %s\n", indent, text)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
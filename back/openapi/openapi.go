@@ -0,0 +1,123 @@
+// Package openapi holds the OpenAPI 3 description of the backend API, serves
+// it, and generates the typed Go client in package client from it.
+//
+// openapi.json is the source of truth: edit it by hand when an endpoint
+// changes, then run "go generate ./client". Tests in package main check it
+// against the registered routes and the handlers' actual responses.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+//go:embed openapi.json
+var Spec []byte
+
+// GET /api/openapi.json
+func ServeSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(Spec)
+}
+
+// Document is the subset of OpenAPI 3 this repo uses.
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Paths      map[string]map[string]Operation `json:"paths"` // path -> lower-case method -> operation
+	Security   []map[string][]string           `json:"security"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type Operation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description"`
+	Tags        []string               `json:"tags"`
+	Security    *[]map[string][]string `json:"security"` // nil inherits the document's; empty means public
+	Permission  string                 `json:"x-permission"`
+	Parameters  []Parameter            `json:"parameters"`
+	RequestBody *struct {
+		Required bool                 `json:"required"`
+		Content  map[string]MediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]Response `json:"responses"` // by status code
+}
+
+// Public reports whether the operation may be called without credentials.
+func (o Operation) Public() bool {
+	return o.Security != nil && len(*o.Security) == 0
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // path, query or header
+	Required    bool    `json:"required"`
+	Description string  `json:"description"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	// AdditionalProperties is either a bool or a schema for map values.
+	AdditionalProperties json.RawMessage `json:"additionalProperties,omitempty"`
+}
+
+// RefName returns the component name of a "#/components/schemas/X" ref.
+func (s *Schema) RefName() string {
+	return strings.TrimPrefix(s.Ref, "#/components/schemas/")
+}
+
+// MapValues returns the schema of map values, if the schema is a map.
+func (s *Schema) MapValues() *Schema {
+	if len(s.AdditionalProperties) == 0 {
+		return nil
+	}
+	var values Schema
+	if json.Unmarshal(s.AdditionalProperties, &values) != nil {
+		return nil // additionalProperties: true/false
+	}
+	return &values
+}
+
+// AllowsAdditional reports whether properties beyond those listed may appear.
+func (s *Schema) AllowsAdditional() bool {
+	return len(s.AdditionalProperties) > 0 && string(s.AdditionalProperties) != "false"
+}
+
+// Parse decodes an OpenAPI document.
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Resolve follows s's $ref, if any.
+func (d *Document) Resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = d.Components.Schemas[s.RefName()]
+	}
+	return s
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"back/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	auditSystemActor = "system"
+	redactedValue    = "[REDACTED]"
+)
+
+// secretFields are never written to the audit log in clear text.
+var secretFields = map[string]bool{
+	"access_token":       true,
+	"authorization_code": true,
+	"secret":             true,
+	"api_key":            true,
+	"hash":               true,
+	"password":           true,
+	"app_secret":         true,
+	"token":              true,
+}
+
+// AuditFilter narrows AuditLog.List. Zero values match everything.
+type AuditFilter struct {
+	TenantID   string
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+}
+
+// AuditLog is an append-only, hash-chained log of mutations (replace with
+// database in production). Entries are never modified or removed.
+type AuditLog struct {
+	entries []models.AuditEntry
+	mutex   sync.RWMutex
+}
+
+func NewAuditLog() *AuditLog {
+	return &AuditLog{}
+}
+
+// Record appends an entry for action on a target, diffing before and after
+// (either may be nil). The actor, request ID and IP come from ctx.
+func (a *AuditLog) Record(ctx context.Context, tenantID, action, targetType, targetID string, before, after interface{}) models.AuditEntry {
+	entry := models.AuditEntry{
+		At:         time.Now().UTC(),
+		TenantID:   tenantID,
+		ActorID:    auditSystemActor,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Changes:    AuditDiff(before, after),
+	}
+	if principal := PrincipalFromContext(ctx); principal != nil {
+		entry.ActorID = principal.ID
+		entry.ActorName = principal.Name
+	}
+	info := RequestInfoFromContext(ctx)
+	entry.RequestID = info.ID
+	entry.IP = info.IP
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	entry.Seq = int64(len(a.entries)) + 1
+	if len(a.entries) > 0 {
+		entry.PrevHash = a.entries[len(a.entries)-1].Hash
+	}
+	entry.Hash = hashAuditEntry(entry)
+	a.entries = append(a.entries, entry)
+	return entry
+}
+
+// List returns matching entries, newest first.
+func (a *AuditLog) List(filter AuditFilter) []models.AuditEntry {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	out := make([]models.AuditEntry, 0)
+	for i := len(a.entries) - 1; i >= 0; i-- {
+		e := a.entries[i]
+		if filter.TenantID != "" && e.TenantID != filter.TenantID ||
+			filter.ActorID != "" && e.ActorID != filter.ActorID ||
+			filter.Action != "" && e.Action != filter.Action ||
+			filter.TargetType != "" && e.TargetType != filter.TargetType ||
+			filter.TargetID != "" && e.TargetID != filter.TargetID ||
+			!filter.Since.IsZero() && e.At.Before(filter.Since) ||
+			!filter.Until.IsZero() && e.At.After(filter.Until) {
+			continue
+		}
+		out = append(out, e)
+		if filter.Limit > 0 && len(out) >= filter.Limit {
+			break
+		}
+	}
+	return out
+}
+
+// Verify recomputes the hash chain and reports the first broken entry.
+func (a *AuditLog) Verify() error {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	prev := ""
+	for _, e := range a.entries {
+		if e.PrevHash != prev {
+			return fmt.Errorf("audit entry %d: previous hash mismatch", e.Seq)
+		}
+		if hashAuditEntry(e) != e.Hash {
+			return fmt.Errorf("audit entry %d: hash mismatch", e.Seq)
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+func hashAuditEntry(e models.AuditEntry) string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditDiff compares the JSON forms of before and after field by field and
+// returns the fields that differ, with secret values redacted.
+func AuditDiff(before, after interface{}) map[string]models.AuditChange {
+	b, a := auditFields(before), auditFields(after)
+	changes := make(map[string]models.AuditChange)
+	for field, bv := range b {
+		if av, ok := a[field]; !ok || !reflect.DeepEqual(bv, av) {
+			changes[field] = models.AuditChange{Before: redactField(field, bv), After: redactField(field, a[field])}
+		}
+	}
+	for field, av := range a {
+		if _, ok := b[field]; !ok {
+			changes[field] = models.AuditChange{After: redactField(field, av)}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+func auditFields(v interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return fields
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+// redactField hides secret values, including those nested in objects.
+func redactField(field string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if secretFields[strings.ToLower(field)] {
+		return redactedValue
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, nested := range val {
+			out[k] = redactField(k, nested)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, nested := range val {
+			out[i] = redactField("", nested)
+		}
+		return out
+	}
+	return v
+}
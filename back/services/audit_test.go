@@ -0,0 +1,78 @@
+package services
+
+import (
+	"back/models"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAuditLogRecordsAccountChangesWithRedaction(t *testing.T) {
+	audit := NewAuditLog()
+	storage := NewStorageService(audit)
+	ctx := WithRequestInfo(
+		WithPrincipal(context.Background(), &models.Principal{ID: "key_1", Name: "ci", TenantID: "tenant-a"}),
+		RequestInfo{ID: "req_1", IP: "203.0.113.7"},
+	)
+
+	account := &models.BusinessAccount{TenantID: "tenant-a", WABAID: "waba-1", BusinessName: "Acme", AccessToken: "EAAG-old"}
+	storage.SaveBusinessAccount(ctx, account)
+	account.AccessToken = "EAAG-new"
+	account.BusinessName = "Acme Ltd"
+	storage.SaveBusinessAccount(ctx, account)
+	storage.DeleteBusinessAccount(ctx, "tenant-a", "waba-1")
+
+	entries := audit.List(AuditFilter{TenantID: "tenant-a"})
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	if entries[0].Action != models.AuditAccountDeleted || entries[2].Action != models.AuditAccountCreated {
+		t.Errorf("actions = %s, %s, %s", entries[0].Action, entries[1].Action, entries[2].Action)
+	}
+
+	updated := entries[1]
+	if updated.ActorID != "key_1" || updated.RequestID != "req_1" || updated.IP != "203.0.113.7" {
+		t.Errorf("actor/request = %+v", updated)
+	}
+	if c := updated.Changes["business_name"]; c.Before != "Acme" || c.After != "Acme Ltd" {
+		t.Errorf("business_name change = %+v", c)
+	}
+	if c, ok := updated.Changes["access_token"]; !ok || c.Before != redactedValue || c.After != redactedValue {
+		t.Errorf("access_token change = %+v", c)
+	}
+	for _, e := range entries {
+		for field, c := range e.Changes {
+			if strings.Contains(fmtValue(c.Before)+fmtValue(c.After), "EAAG") {
+				t.Errorf("entry %d field %s leaks a token", e.Seq, field)
+			}
+		}
+	}
+	if _, ok := updated.Changes["created_at"]; ok {
+		t.Error("unchanged created_at reported as changed")
+	}
+}
+
+func fmtValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func TestAuditLogHashChain(t *testing.T) {
+	audit := NewAuditLog()
+	for i := 0; i < 3; i++ {
+		audit.Record(context.Background(), "tenant-a", models.AuditDataExported, "tenant", "tenant-a", nil, nil)
+	}
+	if err := audit.Verify(); err != nil {
+		t.Fatalf("fresh chain: %v", err)
+	}
+
+	entries := audit.List(AuditFilter{})
+	if entries[0].PrevHash != entries[1].Hash || entries[2].PrevHash != "" {
+		t.Error("entries are not chained")
+	}
+
+	audit.entries[1].TenantID = "tenant-b"
+	if err := audit.Verify(); err == nil {
+		t.Error("tampered entry not detected")
+	}
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"back/config"
+	"back/models"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiKeyPrefix  = "wak_"
+	sessionIssuer = "whatsapp-embedded-backend"
+
+	AuthTypeAPIKey  = "api_key"
+	AuthTypeSession = "session"
+)
+
+var ErrUnauthenticated = errors.New("invalid or missing credentials")
+
+// ErrRoleTooHigh is returned when a caller acts on a key that outranks its own.
+var ErrRoleTooHigh = errors.New("api key has a higher role than the caller")
+
+// AuthService manages API keys (stored as SHA-256 hashes) and issues
+// HS256-signed session tokens for the backend's own API.
+type AuthService struct {
+	signingKey []byte
+	sessionTTL time.Duration
+
+	keys  map[string]*models.APIKey // ID -> key
+	mutex sync.RWMutex
+	seq   int64
+}
+
+func NewAuthService(cfg *config.Config) (*AuthService, error) {
+	if len(cfg.AuthSigningKey) < 32 {
+		return nil, fmt.Errorf("AUTH_SIGNING_KEY must be at least 32 bytes")
+	}
+	return &AuthService{
+		signingKey: []byte(cfg.AuthSigningKey),
+		sessionTTL: cfg.AuthSessionTTL,
+		keys:       make(map[string]*models.APIKey),
+	}, nil
+}
+
+// CreateAPIKey generates a new key for tenantID with the given role. The
+// plaintext is returned only here.
+func (a *AuthService) CreateAPIKey(tenantID, name string, role models.Role) (string, *models.APIKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("generate api key: %w", err)
+	}
+	raw := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	key, err := a.ImportAPIKey(tenantID, name, role, raw)
+	return raw, key, err
+}
+
+// ImportAPIKey registers an externally generated key, e.g. a bootstrap key
+// from configuration.
+func (a *AuthService) ImportAPIKey(tenantID, name string, role models.Role, raw string) (*models.APIKey, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("api key has no tenant")
+	}
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("unknown role %q", role)
+	}
+	if !strings.HasPrefix(raw, apiKeyPrefix) || len(raw) < len(apiKeyPrefix)+24 {
+		return nil, fmt.Errorf("api keys must start with %q and be at least %d characters", apiKeyPrefix, len(apiKeyPrefix)+24)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.seq++
+	now := time.Now()
+	key := &models.APIKey{
+		ID:        fmt.Sprintf("key_%d_%d", now.Unix(), a.seq),
+		TenantID:  tenantID,
+		Name:      name,
+		Role:      role,
+		Prefix:    raw[:len(apiKeyPrefix)+6],
+		Hash:      hashAPIKey(raw),
+		CreatedAt: now,
+	}
+	a.keys[key.ID] = key
+
+	copied := *key
+	return &copied, nil
+}
+
+func (a *AuthService) ListAPIKeys(tenantID string) ([]*models.APIKey, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	keys := make([]*models.APIKey, 0)
+	for _, key := range a.keys {
+		if key.TenantID != tenantID {
+			continue
+		}
+		copied := *key
+		keys = append(keys, &copied)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes a key of the tenant whose role is at most limit, the
+// role of the caller.
+func (a *AuthService) RevokeAPIKey(tenantID, id string, limit models.Role) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	key, exists := a.keys[id]
+	if !exists || key.TenantID != tenantID {
+		return fmt.Errorf("api key not found")
+	}
+	if !RoleAtMost(key.Role, limit) {
+		return ErrRoleTooHigh
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+	}
+	return nil
+}
+
+// Authenticate resolves a bearer credential: an API key ("wak_...") or a
+// session token issued by IssueSessionToken.
+func (a *AuthService) Authenticate(credential string) (*models.Principal, error) {
+	if credential == "" {
+		return nil, ErrUnauthenticated
+	}
+	if strings.HasPrefix(credential, apiKeyPrefix) {
+		return a.authenticateAPIKey(credential)
+	}
+	return a.verifySessionToken(credential)
+}
+
+func (a *AuthService) authenticateAPIKey(raw string) (*models.Principal, error) {
+	hash := hashAPIKey(raw)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, key := range a.keys {
+		if hmac.Equal([]byte(key.Hash), []byte(hash)) {
+			if key.RevokedAt != nil {
+				return nil, ErrUnauthenticated
+			}
+			now := time.Now()
+			key.LastUsedAt = &now
+			return &models.Principal{ID: key.ID, Name: key.Name, TenantID: key.TenantID, Role: key.Role, AuthType: AuthTypeAPIKey}, nil
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+type sessionClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Name      string `json:"name,omitempty"`
+	TenantID  string `json:"tid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var sessionHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// IssueSessionToken returns a JWT for principal, valid for the configured TTL.
+func (a *AuthService) IssueSessionToken(principal *models.Principal) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(a.sessionTTL)
+	claims, err := json.Marshal(sessionClaims{
+		Issuer:    sessionIssuer,
+		Subject:   principal.ID,
+		Name:      principal.Name,
+		TenantID:  principal.TenantID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("encode session claims: %w", err)
+	}
+
+	signingInput := sessionHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return signingInput + "." + a.sign(signingInput), expires, nil
+}
+
+func (a *AuthService) verifySessionToken(token string) (*models.Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != sessionHeader {
+		return nil, ErrUnauthenticated
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(a.sign(parts[0]+"."+parts[1]))) {
+		return nil, ErrUnauthenticated
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrUnauthenticated
+	}
+	if claims.Issuer != sessionIssuer || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrUnauthenticated
+	}
+
+	// Sessions die with the API key they were issued for and share its role
+	a.mutex.RLock()
+	key, exists := a.keys[claims.Subject]
+	valid := exists && key.RevokedAt == nil && key.TenantID == claims.TenantID
+	var role models.Role
+	if valid {
+		role = key.Role
+	}
+	a.mutex.RUnlock()
+	if !valid {
+		return nil, ErrUnauthenticated
+	}
+
+	return &models.Principal{ID: claims.Subject, Name: claims.Name, TenantID: claims.TenantID, Role: role, AuthType: AuthTypeSession}, nil
+}
+
+func (a *AuthService) sign(signingInput string) string {
+	mac := hmac.New(sha256.New, a.signingKey)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func hashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+type principalKey struct{}
+
+// WithPrincipal attaches the authenticated caller to ctx.
+func WithPrincipal(ctx context.Context, principal *models.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the authenticated caller, or nil.
+func PrincipalFromContext(ctx context.Context) *models.Principal {
+	principal, _ := ctx.Value(principalKey{}).(*models.Principal)
+	return principal
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"back/config"
+	"back/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAuth(t *testing.T, ttl time.Duration) *AuthService {
+	t.Helper()
+	auth, err := NewAuthService(&config.Config{
+		AuthSigningKey: strings.Repeat("k", 32),
+		AuthSessionTTL: ttl,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	auth := newTestAuth(t, time.Hour)
+
+	raw, key, err := auth.CreateAPIKey(models.DefaultTenantID, "ci", models.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(key.Hash, raw) || !strings.HasPrefix(raw, key.Prefix) {
+		t.Errorf("key = %+v", key)
+	}
+
+	principal, err := auth.Authenticate(raw)
+	if err != nil || principal.ID != key.ID || principal.AuthType != AuthTypeAPIKey {
+		t.Fatalf("Authenticate = %+v, %v", principal, err)
+	}
+	if _, err := auth.Authenticate(raw + "x"); err == nil {
+		t.Error("tampered key accepted")
+	}
+
+	if err := auth.RevokeAPIKey(models.DefaultTenantID, key.ID, models.RoleAgent); !errors.Is(err, ErrRoleTooHigh) {
+		t.Errorf("agent revoked an admin key: %v", err)
+	}
+	if err := auth.RevokeAPIKey(models.DefaultTenantID, key.ID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Authenticate(raw); err == nil {
+		t.Error("revoked key accepted")
+	}
+}
+
+func TestSessionTokens(t *testing.T) {
+	auth := newTestAuth(t, time.Hour)
+	raw, key, _ := auth.CreateAPIKey(models.DefaultTenantID, "frontend", models.RoleAdmin)
+	principal, _ := auth.Authenticate(raw)
+
+	token, expires, err := auth.IssueSessionToken(principal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(expires) < 59*time.Minute {
+		t.Errorf("expires = %v", expires)
+	}
+
+	session, err := auth.Authenticate(token)
+	if err != nil || session.ID != key.ID || session.AuthType != AuthTypeSession {
+		t.Fatalf("Authenticate(session) = %+v, %v", session, err)
+	}
+
+	parts := strings.Split(token, ".")
+	if _, err := auth.Authenticate(parts[0] + "." + parts[1] + ".AAAA"); err == nil {
+		t.Error("token with forged signature accepted")
+	}
+	other := newTestAuth(t, time.Hour)
+	if _, err := other.Authenticate(token); err == nil {
+		t.Error("token accepted by a service with a different signing key")
+	}
+
+	auth.RevokeAPIKey(models.DefaultTenantID, key.ID, models.RoleOwner)
+	if _, err := auth.Authenticate(token); err == nil {
+		t.Error("session outlived its revoked API key")
+	}
+}
+
+func TestExpiredSessionToken(t *testing.T) {
+	auth := newTestAuth(t, -time.Minute)
+	raw, _, _ := auth.CreateAPIKey(models.DefaultTenantID, "frontend", models.RoleAdmin)
+	principal, _ := auth.Authenticate(raw)
+
+	token, _, _ := auth.IssueSessionToken(principal)
+	if _, err := auth.Authenticate(token); err == nil {
+		t.Error("expired session accepted")
+	}
+}
+
+func TestShortSigningKeyRejected(t *testing.T) {
+	if _, err := NewAuthService(&config.Config{AuthSigningKey: "short"}); err == nil {
+		t.Error("expected error for short signing key")
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"back/models"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var ErrForbidden = errors.New("permission denied")
+
+const maxRecordedDenials = 1000
+
+// rolePermissions is the permission matrix. Each role holds everything the
+// role below it holds, plus its own additions.
+var rolePermissions = map[models.Role][]models.Permission{
+	models.RoleReadOnly: {
+		models.PermissionReadAccounts,
+	},
+	models.RoleAgent: {
+		models.PermissionReadAccounts,
+		models.PermissionSendMessages,
+	},
+	models.RoleAdmin: {
+		models.PermissionReadAccounts,
+		models.PermissionSendMessages,
+		models.PermissionOnboardAccounts,
+		models.PermissionExportData,
+		models.PermissionManageTemplates,
+		models.PermissionManageWebhooks,
+		models.PermissionManageAPIKeys,
+		models.PermissionViewAudit,
+	},
+	models.RoleOwner: {
+		models.PermissionReadAccounts,
+		models.PermissionSendMessages,
+		models.PermissionOnboardAccounts,
+		models.PermissionExportData,
+		models.PermissionManageTemplates,
+		models.PermissionManageWebhooks,
+		models.PermissionManageAPIKeys,
+		models.PermissionViewAudit,
+		models.PermissionDeleteAccounts,
+		models.PermissionViewTokens,
+	},
+}
+
+var roleRank = map[models.Role]int{
+	models.RoleReadOnly: 1,
+	models.RoleAgent:    2,
+	models.RoleAdmin:    3,
+	models.RoleOwner:    4,
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role models.Role) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAtMost reports whether role grants no more access than limit, so a
+// caller can only hand out keys at or below its own level.
+func RoleAtMost(role, limit models.Role) bool {
+	return ValidRole(role) && roleRank[role] <= roleRank[limit]
+}
+
+// Authorizer checks principals against the role permission matrix and keeps
+// a bounded in-memory record of denied attempts.
+type Authorizer struct {
+	denials []models.AuthorizationDenial
+	mutex   sync.RWMutex
+}
+
+func NewAuthorizer() *Authorizer {
+	return &Authorizer{}
+}
+
+// Can reports whether principal holds permission, without recording anything.
+func (a *Authorizer) Can(principal *models.Principal, permission models.Permission) bool {
+	if principal == nil {
+		return false
+	}
+	for _, p := range rolePermissions[principal.Role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize returns ErrForbidden and records the attempt when principal
+// lacks permission. method and path describe the attempted request.
+func (a *Authorizer) Authorize(principal *models.Principal, permission models.Permission, method, path string) error {
+	if a.Can(principal, permission) {
+		return nil
+	}
+
+	denial := models.AuthorizationDenial{
+		At:         time.Now(),
+		Permission: permission,
+		Method:     method,
+		Path:       path,
+	}
+	if principal != nil {
+		denial.PrincipalID = principal.ID
+		denial.TenantID = principal.TenantID
+		denial.Role = principal.Role
+	}
+	slog.Warn("permission denied", "method", method, "path", path,
+		"principal_id", denial.PrincipalID, "tenant_id", denial.TenantID, "role", denial.Role, "permission", permission)
+
+	a.mutex.Lock()
+	a.denials = append(a.denials, denial)
+	if len(a.denials) > maxRecordedDenials {
+		a.denials = append([]models.AuthorizationDenial(nil), a.denials[len(a.denials)-maxRecordedDenials:]...)
+	}
+	a.mutex.Unlock()
+
+	return ErrForbidden
+}
+
+// Denials returns a tenant's recorded denials, newest first.
+func (a *Authorizer) Denials(tenantID string) []models.AuthorizationDenial {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	out := make([]models.AuthorizationDenial, 0)
+	for i := len(a.denials) - 1; i >= 0; i-- {
+		if a.denials[i].TenantID == tenantID {
+			out = append(out, a.denials[i])
+		}
+	}
+	return out
+}
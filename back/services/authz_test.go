@@ -0,0 +1,64 @@
+package services
+
+import (
+	"back/models"
+	"errors"
+	"testing"
+)
+
+func TestAuthorizerRoleMatrix(t *testing.T) {
+	authz := NewAuthorizer()
+	cases := []struct {
+		role       models.Role
+		permission models.Permission
+		allowed    bool
+	}{
+		{models.RoleReadOnly, models.PermissionReadAccounts, true},
+		{models.RoleReadOnly, models.PermissionSendMessages, false},
+		{models.RoleAgent, models.PermissionSendMessages, true},
+		{models.RoleAgent, models.PermissionExportData, false},
+		{models.RoleAdmin, models.PermissionExportData, true},
+		{models.RoleAdmin, models.PermissionManageTemplates, true},
+		{models.RoleAdmin, models.PermissionDeleteAccounts, false},
+		{models.RoleAdmin, models.PermissionViewTokens, false},
+		{models.RoleOwner, models.PermissionDeleteAccounts, true},
+		{models.RoleOwner, models.PermissionViewTokens, true},
+		{models.Role("root"), models.PermissionReadAccounts, false},
+	}
+	for _, tc := range cases {
+		principal := &models.Principal{ID: "key", TenantID: "tenant-a", Role: tc.role}
+		if got := authz.Can(principal, tc.permission); got != tc.allowed {
+			t.Errorf("%s %s: allowed = %v, want %v", tc.role, tc.permission, got, tc.allowed)
+		}
+	}
+	if authz.Can(nil, models.PermissionReadAccounts) {
+		t.Error("nil principal allowed")
+	}
+}
+
+func TestAuthorizerRecordsDenials(t *testing.T) {
+	authz := NewAuthorizer()
+	agent := &models.Principal{ID: "key_1", TenantID: "tenant-a", Role: models.RoleAgent}
+
+	if err := authz.Authorize(agent, models.PermissionSendMessages, "POST", "/api/messages"); err != nil {
+		t.Fatalf("allowed action denied: %v", err)
+	}
+	err := authz.Authorize(agent, models.PermissionExportData, "GET", "/api/business/export")
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("err = %v, want ErrForbidden", err)
+	}
+
+	denials := authz.Denials("tenant-a")
+	if len(denials) != 1 || denials[0].PrincipalID != "key_1" || denials[0].Permission != models.PermissionExportData || denials[0].Path != "/api/business/export" {
+		t.Errorf("denials = %+v", denials)
+	}
+	if other := authz.Denials("tenant-b"); len(other) != 0 {
+		t.Errorf("tenant-b sees %d denials", len(other))
+	}
+}
+
+func TestRoleAtMost(t *testing.T) {
+	if !RoleAtMost(models.RoleAgent, models.RoleAdmin) || RoleAtMost(models.RoleOwner, models.RoleAdmin) || RoleAtMost("root", models.RoleOwner) {
+		t.Error("RoleAtMost ordering wrong")
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"back/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventSubscriber receives normalized events. It must not block for long;
+// slow consumers should queue work internally.
+type EventSubscriber func(event models.Event)
+
+// EventBus fans normalized webhook events out to internal listeners.
+type EventBus struct {
+	subscribers []EventSubscriber
+	mutex       sync.RWMutex
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+func (b *EventBus) Subscribe(subscriber EventSubscriber) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscribers = append(b.subscribers, subscriber)
+}
+
+func (b *EventBus) Publish(events ...models.Event) {
+	b.mutex.RLock()
+	subscribers := append([]EventSubscriber(nil), b.subscribers...)
+	b.mutex.RUnlock()
+
+	for _, event := range events {
+		for _, subscriber := range subscribers {
+			subscriber(event)
+		}
+	}
+}
+
+// EventTypeMatches reports whether eventType matches pattern, which is an
+// exact type, "*", or a "prefix.*" wildcard such as "template.*".
+func EventTypeMatches(pattern, eventType string) bool {
+	if pattern == "*" || pattern == eventType {
+		return true
+	}
+	return strings.HasSuffix(pattern, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(pattern, "*"))
+}
+
+var fieldEventTypes = map[string]string{
+	"message_template_status_update":  models.EventTemplateStatus,
+	"message_template_quality_update": models.EventTemplateQuality,
+	"template_category_update":        models.EventTemplateCategory,
+	"account_alerts":                  models.EventAccountAlert,
+	"account_update":                  models.EventAccountUpdate,
+	"account_review_update":           models.EventAccountReview,
+	"phone_number_quality_update":     models.EventPhoneNumberQuality,
+	"phone_number_name_update":        models.EventPhoneNumberName,
+	"business_capability_update":      models.EventBusinessCapability,
+	"security":                        models.EventSecurity,
+}
+
+// NormalizeWebhook flattens a raw webhook body into one event per inbound
+// message, per status and per non-message change. Fields without a known
+// mapping become "webhook.<field>".
+func NormalizeWebhook(body []byte) ([]models.Event, error) {
+	var raw struct {
+		Entry []struct {
+			ID      string `json:"id"`
+			Time    int64  `json:"time"`
+			Changes []struct {
+				Field string          `json:"field"`
+				Value json.RawMessage `json:"value"`
+			} `json:"changes"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("decode webhook body: %w", err)
+	}
+
+	var events []models.Event
+	for _, entry := range raw.Entry {
+		entryTime := time.Unix(entry.Time, 0)
+		for _, change := range entry.Changes {
+			var value struct {
+				Metadata models.WebhookMetadata `json:"metadata"`
+				Messages []json.RawMessage      `json:"messages"`
+				Statuses []json.RawMessage      `json:"statuses"`
+			}
+			json.Unmarshal(change.Value, &value)
+
+			base := models.Event{
+				WABAID:        entry.ID,
+				PhoneNumberID: value.Metadata.PhoneNumberID,
+				Field:         change.Field,
+				OccurredAt:    entryTime,
+			}
+
+			if change.Field != "messages" {
+				e := base
+				e.Type = fieldEventTypes[change.Field]
+				if e.Type == "" {
+					e.Type = "webhook." + change.Field
+				}
+				e.Data = change.Value
+				e.ID = eventID(e.Type, entry.ID, change.Value)
+				events = append(events, e)
+				continue
+			}
+
+			for _, m := range value.Messages {
+				e := base
+				e.Type = models.EventMessageReceived
+				e.Data = m
+				e.OccurredAt = messageTime(m, entryTime)
+				e.ID = eventID(e.Type, entry.ID, m)
+				events = append(events, e)
+			}
+			for _, s := range value.Statuses {
+				e := base
+				e.Type = models.EventMessageStatus
+				e.Data = s
+				e.OccurredAt = messageTime(s, entryTime)
+				e.ID = eventID(e.Type, entry.ID, s)
+				events = append(events, e)
+			}
+		}
+	}
+	return events, nil
+}
+
+// eventID derives a deterministic ID so receivers can de-duplicate replays.
+func eventID(eventType, wabaID string, data []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(eventType + "\x00" + wabaID + "\x00"))
+	sum.Write(data)
+	return "evt_" + hex.EncodeToString(sum.Sum(nil))[:24]
+}
+
+// messageTime reads the string Unix "timestamp" of a message or status.
+func messageTime(data []byte, fallback time.Time) time.Time {
+	var v struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if json.Unmarshal(data, &v) == nil {
+		if secs, err := strconv.ParseInt(v.Timestamp, 10, 64); err == nil {
+			return time.Unix(secs, 0)
+		}
+	}
+	return fallback
+}
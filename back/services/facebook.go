@@ -1,9 +1,11 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
@@ -15,13 +17,19 @@ import (
 )
 
 type FacebookService struct {
-	config *config.Config
-	client *http.Client
+	config  *config.Config
+	secrets *Secrets
+	client  *http.Client
+	metrics *Metrics
 }
 
-func NewFacebookService(cfg *config.Config) *FacebookService {
+// NewFacebookService reads app secrets through secrets; with nil it uses
+// the configured values.
+func NewFacebookService(cfg *config.Config, secrets *Secrets, metrics *Metrics) *FacebookService {
 	return &FacebookService{
-		config: cfg,
+		config:  cfg,
+		secrets: secrets,
+		metrics: metrics,
 		client: &http.Client{
 			Timeout: 15 * time.Second,
 			Transport: &http.Transport{
@@ -36,52 +44,47 @@ func NewFacebookService(cfg *config.Config) *FacebookService {
 	}
 }
 
-// Graph API error envelope
-type fbError struct {
-	Error struct {
-		Message      string `json:"message"`
-		Type         string `json:"type"`
-		Code         int    `json:"code"`
-		ErrorSubcode int    `json:"error_subcode"`
-		FbTraceID    string `json:"fbtrace_id"`
-	} `json:"error"`
+// graphURL builds a versioned Graph API URL against the configured host.
+func (f *FacebookService) graphURL(path string) string {
+	return strings.TrimRight(f.config.GraphAPIBaseURL, "/") + "/v19.0/" + path
 }
 
-func readFBError(body io.Reader) string {
-	b, _ := io.ReadAll(body)
-	var e fbError
-	if json.Unmarshal(b, &e) == nil && e.Error.Message != "" {
-		return fmt.Sprintf("%s (type=%s code=%d subcode=%d trace=%s)",
-			e.Error.Message, e.Error.Type, e.Error.Code, e.Error.ErrorSubcode, e.Error.FbTraceID)
+// get sends a GET request to a Graph API URL.
+func (f *FacebookService) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
 	}
-	return string(b)
+	return doGraph(ctx, f.client, f.metrics, req)
 }
 
-// Exchange authorization code for access token (Embedded Signup / OAuth)
-func (f *FacebookService) ExchangeToken(authCode, redirectURI string) (*models.FacebookTokenResponse, error) {
-	if f.config.FacebookAppID == "" || f.config.FacebookAppSecret == "" {
-		return nil, fmt.Errorf("missing Facebook app credentials in config")
+// Exchange authorization code for access token (Embedded Signup / OAuth).
+// The code must have been issued to app.
+func (f *FacebookService) ExchangeToken(ctx context.Context, app config.MetaApp, authCode, redirectURI string) (*models.FacebookTokenResponse, error) {
+	app = f.secrets.App(app)
+	if app.AppID == "" || app.AppSecret == "" {
+		return nil, fmt.Errorf("missing credentials for Meta app %q", app.Name)
 	}
 
 	// For WhatsApp Embedded Signup, try multiple strategies for redirect_uri
 	strategies := []map[string]string{
 		// Strategy 1: No redirect_uri (common for embedded signup)
 		{
-			"client_id":     f.config.FacebookAppID,
-			"client_secret": f.config.FacebookAppSecret,
+			"client_id":     app.AppID,
+			"client_secret": app.AppSecret,
 			"code":          authCode,
 		},
 		// Strategy 2: Empty redirect_uri
 		{
-			"client_id":     f.config.FacebookAppID,
-			"client_secret": f.config.FacebookAppSecret,
+			"client_id":     app.AppID,
+			"client_secret": app.AppSecret,
 			"code":          authCode,
 			"redirect_uri":  "",
 		},
 		// Strategy 3: Use provided redirect_uri
 		{
-			"client_id":     f.config.FacebookAppID,
-			"client_secret": f.config.FacebookAppSecret,
+			"client_id":     app.AppID,
+			"client_secret": app.AppSecret,
 			"code":          authCode,
 			"redirect_uri":  redirectURI,
 		},
@@ -95,14 +98,15 @@ func (f *FacebookService) ExchangeToken(authCode, redirectURI string) (*models.F
 
 	var lastError error
 	for i, strategy := range strategiesToTry {
-		fmt.Printf("Trying token exchange strategy %d: %+v\n", i+1, strategy)
+		_, withRedirect := strategy["redirect_uri"]
+		slog.DebugContext(ctx, "trying token exchange strategy", "strategy", i+1, "with_redirect_uri", withRedirect)
 
 		form := url.Values{}
 		for key, value := range strategy {
 			form.Set(key, value)
 		}
 
-		req, err := http.NewRequest(http.MethodPost, "https://graph.facebook.com/v19.0/oauth/access_token", strings.NewReader(form.Encode()))
+		req, err := http.NewRequest(http.MethodPost, f.graphURL("oauth/access_token"), strings.NewReader(form.Encode()))
 		if err != nil {
 			lastError = fmt.Errorf("build token exchange request: %w", err)
 			continue
@@ -110,7 +114,7 @@ func (f *FacebookService) ExchangeToken(authCode, redirectURI string) (*models.F
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := f.client.Do(req)
+		resp, err := doGraph(ctx, f.client, f.metrics, req)
 		if err != nil {
 			lastError = fmt.Errorf("token exchange request failed: %w", err)
 			continue
@@ -120,53 +124,76 @@ func (f *FacebookService) ExchangeToken(authCode, redirectURI string) (*models.F
 		body, _ := io.ReadAll(resp.Body)
 
 		if resp.StatusCode == http.StatusOK {
-			// Success!
-			fmt.Printf("✅ Token exchange successful with strategy %d\n", i+1)
+			slog.InfoContext(ctx, "token exchange succeeded", "strategy", i+1)
 			var tokenResp models.FacebookTokenResponse
 			if err := json.Unmarshal(body, &tokenResp); err != nil {
-				return nil, fmt.Errorf("failed to parse token response: %w; raw=%s", err, string(body))
+				return nil, fmt.Errorf("failed to parse token response: %w", err)
 			}
 			return &tokenResp, nil
 		}
 
 		// Parse error for logging
-		var fe fbError
-		_ = json.Unmarshal(body, &fe)
-		if fe.Error.Message != "" {
-			lastError = fmt.Errorf("strategy %d failed: %s (type=%s code=%d subcode=%d)",
-				i+1, fe.Error.Message, fe.Error.Type, fe.Error.Code, fe.Error.ErrorSubcode)
-			fmt.Printf("❌ Strategy %d failed: %s\n", i+1, fe.Error.Message)
-		} else {
-			lastError = fmt.Errorf("strategy %d failed (%s): %s", i+1, resp.Status, string(body))
-			fmt.Printf("❌ Strategy %d failed: %s\n", i+1, resp.Status)
-		}
+		graphErr := readGraphError(resp.StatusCode, strings.NewReader(string(body)))
+		lastError = fmt.Errorf("strategy %d failed: %w", i+1, graphErr)
+		slog.WarnContext(ctx, "token exchange strategy failed", "strategy", i+1, "error", graphErr)
 	}
 
 	return nil, fmt.Errorf("all token exchange strategies failed, last error: %w", lastError)
 }
 
+// ExtendToken exchanges a still valid user access token for a fresh
+// long-lived one (grant_type=fb_exchange_token). Expired or revoked tokens
+// fail with a *GraphError whose TokenInvalid is true.
+func (f *FacebookService) ExtendToken(ctx context.Context, app config.MetaApp, accessToken string) (*models.FacebookTokenResponse, error) {
+	app = f.secrets.App(app)
+	if app.AppID == "" || app.AppSecret == "" {
+		return nil, fmt.Errorf("missing credentials for Meta app %q", app.Name)
+	}
+	form := url.Values{
+		"grant_type":        {"fb_exchange_token"},
+		"client_id":         {app.AppID},
+		"client_secret":     {app.AppSecret},
+		"fb_exchange_token": {accessToken},
+	}
+	req, err := http.NewRequest(http.MethodPost, f.graphURL("oauth/access_token"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := doGraph(ctx, f.client, f.metrics, req)
+	if err != nil {
+		return nil, fmt.Errorf("token refresh request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, readGraphError(resp.StatusCode, resp.Body)
+	}
+	var tokenResp models.FacebookTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	return &tokenResp, nil
+}
+
 // Get business accounts associated with access token
-func (f *FacebookService) GetBusinessAccounts(accessToken string) ([]models.FacebookBusinessAccount, error) {
-	u, _ := url.Parse("https://graph.facebook.com/v19.0/me/businesses")
+func (f *FacebookService) GetBusinessAccounts(ctx context.Context, accessToken string) ([]models.FacebookBusinessAccount, error) {
+	u, _ := url.Parse(f.graphURL("me/businesses"))
 	q := u.Query()
 	q.Set("fields", "id,name,verification_status,profile_picture_uri")
 	q.Set("access_token", accessToken)
 	u.RawQuery = q.Encode()
 
-	fmt.Printf("🔍 Fetching business accounts from: %s\n", u.String())
-
-	resp, err := f.client.Get(u.String())
+	resp, err := f.get(ctx, u.String())
 	if err != nil {
 		return nil, fmt.Errorf("business accounts request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
-	fmt.Printf("📄 Business accounts response status: %d\n", resp.StatusCode)
-	fmt.Printf("📄 Business accounts response body: %s\n", string(body))
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("business accounts failed (%s): %s", resp.Status, readFBError(strings.NewReader(string(body))))
+		return nil, fmt.Errorf("business accounts failed: %w", readGraphError(resp.StatusCode, strings.NewReader(string(body))))
 	}
 
 	var response struct {
@@ -176,40 +203,36 @@ func (f *FacebookService) GetBusinessAccounts(accessToken string) ([]models.Face
 		return nil, fmt.Errorf("failed to decode business accounts response: %w", err)
 	}
 
-	fmt.Printf("✅ Successfully parsed %d business accounts\n", len(response.Data))
+	slog.DebugContext(ctx, "fetched business accounts", "count", len(response.Data))
 
 	// If no business accounts found, try alternative WhatsApp-specific endpoint
 	if len(response.Data) == 0 {
-		fmt.Printf("🔄 No standard business accounts found, trying WhatsApp-specific approach...\n")
-		return f.getWhatsAppBusinessAccounts(accessToken)
+		slog.DebugContext(ctx, "no standard business accounts found, trying WhatsApp-specific approach")
+		return f.getWhatsAppBusinessAccounts(ctx, accessToken)
 	}
 
 	return response.Data, nil
 }
 
 // Alternative method to get WhatsApp Business Accounts directly
-func (f *FacebookService) getWhatsAppBusinessAccounts(accessToken string) ([]models.FacebookBusinessAccount, error) {
+func (f *FacebookService) getWhatsAppBusinessAccounts(ctx context.Context, accessToken string) ([]models.FacebookBusinessAccount, error) {
 	// Try to get WhatsApp Business Accounts directly
-	u, _ := url.Parse("https://graph.facebook.com/v19.0/me")
+	u, _ := url.Parse(f.graphURL("me"))
 	q := u.Query()
 	q.Set("fields", "id,name")
 	q.Set("access_token", accessToken)
 	u.RawQuery = q.Encode()
 
-	fmt.Printf("🔍 Trying user info endpoint: %s\n", u.String())
-
-	resp, err := f.client.Get(u.String())
+	resp, err := f.get(ctx, u.String())
 	if err != nil {
 		return nil, fmt.Errorf("user info request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
-	fmt.Printf("📄 User info response status: %d\n", resp.StatusCode)
-	fmt.Printf("📄 User info response body: %s\n", string(body))
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("user info failed (%s): %s", resp.Status, string(body))
+		return nil, fmt.Errorf("user info failed: %w", readGraphError(resp.StatusCode, strings.NewReader(string(body))))
 	}
 
 	// For embedded signup, we might need to create a virtual business account
@@ -223,7 +246,7 @@ func (f *FacebookService) getWhatsAppBusinessAccounts(accessToken string) ([]mod
 		return nil, fmt.Errorf("failed to parse user info: %w", err)
 	}
 
-	fmt.Printf("ℹ️ User ID: %s, Name: %s\n", userInfo.ID, userInfo.Name)
+	slog.DebugContext(ctx, "fetched user info", "user_id", userInfo.ID)
 
 	// Return empty for now - this indicates we need to handle the embedded signup differently
 	// The frontend message event should contain the WABA ID that was created
@@ -231,21 +254,21 @@ func (f *FacebookService) getWhatsAppBusinessAccounts(accessToken string) ([]mod
 }
 
 // Get phone numbers for a specific WABA
-func (f *FacebookService) GetPhoneNumbers(accessToken, wabaID string) ([]models.FacebookPhoneNumber, error) {
-	u, _ := url.Parse(fmt.Sprintf("https://graph.facebook.com/v19.0/%s/phone_numbers", url.PathEscape(wabaID)))
+func (f *FacebookService) GetPhoneNumbers(ctx context.Context, accessToken, wabaID string) ([]models.FacebookPhoneNumber, error) {
+	u, _ := url.Parse(f.graphURL(url.PathEscape(wabaID) + "/phone_numbers"))
 	q := u.Query()
-	q.Set("fields", "id,display_phone_number,verified_name,quality_rating,status,code_verification_status")
+	q.Set("fields", "id,display_phone_number,verified_name,quality_rating,status,code_verification_status,messaging_limit_tier,throughput,name_status,platform_type")
 	q.Set("access_token", accessToken)
 	u.RawQuery = q.Encode()
 
-	resp, err := f.client.Get(u.String())
+	resp, err := f.get(ctx, u.String())
 	if err != nil {
 		return nil, fmt.Errorf("phone numbers request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("phone numbers failed (%s): %s", resp.Status, readFBError(resp.Body))
+		return nil, fmt.Errorf("phone numbers failed: %w", readGraphError(resp.StatusCode, resp.Body))
 	}
 
 	var response struct {
@@ -257,14 +280,30 @@ func (f *FacebookService) GetPhoneNumbers(accessToken, wabaID string) ([]models.
 	return response.Data, nil
 }
 
+// Ping checks that the Graph API host answers. Any HTTP response counts:
+// the unauthenticated request is expected to be rejected. It bypasses
+// doGraph so probes do not show up as Graph errors in metrics.
+func (f *FacebookService) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.graphURL("me"), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("graph API unreachable: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
 // Validate access token (simple check)
-func (f *FacebookService) ValidateToken(accessToken string) (bool, error) {
-	u, _ := url.Parse("https://graph.facebook.com/v19.0/me")
+func (f *FacebookService) ValidateToken(ctx context.Context, accessToken string) (bool, error) {
+	u, _ := url.Parse(f.graphURL("me"))
 	q := u.Query()
 	q.Set("access_token", accessToken)
 	u.RawQuery = q.Encode()
 
-	resp, err := f.client.Get(u.String())
+	resp, err := f.get(ctx, u.String())
 	if err != nil {
 		return false, err
 	}
@@ -273,5 +312,5 @@ func (f *FacebookService) ValidateToken(accessToken string) (bool, error) {
 	if resp.StatusCode == http.StatusOK {
 		return true, nil
 	}
-	return false, fmt.Errorf("token invalid (%s): %s", resp.Status, readFBError(resp.Body))
+	return false, fmt.Errorf("token invalid: %w", readGraphError(resp.StatusCode, resp.Body))
 }
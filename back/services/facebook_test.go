@@ -0,0 +1,145 @@
+package services
+
+import (
+	"back/config"
+	"back/fakegraph"
+	"back/models"
+	"context"
+	"strings"
+	"testing"
+)
+
+func newTestConfig(graph *fakegraph.Server) *config.Config {
+	return &config.Config{
+		FacebookAppID:      graph.AppID,
+		FacebookAppSecret:  graph.AppSecret,
+		WebhookVerifyToken: "verify-token",
+		WebhookCallbackURL: "https://example.test/api/whatsapp/webhooks",
+		GraphAPIBaseURL:    graph.URL,
+	}
+}
+
+func TestExchangeToken(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	token := graph.AddAuthCode("code-1")
+
+	cfg := newTestConfig(graph)
+	fb := NewFacebookService(cfg, nil, nil)
+	resp, err := fb.ExchangeToken(context.Background(), cfg.MetaApps()[0], "code-1", "")
+	if err != nil {
+		t.Fatalf("ExchangeToken: %v", err)
+	}
+	if resp.AccessToken != token {
+		t.Errorf("access token = %q, want %q", resp.AccessToken, token)
+	}
+	if resp.ExpiresIn == 0 {
+		t.Error("expires_in not populated")
+	}
+}
+
+func TestExchangeTokenFallsBackToNextStrategy(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	graph.AddAuthCode("code-1")
+	graph.Fail(fakegraph.RouteOAuth, fakegraph.Failure{Code: 100, Subcode: 36008, Message: "redirect_uri mismatch", Times: 1})
+
+	cfg := newTestConfig(graph)
+	fb := NewFacebookService(cfg, nil, nil)
+	if _, err := fb.ExchangeToken(context.Background(), cfg.MetaApps()[0], "code-1", ""); err != nil {
+		t.Fatalf("ExchangeToken: %v", err)
+	}
+	if n := graph.RequestCount(fakegraph.RouteOAuth); n != 2 {
+		t.Errorf("oauth requests = %d, want 2", n)
+	}
+}
+
+func TestExchangeTokenAllStrategiesFail(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	graph.Fail(fakegraph.RouteOAuth, fakegraph.Failure{Code: 100, Subcode: 36009, Message: "code already used"})
+
+	cfg := newTestConfig(graph)
+	fb := NewFacebookService(cfg, nil, nil)
+	_, err := fb.ExchangeToken(context.Background(), cfg.MetaApps()[0], "code-1", "https://example.test/callback")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "code already used") {
+		t.Errorf("error %q does not carry Graph message", err)
+	}
+	if n := graph.RequestCount(fakegraph.RouteOAuth); n != 3 {
+		t.Errorf("oauth requests = %d, want 3", n)
+	}
+}
+
+func TestGetBusinessAccounts(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	token := graph.IssueToken()
+	graph.AddBusiness(token, models.FacebookBusinessAccount{ID: "waba-1", Name: "Acme", VerificationStatus: "verified"})
+
+	fb := NewFacebookService(newTestConfig(graph), nil, nil)
+	businesses, err := fb.GetBusinessAccounts(context.Background(), token)
+	if err != nil {
+		t.Fatalf("GetBusinessAccounts: %v", err)
+	}
+	if len(businesses) != 1 || businesses[0].ID != "waba-1" {
+		t.Errorf("businesses = %+v", businesses)
+	}
+}
+
+func TestGetBusinessAccountsEmptyFallsBackToMe(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	token := graph.IssueToken()
+
+	fb := NewFacebookService(newTestConfig(graph), nil, nil)
+	businesses, err := fb.GetBusinessAccounts(context.Background(), token)
+	if err != nil {
+		t.Fatalf("GetBusinessAccounts: %v", err)
+	}
+	if len(businesses) != 0 {
+		t.Errorf("businesses = %+v, want none", businesses)
+	}
+	if graph.RequestCount(fakegraph.RouteMe) != 1 {
+		t.Error("expected fallback request to /me")
+	}
+}
+
+func TestGetPhoneNumbers(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	token := graph.IssueToken()
+	graph.AddPhoneNumber("waba-1", models.FacebookPhoneNumber{ID: "pn-1", DisplayPhoneNumber: "+1 555 0100", QualityRating: "GREEN"})
+
+	fb := NewFacebookService(newTestConfig(graph), nil, nil)
+	numbers, err := fb.GetPhoneNumbers(context.Background(), token, "waba-1")
+	if err != nil {
+		t.Fatalf("GetPhoneNumbers: %v", err)
+	}
+	if len(numbers) != 1 || numbers[0].QualityRating != "GREEN" {
+		t.Errorf("numbers = %+v", numbers)
+	}
+
+	if _, err := fb.GetPhoneNumbers(context.Background(), token, "unknown-waba"); err == nil {
+		t.Error("expected error for unknown WABA")
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	token := graph.IssueToken()
+
+	fb := NewFacebookService(newTestConfig(graph), nil, nil)
+	if ok, err := fb.ValidateToken(context.Background(), token); !ok || err != nil {
+		t.Errorf("ValidateToken(valid) = %v, %v", ok, err)
+	}
+
+	graph.RevokeToken(token)
+	ok, err := fb.ValidateToken(context.Background(), token)
+	if ok || err == nil || !strings.Contains(err.Error(), "code=190") {
+		t.Errorf("ValidateToken(revoked) = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,474 @@
+package services
+
+import (
+	"back/config"
+	"back/models"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Headers sent with every forwarded event
+const (
+	ForwardingSignatureHeader = "X-Webhook-Signature"
+	ForwardingEventIDHeader   = "X-Webhook-Event-Id"
+	ForwardingEventTypeHeader = "X-Webhook-Event-Type"
+)
+
+const (
+	maxDeliveriesPerSubscription = 500
+	forwardingQueueSize          = 1024 // Deliveries waiting for a worker; more are dropped
+	forwardingWorkers            = 4
+)
+
+// ForwardingService POSTs normalized events to subscribed customer endpoints.
+// Deliveries are signed with the subscription secret, retried with
+// exponential backoff, logged, and endpoints that keep failing are disabled.
+type ForwardingService struct {
+	client       *http.Client
+	maxAttempts  int
+	retryBase    time.Duration
+	disableAfter int
+
+	subscriptions map[string]*models.ForwardingSubscription
+	deliveries    map[string][]models.ForwardingDelivery // subscription ID -> newest last
+	mutex         sync.RWMutex
+
+	jobs    chan forwardingJob
+	pending sync.WaitGroup
+	queued  atomic.Int64 // deliveries waiting for a worker or a retry
+	seq     int64
+}
+
+type forwardingJob struct {
+	subscriptionID string
+	event          models.Event
+	body           []byte
+	attempt        int
+}
+
+func NewForwardingService(cfg *config.Config) *ForwardingService {
+	f := &ForwardingService{
+		client:        forwardingClient(cfg.ForwardingAllowPrivateTargets),
+		maxAttempts:   cfg.ForwardingMaxAttempts,
+		retryBase:     time.Second,
+		disableAfter:  cfg.ForwardingDisableAfter,
+		subscriptions: make(map[string]*models.ForwardingSubscription),
+		deliveries:    make(map[string][]models.ForwardingDelivery),
+		jobs:          make(chan forwardingJob, forwardingQueueSize),
+	}
+	if f.maxAttempts < 1 {
+		f.maxAttempts = 1
+	}
+	for i := 0; i < forwardingWorkers; i++ {
+		go f.worker()
+	}
+	return f
+}
+
+// CreateSubscription validates and stores a new subscription, generating
+// its signing secret. The returned copy is the only one carrying the secret.
+func (f *ForwardingService) CreateSubscription(sub *models.ForwardingSubscription) (*models.ForwardingSubscription, error) {
+	if sub.TenantID == "" {
+		return nil, fmt.Errorf("subscription has no tenant")
+	}
+	if err := validateTargetURL(sub.TargetURL); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate subscription secret: %w", err)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.seq++
+	now := time.Now()
+	stored := &models.ForwardingSubscription{
+		ID:         fmt.Sprintf("fwd_%d_%d", now.Unix(), f.seq),
+		TenantID:   sub.TenantID,
+		TargetURL:  sub.TargetURL,
+		Secret:     "whsec_" + hex.EncodeToString(secret),
+		EventTypes: sub.EventTypes,
+		WABAIDs:    sub.WABAIDs,
+		Enabled:    true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	f.subscriptions[stored.ID] = stored
+
+	created := *stored
+	return &created, nil
+}
+
+// UpdateSubscription replaces the target, filters and enabled flag.
+// Re-enabling clears the failure counter.
+func (f *ForwardingService) UpdateSubscription(tenantID, id string, update *models.ForwardingSubscription) (*models.ForwardingSubscription, error) {
+	if err := validateTargetURL(update.TargetURL); err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	sub, exists := f.subscriptions[id]
+	if !exists || sub.TenantID != tenantID {
+		return nil, fmt.Errorf("subscription not found")
+	}
+	sub.TargetURL = update.TargetURL
+	sub.EventTypes = update.EventTypes
+	sub.WABAIDs = update.WABAIDs
+	if update.Enabled && !sub.Enabled {
+		sub.ConsecutiveFailures = 0
+		sub.DisabledReason = ""
+	}
+	sub.Enabled = update.Enabled
+	sub.UpdatedAt = time.Now()
+
+	return redacted(sub), nil
+}
+
+func (f *ForwardingService) GetSubscription(tenantID, id string) (*models.ForwardingSubscription, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	sub, exists := f.subscriptions[id]
+	if !exists || sub.TenantID != tenantID {
+		return nil, fmt.Errorf("subscription not found")
+	}
+	return redacted(sub), nil
+}
+
+func (f *ForwardingService) ListSubscriptions(tenantID string) ([]*models.ForwardingSubscription, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	subs := make([]*models.ForwardingSubscription, 0)
+	for _, sub := range f.subscriptions {
+		if sub.TenantID != tenantID {
+			continue
+		}
+		subs = append(subs, redacted(sub))
+	}
+	return subs, nil
+}
+
+func (f *ForwardingService) DeleteSubscription(tenantID, id string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if sub, exists := f.subscriptions[id]; !exists || sub.TenantID != tenantID {
+		return fmt.Errorf("subscription not found")
+	}
+	delete(f.subscriptions, id)
+	delete(f.deliveries, id)
+	return nil
+}
+
+// Deliveries returns the delivery log for a subscription, newest first.
+func (f *ForwardingService) Deliveries(tenantID, subscriptionID string) ([]models.ForwardingDelivery, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if sub, exists := f.subscriptions[subscriptionID]; !exists || sub.TenantID != tenantID {
+		return nil, fmt.Errorf("subscription not found")
+	}
+	log := f.deliveries[subscriptionID]
+	out := make([]models.ForwardingDelivery, 0, len(log))
+	for i := len(log) - 1; i >= 0; i-- {
+		out = append(out, log[i])
+	}
+	return out, nil
+}
+
+// HandleEvent queues event for every enabled subscription that matches it.
+// It is an EventSubscriber.
+func (f *ForwardingService) HandleEvent(event models.Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("failed to marshal event for forwarding", "event_id", event.ID, "error", err)
+		return
+	}
+
+	f.mutex.RLock()
+	var targets []string
+	for id, sub := range f.subscriptions {
+		if sub.Enabled && subscriptionMatches(sub, event) {
+			targets = append(targets, id)
+		}
+	}
+	f.mutex.RUnlock()
+
+	for _, id := range targets {
+		f.enqueue(forwardingJob{subscriptionID: id, event: event, body: body, attempt: 1})
+	}
+}
+
+// Wait blocks until every queued delivery, including pending retries, is done.
+func (f *ForwardingService) Wait() {
+	f.pending.Wait()
+}
+
+// Shutdown waits for queued deliveries, including scheduled retries, until
+// ctx is done. Events published afterwards are still accepted.
+func (f *ForwardingService) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		f.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d forwarding deliveries still queued: %w", f.QueueDepth(), ctx.Err())
+	}
+}
+
+// QueueDepth returns the number of deliveries not yet attempted, including
+// scheduled retries.
+func (f *ForwardingService) QueueDepth() int {
+	return int(f.queued.Load())
+}
+
+// enqueue hands job to the workers. Events are published from the webhook
+// request, so a full queue, e.g. behind slow endpoints, drops the delivery
+// instead of holding up Meta's webhook; the drop is logged and recorded.
+func (f *ForwardingService) enqueue(job forwardingJob) {
+	f.pending.Add(1)
+	f.queued.Add(1)
+	select {
+	case f.jobs <- job:
+	default:
+		f.queued.Add(-1)
+		f.pending.Done()
+		f.drop(job)
+	}
+}
+
+// drop records a delivery the queue had no room for. It does not count
+// towards disabling the subscription, since the endpoint was not tried.
+func (f *ForwardingService) drop(job forwardingJob) {
+	slog.Warn("forwarding queue full, delivery dropped", "subscription_id", job.subscriptionID, "event_id", job.event.ID, "attempt", job.attempt)
+	f.record(models.ForwardingDelivery{
+		SubscriptionID: job.subscriptionID,
+		EventID:        job.event.ID,
+		EventType:      job.event.Type,
+		Attempt:        job.attempt,
+		Error:          "dropped: forwarding queue full",
+		AttemptedAt:    time.Now(),
+	}, false, false)
+}
+
+func (f *ForwardingService) worker() {
+	for job := range f.jobs {
+		f.queued.Add(-1)
+		f.deliver(job)
+		f.pending.Done()
+	}
+}
+
+func (f *ForwardingService) deliver(job forwardingJob) {
+	f.mutex.RLock()
+	sub, exists := f.subscriptions[job.subscriptionID]
+	var target, secret string
+	if exists {
+		target, secret = sub.TargetURL, sub.Secret
+		exists = sub.Enabled
+	}
+	f.mutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	started := time.Now()
+	status, err := f.post(target, secret, job)
+	delivery := models.ForwardingDelivery{
+		SubscriptionID: job.subscriptionID,
+		EventID:        job.event.ID,
+		EventType:      job.event.Type,
+		Attempt:        job.attempt,
+		Success:        err == nil,
+		StatusCode:     status,
+		DurationMS:     time.Since(started).Milliseconds(),
+		AttemptedAt:    started,
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	retry := err != nil && job.attempt < f.maxAttempts
+	f.record(delivery, err == nil, !retry)
+
+	if retry {
+		backoff := f.retryBase << (job.attempt - 1)
+		job.attempt++
+		// Counted as queued while the retry is scheduled
+		f.pending.Add(1)
+		f.queued.Add(1)
+		time.AfterFunc(backoff, func() {
+			f.queued.Add(-1)
+			f.enqueue(job)
+			f.pending.Done()
+		})
+	}
+}
+
+// post sends one signed attempt and returns the response status.
+func (f *ForwardingService) post(target, secret string, job forwardingJob) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(job.body))
+	if err != nil {
+		return 0, fmt.Errorf("build forwarding request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ForwardingEventIDHeader, job.event.ID)
+	req.Header.Set(ForwardingEventTypeHeader, job.event.Type)
+	req.Header.Set(ForwardingSignatureHeader, SignForwardedEvent(secret, time.Now(), job.body))
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("forwarding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// record appends to the delivery log and, once an event is finally
+// delivered or abandoned, updates the subscription's failure streak.
+func (f *ForwardingService) record(delivery models.ForwardingDelivery, success, final bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	sub, exists := f.subscriptions[delivery.SubscriptionID]
+	if !exists {
+		return
+	}
+
+	f.seq++
+	delivery.ID = fmt.Sprintf("fwdd_%d_%d", delivery.AttemptedAt.Unix(), f.seq)
+	entries := append(f.deliveries[sub.ID], delivery)
+	if len(entries) > maxDeliveriesPerSubscription {
+		entries = entries[len(entries)-maxDeliveriesPerSubscription:]
+	}
+	f.deliveries[sub.ID] = entries
+
+	switch {
+	case success:
+		sub.ConsecutiveFailures = 0
+	case final:
+		sub.ConsecutiveFailures++
+		if f.disableAfter > 0 && sub.ConsecutiveFailures >= f.disableAfter && sub.Enabled {
+			sub.Enabled = false
+			sub.DisabledReason = fmt.Sprintf("disabled after %d consecutive failed events; last error: %s",
+				sub.ConsecutiveFailures, delivery.Error)
+			sub.UpdatedAt = time.Now()
+			slog.Warn("disabled forwarding subscription", "subscription_id", sub.ID, "target_url", sub.TargetURL, "consecutive_failures", sub.ConsecutiveFailures)
+		}
+	}
+}
+
+// SignForwardedEvent builds the X-Webhook-Signature value:
+// "t=<unix>,v1=<hex HMAC-SHA256 of "<unix>.<body>">".
+func SignForwardedEvent(secret string, at time.Time, body []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func subscriptionMatches(sub *models.ForwardingSubscription, event models.Event) bool {
+	if sub.TenantID != event.TenantID {
+		return false
+	}
+	if len(sub.WABAIDs) > 0 && !contains(sub.WABAIDs, event.WABAID) {
+		return false
+	}
+	if len(sub.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range sub.EventTypes {
+		if EventTypeMatches(t, event.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateTargetURL(target string) error {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("target_url must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// errPrivateTarget is returned when a target resolves to an address
+// tenants must not reach through forwarding.
+var errPrivateTarget = errors.New("target address is not public")
+
+// forwardingClient does not follow redirects and, unless allowPrivate,
+// refuses to connect to loopback, private and link-local addresses, so
+// tenants cannot use forwarding to probe the internal network. The check
+// runs on the resolved address, so a public name pointing inside fails too.
+func forwardingClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !publicAddr(addrPort.Addr()) {
+				return errPrivateTarget
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// sharedAddressSpace is carrier-grade NAT space (RFC 6598), not covered by
+// netip.Addr.IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+func redacted(sub *models.ForwardingSubscription) *models.ForwardingSubscription {
+	copied := *sub
+	copied.Secret = ""
+	return &copied
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"back/config"
+	"back/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const forwardingTestPayload = `{"object":"whatsapp_business_account","entry":[{"id":"waba-1","time":1700000000,"changes":[
+ {"field":"messages","value":{"metadata":{"phone_number_id":"pn-1"},
+  "messages":[{"id":"wamid.1","from":"1555","timestamp":"1700000001","type":"text","text":{"body":"hi"}}],
+  "statuses":[{"id":"wamid.0","status":"read","timestamp":"1700000002"}]}},
+ {"field":"message_template_status_update","value":{"event":"APPROVED","message_template_id":1}}]}]}`
+
+func TestNormalizeWebhook(t *testing.T) {
+	events, err := NormalizeWebhook([]byte(forwardingTestPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{models.EventMessageReceived, models.EventMessageStatus, models.EventTemplateStatus}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, e := range events {
+		if e.Type != want[i] || e.WABAID != "waba-1" || e.ID == "" {
+			t.Errorf("event %d = %+v", i, e)
+		}
+	}
+	if events[0].PhoneNumberID != "pn-1" || events[0].OccurredAt.Unix() != 1700000001 {
+		t.Errorf("message event = %+v", events[0])
+	}
+
+	again, _ := NormalizeWebhook([]byte(forwardingTestPayload))
+	if again[0].ID != events[0].ID {
+		t.Error("event IDs are not stable across replays")
+	}
+}
+
+type forwardingReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int // responses to return in order; 200 once exhausted
+	received []*http.Request
+	bodies   []string
+}
+
+func newForwardingReceiver(statuses ...int) *forwardingReceiver {
+	fr := &forwardingReceiver{statuses: statuses}
+	fr.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fr.mu.Lock()
+		fr.received = append(fr.received, r)
+		fr.bodies = append(fr.bodies, string(body))
+		status := http.StatusOK
+		if len(fr.statuses) > 0 {
+			status, fr.statuses = fr.statuses[0], fr.statuses[1:]
+		}
+		fr.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	return fr
+}
+
+func newTestForwarding(maxAttempts, disableAfter int) *ForwardingService {
+	f := NewForwardingService(&config.Config{ForwardingMaxAttempts: maxAttempts, ForwardingDisableAfter: disableAfter, ForwardingAllowPrivateTargets: true})
+	f.retryBase = time.Millisecond
+	return f
+}
+
+func TestForwardingSignsAndFilters(t *testing.T) {
+	rcv := newForwardingReceiver()
+	defer rcv.Close()
+	f := newTestForwarding(3, 5)
+
+	sub, err := f.CreateSubscription(&models.ForwardingSubscription{TenantID: models.DefaultTenantID, TargetURL: rcv.URL, EventTypes: []string{"message.*"}, WABAIDs: []string{"waba-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sub.Secret, "whsec_") {
+		t.Fatalf("secret = %q", sub.Secret)
+	}
+
+	events, _ := NormalizeWebhook([]byte(forwardingTestPayload))
+	for i := range events {
+		events[i].TenantID = models.DefaultTenantID
+		f.HandleEvent(events[i])
+	}
+	other := events[0]
+	other.WABAID = "waba-2"
+	f.HandleEvent(other)
+	otherTenant := events[0]
+	otherTenant.TenantID = "tenant-b"
+	f.HandleEvent(otherTenant)
+	f.Wait()
+
+	if len(rcv.received) != 2 {
+		t.Fatalf("received %d deliveries, want 2 (message.* for waba-1 in the subscription's tenant only)", len(rcv.received))
+	}
+	for i, r := range rcv.received {
+		sig := r.Header.Get(ForwardingSignatureHeader)
+		secs, _ := strconv.ParseInt(strings.TrimPrefix(strings.Split(sig, ",")[0], "t="), 10, 64)
+		if SignForwardedEvent(sub.Secret, time.Unix(secs, 0), []byte(rcv.bodies[i])) != sig {
+			t.Errorf("delivery %d: signature %q does not verify", i, sig)
+		}
+		if r.Header.Get(ForwardingEventIDHeader) == "" {
+			t.Errorf("delivery %d: missing event ID header", i)
+		}
+	}
+
+	if stored, _ := f.GetSubscription(models.DefaultTenantID, sub.ID); stored.Secret != "" {
+		t.Error("secret exposed after creation")
+	}
+}
+
+func TestForwardingRetriesWithBackoff(t *testing.T) {
+	rcv := newForwardingReceiver(500, 503)
+	defer rcv.Close()
+	f := newTestForwarding(3, 5)
+	sub, _ := f.CreateSubscription(&models.ForwardingSubscription{TenantID: models.DefaultTenantID, TargetURL: rcv.URL})
+
+	f.HandleEvent(models.Event{ID: "evt_1", TenantID: models.DefaultTenantID, Type: models.EventMessageReceived})
+	f.Wait()
+
+	deliveries, _ := f.Deliveries(models.DefaultTenantID, sub.ID)
+	if len(deliveries) != 3 {
+		t.Fatalf("got %d delivery attempts, want 3", len(deliveries))
+	}
+	if !deliveries[0].Success || deliveries[0].Attempt != 3 || deliveries[2].StatusCode != 500 {
+		t.Errorf("deliveries = %+v", deliveries)
+	}
+	if stored, _ := f.GetSubscription(models.DefaultTenantID, sub.ID); stored.ConsecutiveFailures != 0 {
+		t.Errorf("consecutive failures = %d", stored.ConsecutiveFailures)
+	}
+}
+
+func TestForwardingDisablesFailingEndpoint(t *testing.T) {
+	rcv := newForwardingReceiver(500, 500, 500, 500, 500, 500)
+	defer rcv.Close()
+	f := newTestForwarding(2, 2)
+	sub, _ := f.CreateSubscription(&models.ForwardingSubscription{TenantID: models.DefaultTenantID, TargetURL: rcv.URL})
+
+	f.HandleEvent(models.Event{ID: "evt_1", TenantID: models.DefaultTenantID, Type: models.EventMessageReceived})
+	f.Wait()
+	f.HandleEvent(models.Event{ID: "evt_2", TenantID: models.DefaultTenantID, Type: models.EventMessageReceived})
+	f.Wait()
+
+	stored, _ := f.GetSubscription(models.DefaultTenantID, sub.ID)
+	if stored.Enabled || stored.DisabledReason == "" {
+		t.Fatalf("subscription still enabled: %+v", stored)
+	}
+
+	f.HandleEvent(models.Event{ID: "evt_3", TenantID: models.DefaultTenantID, Type: models.EventMessageReceived})
+	f.Wait()
+	if len(rcv.received) != 4 {
+		t.Errorf("received %d attempts, want 4 (none after disabling)", len(rcv.received))
+	}
+
+	stored.Enabled = true
+	reenabled, err := f.UpdateSubscription(models.DefaultTenantID, sub.ID, stored)
+	if err != nil || !reenabled.Enabled || reenabled.ConsecutiveFailures != 0 {
+		t.Errorf("re-enable = %+v, %v", reenabled, err)
+	}
+}
+
+func TestForwardingRejectsInvalidTarget(t *testing.T) {
+	f := newTestForwarding(1, 1)
+	for _, target := range []string{"", "ftp://example.test", "/relative"} {
+		if _, err := f.CreateSubscription(&models.ForwardingSubscription{TenantID: models.DefaultTenantID, TargetURL: target}); err == nil {
+			t.Errorf("CreateSubscription(%q) succeeded", target)
+		}
+	}
+}
+
+func TestForwardingRefusesPrivateTargets(t *testing.T) {
+	rcv := newForwardingReceiver()
+	defer rcv.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(rcv.URL, http.StatusFound))
+	defer redirect.Close()
+
+	// Targets on loopback are refused once resolved
+	f := NewForwardingService(&config.Config{ForwardingMaxAttempts: 1, ForwardingDisableAfter: 5})
+	sub, _ := f.CreateSubscription(&models.ForwardingSubscription{TenantID: models.DefaultTenantID, TargetURL: rcv.URL})
+	f.HandleEvent(models.Event{ID: "evt_1", TenantID: models.DefaultTenantID, Type: models.EventMessageReceived})
+	f.Wait()
+	deliveries, _ := f.Deliveries(models.DefaultTenantID, sub.ID)
+	if len(deliveries) != 1 || deliveries[0].Success || !strings.Contains(deliveries[0].Error, errPrivateTarget.Error()) {
+		t.Errorf("deliveries = %+v", deliveries)
+	}
+
+	// Redirects are not followed
+	f = newTestForwarding(1, 5)
+	sub, _ = f.CreateSubscription(&models.ForwardingSubscription{TenantID: models.DefaultTenantID, TargetURL: redirect.URL})
+	f.HandleEvent(models.Event{ID: "evt_2", TenantID: models.DefaultTenantID, Type: models.EventMessageReceived})
+	f.Wait()
+	deliveries, _ = f.Deliveries(models.DefaultTenantID, sub.ID)
+	if len(deliveries) != 1 || deliveries[0].StatusCode != http.StatusFound {
+		t.Errorf("deliveries = %+v", deliveries)
+	}
+	if len(rcv.received) != 0 {
+		t.Errorf("receiver got %d requests", len(rcv.received))
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34": true, "2606:4700::1111": true,
+		"127.0.0.1": false, "10.1.2.3": false, "172.16.0.1": false, "192.168.1.1": false,
+		"169.254.169.254": false, "100.64.0.1": false, "0.0.0.0": false, "::1": false,
+		"fe80::1": false, "fd00:ec2::254": false, "::ffff:127.0.0.1": false,
+	} {
+		if got := publicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("publicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestForwardingDropsWhenQueueIsFull(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	f := newTestForwarding(1, 5)
+	sub, _ := f.CreateSubscription(&models.ForwardingSubscription{TenantID: models.DefaultTenantID, TargetURL: slow.URL})
+
+	// Workers stuck on the endpoint must not block publishing
+	total := forwardingQueueSize + forwardingWorkers + 10
+	published := make(chan struct{})
+	go func() {
+		for i := range total {
+			f.HandleEvent(models.Event{ID: "evt_" + strconv.Itoa(i), TenantID: models.DefaultTenantID, Type: models.EventMessageReceived})
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("HandleEvent blocked on a full queue")
+	}
+	deliveries, _ := f.Deliveries(models.DefaultTenantID, sub.ID)
+	close(release)
+	f.Wait()
+
+	if len(deliveries) == 0 || !strings.Contains(deliveries[0].Error, "queue full") {
+		t.Errorf("no dropped delivery recorded: %+v", deliveries)
+	}
+	if stored, _ := f.GetSubscription(models.DefaultTenantID, sub.ID); stored.ConsecutiveFailures != 0 || !stored.Enabled {
+		t.Errorf("drops counted against the endpoint: %+v", stored)
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// doGraph sends a Graph API request on behalf of ctx, logs its outcome and
+// records it in metrics. Only the URL path is logged; queries may carry
+// access_token.
+func doGraph(ctx context.Context, client *http.Client, metrics *Metrics, req *http.Request) (*http.Response, error) {
+	req = req.WithContext(ctx)
+	endpoint := graphEndpoint(req.URL.Path)
+	start := time.Now()
+	resp, err := client.Do(req)
+	elapsed := time.Since(start)
+	if err != nil {
+		metrics.GraphRequest(req.Method, endpoint, elapsed, "network")
+		slog.WarnContext(ctx, "graph request failed", "method", req.Method, "path", req.URL.Path, "duration_ms", elapsed.Milliseconds(), "error", err)
+		return nil, err
+	}
+
+	errorCode := ""
+	if resp.StatusCode != http.StatusOK {
+		// Peek at the error code, leaving the body for the caller
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		errorCode = "http_" + strconv.Itoa(resp.StatusCode)
+		if graphErr := readGraphError(resp.StatusCode, bytes.NewReader(body)); graphErr.Code != 0 {
+			errorCode = strconv.Itoa(graphErr.Code)
+		}
+	}
+	metrics.GraphRequest(req.Method, endpoint, elapsed, errorCode)
+	slog.DebugContext(ctx, "graph request", "method", req.Method, "path", req.URL.Path, "status", resp.StatusCode, "duration_ms", elapsed.Milliseconds())
+	return resp, nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GraphError is an error response from the Graph API. Callers unwrap it with
+// errors.As to map Meta's codes onto our own API errors.
+type GraphError struct {
+	Status    int    // HTTP status of the Graph response
+	Message   string // Meta's message, or the raw body when it was not JSON
+	Type      string
+	Code      int
+	Subcode   int
+	FBTraceID string
+}
+
+func (e *GraphError) Error() string {
+	return fmt.Sprintf("%s (status=%d type=%s code=%d subcode=%d trace=%s)",
+		e.Message, e.Status, e.Type, e.Code, e.Subcode, e.FBTraceID)
+}
+
+// rateLimitCodes are Graph and Cloud API throttling errors: app, user, page
+// and WABA level limits, plus per-number throughput and pair rate limits.
+var rateLimitCodes = map[int]bool{
+	4: true, 17: true, 32: true, 613: true, 80004: true, 80007: true,
+	130429: true, 131048: true, 131056: true,
+}
+
+// RateLimited reports whether Meta throttled the request.
+func (e *GraphError) RateLimited() bool {
+	return rateLimitCodes[e.Code] || e.Status == 429
+}
+
+// TokenInvalid reports whether the access token was expired or revoked.
+func (e *GraphError) TokenInvalid() bool {
+	return e.Code == 190 || e.Code == 102
+}
+
+// ObjectNotFound reports whether the requested Graph object (e.g. a WABA)
+// does not exist or is not visible to the token.
+func (e *GraphError) ObjectNotFound() bool {
+	return e.Code == 100 && e.Subcode == 33 || e.Status == 404
+}
+
+type fbError struct {
+	Error struct {
+		Message      string `json:"message"`
+		Type         string `json:"type"`
+		Code         int    `json:"code"`
+		ErrorSubcode int    `json:"error_subcode"`
+		FbTraceID    string `json:"fbtrace_id"`
+	} `json:"error"`
+}
+
+func readGraphError(status int, body io.Reader) *GraphError {
+	b, _ := io.ReadAll(body)
+	var e fbError
+	if json.Unmarshal(b, &e) == nil && e.Error.Message != "" {
+		return &GraphError{
+			Status:    status,
+			Message:   e.Error.Message,
+			Type:      e.Error.Type,
+			Code:      e.Error.Code,
+			Subcode:   e.Error.ErrorSubcode,
+			FBTraceID: e.Error.FbTraceID,
+		}
+	}
+	return &GraphError{Status: status, Message: strings.TrimSpace(string(b))}
+}
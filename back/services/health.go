@@ -0,0 +1,140 @@
+package services
+
+import (
+	"back/models"
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// HealthService runs the readiness checks registered with AddCheck.
+type HealthService struct {
+	build   models.BuildInfo
+	timeout time.Duration
+	checks  []healthCheck
+	mutex   sync.RWMutex
+}
+
+type healthCheck struct {
+	name     string
+	critical bool
+	check    func(ctx context.Context) error
+}
+
+func NewHealthService(build models.BuildInfo) *HealthService {
+	return &HealthService{build: build, timeout: 5 * time.Second}
+}
+
+// AddCheck registers a readiness check. A failing critical check makes the
+// service unavailable; other failures only degrade it.
+func (h *HealthService) AddCheck(name string, critical bool, check func(ctx context.Context) error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.checks = append(h.checks, healthCheck{name: name, critical: critical, check: check})
+}
+
+// Liveness reports that the process is up. It checks no dependencies.
+func (h *HealthService) Liveness() models.HealthResponse {
+	return models.HealthResponse{Status: models.HealthOK, Timestamp: time.Now().UTC(), Build: h.build}
+}
+
+// Readiness runs every check concurrently, each bounded by the service
+// timeout, and summarizes the results.
+func (h *HealthService) Readiness(ctx context.Context) models.ReadinessResponse {
+	h.mutex.RLock()
+	checks := append([]healthCheck(nil), h.checks...)
+	h.mutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	results := make([]models.ComponentHealth, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	resp := models.ReadinessResponse{
+		Status:    models.HealthOK,
+		Timestamp: time.Now().UTC(),
+		Build:     h.build,
+		Checks:    make(map[string]models.ComponentHealth, len(checks)),
+	}
+	for i, c := range checks {
+		result := results[i]
+		resp.Checks[c.name] = result
+		if result.Status == models.HealthOK {
+			continue
+		}
+		if c.critical {
+			resp.Status = models.HealthUnavailable
+		} else if resp.Status == models.HealthOK {
+			resp.Status = models.HealthDegraded
+		}
+	}
+	return resp
+}
+
+func runCheck(ctx context.Context, c healthCheck) models.ComponentHealth {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- c.check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out: %w", ctx.Err())
+	}
+
+	result := models.ComponentHealth{
+		Status:     models.HealthOK,
+		Critical:   c.critical,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = models.HealthFail
+		result.Message = RedactString(err.Error())
+	}
+	return result
+}
+
+// ReadBuildInfo describes the running binary. version is set at link time
+// (-ldflags "-X main.version=..."); the commit comes from the VCS stamp Go
+// embeds in binaries built from a checkout.
+func ReadBuildInfo(version string) models.BuildInfo {
+	build := models.BuildInfo{Version: version}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	build.GoVersion = info.GoVersion
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Commit = setting.Value
+		case "vcs.modified":
+			if setting.Value == "true" && build.Commit != "" {
+				build.Commit += "-dirty"
+			}
+		}
+	}
+	return build
+}
+
+// QueueBacklogCheck fails when depth exceeds max.
+func QueueBacklogCheck(name string, depth func() int, max int) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if n := depth(); max > 0 && n > max {
+			return fmt.Errorf("%s queue backlog %d exceeds %d", name, n, max)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"back/config"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// NewLogger builds the process logger from LOG_LEVEL and LOG_FORMAT. Every
+// record carries the request and trace IDs found in its context, and tokens,
+// phone numbers and message content are masked unless LOG_SENSITIVE_DATA is
+// set.
+func NewLogger(w io.Writer, cfg *config.Config) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", cfg.LogLevel)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.LogFormat) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q (want text or json)", cfg.LogFormat)
+	}
+
+	handler = &contextHandler{next: handler}
+	if !cfg.LogSensitiveData {
+		handler = NewRedactingHandler(handler)
+	}
+	return slog.New(handler), nil
+}
+
+// contextHandler adds the request and trace IDs of the record's context.
+type contextHandler struct {
+	next slog.Handler
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	info := RequestInfoFromContext(ctx)
+	if info.ID != "" {
+		r.AddAttrs(slog.String("request_id", info.ID))
+	}
+	if info.TraceID != "" {
+		r.AddAttrs(slog.String("trace_id", info.TraceID))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{next: h.next.WithGroup(name)}
+}
+
+// logSecretKeys are attributes whose values are never logged.
+var logSecretKeys = map[string]bool{
+	"authorization": true,
+	"client_secret": true,
+	"verify_token":  true,
+	"signature":     true,
+	"credential":    true,
+}
+
+// logPhoneKeys are attributes holding phone numbers; all but the last four
+// digits are masked.
+var logPhoneKeys = map[string]bool{
+	"phone":                true,
+	"phone_number":         true,
+	"display_phone_number": true,
+	"to":                   true,
+	"from":                 true,
+	"wa_id":                true,
+	"recipient":            true,
+	"recipient_id":         true,
+}
+
+// logContentKeys are attributes holding message content; only the length is
+// logged.
+var logContentKeys = map[string]bool{
+	"body":    true,
+	"text":    true,
+	"caption": true,
+	"content": true,
+}
+
+// NewRedactingHandler masks sensitive attribute values and scrubs tokens and
+// phone numbers out of messages and free-text values before passing records
+// on to next.
+func NewRedactingHandler(next slog.Handler) slog.Handler {
+	return &redactingHandler{next: next}
+}
+
+type redactingHandler struct {
+	next slog.Handler
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, RedactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return &redactingHandler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		group := a.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, nested := range group {
+			redacted[i] = redactAttr(nested)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	}
+	return slog.Attr{Key: a.Key, Value: slog.AnyValue(redactLogValue(a.Key, a.Value.Any()))}
+}
+
+func redactLogValue(key string, v any) any {
+	key = strings.ToLower(key)
+	switch {
+	case secretFields[key] || logSecretKeys[key]:
+		return redactedValue
+	case logContentKeys[key]:
+		if s, ok := v.(string); ok {
+			return fmt.Sprintf("[REDACTED len=%d]", len(s))
+		}
+		return redactedValue
+	case logPhoneKeys[key]:
+		if s, ok := v.(string); ok {
+			return MaskPhone(s)
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		return RedactString(val)
+	case error:
+		return RedactString(val.Error())
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, nested := range val {
+			out[k] = redactLogValue(k, nested)
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]any, len(val))
+		for k, nested := range val {
+			out[k] = redactLogValue(k, nested)
+		}
+		return out
+	}
+	return v
+}
+
+var (
+	graphTokenPattern  = regexp.MustCompile(`EAA[A-Za-z0-9]{8,}`)
+	apiKeyPattern      = regexp.MustCompile(`wak_[A-Za-z0-9_-]{6,}`)
+	hookSecretPattern  = regexp.MustCompile(`whsec_[A-Za-z0-9]{6,}`)
+	bearerPattern      = regexp.MustCompile(`(?i)(bearer )[A-Za-z0-9._~+/=-]+`)
+	queryParamPattern  = regexp.MustCompile(`((?:access_token|client_secret|code|hub\.verify_token)=)[^&\s"']+`)
+	e164NumberPattern  = regexp.MustCompile(`\+\d[\d -]{6,}\d`)
+	redactionReplacers = []struct {
+		pattern *regexp.Regexp
+		replace func(string) string
+	}{
+		{graphTokenPattern, func(string) string { return "EAA" + redactedValue }},
+		{apiKeyPattern, func(string) string { return "wak_" + redactedValue }},
+		{hookSecretPattern, func(string) string { return "whsec_" + redactedValue }},
+		{bearerPattern, func(m string) string { return m[:7] + redactedValue }},
+		{queryParamPattern, func(m string) string { return m[:strings.Index(m, "=")+1] + redactedValue }},
+		{e164NumberPattern, MaskPhone},
+	}
+)
+
+// RedactString scrubs Graph access tokens, API keys, webhook secrets,
+// credentials in URLs and "+"-prefixed phone numbers out of free text.
+func RedactString(s string) string {
+	for _, r := range redactionReplacers {
+		s = r.pattern.ReplaceAllStringFunc(s, r.replace)
+	}
+	return s
+}
+
+// MaskPhone replaces all but the last four digits of a phone number with
+// "*", keeping any formatting ("+1 555 0100" -> "+* *** 0100").
+func MaskPhone(s string) string {
+	digits := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	masked := []rune(s)
+	for i, c := range masked {
+		if digits <= 4 {
+			break
+		}
+		if c >= '0' && c <= '9' {
+			masked[i] = '*'
+			digits--
+		}
+	}
+	return string(masked)
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"back/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func newTestLogger(t *testing.T, cfg *config.Config) (*slog.Logger, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logger, &buf
+}
+
+func TestLoggerRedactsSensitiveData(t *testing.T) {
+	logger, buf := newTestLogger(t, &config.Config{LogLevel: "info", LogFormat: "json"})
+
+	logger.Info("calling https://graph.example/me?access_token=EAAGabcdef123456&fields=id for +1 555 010 0199",
+		"access_token", "EAAGabcdef123456",
+		"from", "15550100199",
+		"body", "hello there",
+		"error", errors.New("Bearer wak_abcdefghijklmnop rejected"),
+		slog.Group("message", "to", "447700900123", "text", "secret plans"),
+		"phone_number_id", "106540352242922",
+	)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("not JSON: %v\n%s", err, buf)
+	}
+	out := buf.String()
+	for _, leaked := range []string{"EAAGabcdef123456", "15550100199", "hello there", "wak_abcdefghijklmnop", "447700900123", "secret plans", "555 010 0199"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("log leaks %q:\n%s", leaked, out)
+		}
+	}
+	if line["from"] != "*******0199" {
+		t.Errorf("from = %v, want last four digits kept", line["from"])
+	}
+	if line["body"] != "[REDACTED len=11]" {
+		t.Errorf("body = %v", line["body"])
+	}
+	if line["phone_number_id"] != "106540352242922" {
+		t.Errorf("IDs must not be masked, got %v", line["phone_number_id"])
+	}
+	if msg := line["msg"].(string); !strings.Contains(msg, "fields=id") || !strings.Contains(msg, "0199") {
+		t.Errorf("message over-redacted: %q", msg)
+	}
+}
+
+func TestLoggerSensitiveDataOptIn(t *testing.T) {
+	logger, buf := newTestLogger(t, &config.Config{LogLevel: "info", LogSensitiveData: true})
+	logger.Info("incoming message", "from", "15550100199", "body", "hello there")
+	if !strings.Contains(buf.String(), "15550100199") || !strings.Contains(buf.String(), "hello there") {
+		t.Errorf("LOG_SENSITIVE_DATA should disable redaction:\n%s", buf)
+	}
+}
+
+func TestLoggerAddsRequestContext(t *testing.T) {
+	logger, buf := newTestLogger(t, &config.Config{LogLevel: "debug", LogFormat: "json"})
+	ctx := WithRequestInfo(context.Background(), RequestInfo{ID: "req_1", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"})
+
+	logger.With("component", "test").DebugContext(ctx, "hello")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line["request_id"] != "req_1" || line["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || line["component"] != "test" {
+		t.Errorf("context IDs missing: %v", line)
+	}
+}
+
+func TestNewLoggerRejectsInvalidConfig(t *testing.T) {
+	for _, cfg := range []*config.Config{
+		{LogLevel: "loud"},
+		{LogLevel: "info", LogFormat: "xml"},
+	} {
+		if _, err := NewLogger(&bytes.Buffer{}, cfg); err == nil {
+			t.Errorf("NewLogger(%+v) succeeded", *cfg)
+		}
+	}
+	logger, buf := newTestLogger(t, &config.Config{LogLevel: "warn"})
+	logger.Info("dropped")
+	if buf.Len() != 0 {
+		t.Errorf("info logged at warn level: %s", buf)
+	}
+}
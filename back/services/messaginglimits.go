@@ -0,0 +1,252 @@
+package services
+
+import (
+	"back/models"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MessagingWindow is the rolling window Meta applies messaging limit tiers
+// over.
+const MessagingWindow = 24 * time.Hour
+
+// defaultMessagingLimit is assumed for numbers whose tier Meta has not
+// reported yet; it is the tier new numbers start at.
+const defaultMessagingLimit = 250
+
+var messagingLimitTiers = map[string]int{
+	"TIER_50":        50,
+	"TIER_250":       250,
+	"TIER_1K":        1000,
+	"TIER_2K":        2000,
+	"TIER_10K":       10000,
+	"TIER_100K":      100000,
+	"TIER_UNLIMITED": -1,
+}
+
+// TierLimit returns how many customers a messaging limit tier allows
+// business-initiated conversations with per 24 hours, or -1 for
+// TIER_UNLIMITED. ok is false for tiers it does not know.
+func TierLimit(tier string) (limit int, ok bool) {
+	limit, ok = messagingLimitTiers[tier]
+	return limit, ok
+}
+
+// businessInitiated lists the conversation origins that count against the
+// messaging limit. Service and free-entry-point conversations are opened by
+// the customer and do not.
+var businessInitiated = map[string]bool{
+	"marketing":          true,
+	"marketing_lite":     true,
+	"utility":            true,
+	"authentication":     true,
+	"business_initiated": true,
+}
+
+// MessagingLimits tracks, per phone number, the customers with a
+// business-initiated conversation opened in the rolling 24 hour window that
+// Meta's messaging limit tiers apply to. Conversations are learnt from
+// message status webhooks. Sends admitted by Reserve count as pending until
+// their status arrives, so back-to-back bulk sends cannot overshoot the tier.
+type MessagingLimits struct {
+	mutex  sync.Mutex
+	phones map[string]*phoneConversations // By phone number ID
+	now    func() time.Time
+}
+
+type phoneConversations struct {
+	open     map[string]openConversation // By recipient digits
+	prunedAt time.Time
+}
+
+type openConversation struct {
+	openedAt time.Time
+	pending  bool // Reserved by a send whose status has not arrived yet
+}
+
+func (c openConversation) openAt(t time.Time) bool {
+	return c.openedAt.Add(MessagingWindow).After(t)
+}
+
+func NewMessagingLimits() *MessagingLimits {
+	return &MessagingLimits{
+		phones: make(map[string]*phoneConversations),
+		now:    time.Now,
+	}
+}
+
+// HandleEvent counts conversations reported by message status webhooks. It
+// is an EventSubscriber.
+func (l *MessagingLimits) HandleEvent(event models.Event) {
+	if event.Type != models.EventMessageStatus || event.PhoneNumberID == "" {
+		return
+	}
+	var status struct {
+		RecipientID  string `json:"recipient_id"`
+		Status       string `json:"status"`
+		Conversation *struct {
+			ID                  string `json:"id"`
+			ExpirationTimestamp string `json:"expiration_timestamp"`
+			Origin              struct {
+				Type string `json:"type"`
+			} `json:"origin"`
+		} `json:"conversation"`
+	}
+	if json.Unmarshal(event.Data, &status) != nil || status.RecipientID == "" {
+		return
+	}
+	recipient := digits(status.RecipientID)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	open := l.open(event.PhoneNumberID, l.now())
+	current, tracked := open[recipient]
+	switch {
+	case status.Conversation != nil && businessInitiated[status.Conversation.Origin.Type]:
+		openedAt := event.OccurredAt
+		// Conversations last exactly one window, so the expiry dates the opening
+		if secs, err := strconv.ParseInt(status.Conversation.ExpirationTimestamp, 10, 64); err == nil {
+			openedAt = time.Unix(secs, 0).Add(-MessagingWindow)
+		}
+		if tracked && !current.pending && !current.openedAt.After(openedAt) && current.openAt(openedAt) {
+			return // Replays and later statuses of a conversation already counted
+		}
+		open[recipient] = openConversation{openedAt: openedAt}
+	case tracked && current.pending && (status.Status == "failed" || status.Conversation != nil):
+		// The send failed or did not open a business-initiated conversation
+		delete(open, recipient)
+	}
+}
+
+// Capacity reports the phone number's headroom under its messaging limit
+// tier, with a projection of how it recovers as open conversations age out
+// of the window.
+func (l *MessagingLimits) Capacity(phone models.BusinessPhoneNumber) models.MessagingCapacity {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.capacity(phone, l.now())
+}
+
+func (l *MessagingLimits) capacity(phone models.BusinessPhoneNumber, now time.Time) models.MessagingCapacity {
+	open := l.open(phone.ID, now)
+	limit, known := TierLimit(phone.MessagingLimitTier)
+	if !known {
+		limit = defaultMessagingLimit
+	}
+	capacity := models.MessagingCapacity{
+		PhoneNumberID:      phone.ID,
+		MessagingLimitTier: phone.MessagingLimitTier,
+		Unlimited:          limit < 0,
+	}
+	for _, conversation := range open {
+		if !conversation.openAt(now) {
+			continue
+		}
+		capacity.Used++
+		if conversation.pending {
+			capacity.Pending++
+		}
+	}
+	if capacity.Unlimited {
+		return capacity
+	}
+	capacity.Limit = limit
+	capacity.Remaining = max(limit-capacity.Used, 0)
+
+	// Hourly points over the next window, counting only what is open now
+	for hour := 1; hour <= int(MessagingWindow/time.Hour); hour++ {
+		at := now.Add(time.Duration(hour) * time.Hour)
+		stillOpen := 0
+		for _, conversation := range open {
+			if conversation.openAt(at) {
+				stillOpen++
+			}
+		}
+		capacity.Projection = append(capacity.Projection, models.CapacityPoint{
+			At:        at,
+			Remaining: max(limit-stillOpen, 0),
+		})
+	}
+	return capacity
+}
+
+// Reserve admits recipients for business-initiated messages from phone.
+// Recipients with a conversation already open cost nothing; each other one
+// takes one unit of capacity and is held as pending. Without partial it is
+// all or nothing: if the tier cannot take every recipient none is admitted.
+// Recipients not admitted are returned as deferred, in order.
+func (l *MessagingLimits) Reserve(phone models.BusinessPhoneNumber, recipients []string, partial bool) (admitted, deferred []string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	capacity := l.capacity(phone, now)
+	open := l.open(phone.ID, now)
+
+	var fresh []string
+	for _, to := range recipients {
+		if conversation, ok := open[digits(to)]; ok && conversation.openAt(now) {
+			admitted = append(admitted, to)
+		} else {
+			fresh = append(fresh, to)
+		}
+	}
+	room := len(fresh)
+	if !capacity.Unlimited && room > capacity.Remaining {
+		if !partial {
+			return nil, recipients
+		}
+		room = capacity.Remaining
+	}
+	for _, to := range fresh[:room] {
+		open[digits(to)] = openConversation{openedAt: now, pending: true}
+	}
+	return append(admitted, fresh[:room]...), fresh[room:]
+}
+
+// Release returns the capacity reserved for a recipient whose send failed.
+func (l *MessagingLimits) Release(phoneNumberID, recipient string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	open := l.open(phoneNumberID, l.now())
+	if conversation, ok := open[digits(recipient)]; ok && conversation.pending {
+		delete(open, digits(recipient))
+	}
+}
+
+// DistinctRecipients drops empty and repeated recipients, comparing digits
+// only, so "+1 555 0100" and "15550100" are one.
+func DistinctRecipients(to []string) []string {
+	seen := make(map[string]bool, len(to))
+	var out []string
+	for _, recipient := range to {
+		key := digits(recipient)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, recipient)
+	}
+	return out
+}
+
+// open returns the conversations of a phone number. Those that have left
+// the window are dropped at most once a minute, so busy webhook traffic does
+// not rescan every conversation on each status; callers check openAt.
+func (l *MessagingLimits) open(phoneNumberID string, now time.Time) map[string]openConversation {
+	phone, ok := l.phones[phoneNumberID]
+	if !ok {
+		phone = &phoneConversations{open: make(map[string]openConversation)}
+		l.phones[phoneNumberID] = phone
+	}
+	if now.Sub(phone.prunedAt) >= time.Minute {
+		for recipient, conversation := range phone.open {
+			if !conversation.openAt(now) {
+				delete(phone.open, recipient)
+			}
+		}
+		phone.prunedAt = now
+	}
+	return phone.open
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"back/models"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func statusEvent(phoneID, recipient, status, origin string, at time.Time) models.Event {
+	data := map[string]any{"id": "wamid." + recipient, "recipient_id": recipient, "status": status}
+	if origin != "" {
+		data["conversation"] = map[string]any{
+			"id":                   "conv-" + recipient,
+			"expiration_timestamp": strconv.FormatInt(at.Add(MessagingWindow).Unix(), 10),
+			"origin":               map[string]string{"type": origin},
+		}
+	}
+	raw, _ := json.Marshal(data)
+	return models.Event{Type: models.EventMessageStatus, PhoneNumberID: phoneID, OccurredAt: at, Data: raw}
+}
+
+func TestMessagingLimitsCountsBusinessInitiatedConversations(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	limits := NewMessagingLimits()
+	limits.now = func() time.Time { return now }
+	phone := models.BusinessPhoneNumber{ID: "pn-1", MessagingLimitTier: "TIER_50"}
+
+	limits.HandleEvent(statusEvent("pn-1", "15550001", "sent", "marketing", now.Add(-23*time.Hour)))
+	limits.HandleEvent(statusEvent("pn-1", "15550002", "sent", "utility", now.Add(-time.Hour)))
+	limits.HandleEvent(statusEvent("pn-1", "15550002", "delivered", "utility", now.Add(-time.Hour))) // Same conversation
+	limits.HandleEvent(statusEvent("pn-1", "15550003", "sent", "service", now))                      // Customer-initiated
+	limits.HandleEvent(statusEvent("pn-1", "15550004", "sent", "marketing", now.Add(-25*time.Hour))) // Expired
+	limits.HandleEvent(statusEvent("pn-2", "15550005", "sent", "marketing", now))                    // Another number
+
+	capacity := limits.Capacity(phone)
+	if capacity.Limit != 50 || capacity.Used != 2 || capacity.Remaining != 48 || capacity.Pending != 0 {
+		t.Errorf("capacity = %+v", capacity)
+	}
+	if len(capacity.Projection) != 24 || capacity.Projection[0].Remaining != 49 || capacity.Projection[23].Remaining != 50 {
+		t.Errorf("projection = %+v", capacity.Projection)
+	}
+
+	if c := limits.Capacity(models.BusinessPhoneNumber{ID: "pn-3"}); c.Limit != defaultMessagingLimit || c.Remaining != defaultMessagingLimit {
+		t.Errorf("unknown tier capacity = %+v", c)
+	}
+	if c := limits.Capacity(models.BusinessPhoneNumber{ID: "pn-1", MessagingLimitTier: "TIER_UNLIMITED"}); !c.Unlimited || c.Used != 2 || c.Projection != nil {
+		t.Errorf("unlimited capacity = %+v", c)
+	}
+}
+
+func TestMessagingLimitsReserve(t *testing.T) {
+	now := time.Now()
+	limits := NewMessagingLimits()
+	limits.now = func() time.Time { return now }
+	phone := models.BusinessPhoneNumber{ID: "pn-1", MessagingLimitTier: "TIER_50"}
+	for i := range 48 {
+		limits.HandleEvent(statusEvent("pn-1", fmt.Sprintf("1555%04d", i), "sent", "marketing", now))
+	}
+
+	// Two slots left; the open conversation with 15550000 costs nothing
+	recipients := []string{"+1 555-0000", "15559001", "15559002", "15559003"}
+	if admitted, deferred := limits.Reserve(phone, recipients, false); admitted != nil || len(deferred) != 4 {
+		t.Fatalf("all-or-nothing reserve admitted %v, deferred %v", admitted, deferred)
+	}
+	admitted, deferred := limits.Reserve(phone, recipients, true)
+	if len(admitted) != 3 || len(deferred) != 1 || deferred[0] != "15559003" {
+		t.Fatalf("partial reserve admitted %v, deferred %v", admitted, deferred)
+	}
+	if c := limits.Capacity(phone); c.Remaining != 0 || c.Pending != 2 {
+		t.Errorf("capacity after reserve = %+v", c)
+	}
+
+	// A failed send and a failed status give the capacity back; a status
+	// with a business-initiated conversation confirms the reservation
+	limits.Release("pn-1", "15559001")
+	limits.HandleEvent(statusEvent("pn-1", "15559002", "sent", "marketing", now))
+	if c := limits.Capacity(phone); c.Remaining != 1 || c.Pending != 0 {
+		t.Errorf("capacity after release = %+v", c)
+	}
+	limits.Reserve(phone, []string{"15559003"}, false)
+	limits.HandleEvent(statusEvent("pn-1", "15559003", "failed", "", now))
+	if c := limits.Capacity(phone); c.Remaining != 1 {
+		t.Errorf("capacity after failed status = %+v", c)
+	}
+
+	// Capacity returns as conversations leave the window
+	limits.now = func() time.Time { return now.Add(MessagingWindow) }
+	if c := limits.Capacity(phone); c.Used != 0 || c.Remaining != 50 {
+		t.Errorf("capacity a day later = %+v", c)
+	}
+}
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics collects the backend's Prometheus metrics. All methods are safe on
+// a nil *Metrics, which records nothing, so services can run without one.
+type Metrics struct {
+	registry *MetricsRegistry
+
+	signupSteps       *CounterVec
+	webhookEvents     *CounterVec
+	signatureFailures *CounterVec
+	graphDuration     *HistogramVec
+	graphErrors       *CounterVec
+	outboundMessages  *CounterVec
+	tokenRefreshes    *CounterVec
+	phoneSyncs        *CounterVec
+	queueDepth        *GaugeFuncVec
+}
+
+func NewMetrics() *Metrics {
+	r := NewMetricsRegistry()
+	return &Metrics{
+		registry: r,
+		signupSteps: r.NewCounterVec("whatsapp_signup_steps_total",
+			"Embedded signup steps by outcome (success or failure).", "step", "outcome"),
+		webhookEvents: r.NewCounterVec("whatsapp_webhook_events_total",
+			"Normalized events received from Meta webhooks, excluding replays.", "field", "type"),
+		signatureFailures: r.NewCounterVec("whatsapp_webhook_signature_failures_total",
+			"Webhook deliveries rejected for an invalid X-Hub-Signature-256."),
+		graphDuration: r.NewHistogramVec("whatsapp_graph_request_duration_seconds",
+			"Graph API request latency by endpoint.", DefaultLatencyBuckets, "method", "endpoint"),
+		graphErrors: r.NewCounterVec("whatsapp_graph_errors_total",
+			"Failed Graph API requests by endpoint and Graph error code (\"network\" for transport errors).", "method", "endpoint", "code"),
+		outboundMessages: r.NewCounterVec("whatsapp_outbound_messages_total",
+			"Outbound messages by status: accepted, send_error or deferred (over the messaging limit) from the send APIs, queued and retried from the outbound queue, then sent, delivered, read or failed from status webhooks.", "status"),
+		tokenRefreshes: r.NewCounterVec("whatsapp_token_refreshes_total",
+			"Background access token refreshes by outcome: refreshed, failed (retried on the next run) or reauth_required.", "outcome"),
+		phoneSyncs: r.NewCounterVec("whatsapp_phone_number_syncs_total",
+			"Phone number syncs of a WABA by outcome (synced or failed).", "outcome"),
+		queueDepth: r.NewGaugeFuncVec("whatsapp_queue_depth",
+			"Items waiting in internal work queues.", "queue"),
+	}
+}
+
+// SignupStep records the outcome of one Embedded Signup step.
+func (m *Metrics) SignupStep(step string, ok bool) {
+	if m == nil {
+		return
+	}
+	outcome := "success"
+	if !ok {
+		outcome = "failure"
+	}
+	m.signupSteps.Inc(step, outcome)
+}
+
+// WebhookEvent counts a normalized webhook event.
+func (m *Metrics) WebhookEvent(field, eventType string) {
+	if m == nil {
+		return
+	}
+	m.webhookEvents.Inc(field, eventType)
+}
+
+func (m *Metrics) WebhookSignatureFailure() {
+	if m == nil {
+		return
+	}
+	m.signatureFailures.Inc()
+}
+
+// GraphRequest records a Graph API call. errorCode is empty on success.
+func (m *Metrics) GraphRequest(method, endpoint string, elapsed time.Duration, errorCode string) {
+	if m == nil {
+		return
+	}
+	m.graphDuration.Observe(elapsed.Seconds(), method, endpoint)
+	if errorCode != "" {
+		m.graphErrors.Inc(method, endpoint, errorCode)
+	}
+}
+
+// OutboundMessage counts an outbound message reaching status.
+func (m *Metrics) OutboundMessage(status string) {
+	if m == nil {
+		return
+	}
+	m.outboundMessages.Inc(status)
+}
+
+// TokenRefresh counts the outcome of one background token refresh.
+func (m *Metrics) TokenRefresh(outcome string) {
+	if m == nil {
+		return
+	}
+	m.tokenRefreshes.Inc(outcome)
+}
+
+// PhoneNumberSync counts the outcome of syncing one WABA's phone numbers.
+func (m *Metrics) PhoneNumberSync(ok bool) {
+	if m == nil {
+		return
+	}
+	outcome := "synced"
+	if !ok {
+		outcome = "failed"
+	}
+	m.phoneSyncs.Inc(outcome)
+}
+
+// RegisterQueue exposes the depth of a named queue, read at scrape time.
+func (m *Metrics) RegisterQueue(name string, depth func() int) {
+	if m == nil {
+		return
+	}
+	m.queueDepth.Register(name, func() float64 { return float64(depth()) })
+}
+
+// WritePrometheus writes every metric in the Prometheus text format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	if m == nil {
+		return nil
+	}
+	return m.registry.Write(w)
+}
+
+// graphEndpoint turns a Graph API URL path into a low-cardinality label by
+// dropping the version and replacing numeric IDs ("/v19.0/123/phone_numbers"
+// -> "{id}/phone_numbers").
+func graphEndpoint(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 0 && strings.HasPrefix(segments[0], "v") && strings.Contains(segments[0], ".") {
+		segments = segments[1:]
+	}
+	for i, s := range segments {
+		if s != "" && strings.Trim(s, "0123456789") == "" {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// DefaultLatencyBuckets are histogram upper bounds in seconds for outbound
+// HTTP calls.
+var DefaultLatencyBuckets = []float64{0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// MetricsRegistry renders a fixed set of metrics in the Prometheus text
+// exposition format (version 0.0.4).
+type MetricsRegistry struct {
+	metrics []promMetric
+	mutex   sync.Mutex
+}
+
+type promMetric interface {
+	write(w io.Writer) error
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{}
+}
+
+func (r *MetricsRegistry) register(m promMetric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Write renders all metrics in registration order.
+func (r *MetricsRegistry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	metrics := append([]promMetric(nil), r.metrics...)
+	r.mutex.Unlock()
+
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labeled holds one series per combination of label values.
+type labeled[T any] struct {
+	name, help string
+	labels     []string
+	series     map[string]*labeledSeries[T]
+	mutex      sync.Mutex
+}
+
+type labeledSeries[T any] struct {
+	values []string
+	data   T
+}
+
+func newLabeled[T any](name, help string, labels []string) labeled[T] {
+	return labeled[T]{name: name, help: help, labels: labels, series: map[string]*labeledSeries[T]{}}
+}
+
+// get returns the series for values, creating it with init. Callers must
+// hold the mutex.
+func (l *labeled[T]) get(values []string, init func() T) *labeledSeries[T] {
+	if len(values) != len(l.labels) {
+		panic(fmt.Sprintf("metric %s: got %d label values, want %d", l.name, len(values), len(l.labels)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := l.series[key]
+	if !ok {
+		s = &labeledSeries[T]{values: append([]string(nil), values...), data: init()}
+		l.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by label values. Callers must hold the
+// mutex.
+func (l *labeled[T]) sorted() []*labeledSeries[T] {
+	keys := make([]string, 0, len(l.series))
+	for k := range l.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]*labeledSeries[T], len(keys))
+	for i, k := range keys {
+		out[i] = l.series[k]
+	}
+	return out
+}
+
+func (l *labeled[T]) header(w io.Writer, kind string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", l.name, escapeHelp(l.help), l.name, kind)
+	return err
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	labeled[*float64]
+}
+
+func (r *MetricsRegistry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newLabeled[*float64](name, help, labels)}
+	if len(labels) == 0 {
+		c.get(nil, newFloat) // label-less counters are exported from zero
+	}
+	r.register(c)
+	return c
+}
+
+func newFloat() *float64 { return new(float64) }
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	*c.get(labelValues, newFloat).data += v
+}
+
+// Value returns the current count for labelValues.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return *c.get(labelValues, newFloat).data
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.header(w, "counter"); err != nil {
+		return err
+	}
+	for _, s := range c.sorted() {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, s.values), formatValue(*s.data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	labeled[*histogram]
+	buckets []float64
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (r *MetricsRegistry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{labeled: newLabeled[*histogram](name, help, labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s := h.get(labelValues, func() *histogram { return &histogram{counts: make([]uint64, len(h.buckets))} }).data
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err := h.header(w, "histogram"); err != nil {
+		return err
+	}
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, s := range h.sorted() {
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.data.counts[i]
+			values := append(append([]string(nil), s.values...), formatValue(upper))
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(bucketLabels, values), cumulative); err != nil {
+				return err
+			}
+		}
+		values := append(append([]string(nil), s.values...), "+Inf")
+		labels := formatLabels(h.labels, s.values)
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, formatLabels(bucketLabels, values), s.data.count,
+			h.name, labels, formatValue(s.data.sum),
+			h.name, labels, s.data.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GaugeFuncVec is a gauge with one label whose values are read from
+// callbacks at scrape time.
+type GaugeFuncVec struct {
+	labeled[func() float64]
+}
+
+func (r *MetricsRegistry) NewGaugeFuncVec(name, help, label string) *GaugeFuncVec {
+	g := &GaugeFuncVec{newLabeled[func() float64](name, help, []string{label})}
+	r.register(g)
+	return g
+}
+
+// Register sets the callback reporting the gauge for labelValue.
+func (g *GaugeFuncVec) Register(labelValue string, fn func() float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.get([]string{labelValue}, func() func() float64 { return nil }).data = fn
+}
+
+func (g *GaugeFuncVec) write(w io.Writer) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if err := g.header(w, "gauge"); err != nil {
+		return err
+	}
+	for _, s := range g.sorted() {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, s.values), formatValue(s.data())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(s string) string { return labelValueEscaper.Replace(s) }
+
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsRegistryExposition(t *testing.T) {
+	r := NewMetricsRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests.\nBy path.", "path")
+	r.NewCounterVec("test_failures_total", "Failures.")
+	latency := r.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "path")
+	depth := r.NewGaugeFuncVec("test_queue_depth", "Depth.", "queue")
+
+	requests.Inc(`/a"b`)
+	requests.Add(2, "/a")
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.5, "/a")
+	latency.Observe(3, "/a")
+	depth.Register("jobs", func() float64 { return 7 })
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_requests_total Requests.\nBy path.
+# TYPE test_requests_total counter
+test_requests_total{path="/a"} 2
+test_requests_total{path="/a\"b"} 1
+# HELP test_failures_total Failures.
+# TYPE test_failures_total counter
+test_failures_total 0
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{path="/a",le="0.1"} 1
+test_latency_seconds_bucket{path="/a",le="1"} 2
+test_latency_seconds_bucket{path="/a",le="+Inf"} 3
+test_latency_seconds_sum{path="/a"} 3.55
+test_latency_seconds_count{path="/a"} 3
+# HELP test_queue_depth Depth.
+# TYPE test_queue_depth gauge
+test_queue_depth{queue="jobs"} 7
+`
+	if b.String() != want {
+		t.Errorf("exposition:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestNilMetricsRecordNothing(t *testing.T) {
+	var m *Metrics
+	m.SignupStep("save", true)
+	m.GraphRequest("GET", "me", time.Second, "190")
+	m.RegisterQueue("jobs", func() int { return 1 })
+	if err := m.WritePrometheus(&strings.Builder{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGraphEndpoint(t *testing.T) {
+	cases := map[string]string{
+		"/v19.0/oauth/access_token":               "oauth/access_token",
+		"/v23.0/106540352242922/messages":         "{id}/messages",
+		"/v19.0/me/businesses":                    "me/businesses",
+		"/v23.0/2345/message_templates":           "{id}/message_templates",
+		"/v19.0/waba-1/phone_numbers":             "waba-1/phone_numbers",
+		"/v23.0/106540352242922/subscribed_apps/": "{id}/subscribed_apps",
+	}
+	for path, want := range cases {
+		if got := graphEndpoint(path); got != want {
+			t.Errorf("graphEndpoint(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
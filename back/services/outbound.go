@@ -0,0 +1,735 @@
+package services
+
+import (
+	"back/config"
+	"back/models"
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrOutboundMessageNotFound is returned for unknown or evicted messages.
+var ErrOutboundMessageNotFound = errors.New("outbound message not found")
+
+// Cloud API throughput levels, in messages per second per phone number.
+// Numbers whose level is unknown get the standard rate.
+var throughputRates = map[string]float64{
+	"STANDARD": 80,
+	"HIGH":     1000,
+}
+
+const defaultThroughputRate = 80
+
+// Cloud API errors the queue retries
+const (
+	errThroughputReached = 130429 // Per-number throughput exceeded
+	errSpamRateLimit     = 131048 // Number restricted for sending too many messages
+	errPairRateLimit     = 131056 // Too many messages to the same recipient
+)
+
+const (
+	maxOutboundInFlight = 32    // Concurrent sends per phone number
+	maxFinishedOutbound = 10000 // Sent and failed messages kept for status lookups
+	outboundSendTimeout = 30 * time.Second
+	outboundRetryBase   = time.Second
+	outboundRetryMax    = 5 * time.Minute
+	spamBackoffBase     = time.Minute
+	pairBackoffBase     = 6 * time.Second // Meta allows about one message every 6 seconds per recipient
+	outboundIdleWait    = time.Hour
+)
+
+var errOutboundAccountGone = errors.New("account or phone number is no longer onboarded")
+
+// OutboundQueue sends text messages in the background, per phone number at
+// the rate its Cloud API throughput allows. Messages to the same recipient
+// go out in order. Throttling errors are retried: throughput and spam rate
+// limits pause the whole number, pair rate limits only the recipient.
+// Messages are journaled to OUTBOUND_QUEUE_FILE when set, so the queue
+// survives restarts; one interrupted mid-send is sent again.
+type OutboundQueue struct {
+	whatsapp    *WhatsAppService
+	storage     *StorageService
+	limits      *MessagingLimits
+	metrics     *Metrics
+	journal     *outboundJournal
+	journalErr  error // Last journal write, nil once one succeeds again
+	maxAttempts int
+
+	messages map[string]*models.OutboundMessage
+	byWAMID  map[string]string // WhatsApp message ID -> message ID
+	lanes    map[string]*outboundLane
+	finished []string // Sent and failed message IDs, oldest first
+	mutex    sync.Mutex
+
+	wake    chan struct{}
+	sending sync.WaitGroup
+	now     func() time.Time
+}
+
+// outboundLane is the queue of one phone number.
+type outboundLane struct {
+	bucket      tokenBucket
+	queue       []*models.OutboundMessage // Queued and sending, oldest first
+	inFlight    int
+	pausedUntil time.Time
+	pause       time.Duration            // Last pause, doubled while throttling continues
+	pairs       map[string]time.Duration // Pair rate limit backoff by recipient digits
+}
+
+func NewOutboundQueue(cfg *config.Config, whatsapp *WhatsAppService, storage *StorageService, limits *MessagingLimits, metrics *Metrics) (*OutboundQueue, error) {
+	q := &OutboundQueue{
+		whatsapp:    whatsapp,
+		storage:     storage,
+		limits:      limits,
+		metrics:     metrics,
+		maxAttempts: cfg.OutboundMaxAttempts,
+		messages:    make(map[string]*models.OutboundMessage),
+		byWAMID:     make(map[string]string),
+		lanes:       make(map[string]*outboundLane),
+		wake:        make(chan struct{}, 1),
+		now:         time.Now,
+	}
+	if cfg.OutboundQueueFile == "" {
+		return q, nil
+	}
+	journal, messages, err := openOutboundJournal(cfg.OutboundQueueFile)
+	if err != nil {
+		return nil, fmt.Errorf("outbound queue: %w", err)
+	}
+	q.journal = journal
+	for _, msg := range messages {
+		if msg.Status == models.OutboundSending {
+			msg.Status = models.OutboundQueued
+		}
+		q.add(msg)
+	}
+	if len(messages) > 0 {
+		slog.Info("outbound queue restored", "file", cfg.OutboundQueueFile, "queued", q.QueueDepth(), "finished", len(q.finished))
+	}
+	return q, nil
+}
+
+// Enqueue queues a text message from phone, a number of account. With
+// reserved the message holds messaging limit capacity, which is given back
+// if it fails.
+func (q *OutboundQueue) Enqueue(account *models.BusinessAccount, phone models.BusinessPhoneNumber, to, text string, reserved bool) models.OutboundMessage {
+	now := q.now()
+	msg := &models.OutboundMessage{
+		ID:            "out_" + rand.Text(),
+		TenantID:      account.TenantID,
+		WABAID:        account.WABAID,
+		PhoneNumberID: phone.ID,
+		To:            to,
+		Text:          text,
+		Status:        models.OutboundQueued,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Reserved:      reserved,
+	}
+
+	q.mutex.Lock()
+	q.add(msg)
+	q.lane(phone.ID).bucket.rate = throughputRate(phone.Throughput)
+	q.persist(msg)
+	queued := *msg
+	q.mutex.Unlock()
+
+	q.metrics.OutboundMessage("queued")
+	q.signal()
+	return queued
+}
+
+// Get returns a message queued for a tenant's WABA.
+func (q *OutboundQueue) Get(tenantID, wabaID, id string) (models.OutboundMessage, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	msg, ok := q.messages[id]
+	if !ok || msg.TenantID != tenantID || msg.WABAID != wabaID {
+		return models.OutboundMessage{}, ErrOutboundMessageNotFound
+	}
+	return *msg, nil
+}
+
+// QueueDepth returns the number of messages not yet sent or failed.
+func (q *OutboundQueue) QueueDepth() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	depth := 0
+	for _, lane := range q.lanes {
+		depth += len(lane.queue)
+	}
+	return depth
+}
+
+// Ping reports whether the last journal write failed, in which case queued
+// messages would not survive a restart.
+func (q *OutboundQueue) Ping(ctx context.Context) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.journalErr != nil {
+		return fmt.Errorf("outbound queue journal: %w", q.journalErr)
+	}
+	return ctx.Err()
+}
+
+// Run sends queued messages until ctx is done. Sends still in flight then
+// finish in the background; Shutdown waits for them.
+func (q *OutboundQueue) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		timer.Reset(q.dispatch(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// Shutdown waits for sends in flight, then closes the journal. Messages
+// still queued are sent after the next start if the queue is journaled.
+func (q *OutboundQueue) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		q.sending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("outbound sends still in flight: %w", ctx.Err())
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.journal == nil {
+		return nil
+	}
+	if err := q.journal.compact(q.snapshot()); err != nil {
+		q.journal.close()
+		return err
+	}
+	return q.journal.close()
+}
+
+// HandleEvent follows queued messages through their status webhooks. Meta
+// can accept a message and then report it failed for throttling; those are
+// queued again. It is an EventSubscriber.
+func (q *OutboundQueue) HandleEvent(event models.Event) {
+	if event.Type != models.EventMessageStatus {
+		return
+	}
+	var status struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		Errors []struct {
+			Code int `json:"code"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(event.Data, &status) != nil || status.ID == "" {
+		return
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	msg, ok := q.messages[q.byWAMID[status.ID]]
+	if !ok || msg.Status != models.OutboundSent {
+		return
+	}
+	now := q.now()
+	msg.DeliveryStatus = status.Status
+	msg.UpdatedAt = now
+	if status.Status == "failed" {
+		failure := outboundFailure{reason: "failed after Meta accepted it"}
+		if len(status.Errors) > 0 {
+			failure = outboundFailureFor(status.Errors[0].Code)
+		}
+		if failure.scope != retryNone && msg.Attempts < q.maxAttempts {
+			delete(q.byWAMID, msg.MessageID)
+			q.finished = slices.DeleteFunc(q.finished, func(id string) bool { return id == msg.ID })
+			msg.MessageID, msg.DeliveryStatus, msg.SentAt = "", "", time.Time{}
+			lane := q.lane(msg.PhoneNumberID)
+			lane.queue = insertByCreation(lane.queue, msg)
+			q.retry(lane, msg, failure, now)
+			q.persist(msg)
+			q.signal()
+			return
+		}
+		q.fail(msg, failure)
+	}
+	q.persist(msg)
+}
+
+// add indexes msg, which is new or restored from the journal.
+func (q *OutboundQueue) add(msg *models.OutboundMessage) {
+	q.messages[msg.ID] = msg
+	if msg.MessageID != "" {
+		q.byWAMID[msg.MessageID] = msg.ID
+	}
+	switch msg.Status {
+	case models.OutboundSent, models.OutboundFailed:
+		q.finished = append(q.finished, msg.ID)
+		q.evict()
+	default:
+		lane := q.lane(msg.PhoneNumberID)
+		lane.queue = append(lane.queue, msg)
+	}
+}
+
+func (q *OutboundQueue) lane(phoneNumberID string) *outboundLane {
+	lane, ok := q.lanes[phoneNumberID]
+	if !ok {
+		lane = &outboundLane{
+			bucket: tokenBucket{rate: defaultThroughputRate},
+			pairs:  make(map[string]time.Duration),
+		}
+		q.lanes[phoneNumberID] = lane
+	}
+	return lane
+}
+
+func (q *OutboundQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch starts every send that is due and allowed now, and returns how
+// long until the next one could be.
+func (q *OutboundQueue) dispatch(ctx context.Context) time.Duration {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	now := q.now()
+	next := outboundIdleWait
+	for _, lane := range q.lanes {
+		next = min(next, q.dispatchLane(ctx, lane, now))
+	}
+	return next
+}
+
+func (q *OutboundQueue) dispatchLane(ctx context.Context, lane *outboundLane, now time.Time) time.Duration {
+	if len(lane.queue) == 0 {
+		return outboundIdleWait
+	}
+	if lane.pausedUntil.After(now) {
+		return lane.pausedUntil.Sub(now)
+	}
+	next := outboundIdleWait
+	busy := make(map[string]bool)
+	for _, msg := range lane.queue {
+		recipient := digits(msg.To)
+		if busy[recipient] {
+			continue
+		}
+		// Later messages to this recipient wait for this one
+		busy[recipient] = true
+		if msg.Status == models.OutboundSending {
+			continue
+		}
+		if msg.NextAttemptAt.After(now) {
+			next = min(next, msg.NextAttemptAt.Sub(now))
+			continue
+		}
+		if lane.inFlight >= maxOutboundInFlight {
+			return next // A finishing send wakes the dispatcher
+		}
+		if wait, ok := lane.bucket.take(now); !ok {
+			return min(next, wait)
+		}
+		q.start(ctx, lane, msg, now)
+	}
+	return next
+}
+
+func (q *OutboundQueue) start(ctx context.Context, lane *outboundLane, msg *models.OutboundMessage, now time.Time) {
+	msg.Status = models.OutboundSending
+	msg.Attempts++
+	msg.NextAttemptAt = time.Time{}
+	msg.UpdatedAt = now
+	q.persist(msg)
+	lane.inFlight++
+	q.sending.Add(1)
+	go q.send(context.WithoutCancel(ctx), *msg)
+}
+
+func (q *OutboundQueue) send(ctx context.Context, msg models.OutboundMessage) {
+	defer q.sending.Done()
+	var messageID, throughput string
+	account, err := q.storage.GetBusinessAccount(msg.TenantID, msg.WABAID)
+	if err == nil {
+		err = errOutboundAccountGone
+		for _, phone := range account.PhoneNumbers {
+			if phone.ID == msg.PhoneNumberID {
+				throughput = phone.Throughput
+				sendCtx, cancel := context.WithTimeout(ctx, outboundSendTimeout)
+				messageID, err = q.whatsapp.SendTextMessage(sendCtx, account.AccessToken, msg.PhoneNumberID, msg.To, msg.Text)
+				cancel()
+				break
+			}
+		}
+	} else {
+		err = errOutboundAccountGone
+	}
+	q.finish(msg.ID, throughput, messageID, err)
+}
+
+// finish records the outcome of a send.
+func (q *OutboundQueue) finish(id, throughput, messageID string, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	defer q.signal()
+	msg, ok := q.messages[id]
+	if !ok {
+		return
+	}
+	lane := q.lane(msg.PhoneNumberID)
+	lane.inFlight--
+	if throughput != "" {
+		// Follows upgrades found by the phone number sync
+		lane.bucket.rate = throughputRate(throughput)
+	}
+	now := q.now()
+	msg.UpdatedAt = now
+
+	if err == nil {
+		msg.Status = models.OutboundSent
+		msg.MessageID = messageID
+		msg.SentAt = now
+		msg.ErrorCode, msg.Error = 0, ""
+		q.byWAMID[messageID] = msg.ID
+		lane.pause = 0
+		delete(lane.pairs, digits(msg.To))
+		q.done(lane, msg)
+		q.persist(msg)
+		q.metrics.OutboundMessage("accepted")
+		return
+	}
+
+	failure := classifyOutboundError(err)
+	if failure.scope == retryNone || msg.Attempts >= q.maxAttempts {
+		slog.Warn("outbound message failed", "outbound_id", msg.ID, "phone_number_id", msg.PhoneNumberID, "attempts", msg.Attempts, "error", err)
+		q.done(lane, msg)
+		q.fail(msg, failure)
+	} else {
+		slog.Info("outbound message throttled, retrying", "outbound_id", msg.ID, "phone_number_id", msg.PhoneNumberID, "attempts", msg.Attempts, "error", err)
+		q.retry(lane, msg, failure, now)
+	}
+	q.persist(msg)
+}
+
+// retry queues msg again after the backoff failure calls for.
+func (q *OutboundQueue) retry(lane *outboundLane, msg *models.OutboundMessage, failure outboundFailure, now time.Time) {
+	msg.Status = models.OutboundQueued
+	msg.ErrorCode, msg.Error = failure.code, failure.reason
+	switch failure.scope {
+	case retryLane, retrySpam:
+		base := outboundRetryBase
+		if failure.scope == retrySpam {
+			base = spamBackoffBase
+		}
+		lane.pause = nextBackoff(lane.pause, base)
+		lane.pausedUntil = now.Add(lane.pause)
+		msg.NextAttemptAt = lane.pausedUntil
+	case retryPair:
+		recipient := digits(msg.To)
+		lane.pairs[recipient] = nextBackoff(lane.pairs[recipient], pairBackoffBase)
+		msg.NextAttemptAt = now.Add(lane.pairs[recipient])
+	default:
+		msg.NextAttemptAt = now.Add(retryDelay(msg.Attempts))
+	}
+	q.metrics.OutboundMessage("retried")
+}
+
+// fail marks msg as finally failed and gives back its messaging limit
+// capacity.
+func (q *OutboundQueue) fail(msg *models.OutboundMessage, failure outboundFailure) {
+	msg.Status = models.OutboundFailed
+	msg.ErrorCode, msg.Error = failure.code, failure.reason
+	msg.NextAttemptAt = time.Time{}
+	if msg.Reserved {
+		q.limits.Release(msg.PhoneNumberID, msg.To)
+	}
+	q.metrics.OutboundMessage("send_error")
+}
+
+// done moves msg from its lane to the finished messages.
+func (q *OutboundQueue) done(lane *outboundLane, msg *models.OutboundMessage) {
+	lane.queue = slices.DeleteFunc(lane.queue, func(m *models.OutboundMessage) bool { return m == msg })
+	q.finished = append(q.finished, msg.ID)
+	q.evict()
+}
+
+// evict forgets the oldest finished messages beyond maxFinishedOutbound.
+func (q *OutboundQueue) evict() {
+	for len(q.finished) > maxFinishedOutbound {
+		if msg, ok := q.messages[q.finished[0]]; ok {
+			delete(q.byWAMID, msg.MessageID)
+			delete(q.messages, msg.ID)
+		}
+		q.finished = q.finished[1:]
+	}
+}
+
+// persist journals msg, compacting the journal once superseded entries
+// outnumber live ones.
+func (q *OutboundQueue) persist(msg *models.OutboundMessage) {
+	if q.journal == nil {
+		return
+	}
+	err := q.journal.append(msg)
+	if err == nil && q.journal.lines > 2*len(q.messages)+1000 {
+		err = q.journal.compact(q.snapshot())
+	}
+	if err != nil {
+		slog.Error("failed to write outbound queue journal", "file", q.journal.path, "error", err)
+	}
+	q.journalErr = err
+}
+
+// snapshot lists every message, oldest first.
+func (q *OutboundQueue) snapshot() []*models.OutboundMessage {
+	messages := make([]*models.OutboundMessage, 0, len(q.messages))
+	for _, msg := range q.messages {
+		messages = append(messages, msg)
+	}
+	sortByCreation(messages)
+	return messages
+}
+
+// How far a throttling error backs off
+type retryScope int
+
+const (
+	retryNone    retryScope = iota // Permanent failure
+	retryMessage                   // This message, with exponential backoff
+	retryPair                      // Every message to the recipient
+	retryLane                      // Every message from the number
+	retrySpam                      // Every message from the number, for longer
+)
+
+type outboundFailure struct {
+	code   int
+	reason string // Ours; Meta's message is only logged
+	scope  retryScope
+}
+
+func classifyOutboundError(err error) outboundFailure {
+	var graphErr *GraphError
+	switch {
+	case errors.Is(err, errOutboundAccountGone):
+		return outboundFailure{reason: err.Error()}
+	case !errors.As(err, &graphErr):
+		return outboundFailure{reason: "Graph API request failed", scope: retryMessage}
+	}
+	failure := outboundFailureFor(graphErr.Code)
+	if failure.scope == retryNone && graphErr.Status >= 500 {
+		failure.reason, failure.scope = "Graph API unavailable", retryMessage
+	}
+	return failure
+}
+
+func outboundFailureFor(code int) outboundFailure {
+	switch code {
+	case errThroughputReached:
+		return outboundFailure{code, "phone number throughput limit reached", retryLane}
+	case errSpamRateLimit:
+		return outboundFailure{code, "phone number spam rate limit reached", retrySpam}
+	case errPairRateLimit:
+		return outboundFailure{code, "too many messages to this recipient", retryPair}
+	case 190:
+		return outboundFailure{code, "access token invalid, the business must re-authorize", retryNone}
+	}
+	return outboundFailure{code, "rejected by the Cloud API", retryNone}
+}
+
+// retryDelay doubles from outboundRetryBase with each attempt made, up to
+// outboundRetryMax.
+func retryDelay(attempts int) time.Duration {
+	delay := outboundRetryBase
+	for i := 1; i < attempts && delay < outboundRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, outboundRetryMax)
+}
+
+func nextBackoff(previous, base time.Duration) time.Duration {
+	if previous < base {
+		return base
+	}
+	return min(2*previous, outboundRetryMax)
+}
+
+func throughputRate(level string) float64 {
+	if rate, ok := throughputRates[level]; ok {
+		return rate
+	}
+	return defaultThroughputRate
+}
+
+func sortByCreation(messages []*models.OutboundMessage) {
+	slices.SortStableFunc(messages, func(a, b *models.OutboundMessage) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+}
+
+// insertByCreation puts msg back into an oldest-first queue.
+func insertByCreation(queue []*models.OutboundMessage, msg *models.OutboundMessage) []*models.OutboundMessage {
+	i, _ := slices.BinarySearchFunc(queue, msg, func(m, target *models.OutboundMessage) int {
+		return m.CreatedAt.Compare(target.CreatedAt)
+	})
+	return slices.Insert(queue, i, msg)
+}
+
+// tokenBucket allows rate events per second, in bursts of up to one
+// second's worth.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// take uses up a token if one is available at now, or reports how long
+// until one is.
+func (b *tokenBucket) take(now time.Time) (time.Duration, bool) {
+	if b.last.IsZero() {
+		b.tokens = b.rate
+	} else if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.rate, b.tokens+elapsed.Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second)), false
+}
+
+// outboundJournal appends every change to a message as a JSON line; the
+// last line for a message ID wins. It is rewritten from the live messages
+// once it grows well beyond them.
+type outboundJournal struct {
+	path  string
+	file  *os.File
+	lines int
+}
+
+// outboundRecord is a journal line. Reserved is internal and not part of
+// the message's JSON.
+type outboundRecord struct {
+	models.OutboundMessage
+	Reserved bool `json:"reserved,omitempty"`
+}
+
+func openOutboundJournal(path string) (*outboundJournal, []*models.OutboundMessage, error) {
+	j := &outboundJournal{path: path}
+	byID := make(map[string]*models.OutboundMessage)
+	file, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, nil, err
+	default:
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var record outboundRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.ID == "" {
+				// A line torn by a crash mid-write
+				slog.Warn("skipping unreadable outbound queue journal line", "file", path, "line", j.lines+1)
+				continue
+			}
+			j.lines++
+			msg := record.OutboundMessage
+			msg.Reserved = record.Reserved
+			byID[msg.ID] = &msg
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	messages := make([]*models.OutboundMessage, 0, len(byID))
+	for _, msg := range byID {
+		messages = append(messages, msg)
+	}
+	sortByCreation(messages)
+	// Start from a clean file, which also drops torn lines
+	if err := j.compact(messages); err != nil {
+		return nil, nil, err
+	}
+	return j, messages, nil
+}
+
+func (j *outboundJournal) append(msg *models.OutboundMessage) error {
+	line, err := json.Marshal(outboundRecord{OutboundMessage: *msg, Reserved: msg.Reserved})
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	j.lines++
+	return nil
+}
+
+// compact replaces the journal with one line per message.
+func (j *outboundJournal) compact(messages []*models.OutboundMessage) error {
+	tmp, err := os.OpenFile(j.path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, msg := range messages {
+		line, err := json.Marshal(outboundRecord{OutboundMessage: *msg, Reserved: msg.Reserved})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	if j.file != nil {
+		j.file.Close()
+	}
+	// The temporary file is now the journal; keep appending to it
+	if _, err := tmp.Seek(0, io.SeekEnd); err != nil {
+		tmp.Close()
+		return err
+	}
+	j.file = tmp
+	j.lines = len(messages)
+	return nil
+}
+
+func (j *outboundJournal) close() error {
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
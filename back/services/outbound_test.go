@@ -0,0 +1,257 @@
+package services
+
+import (
+	"back/fakegraph"
+	"back/models"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type outboundFixture struct {
+	graph   *fakegraph.Server
+	queue   *OutboundQueue
+	limits  *MessagingLimits
+	account *models.BusinessAccount
+	clock   time.Time
+}
+
+func newOutboundFixture(t *testing.T, journal string) *outboundFixture {
+	t.Helper()
+	graph := fakegraph.New()
+	t.Cleanup(graph.Close)
+	cfg := newTestConfig(graph)
+	cfg.OutboundMaxAttempts = 3
+	cfg.OutboundQueueFile = journal
+
+	storage := NewStorageService(NewAuditLog())
+	account := &models.BusinessAccount{
+		TenantID: "tenant-a", WABAID: "waba-1", AccessToken: graph.IssueToken(),
+		PhoneNumbers: []models.BusinessPhoneNumber{{ID: "pn-1", PhoneNumber: "+1 555 0100", Throughput: "STANDARD"}},
+	}
+	storage.SaveBusinessAccount(context.Background(), account)
+	limits := NewMessagingLimits()
+	queue, err := NewOutboundQueue(cfg, NewWhatsAppService(cfg, NewFacebookService(cfg, nil, nil), nil), storage, limits, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &outboundFixture{graph: graph, queue: queue, limits: limits, account: account, clock: time.Unix(1700000000, 0)}
+	queue.now = func() time.Time { return f.clock }
+	limits.now = queue.now
+	return f
+}
+
+func (f *outboundFixture) enqueue(to string, reserved bool) models.OutboundMessage {
+	return f.queue.Enqueue(f.account, f.account.PhoneNumbers[0], to, "Hello", reserved)
+}
+
+// dispatch starts every send due at the fixture's clock and waits for
+// them, returning how long until the next one is due.
+func (f *outboundFixture) dispatch() time.Duration {
+	next := f.queue.dispatch(context.Background())
+	f.queue.sending.Wait()
+	return next
+}
+
+func (f *outboundFixture) get(t *testing.T, id string) models.OutboundMessage {
+	t.Helper()
+	msg, err := f.queue.Get("tenant-a", "waba-1", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestOutboundQueueBacksOffPairRateLimit(t *testing.T) {
+	f := newOutboundFixture(t, "")
+	f.graph.Fail(fakegraph.RouteMessages, fakegraph.Failure{Code: errPairRateLimit, Message: "throttled", Times: 1})
+	first := f.enqueue("15550001", false)
+	second := f.enqueue("+1 555 0001", false)
+
+	f.dispatch()
+	if got := f.get(t, first.ID); got.Status != models.OutboundQueued || got.ErrorCode != errPairRateLimit || got.Attempts != 1 {
+		t.Fatalf("first after pair limit = %+v", got)
+	}
+	// The second message waits behind the first, which waits out the backoff
+	if next := f.dispatch(); next != pairBackoffBase {
+		t.Errorf("next attempt in %v, want %v", next, pairBackoffBase)
+	}
+	if got := f.get(t, second.ID); got.Status != models.OutboundQueued || got.Attempts != 0 {
+		t.Fatalf("second sent out of order: %+v", got)
+	}
+
+	f.clock = f.clock.Add(pairBackoffBase)
+	f.dispatch()
+	f.dispatch()
+	for _, id := range []string{first.ID, second.ID} {
+		if got := f.get(t, id); got.Status != models.OutboundSent || got.MessageID == "" || got.ErrorCode != 0 {
+			t.Errorf("message = %+v", got)
+		}
+	}
+	if n := f.graph.RequestCount(fakegraph.RouteMessages); n != 3 {
+		t.Errorf("messages requests = %d, want 3", n)
+	}
+	if depth := f.queue.QueueDepth(); depth != 0 {
+		t.Errorf("queue depth = %d", depth)
+	}
+}
+
+func TestOutboundQueuePausesNumberOnThroughputLimit(t *testing.T) {
+	f := newOutboundFixture(t, "")
+	f.graph.Fail(fakegraph.RouteMessages, fakegraph.Failure{Code: errThroughputReached, Message: "throttled", Times: 1})
+	first := f.enqueue("15550001", false)
+	f.dispatch()
+	other := f.enqueue("15550002", false)
+
+	// Every recipient waits while the number is paused
+	if next := f.dispatch(); next != outboundRetryBase {
+		t.Errorf("next attempt in %v, want %v", next, outboundRetryBase)
+	}
+	if got := f.get(t, other.ID); got.Attempts != 0 {
+		t.Fatalf("sent while paused: %+v", got)
+	}
+
+	f.clock = f.clock.Add(outboundRetryBase)
+	f.dispatch()
+	for _, id := range []string{first.ID, other.ID} {
+		if got := f.get(t, id); got.Status != models.OutboundSent {
+			t.Errorf("message = %+v", got)
+		}
+	}
+}
+
+func TestOutboundQueueFailsPermanentErrors(t *testing.T) {
+	f := newOutboundFixture(t, "")
+	f.graph.Fail(fakegraph.RouteMessages, fakegraph.Failure{Code: 131026, Message: "Message undeliverable", Times: 1})
+	phone := f.account.PhoneNumbers[0]
+	f.limits.Reserve(phone, []string{"15550001"}, false)
+	msg := f.enqueue("15550001", true)
+
+	f.dispatch()
+	if got := f.get(t, msg.ID); got.Status != models.OutboundFailed || got.ErrorCode != 131026 || got.Attempts != 1 {
+		t.Fatalf("message = %+v", got)
+	}
+	if capacity := f.limits.Capacity(phone); capacity.Used != 0 {
+		t.Errorf("failed message still holds capacity: %+v", capacity)
+	}
+
+	// Retryable errors give up after OUTBOUND_MAX_ATTEMPTS
+	f.graph.Fail(fakegraph.RouteMessages, fakegraph.Failure{Code: errPairRateLimit, Message: "throttled"})
+	msg = f.enqueue("15550002", false)
+	for range 3 {
+		f.dispatch()
+		f.clock = f.clock.Add(outboundRetryMax)
+	}
+	if got := f.get(t, msg.ID); got.Status != models.OutboundFailed || got.Attempts != 3 {
+		t.Errorf("message = %+v", got)
+	}
+}
+
+func TestOutboundQueueFollowsStatusWebhooks(t *testing.T) {
+	f := newOutboundFixture(t, "")
+	msg := f.enqueue("15550001", false)
+	f.dispatch()
+	sent := f.get(t, msg.ID)
+
+	status := func(s string, errorCode int) {
+		data, _ := json.Marshal(map[string]any{
+			"id": sent.MessageID, "recipient_id": "15550001", "status": s,
+			"errors": []map[string]int{{"code": errorCode}},
+		})
+		f.queue.HandleEvent(models.Event{Type: models.EventMessageStatus, PhoneNumberID: "pn-1", Data: data})
+	}
+	status("delivered", 0)
+	if got := f.get(t, msg.ID); got.DeliveryStatus != "delivered" {
+		t.Fatalf("message = %+v", got)
+	}
+
+	// Meta accepted the message, then dropped it for throughput
+	status("failed", errThroughputReached)
+	if got := f.get(t, msg.ID); got.Status != models.OutboundQueued || got.MessageID != "" || got.ErrorCode != errThroughputReached {
+		t.Fatalf("message = %+v", got)
+	}
+	f.clock = f.clock.Add(outboundRetryBase)
+	f.dispatch()
+	if got := f.get(t, msg.ID); got.Status != models.OutboundSent || got.MessageID == sent.MessageID || got.Attempts != 2 {
+		t.Errorf("message = %+v", got)
+	}
+}
+
+func TestOutboundQueueJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbound.jsonl")
+	f := newOutboundFixture(t, path)
+	sent := f.enqueue("15550001", false)
+	f.dispatch()
+	queued := f.enqueue("15550002", true)
+	if err := f.queue.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := newOutboundFixture(t, path)
+	if got := restarted.get(t, sent.ID); got.Status != models.OutboundSent || got.MessageID == "" {
+		t.Errorf("sent message after restart = %+v", got)
+	}
+	got := restarted.get(t, queued.ID)
+	if got.Status != models.OutboundQueued || !got.Reserved || restarted.queue.QueueDepth() != 1 {
+		t.Fatalf("queued message after restart = %+v, depth %d", got, restarted.queue.QueueDepth())
+	}
+	restarted.account.AccessToken = restarted.graph.IssueToken()
+	restarted.queue.storage.SaveBusinessAccount(context.Background(), restarted.account)
+	restarted.dispatch()
+	if got := restarted.get(t, queued.ID); got.Status != models.OutboundSent {
+		t.Errorf("restored message = %+v", got)
+	}
+}
+
+func TestOutboundQueuePingReportsJournalFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbound.jsonl")
+	f := newOutboundFixture(t, path)
+	if err := f.queue.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping = %v", err)
+	}
+
+	f.queue.journal.file.Close()
+	f.enqueue("15550001", false)
+	if err := f.queue.Ping(context.Background()); err == nil {
+		t.Fatal("Ping passed after a failed journal write")
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.queue.journal.file = file
+	f.enqueue("15550002", false)
+	if err := f.queue.Ping(context.Background()); err != nil {
+		t.Errorf("Ping after the journal recovered = %v", err)
+	}
+	f.queue.Shutdown(context.Background())
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: outboundRetryBase, 3: 4 * outboundRetryBase, 20: outboundRetryMax, 100: outboundRetryMax} {
+		if got := retryDelay(attempts); got != want {
+			t.Errorf("retryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	bucket := tokenBucket{rate: 80}
+	for i := range 80 {
+		if _, ok := bucket.take(now); !ok {
+			t.Fatalf("take %d refused within the burst", i)
+		}
+	}
+	wait, ok := bucket.take(now)
+	if ok || wait != time.Second/80 {
+		t.Fatalf("take beyond the burst = %v, %v", wait, ok)
+	}
+	if _, ok := bucket.take(now.Add(wait)); !ok {
+		t.Error("take refused after refill")
+	}
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"back/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// phoneSyncBacklog bounds the WABAs waiting for a webhook-triggered sync.
+// When it is full the periodic sync catches up instead.
+const phoneSyncBacklog = 100
+
+// PhoneNumberSync keeps stored phone numbers in step with Meta. Every
+// account is re-fetched periodically; a phone_number_quality_update webhook
+// applies the new messaging limit at once and queues its WABA for a full
+// sync. Changed fields are recorded in the phone number history and
+// published as phone_number.updated events.
+type PhoneNumberSync struct {
+	facebook *FacebookService
+	storage  *StorageService
+	events   *EventBus
+	metrics  *Metrics
+	pending  chan accountRef
+	now      func() time.Time
+}
+
+type accountRef struct {
+	tenantID string
+	wabaID   string
+}
+
+func NewPhoneNumberSync(facebook *FacebookService, storage *StorageService, events *EventBus, metrics *Metrics) *PhoneNumberSync {
+	return &PhoneNumberSync{
+		facebook: facebook,
+		storage:  storage,
+		events:   events,
+		metrics:  metrics,
+		pending:  make(chan accountRef, phoneSyncBacklog),
+		now:      time.Now,
+	}
+}
+
+// Run syncs every account every interval, and WABAs queued by webhooks as
+// they come, until ctx is done. With a zero interval only the latter run.
+func (p *PhoneNumberSync) Run(ctx context.Context, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			if err := p.SyncAll(ctx); err != nil {
+				slog.Error("phone number sync failed", "error", err)
+			}
+		case ref := <-p.pending:
+			if err := p.SyncAccount(ctx, ref.tenantID, ref.wabaID); err != nil {
+				slog.Warn("phone number sync failed", "tenant_id", ref.tenantID, "waba_id", ref.wabaID, "error", err)
+			}
+		}
+	}
+}
+
+// SyncAll syncs the phone numbers of every account that still has a usable
+// token. Failures are per account and do not stop the run.
+func (p *PhoneNumberSync) SyncAll(ctx context.Context) error {
+	accounts, err := p.storage.AllBusinessAccounts()
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if account.NeedsReauth {
+			continue
+		}
+		if err := p.SyncAccount(ctx, account.TenantID, account.WABAID); err != nil {
+			slog.Warn("phone number sync failed", "tenant_id", account.TenantID, "waba_id", account.WABAID, "error", err)
+		}
+	}
+	return nil
+}
+
+// SyncAccount re-fetches a WABA's phone numbers and stores what changed.
+func (p *PhoneNumberSync) SyncAccount(ctx context.Context, tenantID, wabaID string) error {
+	account, err := p.storage.GetBusinessAccount(tenantID, wabaID)
+	if err != nil {
+		return err
+	}
+	if account.NeedsReauth {
+		return nil
+	}
+	numbers, err := p.facebook.GetPhoneNumbers(ctx, account.AccessToken, wabaID)
+	p.metrics.PhoneNumberSync(err == nil)
+	if err != nil {
+		return err
+	}
+
+	now := p.now()
+	var changes []models.PhoneNumberChange
+	err = p.storage.UpdateBusinessAccount(ctx, tenantID, wabaID, func(stored *models.BusinessAccount) error {
+		updated := make([]models.BusinessPhoneNumber, 0, len(numbers))
+		for _, number := range numbers {
+			updated = append(updated, PhoneNumberFromGraph(number))
+		}
+		changes = diffPhoneNumbers(stored.PhoneNumbers, updated, models.PhoneChangeSync, now)
+		if len(changes) == 0 {
+			return ErrUnchanged
+		}
+		stored.PhoneNumbers = updated
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.record(account, changes)
+	return nil
+}
+
+// HandleEvent reacts to phone_number_quality_update webhooks. It is an
+// EventSubscriber.
+func (p *PhoneNumberSync) HandleEvent(event models.Event) {
+	if event.Type != models.EventPhoneNumberQuality || event.TenantID == "" {
+		return
+	}
+	var update struct {
+		DisplayPhoneNumber string `json:"display_phone_number"`
+		CurrentLimit       string `json:"current_limit"`
+	}
+	json.Unmarshal(event.Data, &update)
+
+	if update.CurrentLimit != "" {
+		if err := p.applyLimit(event, update.DisplayPhoneNumber, update.CurrentLimit); err != nil {
+			slog.Warn("failed to apply messaging limit update", "waba_id", event.WABAID, "error", err)
+		}
+	}
+	// The webhook carries neither the quality rating nor the phone number ID
+	select {
+	case p.pending <- accountRef{tenantID: event.TenantID, wabaID: event.WABAID}:
+	default:
+		slog.Warn("phone number sync queue full, waiting for the periodic sync", "waba_id", event.WABAID)
+	}
+}
+
+// applyLimit sets the messaging limit tier reported by a webhook on the
+// phone number with the given display number.
+func (p *PhoneNumberSync) applyLimit(event models.Event, displayNumber, tier string) error {
+	var account *models.BusinessAccount
+	var changes []models.PhoneNumberChange
+	err := p.storage.UpdateBusinessAccount(context.Background(), event.TenantID, event.WABAID, func(stored *models.BusinessAccount) error {
+		for i := range stored.PhoneNumbers {
+			phone := &stored.PhoneNumbers[i]
+			if digits(phone.PhoneNumber) != digits(displayNumber) {
+				continue
+			}
+			if phone.MessagingLimitTier == tier {
+				return ErrUnchanged
+			}
+			changes = append(changes, models.PhoneNumberChange{
+				PhoneNumberID: phone.ID,
+				Field:         "messaging_limit_tier",
+				Before:        phone.MessagingLimitTier,
+				After:         tier,
+				Source:        models.PhoneChangeWebhook,
+				ChangedAt:     event.OccurredAt,
+			})
+			phone.MessagingLimitTier = tier
+			account = stored
+			return nil
+		}
+		return fmt.Errorf("no phone number %s on the account", displayNumber)
+	})
+	if err != nil || account == nil {
+		return err
+	}
+	p.record(account, changes)
+	return nil
+}
+
+// record stores changes in the history and publishes one event per changed
+// phone number.
+func (p *PhoneNumberSync) record(account *models.BusinessAccount, changes []models.PhoneNumberChange) {
+	if len(changes) == 0 {
+		return
+	}
+	p.storage.RecordPhoneNumberChanges(account.WABAID, changes...)
+
+	byPhone := map[string][]models.PhoneNumberChange{}
+	var order []string
+	for _, change := range changes {
+		if _, seen := byPhone[change.PhoneNumberID]; !seen {
+			order = append(order, change.PhoneNumberID)
+		}
+		byPhone[change.PhoneNumberID] = append(byPhone[change.PhoneNumberID], change)
+	}
+	for _, phoneID := range order {
+		data, _ := json.Marshal(map[string]any{"changes": byPhone[phoneID]})
+		slog.Info("phone number changed", "tenant_id", account.TenantID, "waba_id", account.WABAID, "phone_number_id", phoneID, "changes", len(byPhone[phoneID]))
+		p.events.Publish(models.Event{
+			ID:            eventID(models.EventPhoneNumberUpdated, account.WABAID, data),
+			Type:          models.EventPhoneNumberUpdated,
+			TenantID:      account.TenantID,
+			AppID:         account.AppID,
+			WABAID:        account.WABAID,
+			PhoneNumberID: phoneID,
+			OccurredAt:    p.now(),
+			Data:          data,
+		})
+	}
+}
+
+// PhoneNumberFromGraph converts a Graph phone number into its stored form.
+func PhoneNumberFromGraph(phone models.FacebookPhoneNumber) models.BusinessPhoneNumber {
+	return models.BusinessPhoneNumber{
+		ID:                 phone.ID,
+		PhoneNumber:        phone.DisplayPhoneNumber,
+		DisplayName:        phone.VerifiedName,
+		Status:             phone.Status,
+		QualityRating:      phone.QualityRating,
+		IsVerified:         phone.CodeVerificationStatus == "VERIFIED",
+		MessagingLimitTier: phone.MessagingLimitTier,
+		Throughput:         phone.Throughput.Level,
+		NameStatus:         phone.NameStatus,
+		PlatformType:       phone.PlatformType,
+	}
+}
+
+// phoneFields are the phone number fields whose changes are recorded.
+var phoneFields = []struct {
+	name string
+	get  func(models.BusinessPhoneNumber) string
+}{
+	{"phone_number", func(p models.BusinessPhoneNumber) string { return p.PhoneNumber }},
+	{"display_name", func(p models.BusinessPhoneNumber) string { return p.DisplayName }},
+	{"status", func(p models.BusinessPhoneNumber) string { return p.Status }},
+	{"quality_rating", func(p models.BusinessPhoneNumber) string { return p.QualityRating }},
+	{"messaging_limit_tier", func(p models.BusinessPhoneNumber) string { return p.MessagingLimitTier }},
+	{"throughput", func(p models.BusinessPhoneNumber) string { return p.Throughput }},
+	{"name_status", func(p models.BusinessPhoneNumber) string { return p.NameStatus }},
+	{"platform_type", func(p models.BusinessPhoneNumber) string { return p.PlatformType }},
+}
+
+// diffPhoneNumbers lists the field changes from before to after. Numbers
+// that appear or disappear are recorded as a change of phone_number from or
+// to "".
+func diffPhoneNumbers(before, after []models.BusinessPhoneNumber, source string, at time.Time) []models.PhoneNumberChange {
+	var changes []models.PhoneNumberChange
+	change := func(phoneID, field, from, to string) {
+		changes = append(changes, models.PhoneNumberChange{
+			PhoneNumberID: phoneID, Field: field, Before: from, After: to, Source: source, ChangedAt: at,
+		})
+	}
+	old := make(map[string]models.BusinessPhoneNumber, len(before))
+	for _, phone := range before {
+		old[phone.ID] = phone
+	}
+	for _, phone := range after {
+		previous, existed := old[phone.ID]
+		delete(old, phone.ID)
+		if !existed {
+			change(phone.ID, "phone_number", "", phone.PhoneNumber)
+			continue
+		}
+		for _, field := range phoneFields {
+			if from, to := field.get(previous), field.get(phone); from != to {
+				change(phone.ID, field.name, from, to)
+			}
+		}
+	}
+	for _, phone := range before {
+		if _, removed := old[phone.ID]; removed {
+			change(phone.ID, "phone_number", phone.PhoneNumber, "")
+		}
+	}
+	return changes
+}
+
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"back/fakegraph"
+	"back/models"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPhoneNumberSync(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	cfg := newTestConfig(graph)
+	storage := NewStorageService(NewAuditLog())
+	bus := NewEventBus()
+	var events []models.Event
+	bus.Subscribe(func(e models.Event) { events = append(events, e) })
+	sync := NewPhoneNumberSync(NewFacebookService(cfg, nil, nil), storage, bus, nil)
+
+	ctx := context.Background()
+	token := graph.IssueToken()
+	phone := models.FacebookPhoneNumber{ID: "pn-1", DisplayPhoneNumber: "+1 555 0100", QualityRating: "GREEN", MessagingLimitTier: "TIER_1K"}
+	graph.AddPhoneNumber("waba-1", phone)
+	storage.SaveBusinessAccount(ctx, &models.BusinessAccount{
+		TenantID: "tenant-a", WABAID: "waba-1", AccessToken: token,
+		PhoneNumbers: []models.BusinessPhoneNumber{PhoneNumberFromGraph(phone)},
+	})
+
+	// Nothing changed at Meta
+	if err := sync.SyncAccount(ctx, "tenant-a", "waba-1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("unchanged sync published %d events", len(events))
+	}
+
+	phone.QualityRating, phone.MessagingLimitTier = "YELLOW", "TIER_10K"
+	graph.UpdatePhoneNumber("waba-1", phone)
+	if err := sync.SyncAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	account, _ := storage.GetBusinessAccount("tenant-a", "waba-1")
+	if got := account.PhoneNumbers[0]; got.QualityRating != "YELLOW" || got.MessagingLimitTier != "TIER_10K" {
+		t.Errorf("stored phone number = %+v", got)
+	}
+	history, err := storage.PhoneNumberHistory("tenant-a", "waba-1", "pn-1")
+	if err != nil || len(history) != 2 {
+		t.Fatalf("history = %+v, %v", history, err)
+	}
+	for _, change := range history {
+		if change.Source != models.PhoneChangeSync {
+			t.Errorf("change source = %q", change.Source)
+		}
+	}
+	if len(events) != 1 || events[0].Type != models.EventPhoneNumberUpdated || events[0].PhoneNumberID != "pn-1" {
+		t.Errorf("events = %+v", events)
+	}
+	if _, err := storage.PhoneNumberHistory("tenant-b", "waba-1", "pn-1"); err == nil {
+		t.Error("history visible to another tenant")
+	}
+}
+
+func TestPhoneNumberSyncAppliesQualityWebhook(t *testing.T) {
+	storage := NewStorageService(NewAuditLog())
+	bus := NewEventBus()
+	var events []models.Event
+	bus.Subscribe(func(e models.Event) { events = append(events, e) })
+	sync := NewPhoneNumberSync(nil, storage, bus, nil)
+
+	ctx := context.Background()
+	storage.SaveBusinessAccount(ctx, &models.BusinessAccount{
+		TenantID: "tenant-a", WABAID: "waba-1",
+		PhoneNumbers: []models.BusinessPhoneNumber{{ID: "pn-1", PhoneNumber: "+1 555-0100", MessagingLimitTier: "TIER_1K"}},
+	})
+	data, _ := json.Marshal(map[string]string{"display_phone_number": "15550100", "event": "UPGRADE", "current_limit": "TIER_10K"})
+	sync.HandleEvent(models.Event{Type: models.EventPhoneNumberQuality, TenantID: "tenant-a", WABAID: "waba-1", OccurredAt: time.Now(), Data: data})
+
+	account, _ := storage.GetBusinessAccount("tenant-a", "waba-1")
+	if tier := account.PhoneNumbers[0].MessagingLimitTier; tier != "TIER_10K" {
+		t.Errorf("tier = %q, want TIER_10K", tier)
+	}
+	history, _ := storage.PhoneNumberHistory("tenant-a", "waba-1", "pn-1")
+	if len(history) != 1 || history[0].Source != models.PhoneChangeWebhook || history[0].Before != "TIER_1K" {
+		t.Errorf("history = %+v", history)
+	}
+	if len(events) != 1 || events[0].Type != models.EventPhoneNumberUpdated {
+		t.Errorf("events = %+v", events)
+	}
+	select {
+	case ref := <-sync.pending:
+		if ref.wabaID != "waba-1" {
+			t.Errorf("queued %+v", ref)
+		}
+	default:
+		t.Error("WABA not queued for a full sync")
+	}
+}
@@ -0,0 +1,24 @@
+package services
+
+import "context"
+
+// RequestInfo identifies the HTTP request an operation runs on behalf of.
+type RequestInfo struct {
+	ID      string
+	IP      string
+	TraceID string // W3C trace ID, from the caller's traceparent header or generated
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo attaches the request ID, trace ID and client IP to ctx.
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFromContext returns the request info, or a zero value outside
+// of a request.
+func RequestInfoFromContext(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
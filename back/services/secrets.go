@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"back/config"
+)
+
+// ErrSecretNotFound is returned by providers that do not hold a secret.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider reads secrets by name. Names are the secret's config
+// setting, e.g. FACEBOOK_APP_SECRET or META_APP_EMEA_APP_SECRET.
+type SecretProvider interface {
+	Secret(name string) (string, error)
+}
+
+// NewSecretProvider returns the provider selected by SECRETS_PROVIDER.
+func NewSecretProvider(cfg *config.Config) (SecretProvider, error) {
+	switch cfg.SecretsProvider {
+	case "", config.SecretsFromEnv:
+		return NewEnvSecretProvider(cfg.SecretValue), nil
+	case config.SecretsFromDir:
+		return NewDirSecretProvider(cfg.SecretsDir), nil
+	case config.SecretsFromEncryptedFile:
+		return NewEncryptedFileSecretProvider(cfg.SecretsFile, cfg.SecretsFileKey), nil
+	default:
+		return nil, fmt.Errorf("unknown secrets provider %q", cfg.SecretsProvider)
+	}
+}
+
+// EnvSecretProvider serves secrets from environment variables as resolved
+// by config.Load, so .env, config file and flag overrides apply.
+type EnvSecretProvider struct {
+	lookup func(name string) string
+}
+
+func NewEnvSecretProvider(lookup func(name string) string) *EnvSecretProvider {
+	return &EnvSecretProvider{lookup: lookup}
+}
+
+func (p *EnvSecretProvider) Secret(name string) (string, error) {
+	if v := p.lookup(name); v != "" {
+		return v, nil
+	}
+	return "", ErrSecretNotFound
+}
+
+// DirSecretProvider serves secrets mounted as files, one per secret, as
+// Kubernetes and Docker do. A secret is read from <dir>/<NAME> or, failing
+// that, <dir>/<name>; surrounding whitespace is trimmed.
+type DirSecretProvider struct {
+	dir string
+}
+
+func NewDirSecretProvider(dir string) *DirSecretProvider {
+	return &DirSecretProvider{dir: dir}
+}
+
+func (p *DirSecretProvider) Secret(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) || name == "" || name[0] == '.' {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	for _, file := range []string{name, strings.ToLower(name)} {
+		data, err := os.ReadFile(filepath.Join(p.dir, file))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", ErrSecretNotFound
+}
+
+// EncryptedFileSecretProvider serves secrets from a JSON object of names to
+// values, encrypted with a passphrase by EncryptSecretsFile. The file is
+// decrypted again only when it changes on disk.
+type EncryptedFileSecretProvider struct {
+	path       string
+	passphrase string
+	mutex      sync.Mutex
+	seen       fileStamp
+	secrets    map[string]string
+}
+
+func NewEncryptedFileSecretProvider(path, passphrase string) *EncryptedFileSecretProvider {
+	return &EncryptedFileSecretProvider{path: path, passphrase: passphrase}
+}
+
+func (p *EncryptedFileSecretProvider) Secret(name string) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return "", err
+	}
+	stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+	if p.secrets == nil || stamp != p.seen {
+		data, err := os.ReadFile(p.path)
+		if err != nil {
+			return "", err
+		}
+		secrets, err := DecryptSecretsFile(p.passphrase, data)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", p.path, err)
+		}
+		p.secrets, p.seen = secrets, stamp
+	}
+	if v, ok := p.secrets[name]; ok && v != "" {
+		return v, nil
+	}
+	return "", ErrSecretNotFound
+}
+
+// secretsFile is the on-disk format of an encrypted secrets file.
+type secretsFile struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Passphrases are stretched with PBKDF2-SHA256 at OWASP's recommended count.
+const secretsFileIterations = 600000
+
+// EncryptSecretsFile encrypts secrets with AES-256-GCM under a key derived
+// from passphrase.
+func EncryptSecretsFile(passphrase string, secrets map[string]string) ([]byte, error) {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	file := secretsFile{Version: 1, Salt: make([]byte, 16)}
+	rand.Read(file.Salt)
+	key, err := pbkdf2.Key(sha256.New, passphrase, file.Salt, secretsFileIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	if file.Nonce, file.Ciphertext, err = seal(key, plaintext); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// DecryptSecretsFile reverses EncryptSecretsFile.
+func DecryptSecretsFile(passphrase string, data []byte) (map[string]string, error) {
+	var file secretsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("not a secrets file: %w", err)
+	}
+	if file.Version != 1 {
+		return nil, fmt.Errorf("unsupported secrets file version %d", file.Version)
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, file.Salt, secretsFileIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(key, file.Nonce, file.Ciphertext)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or corrupted secrets file")
+	}
+	var secrets map[string]string
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func seal(key, plaintext []byte) (nonce, ciphertext []byte, err error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return nonce, aead.Seal(nil, nonce, plaintext, nil), nil
+}
+
+func open(key, nonce, ciphertext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Secrets caches secrets read from a provider and refreshes them
+// periodically, so rotated values are picked up without a restart.
+// Consumers read through it on every use rather than keeping copies. A
+// secret the provider does not hold falls back to its configured value.
+// A nil *Secrets serves configured values only.
+type Secrets struct {
+	provider SecretProvider
+	fallback func(name string) string
+	values   map[string]string
+	mutex    sync.RWMutex
+}
+
+func NewSecrets(provider SecretProvider, fallback func(name string) string) *Secrets {
+	return &Secrets{
+		provider: provider,
+		fallback: fallback,
+		values:   make(map[string]string),
+	}
+}
+
+// Get returns the named secret, reading it from the provider on first use.
+func (s *Secrets) Get(name string) string {
+	s.mutex.RLock()
+	v, ok := s.values[name]
+	s.mutex.RUnlock()
+	if ok {
+		return v
+	}
+
+	v, err := s.read(name)
+	if err != nil {
+		slog.Error("failed to read secret", "secret", name, "error", err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if cached, ok := s.values[name]; ok {
+		return cached // A concurrent Get or Refresh got there first
+	}
+	// Cached even after an error; Refresh retries it
+	s.values[name] = v
+	return v
+}
+
+// read asks the provider for a secret, falling back to the configured value.
+func (s *Secrets) read(name string) (string, error) {
+	v, err := s.provider.Secret(name)
+	if errors.Is(err, ErrSecretNotFound) || (err == nil && config.IsPlaceholder(v)) {
+		return s.fallback(name), nil
+	}
+	if err != nil {
+		return s.fallback(name), err
+	}
+	return v, nil
+}
+
+// Refresh re-reads every secret used so far. A secret that fails to read
+// keeps its previous value.
+func (s *Secrets) Refresh() error {
+	s.mutex.RLock()
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	s.mutex.RUnlock()
+
+	var problems []error
+	for _, name := range names {
+		v, err := s.read(name)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		s.mutex.Lock()
+		if s.values[name] != v {
+			slog.Info("secret rotated", "secret", name)
+			s.values[name] = v
+		}
+		s.mutex.Unlock()
+	}
+	return errors.Join(problems...)
+}
+
+// Run refreshes secrets every interval until ctx is done.
+func (s *Secrets) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(); err != nil {
+				slog.Error("failed to refresh secrets", "error", err)
+			}
+		}
+	}
+}
+
+// Check reports required secrets that are missing, e.g. from a mounted
+// directory, as config.Validate does for the env provider.
+func (s *Secrets) Check(names ...string) error {
+	var problems []error
+	for _, name := range names {
+		if config.IsPlaceholder(s.Get(name)) {
+			problems = append(problems, fmt.Errorf("%s is not set", name))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// App returns app with its secret and verify token read through s.
+func (s *Secrets) App(app config.MetaApp) config.MetaApp {
+	if s == nil {
+		return app
+	}
+	app.AppSecret = s.Get(app.SecretKey())
+	app.WebhookVerifyToken = s.Get(app.VerifyTokenKey())
+	return app
+}
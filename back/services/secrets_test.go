@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"back/config"
+)
+
+func noFallback(string) string { return "" }
+
+func TestDirSecretProvider(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "FACEBOOK_APP_SECRET"), []byte("from-file\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, "webhook_verify_token"), []byte("lower-case"), 0o600)
+	p := NewDirSecretProvider(dir)
+
+	for name, want := range map[string]string{"FACEBOOK_APP_SECRET": "from-file", "WEBHOOK_VERIFY_TOKEN": "lower-case"} {
+		if got, err := p.Secret(name); err != nil || got != want {
+			t.Errorf("Secret(%s) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := p.Secret("TOKEN_ENCRYPTION_KEY"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("missing secret: err = %v", err)
+	}
+	if _, err := p.Secret("../etc/passwd"); err == nil || errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("path traversal: err = %v", err)
+	}
+}
+
+func TestEncryptedFileSecretProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	write := func(secrets map[string]string, stamp time.Time) {
+		t.Helper()
+		data, err := EncryptSecretsFile("passphrase", secrets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(path, data, 0o600)
+		os.Chtimes(path, stamp, stamp)
+	}
+	write(map[string]string{"FACEBOOK_APP_SECRET": "v1"}, time.Now())
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "v1") {
+		t.Fatalf("secrets file holds the secret in clear text: %s", data)
+	}
+
+	p := NewEncryptedFileSecretProvider(path, "passphrase")
+	if got, err := p.Secret("FACEBOOK_APP_SECRET"); err != nil || got != "v1" {
+		t.Fatalf("Secret = %q, %v", got, err)
+	}
+	if _, err := p.Secret("WEBHOOK_VERIFY_TOKEN"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("missing secret: err = %v", err)
+	}
+	write(map[string]string{"FACEBOOK_APP_SECRET": "v2"}, time.Now().Add(time.Minute))
+	if got, _ := p.Secret("FACEBOOK_APP_SECRET"); got != "v2" {
+		t.Errorf("after rewrite Secret = %q, want v2", got)
+	}
+
+	if _, err := NewEncryptedFileSecretProvider(path, "wrong").Secret("FACEBOOK_APP_SECRET"); err == nil {
+		t.Error("wrong passphrase accepted")
+	}
+}
+
+// mapProvider is a SecretProvider tests can rotate.
+type mapProvider map[string]string
+
+func (m mapProvider) Secret(name string) (string, error) {
+	if v, ok := m[name]; ok {
+		return v, nil
+	}
+	return "", ErrSecretNotFound
+}
+
+func TestSecretsRefreshPicksUpRotation(t *testing.T) {
+	provider := mapProvider{"FACEBOOK_APP_SECRET": "old"}
+	cfg := &config.Config{FacebookAppSecret: "configured", WebhookVerifyToken: "configured-token"}
+	secrets := NewSecrets(provider, cfg.SecretValue)
+
+	app := secrets.App(cfg.MetaApps()[0])
+	if app.AppSecret != "old" || app.WebhookVerifyToken != "configured-token" {
+		t.Fatalf("app = %+v, want provider secret and configured verify token", app)
+	}
+
+	provider["FACEBOOK_APP_SECRET"] = "new"
+	if got := secrets.Get("FACEBOOK_APP_SECRET"); got != "old" {
+		t.Errorf("before refresh Get = %q, want cached old", got)
+	}
+	if err := secrets.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := secrets.Get("FACEBOOK_APP_SECRET"); got != "new" {
+		t.Errorf("after refresh Get = %q, want new", got)
+	}
+
+	if err := secrets.Check("FACEBOOK_APP_SECRET", "TOKEN_ENCRYPTION_KEY"); err == nil || !strings.Contains(err.Error(), "TOKEN_ENCRYPTION_KEY is not set") {
+		t.Errorf("Check = %v", err)
+	}
+}
+
+func TestTokenCipherRotation(t *testing.T) {
+	provider := mapProvider{}
+	secrets := NewSecrets(provider, noFallback)
+	tokens := NewTokenCipher(secrets)
+
+	// Without a key tokens pass through
+	if got, _ := tokens.Encrypt("EAAplain"); got != "EAAplain" {
+		t.Errorf("Encrypt without key = %q", got)
+	}
+
+	provider[TokenKeySecret] = "key-1"
+	secrets.Refresh()
+	sealed, err := tokens.Encrypt("EAAsecret")
+	if err != nil || !strings.HasPrefix(sealed, encryptedTokenPrefix) || strings.Contains(sealed, "EAAsecret") {
+		t.Fatalf("Encrypt = %q, %v", sealed, err)
+	}
+	if got, err := tokens.Decrypt(sealed); err != nil || got != "EAAsecret" {
+		t.Errorf("Decrypt = %q, %v", got, err)
+	}
+	if got, _ := tokens.Decrypt("EAAplain"); got != "EAAplain" {
+		t.Errorf("Decrypt of a token stored unencrypted = %q", got)
+	}
+
+	// After rotation the old key still opens existing tokens
+	provider[TokenKeySecret], provider[PreviousTokenKeySecret] = "key-2", "key-1"
+	secrets.Refresh()
+	if got, err := tokens.Decrypt(sealed); err != nil || got != "EAAsecret" {
+		t.Errorf("Decrypt after rotation = %q, %v", got, err)
+	}
+
+	delete(provider, PreviousTokenKeySecret)
+	secrets.Refresh()
+	if _, err := tokens.Decrypt(sealed); err == nil {
+		t.Error("token opened after its key was retired")
+	}
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// SignatureHeader is the header Meta uses to sign webhook deliveries.
+const SignatureHeader = "X-Hub-Signature-256"
+
+// SignWebhookPayload returns the X-Hub-Signature-256 value for body,
+// an HMAC-SHA256 keyed with the app secret.
+func SignWebhookPayload(appSecret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidWebhookSignature reports whether signature matches body for appSecret.
+func ValidWebhookSignature(appSecret, signature string, body []byte) bool {
+	if appSecret == "" || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(SignWebhookPayload(appSecret, body)))
+}
@@ -1,80 +1,410 @@
 package services
 
 import (
+	"back/models"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"sync"
 	"time"
-	"back/models"
 )
 
+// ErrAccountClaimed is returned when a WABA is already onboarded by another tenant.
+var ErrAccountClaimed = errors.New("business account belongs to another tenant")
+
 // In-memory storage (replace with database in production)
+// Accounts are keyed by WABA ID; every read is scoped to the owning tenant.
+// Stored accounts are copies, so every change goes through
+// SaveBusinessAccount and lands in the audit log. With a TokenCipher,
+// access tokens are held encrypted and decrypted on every read; reads
+// re-encrypt tokens still sealed with a previous key, so after a rotation
+// the old key is only needed until every account has been read once.
 type StorageService struct {
 	businesses map[string]*models.BusinessAccount
+	history    map[string][]models.PhoneNumberChange // phoneHistoryKey -> changes, oldest first
+	audit      *AuditLog
+	tokens     *TokenCipher
 	mutex      sync.RWMutex
 }
 
-func NewStorageService() *StorageService {
+func NewStorageService(audit *AuditLog) *StorageService {
 	return &StorageService{
 		businesses: make(map[string]*models.BusinessAccount),
+		history:    make(map[string][]models.PhoneNumberChange),
+		audit:      audit,
 		mutex:      sync.RWMutex{},
 	}
 }
 
-func (s *StorageService) SaveBusinessAccount(account *models.BusinessAccount) error {
+// EncryptTokensWith makes storage encrypt access tokens saved from now on.
+func (s *StorageService) EncryptTokensWith(tokens *TokenCipher) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	s.tokens = tokens
+}
+
+func (s *StorageService) SaveBusinessAccount(ctx context.Context, account *models.BusinessAccount) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.save(ctx, account)
+}
+
+// ErrUnchanged is returned by UpdateBusinessAccount callbacks that have
+// nothing to change, so no update is stored or audited.
+var ErrUnchanged = errors.New("unchanged")
+
+// UpdateBusinessAccount applies update to the current stored account under
+// the storage lock, so changes made by background jobs cannot overwrite a
+// concurrent re-onboarding. An error from update aborts the change;
+// ErrUnchanged aborts it silently.
+func (s *StorageService) UpdateBusinessAccount(ctx context.Context, tenantID, wabaID string, update func(account *models.BusinessAccount) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, exists := s.businesses[wabaID]
+	if !exists || stored.TenantID != tenantID {
+		return fmt.Errorf("business account not found")
+	}
+	account, unreadable := s.openOrFlag(stored)
+	if err := update(account); errors.Is(err, ErrUnchanged) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	account.TenantID, account.WABAID = tenantID, wabaID
+	if err := s.save(ctx, account); err != nil {
+		return err
+	}
+	if unreadable && account.AccessToken == "" {
+		// Keep the sealed token in case its key comes back
+		s.businesses[wabaID].AccessToken = stored.AccessToken
+	}
+	return nil
+}
+
+// save stores account. Callers hold the write lock.
+func (s *StorageService) save(ctx context.Context, account *models.BusinessAccount) error {
+	if account.TenantID == "" {
+		return fmt.Errorf("business account has no tenant")
+	}
+	existing, exists := s.businesses[account.WABAID]
+	if exists && existing.TenantID != account.TenantID {
+		return fmt.Errorf("WABA %s: %w", account.WABAID, ErrAccountClaimed)
+	}
 
 	account.UpdatedAt = time.Now()
 	if account.CreatedAt.IsZero() {
 		account.CreatedAt = time.Now()
 	}
 
-	s.businesses[account.WABAID] = account
+	stored := copyAccount(account)
+	if s.tokens != nil {
+		token, err := s.tokens.Encrypt(account.AccessToken)
+		if err != nil {
+			return fmt.Errorf("encrypt access token: %w", err)
+		}
+		stored.AccessToken = token
+	}
+	if exists {
+		// Compare plain tokens so an unchanged one is not audited as changed
+		if opened, err := s.open(existing); err == nil {
+			existing = opened
+		}
+	}
+
+	s.businesses[account.WABAID] = stored
+	if exists {
+		s.audit.Record(ctx, account.TenantID, models.AuditAccountUpdated, "business_account", account.WABAID, existing, account)
+	} else {
+		s.audit.Record(ctx, account.TenantID, models.AuditAccountCreated, "business_account", account.WABAID, nil, account)
+	}
 	return nil
 }
 
-func (s *StorageService) GetBusinessAccount(wabaID string) (*models.BusinessAccount, error) {
+// Ping reports whether storage is usable. The in-memory store always is
+// unless ctx is done; a database-backed one would round-trip here.
+func (s *StorageService) Ping(ctx context.Context) error {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
+	return ctx.Err()
+}
 
-	account, exists := s.businesses[wabaID]
-	if !exists {
+func (s *StorageService) GetBusinessAccount(tenantID, wabaID string) (*models.BusinessAccount, error) {
+	s.mutex.RLock()
+	stored, exists := s.businesses[wabaID]
+	if !exists || stored.TenantID != tenantID {
+		s.mutex.RUnlock()
 		return nil, fmt.Errorf("business account not found")
 	}
+	account, unreadable := s.openOrFlag(stored)
+	stale := !unreadable && s.stale(stored)
+	s.mutex.RUnlock()
 
+	if stale {
+		s.reseal([]string{wabaID})
+	}
 	return account, nil
 }
 
-func (s *StorageService) ListBusinessAccounts() ([]*models.BusinessAccount, error) {
+// ListBusinessAccounts lists a tenant's accounts. Accounts whose token can
+// no longer be decrypted are listed without it, flagged for
+// re-authorization.
+func (s *StorageService) ListBusinessAccounts(tenantID string) ([]*models.BusinessAccount, error) {
 	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	accounts := make([]*models.BusinessAccount, 0, len(s.businesses))
-	for _, account := range s.businesses {
-		accounts = append(accounts, account)
-	}
+	accounts, stale := s.openAll(func(account *models.BusinessAccount) bool {
+		return account.TenantID == tenantID
+	})
+	s.mutex.RUnlock()
 
+	s.reseal(stale)
 	return accounts, nil
 }
 
-func (s *StorageService) DeleteBusinessAccount(wabaID string) error {
+func (s *StorageService) DeleteBusinessAccount(ctx context.Context, tenantID, wabaID string) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	account, exists := s.businesses[wabaID]
+	if !exists || account.TenantID != tenantID {
+		return fmt.Errorf("business account not found")
+	}
 	delete(s.businesses, wabaID)
+	for key := range s.history {
+		if strings.HasPrefix(key, wabaID+"/") {
+			delete(s.history, key)
+		}
+	}
+	s.audit.Record(ctx, tenantID, models.AuditAccountDeleted, "business_account", wabaID, account, nil)
 	return nil
 }
 
-// Utility method to export data (for backup/migration)
-func (s *StorageService) ExportData() (string, error) {
+// ResolveTenant finds the tenant owning a webhook's phone number or WABA.
+// The phone number wins because it is the more specific identifier.
+func (s *StorageService) ResolveTenant(wabaID, phoneNumberID string) (string, bool) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	data, err := json.MarshalIndent(s.businesses, "", "  ")
+	if phoneNumberID != "" {
+		for _, account := range s.businesses {
+			for _, phone := range account.PhoneNumbers {
+				if phone.ID == phoneNumberID {
+					return account.TenantID, true
+				}
+			}
+		}
+	}
+	if account, exists := s.businesses[wabaID]; exists {
+		return account.TenantID, true
+	}
+	return "", false
+}
+
+// maxPhoneNumberHistory bounds the changes kept per phone number.
+const maxPhoneNumberHistory = 200
+
+// RecordPhoneNumberChanges appends to the history of the WABA's phone
+// numbers the changes are about. History outlives a number's removal from
+// the WABA, but not the account.
+func (s *StorageService) RecordPhoneNumberChanges(wabaID string, changes ...models.PhoneNumberChange) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, change := range changes {
+		key := phoneHistoryKey(wabaID, change.PhoneNumberID)
+		history := append(s.history[key], change)
+		if len(history) > maxPhoneNumberHistory {
+			history = append([]models.PhoneNumberChange(nil), history[len(history)-maxPhoneNumberHistory:]...)
+		}
+		s.history[key] = history
+	}
+}
+
+func phoneHistoryKey(wabaID, phoneNumberID string) string { return wabaID + "/" + phoneNumberID }
+
+// PhoneNumberHistory returns the recorded changes of a phone number of the
+// tenant's account, oldest first.
+func (s *StorageService) PhoneNumberHistory(tenantID, wabaID, phoneNumberID string) ([]models.PhoneNumberChange, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	account, exists := s.businesses[wabaID]
+	if !exists || account.TenantID != tenantID {
+		return nil, fmt.Errorf("business account not found")
+	}
+	history := s.history[phoneHistoryKey(wabaID, phoneNumberID)]
+	if !hasPhone(account, phoneNumberID) && len(history) == 0 {
+		return nil, fmt.Errorf("phone number not found")
+	}
+	return append([]models.PhoneNumberChange{}, history...), nil
+}
+
+// AllBusinessAccounts lists the accounts of every tenant, flagging those
+// whose token can no longer be decrypted like ListBusinessAccounts. It is
+// for background jobs; API reads stay tenant scoped.
+func (s *StorageService) AllBusinessAccounts() ([]*models.BusinessAccount, error) {
+	s.mutex.RLock()
+	accounts, stale := s.openAll(func(*models.BusinessAccount) bool { return true })
+	s.mutex.RUnlock()
+
+	s.reseal(stale)
+	return accounts, nil
+}
+
+// ExpiringTokens lists accounts of every tenant whose access token expires
+// before t and that do not already need re-authorization. It is for
+// background jobs; API reads stay tenant scoped.
+func (s *StorageService) ExpiringTokens(t time.Time) ([]*models.BusinessAccount, error) {
+	s.mutex.RLock()
+	expiring, stale := s.openAll(func(account *models.BusinessAccount) bool {
+		return !account.NeedsReauth && !account.TokenExpiresAt.IsZero() && account.TokenExpiresAt.Before(t)
+	})
+	s.mutex.RUnlock()
+
+	s.reseal(stale)
+	var accounts []*models.BusinessAccount
+	for _, account := range expiring {
+		if !account.NeedsReauth { // Tokens that no longer decrypt cannot be exchanged
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts, nil
+}
+
+// Utility method to export a tenant's data (for backup/migration).
+// Access tokens are left out unless withTokens is set.
+func (s *StorageService) ExportData(tenantID string, withTokens bool) (string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	tenantBusinesses := make(map[string]*models.BusinessAccount)
+	for wabaID, account := range s.businesses {
+		if account.TenantID != tenantID {
+			continue
+		}
+		if !withTokens {
+			redacted := *account
+			redacted.AccessToken = ""
+			account = &redacted
+		} else {
+			account, _ = s.openOrFlag(account)
+		}
+		tenantBusinesses[wabaID] = account
+	}
+
+	data, err := json.MarshalIndent(tenantBusinesses, "", "  ")
 	if err != nil {
 		return "", fmt.Errorf("failed to export data: %w", err)
 	}
 
 	return string(data), nil
 }
+
+// openAll opens the stored accounts keep selects. Callers hold the read
+// lock and pass the returned WABA IDs of stale tokens to reseal once they
+// have released it.
+func (s *StorageService) openAll(keep func(account *models.BusinessAccount) bool) (accounts []*models.BusinessAccount, stale []string) {
+	accounts = make([]*models.BusinessAccount, 0)
+	for wabaID, account := range s.businesses {
+		if !keep(account) {
+			continue
+		}
+		opened, unreadable := s.openOrFlag(account)
+		accounts = append(accounts, opened)
+		if !unreadable && s.stale(account) {
+			stale = append(stale, wabaID)
+		}
+	}
+	return accounts, stale
+}
+
+// openOrFlag opens a stored account. A token that cannot be decrypted, e.g.
+// because its key was retired, is left out and the account flagged for
+// re-authorization, so it can still be read, updated and deleted.
+func (s *StorageService) openOrFlag(account *models.BusinessAccount) (opened *models.BusinessAccount, unreadable bool) {
+	opened, err := s.open(account)
+	if err != nil {
+		slog.Warn("cannot decrypt stored access token, account needs re-authorization",
+			"tenant_id", account.TenantID, "waba_id", account.WABAID, "error", err)
+		opened = copyAccount(account)
+		opened.AccessToken = ""
+		opened.NeedsReauth = true
+		return opened, true
+	}
+	return opened, false
+}
+
+// stale reports whether a stored account's token is sealed with an older
+// key than the current one. Callers hold the lock.
+func (s *StorageService) stale(account *models.BusinessAccount) bool {
+	return s.tokens != nil && s.tokens.Stale(account.AccessToken)
+}
+
+// reseal re-encrypts the tokens of wabaIDs that are still stale with the
+// current key. The plain tokens do not change, so nothing is audited.
+func (s *StorageService) reseal(wabaIDs []string) {
+	if len(wabaIDs) == 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	resealed := 0
+	for _, wabaID := range wabaIDs {
+		stored, exists := s.businesses[wabaID]
+		if !exists || !s.stale(stored) {
+			continue // Saved or resealed since it was read
+		}
+		opened, err := s.open(stored)
+		if err != nil {
+			continue
+		}
+		token, err := s.tokens.Encrypt(opened.AccessToken)
+		if err != nil {
+			slog.Warn("failed to re-encrypt access token", "waba_id", wabaID, "error", err)
+			continue
+		}
+		updated := copyAccount(stored)
+		updated.AccessToken = token
+		s.businesses[wabaID] = updated
+		resealed++
+	}
+	if resealed > 0 {
+		slog.Info("re-encrypted access tokens with the current key", "accounts", resealed)
+	}
+}
+
+// open returns a copy of a stored account with its access token decrypted.
+// Tokens saved before encryption was enabled are returned as stored.
+func (s *StorageService) open(account *models.BusinessAccount) (*models.BusinessAccount, error) {
+	opened := copyAccount(account)
+	if s.tokens != nil {
+		token, err := s.tokens.Decrypt(account.AccessToken)
+		if err != nil {
+			return nil, fmt.Errorf("access token: %w", err)
+		}
+		opened.AccessToken = token
+	}
+	return opened, nil
+}
+
+func hasPhone(account *models.BusinessAccount, phoneNumberID string) bool {
+	for _, phone := range account.PhoneNumbers {
+		if phone.ID == phoneNumberID {
+			return true
+		}
+	}
+	return false
+}
+
+func copyAccount(account *models.BusinessAccount) *models.BusinessAccount {
+	copied := *account
+	copied.PhoneNumbers = append([]models.BusinessPhoneNumber(nil), account.PhoneNumbers...)
+	if account.Metadata != nil {
+		copied.Metadata = make(map[string]interface{}, len(account.Metadata))
+		for k, v := range account.Metadata {
+			copied.Metadata[k] = v
+		}
+	}
+	return &copied
+}
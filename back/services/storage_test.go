@@ -0,0 +1,122 @@
+package services
+
+import (
+	"back/models"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStorageScopesAccountsByTenant(t *testing.T) {
+	s := NewStorageService(NewAuditLog())
+	s.SaveBusinessAccount(context.Background(), &models.BusinessAccount{
+		TenantID:     "tenant-a",
+		WABAID:       "waba-1",
+		PhoneNumbers: []models.BusinessPhoneNumber{{ID: "pn-1"}},
+	})
+
+	if _, err := s.GetBusinessAccount("tenant-b", "waba-1"); err == nil {
+		t.Error("tenant-b can read tenant-a's account")
+	}
+	if accounts, _ := s.ListBusinessAccounts("tenant-b"); len(accounts) != 0 {
+		t.Errorf("tenant-b lists %d accounts", len(accounts))
+	}
+	if err := s.DeleteBusinessAccount(context.Background(), "tenant-b", "waba-1"); err == nil {
+		t.Error("tenant-b can delete tenant-a's account")
+	}
+
+	err := s.SaveBusinessAccount(context.Background(), &models.BusinessAccount{TenantID: "tenant-b", WABAID: "waba-1"})
+	if !errors.Is(err, ErrAccountClaimed) {
+		t.Errorf("claiming another tenant's WABA: err = %v", err)
+	}
+
+	if tenant, ok := s.ResolveTenant("", "pn-1"); !ok || tenant != "tenant-a" {
+		t.Errorf("ResolveTenant by phone = %q, %v", tenant, ok)
+	}
+	if tenant, ok := s.ResolveTenant("waba-1", "pn-unknown"); !ok || tenant != "tenant-a" {
+		t.Errorf("ResolveTenant by WABA = %q, %v", tenant, ok)
+	}
+	if _, ok := s.ResolveTenant("waba-2", ""); ok {
+		t.Error("ResolveTenant found an owner for an unknown WABA")
+	}
+}
+
+func TestStorageEncryptsAccessTokens(t *testing.T) {
+	s := NewStorageService(NewAuditLog())
+	s.EncryptTokensWith(NewTokenCipher(NewSecrets(mapProvider{TokenKeySecret: "key-1"}, noFallback)))
+	ctx := context.Background()
+	s.SaveBusinessAccount(ctx, &models.BusinessAccount{TenantID: "tenant-a", WABAID: "waba-1", AccessToken: "EAAsecret"})
+
+	if stored := s.businesses["waba-1"].AccessToken; !strings.HasPrefix(stored, encryptedTokenPrefix) {
+		t.Errorf("stored token = %q, want encrypted", stored)
+	}
+	account, err := s.GetBusinessAccount("tenant-a", "waba-1")
+	if err != nil || account.AccessToken != "EAAsecret" {
+		t.Fatalf("GetBusinessAccount = %+v, %v", account, err)
+	}
+	if accounts, _ := s.ListBusinessAccounts("tenant-a"); len(accounts) != 1 || accounts[0].AccessToken != "EAAsecret" {
+		t.Errorf("ListBusinessAccounts = %+v", accounts)
+	}
+	if export, _ := s.ExportData("tenant-a", true); !strings.Contains(export, `"EAAsecret"`) {
+		t.Errorf("export with tokens = %s", export)
+	}
+}
+
+func TestStorageReencryptsTokensAfterRotation(t *testing.T) {
+	provider := mapProvider{TokenKeySecret: "key-1"}
+	secrets := NewSecrets(provider, noFallback)
+	s := NewStorageService(NewAuditLog())
+	s.EncryptTokensWith(NewTokenCipher(secrets))
+	ctx := context.Background()
+	s.SaveBusinessAccount(ctx, &models.BusinessAccount{TenantID: "tenant-a", WABAID: "waba-1", AccessToken: "EAAone"})
+	s.SaveBusinessAccount(ctx, &models.BusinessAccount{TenantID: "tenant-a", WABAID: "waba-2", AccessToken: "EAAtwo"})
+	before := s.businesses["waba-1"].AccessToken
+
+	provider[TokenKeySecret], provider[PreviousTokenKeySecret] = "key-2", "key-1"
+	secrets.Refresh()
+	// Reading waba-1 re-encrypts it; waba-2 is left under the old key
+	if account, err := s.GetBusinessAccount("tenant-a", "waba-1"); err != nil || account.AccessToken != "EAAone" {
+		t.Fatalf("GetBusinessAccount = %+v, %v", account, err)
+	}
+	if after := s.businesses["waba-1"].AccessToken; after == before || s.tokens.Stale(after) {
+		t.Errorf("token not re-encrypted with the current key: %q", after)
+	}
+
+	// Once the old key is retired, the account read under it is fine and
+	// the other one is flagged instead of failing the list
+	delete(provider, PreviousTokenKeySecret)
+	secrets.Refresh()
+	accounts, err := s.ListBusinessAccounts("tenant-a")
+	if err != nil || len(accounts) != 2 {
+		t.Fatalf("ListBusinessAccounts = %+v, %v", accounts, err)
+	}
+	for _, account := range accounts {
+		retired := account.WABAID == "waba-2"
+		if account.NeedsReauth != retired || (account.AccessToken == "") != retired {
+			t.Errorf("%s: token %q, needs_reauth %v", account.WABAID, account.AccessToken, account.NeedsReauth)
+		}
+	}
+	if all, err := s.AllBusinessAccounts(); err != nil || len(all) != 2 {
+		t.Errorf("AllBusinessAccounts = %d accounts, %v", len(all), err)
+	}
+	if _, err := s.ExportData("tenant-a", true); err != nil {
+		t.Errorf("ExportData: %v", err)
+	}
+
+	// It can still be read, updated and deleted
+	if account, err := s.GetBusinessAccount("tenant-a", "waba-2"); err != nil || !account.NeedsReauth || account.AccessToken != "" {
+		t.Errorf("GetBusinessAccount = %+v, %v", account, err)
+	}
+	sealed := s.businesses["waba-2"].AccessToken
+	err = s.UpdateBusinessAccount(ctx, "tenant-a", "waba-2", func(account *models.BusinessAccount) error {
+		account.BusinessName = "Renamed"
+		return nil
+	})
+	if stored := s.businesses["waba-2"]; err != nil || stored.BusinessName != "Renamed" || !stored.NeedsReauth || stored.AccessToken != sealed {
+		t.Errorf("after update: %+v, %v", stored, err)
+	}
+	if err := s.DeleteBusinessAccount(ctx, "tenant-a", "waba-2"); err != nil {
+		t.Errorf("DeleteBusinessAccount: %v", err)
+	}
+}
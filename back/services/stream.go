@@ -0,0 +1,114 @@
+package services
+
+import (
+	"back/models"
+	"sync"
+)
+
+// StreamEvent is a normalized event with its position in the live stream.
+type StreamEvent struct {
+	Seq   uint64
+	Event models.Event
+}
+
+// EventStream fans events out to connected real-time clients and keeps a
+// bounded backlog so clients can resume from their last seen sequence.
+type EventStream struct {
+	backlog []StreamEvent // oldest first, at most size entries
+	size    int
+	seq     uint64
+	clients map[chan StreamEvent]struct{}
+	closed  bool
+	mutex   sync.Mutex
+}
+
+const streamClientBuffer = 64
+
+func NewEventStream(backlogSize int) *EventStream {
+	return &EventStream{
+		size:    backlogSize,
+		clients: make(map[chan StreamEvent]struct{}),
+	}
+}
+
+// HandleEvent assigns the next sequence number and delivers event to every
+// client. Clients that cannot keep up are disconnected and expected to
+// reconnect with their last sequence. It is an EventSubscriber.
+func (s *EventStream) HandleEvent(event models.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.seq++
+	se := StreamEvent{Seq: s.seq, Event: event}
+	s.backlog = append(s.backlog, se)
+	if len(s.backlog) > s.size {
+		s.backlog = append([]StreamEvent(nil), s.backlog[len(s.backlog)-s.size:]...)
+	}
+
+	for ch := range s.clients {
+		select {
+		case ch <- se:
+		default:
+			delete(s.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers a client. Events after lastSeq still in the backlog are
+// returned for immediate delivery; gap reports that some were already
+// evicted. Sequences are per process, so a lastSeq ahead of the stream (an
+// ID from before a restart or from another instance) is reported as a gap
+// too. The returned channel is closed by cancel, on overflow, or when the
+// stream is closed.
+func (s *EventStream) Subscribe(lastSeq uint64) (missed []StreamEvent, gap bool, events <-chan StreamEvent, cancel func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if lastSeq > 0 && lastSeq < s.seq {
+		for _, se := range s.backlog {
+			if se.Seq > lastSeq {
+				missed = append(missed, se)
+			}
+		}
+		gap = len(s.backlog) == 0 || s.backlog[0].Seq > lastSeq+1
+	} else if lastSeq > s.seq {
+		gap = true
+	}
+
+	ch := make(chan StreamEvent, streamClientBuffer)
+	if s.closed {
+		close(ch)
+		return missed, gap, ch, func() {}
+	}
+	s.clients[ch] = struct{}{}
+	cancel = func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if _, ok := s.clients[ch]; ok {
+			delete(s.clients, ch)
+			close(ch)
+		}
+	}
+	return missed, gap, ch, cancel
+}
+
+// Close disconnects every client and refuses new ones, so open streams end
+// and do not hold up a graceful shutdown. Clients reconnect elsewhere with
+// their Last-Event-ID.
+func (s *EventStream) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	for ch := range s.clients {
+		delete(s.clients, ch)
+		close(ch)
+	}
+}
+
+// Clients returns the number of connected clients.
+func (s *EventStream) Clients() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.clients)
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"back/models"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// In-memory tenant registry (replace with database in production)
+type TenantService struct {
+	tenants map[string]*models.Tenant
+	mutex   sync.RWMutex
+	seq     int64
+}
+
+// NewTenantService starts with the default (platform) tenant.
+func NewTenantService() *TenantService {
+	return &TenantService{
+		tenants: map[string]*models.Tenant{
+			models.DefaultTenantID: {ID: models.DefaultTenantID, Name: "Default", CreatedAt: time.Now()},
+		},
+	}
+}
+
+func (t *TenantService) CreateTenant(name string) (*models.Tenant, error) {
+	if name == "" {
+		return nil, fmt.Errorf("tenant name is required")
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.seq++
+	now := time.Now()
+	tenant := &models.Tenant{
+		ID:        fmt.Sprintf("tn_%d_%d", now.Unix(), t.seq),
+		Name:      name,
+		CreatedAt: now,
+	}
+	t.tenants[tenant.ID] = tenant
+
+	copied := *tenant
+	return &copied, nil
+}
+
+func (t *TenantService) GetTenant(id string) (*models.Tenant, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	tenant, exists := t.tenants[id]
+	if !exists {
+		return nil, fmt.Errorf("tenant not found")
+	}
+	copied := *tenant
+	return &copied, nil
+}
+
+func (t *TenantService) ListTenants() ([]*models.Tenant, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	tenants := make([]*models.Tenant, 0, len(t.tenants))
+	for _, tenant := range t.tenants {
+		copied := *tenant
+		tenants = append(tenants, &copied)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].CreatedAt.Before(tenants[j].CreatedAt) })
+	return tenants, nil
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CertReloader serves a TLS certificate pair from disk and picks up
+// replacements without a restart. A pair that fails to load is ignored and
+// the previous certificate stays in use.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+	mutex    sync.Mutex // serializes reloads
+	seen     [2]fileStamp
+}
+
+// fileStamp identifies a version of a file on disk.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewCertReloader loads the initial certificate pair.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	c := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// Reload reads the pair from disk unconditionally.
+func (c *CertReloader) Reload() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stamps, err := c.stat()
+	if err != nil {
+		return err
+	}
+	return c.load(stamps)
+}
+
+// reloadIfChanged reloads the pair when either file was modified since the
+// last load. Rotations that replace the cert and key one after the other
+// may fail to load in between; the next poll retries.
+func (c *CertReloader) reloadIfChanged() (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stamps, err := c.stat()
+	if err != nil {
+		return false, err
+	}
+	if stamps == c.seen {
+		return false, nil
+	}
+	return true, c.load(stamps)
+}
+
+func (c *CertReloader) stat() ([2]fileStamp, error) {
+	var stamps [2]fileStamp
+	for i, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return stamps, err
+		}
+		stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
+
+func (c *CertReloader) load(stamps [2]fileStamp) error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("parse TLS certificate: %w", err)
+		}
+	}
+	c.cert.Store(&cert)
+	c.seen = stamps
+	return nil
+}
+
+// Watch polls the files every interval and reloads them on change until ctx
+// is done. With no interval files are only reloaded on SIGHUP.
+func (c *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reloaded, err := c.reloadIfChanged()
+		if err != nil {
+			slog.Error("TLS certificate reload failed, keeping the current certificate", "cert_file", c.certFile, "error", err)
+			continue
+		}
+		if reloaded {
+			slog.Info("TLS certificate reloaded", "cert_file", c.certFile, "not_after", c.NotAfter())
+		}
+	}
+}
+
+// NotAfter returns the expiry of the certificate being served.
+func (c *CertReloader) NotAfter() time.Time {
+	return c.cert.Load().Leaf.NotAfter
+}
+
+// ExpiryCheck fails once the served certificate expires within the given
+// window, so a rotation that never happened shows up before clients break.
+func (c *CertReloader) ExpiryCheck(within time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		notAfter := c.NotAfter()
+		switch left := time.Until(notAfter); {
+		case left <= 0:
+			return errors.New("TLS certificate expired at " + notAfter.UTC().Format(time.RFC3339))
+		case left < within:
+			return fmt.Errorf("TLS certificate expires at %s", notAfter.UTC().Format(time.RFC3339))
+		}
+		return nil
+	}
+}
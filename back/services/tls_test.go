@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate with the given serial and
+// lifetime to dir.
+func writeTestCert(t *testing.T, dir string, serial int64, validFor time.Duration) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	// Make the rewrite visible even on filesystems with coarse timestamps
+	stamp := time.Now().Add(time.Duration(serial) * time.Second)
+	os.Chtimes(certFile, stamp, stamp)
+	os.Chtimes(keyFile, stamp, stamp)
+	return certFile, keyFile
+}
+
+func servedSerial(t *testing.T, c *CertReloader) int64 {
+	t.Helper()
+	cert, err := c.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestCertReloaderPicksUpRotation(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, 1, 90*24*time.Hour)
+	c, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reloaded, err := c.reloadIfChanged(); reloaded || err != nil {
+		t.Errorf("unchanged files: reloaded=%v err=%v", reloaded, err)
+	}
+
+	writeTestCert(t, dir, 2, 90*24*time.Hour)
+	if reloaded, err := c.reloadIfChanged(); !reloaded || err != nil {
+		t.Fatalf("rotated files: reloaded=%v err=%v", reloaded, err)
+	}
+	if got := servedSerial(t, c); got != 2 {
+		t.Errorf("serving serial %d after rotation, want 2", got)
+	}
+
+	// A broken rotation keeps the last good certificate
+	os.WriteFile(certFile, []byte("not a certificate"), 0o600)
+	if _, err := c.reloadIfChanged(); err == nil {
+		t.Error("expected an error for an invalid certificate")
+	}
+	if got := servedSerial(t, c); got != 2 {
+		t.Errorf("serving serial %d after failed reload, want 2", got)
+	}
+}
+
+func TestCertReloaderExpiryCheck(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir(), 1, 24*time.Hour)
+	c, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ExpiryCheck(time.Hour)(context.Background()); err != nil {
+		t.Errorf("certificate valid for a day: %v", err)
+	}
+	if err := c.ExpiryCheck(14 * 24 * time.Hour)(context.Background()); err == nil {
+		t.Error("expected a failure for a certificate expiring within the window")
+	}
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	if _, err := NewCertReloader("/nonexistent/cert.pem", "/nonexistent/key.pem"); err == nil {
+		t.Error("expected an error for missing files")
+	}
+}
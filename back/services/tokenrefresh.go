@@ -0,0 +1,205 @@
+package services
+
+import (
+	"back/config"
+	"back/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// errTokenReplaced aborts a refresh whose account was re-onboarded with a
+// new token while the refresh was in flight.
+var errTokenReplaced = errors.New("access token was replaced")
+
+// Token refresh outcomes, as counted in metrics
+const (
+	tokenRefreshed      = "refreshed"
+	tokenRefreshFailed  = "failed"
+	tokenReauthRequired = "reauth_required"
+)
+
+// expiryAlertInterval limits how often a token that keeps failing to
+// refresh is announced as expiring.
+const expiryAlertInterval = 24 * time.Hour
+
+// TokenRefresher keeps business access tokens from expiring. It extends
+// tokens that expire within the refresh window and marks accounts whose
+// token cannot be extended as needing re-authorization. Each outcome is
+// published as an event, which reaches the frontend through the event
+// stream so it can prompt the business to redo Embedded Signup.
+type TokenRefresher struct {
+	config   *config.Config
+	facebook *FacebookService
+	storage  *StorageService
+	events   *EventBus
+	metrics  *Metrics
+	alerted  map[string]time.Time // WABA ID -> last expiring alert
+	mutex    sync.Mutex           // serializes runs
+	now      func() time.Time
+}
+
+func NewTokenRefresher(cfg *config.Config, facebook *FacebookService, storage *StorageService, events *EventBus, metrics *Metrics) *TokenRefresher {
+	return &TokenRefresher{
+		config:   cfg,
+		facebook: facebook,
+		storage:  storage,
+		events:   events,
+		metrics:  metrics,
+		alerted:  make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Run refreshes expiring tokens at once and then every interval until ctx
+// is done.
+func (r *TokenRefresher) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.RefreshExpiring(ctx); err != nil {
+			slog.Error("token refresh run failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RefreshExpiring handles every account whose token expires within the
+// refresh window. Failures are per account and do not stop the run.
+func (r *TokenRefresher) RefreshExpiring(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	accounts, err := r.storage.ExpiringTokens(r.now().Add(r.config.TokenRefreshWindow))
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r.refresh(ctx, account)
+	}
+	return nil
+}
+
+func (r *TokenRefresher) refresh(ctx context.Context, account *models.BusinessAccount) {
+	log := slog.With("tenant_id", account.TenantID, "waba_id", account.WABAID)
+	app, ok := r.config.FindMetaApp(account.AppID, "")
+	if !ok {
+		r.requireReauth(ctx, account, "the Meta app the account onboarded through is no longer configured")
+		return
+	}
+
+	tokenResp, err := r.facebook.ExtendToken(ctx, app, account.AccessToken)
+	var graphErr *GraphError
+	switch {
+	case err == nil:
+	case errors.As(err, &graphErr) && graphErr.TokenInvalid():
+		r.requireReauth(ctx, account, "the access token expired or was revoked")
+		return
+	case !account.TokenExpiresAt.After(r.now()):
+		r.requireReauth(ctx, account, "the access token expired before it could be refreshed")
+		return
+	default:
+		log.Warn("token refresh failed, retrying on the next run", "expires_at", account.TokenExpiresAt, "error", err)
+		r.metrics.TokenRefresh(tokenRefreshFailed)
+		if last, ok := r.alerted[account.WABAID]; !ok || r.now().Sub(last) >= expiryAlertInterval {
+			r.alerted[account.WABAID] = r.now()
+			r.publish(models.EventTokenExpiring, account, "the access token could not be refreshed yet")
+		}
+		return
+	}
+
+	refreshed := r.now()
+	err = r.storage.UpdateBusinessAccount(ctx, account.TenantID, account.WABAID, func(stored *models.BusinessAccount) error {
+		if stored.AccessToken != account.AccessToken {
+			return errTokenReplaced
+		}
+		stored.AccessToken = tokenResp.AccessToken
+		stored.TokenExpiresAt = TokenExpiry(refreshed, tokenResp.ExpiresIn)
+		stored.TokenRefreshedAt = refreshed
+		*account = *stored
+		return nil
+	})
+	if errors.Is(err, errTokenReplaced) {
+		log.Info("skipped token refresh, account was re-onboarded meanwhile")
+		return
+	}
+	if err != nil {
+		log.Error("failed to store refreshed token", "error", err)
+		r.metrics.TokenRefresh(tokenRefreshFailed)
+		return
+	}
+	delete(r.alerted, account.WABAID)
+	log.Info("access token refreshed", "expires_at", account.TokenExpiresAt)
+	r.metrics.TokenRefresh(tokenRefreshed)
+	r.publish(models.EventTokenRefreshed, account, "")
+}
+
+func (r *TokenRefresher) requireReauth(ctx context.Context, account *models.BusinessAccount, reason string) {
+	err := r.storage.UpdateBusinessAccount(ctx, account.TenantID, account.WABAID, func(stored *models.BusinessAccount) error {
+		if stored.AccessToken != account.AccessToken {
+			return errTokenReplaced
+		}
+		stored.NeedsReauth = true
+		stored.ReauthReason = reason
+		*account = *stored
+		return nil
+	})
+	if errors.Is(err, errTokenReplaced) {
+		return
+	}
+	if err != nil {
+		slog.Error("failed to mark account for re-authorization", "tenant_id", account.TenantID, "waba_id", account.WABAID, "error", err)
+		return
+	}
+	delete(r.alerted, account.WABAID)
+	slog.Warn("account needs re-authorization", "tenant_id", account.TenantID, "waba_id", account.WABAID, "reason", reason)
+	r.metrics.TokenRefresh(tokenReauthRequired)
+	r.publish(models.EventReauthRequired, account, reason)
+}
+
+// tokenEvent is the data of token lifecycle events.
+type tokenEvent struct {
+	WABAID         string     `json:"waba_id"`
+	BusinessName   string     `json:"business_name"`
+	TokenExpiresAt *time.Time `json:"token_expires_at,omitempty"`
+	Reason         string     `json:"reason,omitempty"`
+}
+
+func (r *TokenRefresher) publish(eventType string, account *models.BusinessAccount, reason string) {
+	data := tokenEvent{WABAID: account.WABAID, BusinessName: account.BusinessName, Reason: reason}
+	if !account.TokenExpiresAt.IsZero() {
+		data.TokenExpiresAt = &account.TokenExpiresAt
+	}
+	body, _ := json.Marshal(data)
+	r.events.Publish(models.Event{
+		ID:         eventID(eventType, account.WABAID, append(body, r.now().Format(time.RFC3339Nano)...)),
+		Type:       eventType,
+		TenantID:   account.TenantID,
+		AppID:      account.AppID,
+		WABAID:     account.WABAID,
+		OccurredAt: r.now(),
+		Data:       body,
+	})
+}
+
+// TokenExpiry converts an expires_in from Meta into an expiry time. Zero
+// means the token does not expire, as for system user tokens.
+func TokenExpiry(issued time.Time, expiresIn int) time.Time {
+	if expiresIn <= 0 {
+		return time.Time{}
+	}
+	return issued.Add(time.Duration(expiresIn) * time.Second)
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"back/fakegraph"
+	"back/models"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokenRefresher(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	cfg := newTestConfig(graph)
+	cfg.TokenRefreshWindow = 7 * 24 * time.Hour
+	storage := NewStorageService(NewAuditLog())
+	bus := NewEventBus()
+	var events []models.Event
+	bus.Subscribe(func(e models.Event) { events = append(events, e) })
+	refresher := NewTokenRefresher(cfg, NewFacebookService(cfg, nil, nil), storage, bus, nil)
+
+	ctx := context.Background()
+	now := time.Now()
+	expiring, revoked, fresh := graph.IssueToken(), graph.IssueToken(), graph.IssueToken()
+	graph.RevokeToken(revoked)
+	for waba, account := range map[string]models.BusinessAccount{
+		"waba-expiring": {AccessToken: expiring, TokenExpiresAt: now.Add(24 * time.Hour)},
+		"waba-revoked":  {AccessToken: revoked, TokenExpiresAt: now.Add(time.Hour)},
+		"waba-fresh":    {AccessToken: fresh, TokenExpiresAt: now.Add(30 * 24 * time.Hour)},
+		"waba-system":   {AccessToken: fresh}, // System user tokens do not expire
+	} {
+		account.TenantID, account.WABAID = "tenant-a", waba
+		storage.SaveBusinessAccount(ctx, &account)
+	}
+
+	if err := refresher.RefreshExpiring(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	account, _ := storage.GetBusinessAccount("tenant-a", "waba-expiring")
+	if account.AccessToken == expiring || account.TokenExpiresAt.Before(now.Add(50*24*time.Hour)) || account.TokenRefreshedAt.IsZero() {
+		t.Errorf("expiring account not refreshed: %+v", account)
+	}
+	account, _ = storage.GetBusinessAccount("tenant-a", "waba-revoked")
+	if !account.NeedsReauth || account.ReauthReason == "" {
+		t.Errorf("revoked account not marked for re-authorization: %+v", account)
+	}
+	for _, waba := range []string{"waba-fresh", "waba-system"} {
+		if account, _ = storage.GetBusinessAccount("tenant-a", waba); account.AccessToken != fresh || account.NeedsReauth {
+			t.Errorf("%s changed: %+v", waba, account)
+		}
+	}
+	types := map[string]string{}
+	for _, e := range events {
+		types[e.WABAID] = e.Type
+	}
+	if types["waba-expiring"] != models.EventTokenRefreshed || types["waba-revoked"] != models.EventReauthRequired || len(events) != 2 {
+		t.Errorf("events = %v", types)
+	}
+
+	// Accounts needing re-authorization are left alone until re-onboarded
+	events = nil
+	refresher.RefreshExpiring(ctx)
+	if len(events) != 0 {
+		t.Errorf("second run published %d events", len(events))
+	}
+}
+
+func TestTokenRefresherAlertsOnTransientFailure(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	cfg := newTestConfig(graph)
+	cfg.TokenRefreshWindow = 7 * 24 * time.Hour
+	storage := NewStorageService(NewAuditLog())
+	bus := NewEventBus()
+	var events []models.Event
+	bus.Subscribe(func(e models.Event) { events = append(events, e) })
+	refresher := NewTokenRefresher(cfg, NewFacebookService(cfg, nil, nil), storage, bus, nil)
+
+	ctx := context.Background()
+	token := graph.IssueToken()
+	storage.SaveBusinessAccount(ctx, &models.BusinessAccount{TenantID: "tenant-a", WABAID: "waba-1", AccessToken: token, TokenExpiresAt: time.Now().Add(time.Hour)})
+	graph.Fail(fakegraph.RouteOAuth, fakegraph.Failure{Status: http.StatusInternalServerError, Code: 2, Type: "OAuthException", Message: "Service temporarily unavailable"})
+
+	refresher.RefreshExpiring(ctx)
+	refresher.RefreshExpiring(ctx)
+	if len(events) != 1 || events[0].Type != models.EventTokenExpiring {
+		t.Fatalf("events = %+v, want one token_expiring alert", events)
+	}
+	if account, _ := storage.GetBusinessAccount("tenant-a", "waba-1"); account.NeedsReauth || account.AccessToken != token {
+		t.Errorf("account changed on a transient failure: %+v", account)
+	}
+
+	// Once the token has expired a failure means re-authorization
+	refresher.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	refresher.RefreshExpiring(ctx)
+	if account, _ := storage.GetBusinessAccount("tenant-a", "waba-1"); !account.NeedsReauth {
+		t.Errorf("expired account not marked for re-authorization: %+v", account)
+	}
+}
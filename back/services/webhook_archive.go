@@ -0,0 +1,184 @@
+package services
+
+import (
+	"back/models"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WebhookEventFilter narrows WebhookArchive.Search. Zero values match everything.
+type WebhookEventFilter struct {
+	TenantID      string
+	WABAID        string
+	PhoneNumberID string
+	Field         string
+	Outcome       string
+	Since         time.Time
+	Until         time.Time
+	Limit         int
+}
+
+// maxRejectedWebhooks bounds the rejected deliveries kept.
+const maxRejectedWebhooks = 100
+
+// In-memory archive of raw webhook bodies (replace with database in production).
+// Oldest records are evicted once maxEvents is reached. Rejected deliveries
+// are kept apart, without their bodies, so they cannot evict real ones.
+type WebhookArchive struct {
+	events    map[string]*models.WebhookEventRecord
+	order     []string
+	maxEvents int
+	seq       int64
+	rejected  []models.RejectedWebhook // Oldest first
+	mutex     sync.RWMutex
+}
+
+func NewWebhookArchive(maxEvents int) *WebhookArchive {
+	return &WebhookArchive{
+		events:    make(map[string]*models.WebhookEventRecord),
+		maxEvents: maxEvents,
+	}
+}
+
+// Save stores a copy of a new record, assigning its ID.
+func (a *WebhookArchive) Save(record *models.WebhookEventRecord) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.seq++
+	record.ID = fmt.Sprintf("whe_%d_%d", record.ReceivedAt.Unix(), a.seq)
+	copied := *record
+	a.events[record.ID] = &copied
+	a.order = append(a.order, record.ID)
+
+	if a.maxEvents > 0 && len(a.order) > a.maxEvents {
+		evict := a.order[:len(a.order)-a.maxEvents]
+		for _, id := range evict {
+			delete(a.events, id)
+		}
+		a.order = append([]string(nil), a.order[len(evict):]...)
+	}
+	return nil
+}
+
+// Update replaces a stored record, e.g. after replaying it. The replay
+// count and time are kept as stored; RecordReplay owns them.
+func (a *WebhookArchive) Update(record *models.WebhookEventRecord) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stored, exists := a.events[record.ID]
+	if !exists {
+		return fmt.Errorf("webhook event not found")
+	}
+	copied := *record
+	copied.ReplayCount, copied.LastReplayedAt = stored.ReplayCount, stored.LastReplayedAt
+	a.events[record.ID] = &copied
+	return nil
+}
+
+// RecordReplay counts a replay of a stored record and returns a copy
+// carrying the new count, so concurrent replays each count once.
+func (a *WebhookArchive) RecordReplay(id string, at time.Time) (*models.WebhookEventRecord, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	record, exists := a.events[id]
+	if !exists {
+		return nil, fmt.Errorf("webhook event not found")
+	}
+	record.ReplayCount++
+	record.LastReplayedAt = &at
+	copied := *record
+	return &copied, nil
+}
+
+func (a *WebhookArchive) Get(id string) (*models.WebhookEventRecord, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	record, exists := a.events[id]
+	if !exists {
+		return nil, fmt.Errorf("webhook event not found")
+	}
+	copied := *record
+	return &copied, nil
+}
+
+// Search returns matching records, newest first.
+func (a *WebhookArchive) Search(filter WebhookEventFilter) ([]*models.WebhookEventRecord, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	var out []*models.WebhookEventRecord
+	for i := len(a.order) - 1; i >= 0; i-- {
+		record := a.events[a.order[i]]
+		if !filter.matches(record) {
+			continue
+		}
+		copied := *record
+		out = append(out, &copied)
+		if filter.Limit > 0 && len(out) >= filter.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (f WebhookEventFilter) matches(r *models.WebhookEventRecord) bool {
+	if f.TenantID != "" && r.TenantID != f.TenantID {
+		return false
+	}
+	if f.WABAID != "" && !contains(r.WABAIDs, f.WABAID) {
+		return false
+	}
+	if f.PhoneNumberID != "" && !contains(r.PhoneNumberIDs, f.PhoneNumberID) {
+		return false
+	}
+	if f.Field != "" && !contains(r.Fields, f.Field) {
+		return false
+	}
+	if f.Outcome != "" && r.Outcome != f.Outcome {
+		return false
+	}
+	if !f.Since.IsZero() && r.ReceivedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && r.ReceivedAt.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Reject records a delivery that was refused before archiving.
+func (a *WebhookArchive) Reject(rejected models.RejectedWebhook) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.rejected = append(a.rejected, rejected)
+	if len(a.rejected) > maxRejectedWebhooks {
+		a.rejected = append([]models.RejectedWebhook(nil), a.rejected[len(a.rejected)-maxRejectedWebhooks:]...)
+	}
+}
+
+// Rejected returns the recent rejected deliveries, newest first.
+func (a *WebhookArchive) Rejected() []models.RejectedWebhook {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	out := make([]models.RejectedWebhook, len(a.rejected))
+	for i, rejected := range a.rejected {
+		out[len(out)-1-i] = rejected
+	}
+	return out
+}
@@ -4,32 +4,41 @@ import (
 	"back/config"
 	"back/models"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 type WhatsAppService struct {
 	config   *config.Config
 	client   *http.Client
 	facebook *FacebookService
+	metrics  *Metrics
 }
 
-func NewWhatsAppService(cfg *config.Config, facebook *FacebookService) *WhatsAppService {
+func NewWhatsAppService(cfg *config.Config, facebook *FacebookService, metrics *Metrics) *WhatsAppService {
 	return &WhatsAppService{
 		config:   cfg,
 		client:   &http.Client{},
 		facebook: facebook,
+		metrics:  metrics,
 	}
 }
 
+// graphURL builds a versioned Graph API URL against the configured host.
+func (w *WhatsAppService) graphURL(path string) string {
+	return strings.TrimRight(w.config.GraphAPIBaseURL, "/") + "/v23.0/" + path
+}
+
 // Setup webhooks for a WABA
-func (w *WhatsAppService) SetupWebhooks(accessToken, wabaID string) error {
+func (w *WhatsAppService) SetupWebhooks(ctx context.Context, accessToken, wabaID string) error {
 	if w.config.WebhookCallbackURL == "" {
 		return fmt.Errorf("webhook callback URL not configured")
 	}
 
-	url := fmt.Sprintf("https://graph.facebook.com/v23.0/%s/subscribed_apps", wabaID)
+	url := w.graphURL(wabaID + "/subscribed_apps")
 
 	payload := map[string]interface{}{
 		"subscribed_fields": []string{
@@ -55,22 +64,43 @@ func (w *WhatsAppService) SetupWebhooks(accessToken, wabaID string) error {
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := w.client.Do(req)
+	resp, err := doGraph(ctx, w.client, w.metrics, req)
 	if err != nil {
 		return fmt.Errorf("webhook setup request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("webhook setup failed with status %d", resp.StatusCode)
+		return fmt.Errorf("webhook setup failed: %w", readGraphError(resp.StatusCode, resp.Body))
 	}
 
 	return nil
 }
 
 // Get business profile information
-func (w *WhatsAppService) GetBusinessProfile(accessToken, phoneNumberID string) (map[string]interface{}, error) {
-	url := fmt.Sprintf("https://graph.facebook.com/v23.0/%s/whatsapp_business_profile", phoneNumberID)
+// UnsubscribeWebhooks removes our app from the WABA's webhook subscriptions.
+func (w *WhatsAppService) UnsubscribeWebhooks(ctx context.Context, accessToken, wabaID string) error {
+	req, err := http.NewRequest("DELETE", w.graphURL(wabaID+"/subscribed_apps"), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := doGraph(ctx, w.client, w.metrics, req)
+	if err != nil {
+		return fmt.Errorf("webhook unsubscribe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook unsubscribe failed: %w", readGraphError(resp.StatusCode, resp.Body))
+	}
+
+	return nil
+}
+
+func (w *WhatsAppService) GetBusinessProfile(ctx context.Context, accessToken, phoneNumberID string) (map[string]interface{}, error) {
+	url := w.graphURL(phoneNumberID + "/whatsapp_business_profile")
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -78,7 +108,7 @@ func (w *WhatsAppService) GetBusinessProfile(accessToken, phoneNumberID string)
 	}
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	resp, err := w.client.Do(req)
+	resp, err := doGraph(ctx, w.client, w.metrics, req)
 	if err != nil {
 		return nil, fmt.Errorf("business profile request failed: %w", err)
 	}
@@ -100,8 +130,15 @@ func (w *WhatsAppService) GetBusinessProfile(accessToken, phoneNumberID string)
 }
 
 // Send a test message (for verification)
-func (w *WhatsAppService) SendTestMessage(accessToken, phoneNumberID, recipientNumber, message string) error {
-	url := fmt.Sprintf("https://graph.facebook.com/v23.0/%s/messages", phoneNumberID)
+func (w *WhatsAppService) SendTestMessage(ctx context.Context, accessToken, phoneNumberID, recipientNumber, message string) error {
+	_, err := w.SendTextMessage(ctx, accessToken, phoneNumberID, recipientNumber, message)
+	return err
+}
+
+// SendTextMessage sends a text message from phoneNumberID and returns the
+// WhatsApp message ID ("wamid...") that status webhooks will refer to.
+func (w *WhatsAppService) SendTextMessage(ctx context.Context, accessToken, phoneNumberID, recipientNumber, message string) (string, error) {
+	url := w.graphURL(phoneNumberID + "/messages")
 
 	payload := map[string]interface{}{
 		"messaging_product": "whatsapp",
@@ -114,33 +151,45 @@ func (w *WhatsAppService) SendTestMessage(accessToken, phoneNumberID, recipientN
 
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal message payload: %w", err)
+		return "", fmt.Errorf("failed to marshal message payload: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := w.client.Do(req)
+	resp, err := doGraph(ctx, w.client, w.metrics, req)
 	if err != nil {
-		return fmt.Errorf("send message request failed: %w", err)
+		return "", fmt.Errorf("send message request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("send message failed with status %d", resp.StatusCode)
+		return "", fmt.Errorf("send message failed: %w", readGraphError(resp.StatusCode, resp.Body))
 	}
 
-	return nil
+	var result struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode send message response: %w", err)
+	}
+	if len(result.Messages) == 0 {
+		return "", fmt.Errorf("send message response has no message ID")
+	}
+
+	return result.Messages[0].ID, nil
 }
 
 // ListTemplates fetches all message templates for a WABA.
-func (w *WhatsAppService) ListTemplates(accessToken, wabaID string) ([]models.WhatsAppTemplate, error) {
-	base := fmt.Sprintf("https://graph.facebook.com/v23.0/%s/message_templates", wabaID)
+func (w *WhatsAppService) ListTemplates(ctx context.Context, accessToken, wabaID string) ([]models.WhatsAppTemplate, error) {
+	base := w.graphURL(wabaID + "/message_templates")
 	fields := "id,name,language,status,category,quality_score"
 	url := fmt.Sprintf("%s?fields=%s&limit=100", base, fields)
 
@@ -152,14 +201,14 @@ func (w *WhatsAppService) ListTemplates(accessToken, wabaID string) ([]models.Wh
 
 	var out []models.WhatsAppTemplate
 	for {
-		resp, err := w.client.Do(req)
+		resp, err := doGraph(ctx, w.client, w.metrics, req)
 		if err != nil {
 			return nil, fmt.Errorf("templates request failed: %w", err)
 		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("templates failed (%s)", resp.Status)
+			return nil, fmt.Errorf("templates failed: %w", readGraphError(resp.StatusCode, resp.Body))
 		}
 
 		var body struct {
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"back/fakegraph"
+	"back/models"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func newTestWhatsApp(graph *fakegraph.Server) *WhatsAppService {
+	cfg := newTestConfig(graph)
+	return NewWhatsAppService(cfg, NewFacebookService(cfg, nil, nil), nil)
+}
+
+func TestSetupWebhooks(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	token := graph.IssueToken()
+	graph.AddPhoneNumber("waba-1", models.FacebookPhoneNumber{ID: "pn-1"})
+
+	wa := newTestWhatsApp(graph)
+	if err := wa.SetupWebhooks(context.Background(), token, "waba-1"); err != nil {
+		t.Fatalf("SetupWebhooks: %v", err)
+	}
+	subscribed, fields := graph.Subscribed("waba-1")
+	if !subscribed {
+		t.Fatal("app not subscribed to WABA")
+	}
+	if len(fields) == 0 || fields[0] != "messages" {
+		t.Errorf("subscribed fields = %v", fields)
+	}
+}
+
+func TestSetupWebhooksFailure(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	token := graph.IssueToken()
+	graph.AddPhoneNumber("waba-1", models.FacebookPhoneNumber{ID: "pn-1"})
+	graph.Fail(fakegraph.RouteSubscribedApps, fakegraph.Failure{Status: 403, Code: 200, Message: "Permissions error"})
+
+	if err := newTestWhatsApp(graph).SetupWebhooks(context.Background(), token, "waba-1"); err == nil {
+		t.Fatal("expected error")
+	}
+	if subscribed, _ := graph.Subscribed("waba-1"); subscribed {
+		t.Error("WABA subscribed despite failure")
+	}
+}
+
+func TestGetBusinessProfile(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	token := graph.IssueToken()
+	graph.SetBusinessProfile("pn-1", map[string]interface{}{"about": "Hello", "vertical": "RETAIL"})
+
+	wa := newTestWhatsApp(graph)
+	profile, err := wa.GetBusinessProfile(context.Background(), token, "pn-1")
+	if err != nil {
+		t.Fatalf("GetBusinessProfile: %v", err)
+	}
+	if profile["vertical"] != "RETAIL" {
+		t.Errorf("profile = %v", profile)
+	}
+
+	empty, err := wa.GetBusinessProfile(context.Background(), token, "pn-2")
+	if err != nil || len(empty) != 0 {
+		t.Errorf("GetBusinessProfile(no profile) = %v, %v", empty, err)
+	}
+}
+
+func TestSendTestMessage(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	token := graph.IssueToken()
+
+	wa := newTestWhatsApp(graph)
+	if err := wa.SendTestMessage(context.Background(), token, "pn-1", "15550100", "hi"); err != nil {
+		t.Fatalf("SendTestMessage: %v", err)
+	}
+	msgs := graph.Messages()
+	if len(msgs) != 1 || msgs[0].PhoneNumberID != "pn-1" || msgs[0].To != "15550100" || msgs[0].Type != "text" {
+		t.Errorf("messages = %+v", msgs)
+	}
+
+	graph.Fail(fakegraph.RouteMessages, fakegraph.Failure{Status: 429, Code: 130429, Message: "Rate limit hit", Times: 1})
+	if err := wa.SendTestMessage(context.Background(), token, "pn-1", "15550100", "hi"); err == nil {
+		t.Error("expected error on throughput failure")
+	}
+}
+
+func TestListTemplatesFollowsPaging(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+	graph.PageSize = 2
+	token := graph.IssueToken()
+	for i := 0; i < 5; i++ {
+		graph.AddTemplate("waba-1", models.WhatsAppTemplate{ID: fmt.Sprint(i), Name: fmt.Sprintf("tmpl_%d", i), Language: "en_US", Status: "APPROVED"})
+	}
+
+	templates, err := newTestWhatsApp(graph).ListTemplates(context.Background(), token, "waba-1")
+	if err != nil {
+		t.Fatalf("ListTemplates: %v", err)
+	}
+	if len(templates) != 5 {
+		t.Errorf("got %d templates, want 5", len(templates))
+	}
+	if n := graph.RequestCount(fakegraph.RouteTemplates); n != 3 {
+		t.Errorf("template requests = %d, want 3", n)
+	}
+}
+
+func TestListTemplatesInvalidToken(t *testing.T) {
+	graph := fakegraph.New()
+	defer graph.Close()
+
+	if _, err := newTestWhatsApp(graph).ListTemplates(context.Background(), "bogus", "waba-1"); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,378 @@
+// Package webhooksim generates realistic WhatsApp Business webhook payloads
+// and delivers them, signed, to a running backend.
+package webhooksim
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Params identifies the account the simulated events belong to.
+type Params struct {
+	WABAID             string
+	PhoneNumberID      string
+	DisplayPhoneNumber string
+	From               string // customer wa_id for inbound messages
+	ContactName        string
+	Now                time.Time
+}
+
+// DefaultParams returns a consistent fake account usable against a fresh backend.
+func DefaultParams() Params {
+	return Params{
+		WABAID:             "102290129340398",
+		PhoneNumberID:      "106540352242922",
+		DisplayPhoneNumber: "15550783881",
+		From:               "16505551234",
+		ContactName:        "Sim Customer",
+	}
+}
+
+// EventType describes a generator for one webhook event shape.
+type EventType struct {
+	Name        string
+	Field       string
+	Description string
+	value       func(p Params, seq int) map[string]interface{}
+}
+
+var eventTypes = []EventType{
+	// Inbound messages
+	{"message.text", "messages", "Inbound text message", func(p Params, n int) map[string]interface{} {
+		return inbound(p, n, "text", map[string]interface{}{"body": fmt.Sprintf("Hello from the simulator #%d", n)})
+	}},
+	{"message.image", "messages", "Inbound image with caption", func(p Params, n int) map[string]interface{} {
+		return inbound(p, n, "image", mediaObject(n, "image/jpeg", "A photo"))
+	}},
+	{"message.audio", "messages", "Inbound voice note", func(p Params, n int) map[string]interface{} {
+		m := mediaObject(n, "audio/ogg; codecs=opus", "")
+		m["voice"] = true
+		return inbound(p, n, "audio", m)
+	}},
+	{"message.video", "messages", "Inbound video", func(p Params, n int) map[string]interface{} {
+		return inbound(p, n, "video", mediaObject(n, "video/mp4", "A clip"))
+	}},
+	{"message.document", "messages", "Inbound document", func(p Params, n int) map[string]interface{} {
+		m := mediaObject(n, "application/pdf", "Invoice")
+		m["filename"] = "invoice.pdf"
+		return inbound(p, n, "document", m)
+	}},
+	{"message.sticker", "messages", "Inbound sticker", func(p Params, n int) map[string]interface{} {
+		m := mediaObject(n, "image/webp", "")
+		m["animated"] = false
+		return inbound(p, n, "sticker", m)
+	}},
+	{"message.location", "messages", "Inbound location pin", func(p Params, n int) map[string]interface{} {
+		return inbound(p, n, "location", map[string]interface{}{
+			"latitude": 37.4847, "longitude": -122.1477, "name": "Menlo Park", "address": "1 Hacker Way",
+		})
+	}},
+	{"message.contacts", "messages", "Inbound shared contact card", func(p Params, n int) map[string]interface{} {
+		return inbound(p, n, "contacts", []map[string]interface{}{{
+			"name":   map[string]string{"formatted_name": "Jane Doe", "first_name": "Jane", "last_name": "Doe"},
+			"phones": []map[string]string{{"phone": "+1 650 555 9876", "type": "CELL", "wa_id": "16505559876"}},
+		}})
+	}},
+	{"message.interactive.button_reply", "messages", "Reply to an interactive button message", func(p Params, n int) map[string]interface{} {
+		v := inbound(p, n, "interactive", map[string]interface{}{
+			"type":         "button_reply",
+			"button_reply": map[string]string{"id": "confirm", "title": "Confirm"},
+		})
+		withContext(v, p, n)
+		return v
+	}},
+	{"message.interactive.list_reply", "messages", "Reply to an interactive list message", func(p Params, n int) map[string]interface{} {
+		v := inbound(p, n, "interactive", map[string]interface{}{
+			"type":       "list_reply",
+			"list_reply": map[string]string{"id": "opt_2", "title": "Option 2", "description": "Second option"},
+		})
+		withContext(v, p, n)
+		return v
+	}},
+	{"message.button", "messages", "Quick-reply button on a template message", func(p Params, n int) map[string]interface{} {
+		v := inbound(p, n, "button", map[string]interface{}{"payload": "STOP_PROMOTIONS", "text": "Stop promotions"})
+		withContext(v, p, n)
+		return v
+	}},
+	{"message.reaction", "messages", "Emoji reaction to a sent message", func(p Params, n int) map[string]interface{} {
+		return inbound(p, n, "reaction", map[string]interface{}{"message_id": outboundID(n), "emoji": "\U0001F44D"})
+	}},
+	{"message.order", "messages", "Cart order from a catalog", func(p Params, n int) map[string]interface{} {
+		return inbound(p, n, "order", map[string]interface{}{
+			"catalog_id": "1234567890",
+			"text":       "Please deliver tomorrow",
+			"product_items": []map[string]interface{}{
+				{"product_retailer_id": "sku-1", "quantity": 2, "item_price": 9.99, "currency": "USD"},
+			},
+		})
+	}},
+	{"message.system", "messages", "System message (customer changed number)", func(p Params, n int) map[string]interface{} {
+		return inbound(p, n, "system", map[string]interface{}{
+			"body": "User changed from " + p.From + " to 16505550000", "wa_id": "16505550000", "type": "user_changed_number",
+		})
+	}},
+	{"message.unsupported", "messages", "Unsupported message type", func(p Params, n int) map[string]interface{} {
+		v := inbound(p, n, "unsupported", nil)
+		msg := v["messages"].([]map[string]interface{})[0]
+		delete(msg, "unsupported")
+		msg["errors"] = []map[string]interface{}{{
+			"code": 131051, "title": "Message type unknown", "message": "Message type unknown",
+			"error_data": map[string]string{"details": "Message type is currently not supported."},
+		}}
+		return v
+	}},
+
+	// Outbound message statuses
+	{"status.sent", "messages", "Outbound message sent", func(p Params, n int) map[string]interface{} {
+		return status(p, n, "sent", true)
+	}},
+	{"status.delivered", "messages", "Outbound message delivered", func(p Params, n int) map[string]interface{} {
+		return status(p, n, "delivered", true)
+	}},
+	{"status.read", "messages", "Outbound message read", func(p Params, n int) map[string]interface{} {
+		return status(p, n, "read", false)
+	}},
+	{"status.failed", "messages", "Outbound message failed", func(p Params, n int) map[string]interface{} {
+		v := status(p, n, "failed", false)
+		v["statuses"].([]map[string]interface{})[0]["errors"] = []map[string]interface{}{{
+			"code": 131047, "title": "Re-engagement message", "message": "Re-engagement message",
+			"error_data": map[string]string{"details": "Message failed to send because more than 24 hours have passed since the customer last replied to this number."},
+		}}
+		return v
+	}},
+
+	// Template events
+	{"template.status.approved", "message_template_status_update", "Template approved", func(p Params, n int) map[string]interface{} {
+		return templateStatus(n, "APPROVED", "NONE")
+	}},
+	{"template.status.rejected", "message_template_status_update", "Template rejected", func(p Params, n int) map[string]interface{} {
+		return templateStatus(n, "REJECTED", "INVALID_FORMAT")
+	}},
+	{"template.status.paused", "message_template_status_update", "Template paused for low quality", func(p Params, n int) map[string]interface{} {
+		v := templateStatus(n, "PAUSED", "NONE")
+		v["other_info"] = map[string]string{"title": "FIRST_PAUSE", "description": "Your template has been paused due to low quality."}
+		return v
+	}},
+	{"template.status.disabled", "message_template_status_update", "Template disabled", func(p Params, n int) map[string]interface{} {
+		return templateStatus(n, "DISABLED", "NONE")
+	}},
+	{"template.quality", "message_template_quality_update", "Template quality score change", func(p Params, n int) map[string]interface{} {
+		return map[string]interface{}{
+			"previous_quality_score":    "GREEN",
+			"new_quality_score":         "YELLOW",
+			"message_template_id":       templateID(n),
+			"message_template_name":     "order_confirmation",
+			"message_template_language": "en_US",
+		}
+	}},
+	{"template.category", "template_category_update", "Template category changed", func(p Params, n int) map[string]interface{} {
+		return map[string]interface{}{
+			"message_template_id":       templateID(n),
+			"message_template_name":     "order_confirmation",
+			"message_template_language": "en_US",
+			"previous_category":         "UTILITY",
+			"new_category":              "MARKETING",
+		}
+	}},
+
+	// Account and phone number events
+	{"account.alert", "account_alerts", "Account alert (messaging limit)", func(p Params, n int) map[string]interface{} {
+		return map[string]interface{}{
+			"entity_type":       "BUSINESS",
+			"entity_id":         p.WABAID,
+			"alert_severity":    "CRITICAL",
+			"alert_status":      "ACTIVE",
+			"alert_type":        "INCREASED_CAPABILITIES_ELIGIBILITY_FAILED",
+			"alert_description": "Your business is not eligible for a higher messaging limit.",
+		}
+	}},
+	{"account.update.banned", "account_update", "WABA disabled by policy enforcement", func(p Params, n int) map[string]interface{} {
+		return map[string]interface{}{
+			"phone_number": p.DisplayPhoneNumber,
+			"event":        "DISABLED_UPDATE",
+			"ban_info":     map[string]string{"waba_ban_state": "DISABLE", "waba_ban_date": p.Now.Format("2006-01-02")},
+		}
+	}},
+	{"account.update.violation", "account_update", "Policy violation recorded", func(p Params, n int) map[string]interface{} {
+		return map[string]interface{}{
+			"phone_number":   p.DisplayPhoneNumber,
+			"event":          "ACCOUNT_VIOLATION",
+			"violation_info": map[string]string{"violation_type": "SCAM"},
+		}
+	}},
+	{"account.review", "account_review_update", "WABA review decision", func(p Params, n int) map[string]interface{} {
+		return map[string]interface{}{"decision": "APPROVED"}
+	}},
+	{"phone.quality", "phone_number_quality_update", "Phone number quality/limit change", func(p Params, n int) map[string]interface{} {
+		return map[string]interface{}{
+			"display_phone_number": p.DisplayPhoneNumber,
+			"event":                "DOWNGRADE",
+			"current_limit":        "TIER_1K",
+			"old_limit":            "TIER_10K",
+		}
+	}},
+	{"phone.name", "phone_number_name_update", "Display name review decision", func(p Params, n int) map[string]interface{} {
+		return map[string]interface{}{
+			"display_phone_number":    p.DisplayPhoneNumber,
+			"decision":                "APPROVED",
+			"requested_verified_name": "Sim Business",
+		}
+	}},
+	{"business.capability", "business_capability_update", "Business messaging capability change", func(p Params, n int) map[string]interface{} {
+		return map[string]interface{}{"max_daily_conversation_per_phone": 10000, "max_phone_numbers_per_business": 25}
+	}},
+	{"security", "security", "Two-step verification PIN change", func(p Params, n int) map[string]interface{} {
+		return map[string]interface{}{
+			"display_phone_number": p.DisplayPhoneNumber,
+			"event":                "PIN_CHANGED",
+			"requester":            "10000000001",
+		}
+	}},
+}
+
+// EventTypes returns every event type the simulator can generate.
+func EventTypes() []EventType {
+	return append([]EventType(nil), eventTypes...)
+}
+
+// Lookup finds an event type by name.
+func Lookup(name string) (EventType, bool) {
+	for _, e := range eventTypes {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return EventType{}, false
+}
+
+// Fields returns the distinct webhook fields covered by the simulator.
+func Fields() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, e := range eventTypes {
+		if !seen[e.Field] {
+			seen[e.Field] = true
+			out = append(out, e.Field)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Payload builds the full webhook body for event type e. seq makes message
+// and template IDs unique across a run.
+func (e EventType) Payload(p Params, seq int) map[string]interface{} {
+	if p.Now.IsZero() {
+		p.Now = time.Now()
+	}
+	return map[string]interface{}{
+		"object": "whatsapp_business_account",
+		"entry": []map[string]interface{}{{
+			"id":   p.WABAID,
+			"time": p.Now.Unix(),
+			"changes": []map[string]interface{}{{
+				"field": e.Field,
+				"value": e.value(p, seq),
+			}},
+		}},
+	}
+}
+
+// Body is Payload encoded as the JSON bytes Meta would deliver.
+func (e EventType) Body(p Params, seq int) ([]byte, error) {
+	body, err := json.Marshal(e.Payload(p, seq))
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s payload: %w", e.Name, err)
+	}
+	return body, nil
+}
+
+func metadata(p Params) map[string]interface{} {
+	return map[string]interface{}{
+		"display_phone_number": p.DisplayPhoneNumber,
+		"phone_number_id":      p.PhoneNumberID,
+	}
+}
+
+func inbound(p Params, n int, msgType string, content interface{}) map[string]interface{} {
+	msg := map[string]interface{}{
+		"from":      p.From,
+		"id":        fmt.Sprintf("wamid.SIM.IN.%d.%d", p.Now.UnixNano(), n),
+		"timestamp": strconv.FormatInt(p.Now.Unix(), 10),
+		"type":      msgType,
+	}
+	if content != nil {
+		msg[msgType] = content
+	}
+	return map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"metadata":          metadata(p),
+		"contacts": []map[string]interface{}{{
+			"profile": map[string]string{"name": p.ContactName},
+			"wa_id":   p.From,
+		}},
+		"messages": []map[string]interface{}{msg},
+	}
+}
+
+func withContext(v map[string]interface{}, p Params, n int) {
+	v["messages"].([]map[string]interface{})[0]["context"] = map[string]string{
+		"from": p.DisplayPhoneNumber,
+		"id":   outboundID(n),
+	}
+}
+
+func mediaObject(n int, mimeType, caption string) map[string]interface{} {
+	m := map[string]interface{}{
+		"id":        fmt.Sprintf("%d", 900000000000+n),
+		"mime_type": mimeType,
+		"sha256":    "f9a4c5d0a9e2c7e6b1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4",
+	}
+	if caption != "" {
+		m["caption"] = caption
+	}
+	return m
+}
+
+func outboundID(n int) string {
+	return fmt.Sprintf("wamid.SIM.OUT.%d", n)
+}
+
+func templateID(n int) int64 {
+	return 500000000000 + int64(n)
+}
+
+func status(p Params, n int, s string, withConversation bool) map[string]interface{} {
+	st := map[string]interface{}{
+		"id":           outboundID(n),
+		"recipient_id": p.From,
+		"status":       s,
+		"timestamp":    strconv.FormatInt(p.Now.Unix(), 10),
+	}
+	if withConversation {
+		st["conversation"] = map[string]interface{}{
+			"id":                   fmt.Sprintf("conv-%d", n),
+			"expiration_timestamp": strconv.FormatInt(p.Now.Add(24*time.Hour).Unix(), 10),
+			"origin":               map[string]string{"type": "marketing"},
+		}
+		st["pricing"] = map[string]interface{}{"billable": true, "pricing_model": "CBP", "category": "marketing"}
+	}
+	return map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"metadata":          metadata(p),
+		"statuses":          []map[string]interface{}{st},
+	}
+}
+
+func templateStatus(n int, event, reason string) map[string]interface{} {
+	return map[string]interface{}{
+		"event":                     event,
+		"message_template_id":       templateID(n),
+		"message_template_name":     "order_confirmation",
+		"message_template_language": "en_US",
+		"reason":                    reason,
+	}
+}
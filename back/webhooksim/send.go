@@ -0,0 +1,107 @@
+package webhooksim
+
+import (
+	"back/services"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Sender posts signed webhook bodies to a backend's webhook endpoint.
+type Sender struct {
+	URL       string
+	AppSecret string
+	// BadSignature signs with a wrong key to exercise signature rejection.
+	BadSignature bool
+	Client       *http.Client
+}
+
+// Result is the backend's answer to one delivery.
+type Result struct {
+	Status int
+	Body   string
+}
+
+// Send signs body and POSTs it.
+func (s *Sender) Send(body []byte) (*Result, error) {
+	secret := s.AppSecret
+	if s.BadSignature {
+		secret = "not-the-app-secret"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "facebookexternalua")
+	req.Header.Set(services.SignatureHeader, services.SignWebhookPayload(secret, body))
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("webhook delivery failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	return &Result{Status: resp.StatusCode, Body: string(respBody)}, nil
+}
+
+// SendEvent generates event e and sends it, returning the body that was sent.
+func (s *Sender) SendEvent(e EventType, p Params, seq int) ([]byte, *Result, error) {
+	body, err := e.Body(p, seq)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := s.Send(body)
+	return body, res, err
+}
+
+// ReadRecorded loads raw webhook bodies from a file. The file is either a
+// JSON array of payloads or JSON Lines with one payload per line.
+func ReadRecorded(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read recorded payloads: %w", err)
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var arr []json.RawMessage
+		if err := json.Unmarshal(trimmed, &arr); err != nil {
+			return nil, fmt.Errorf("parse recorded payload array: %w", err)
+		}
+		out := make([][]byte, 0, len(arr))
+		for _, raw := range arr {
+			out = append(out, []byte(raw))
+		}
+		return out, nil
+	}
+
+	var out [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		l := bytes.TrimSpace(scanner.Bytes())
+		if len(l) == 0 {
+			continue
+		}
+		if !json.Valid(l) {
+			return nil, fmt.Errorf("line %d is not valid JSON", line)
+		}
+		out = append(out, append([]byte(nil), l...))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan recorded payloads: %w", err)
+	}
+	return out, nil
+}
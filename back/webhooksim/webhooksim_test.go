@@ -0,0 +1,56 @@
+package webhooksim
+
+import (
+	"back/config"
+	"back/handlers"
+	"back/services"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEveryEventTypeIsAccepted(t *testing.T) {
+	var signatures []string
+	webhook := handlers.NewWebhookHandler(&config.Config{FacebookAppSecret: "secret"}, nil, services.NewWebhookArchive(100), services.NewEventBus(), services.NewStorageService(services.NewAuditLog()), services.NewAuditLog(), nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signatures = append(signatures, r.Header.Get(services.SignatureHeader))
+		webhook.ReceiveWebhook(w, r)
+	}))
+	defer srv.Close()
+
+	sender := &Sender{URL: srv.URL, AppSecret: "secret"}
+	for i, e := range EventTypes() {
+		body, res, err := sender.SendEvent(e, DefaultParams(), i)
+		if err != nil {
+			t.Fatalf("%s: %v", e.Name, err)
+		}
+		if res.Status != http.StatusOK {
+			t.Errorf("%s: status %d %s", e.Name, res.Status, res.Body)
+		}
+		if !services.ValidWebhookSignature("secret", signatures[len(signatures)-1], body) {
+			t.Errorf("%s: signature does not verify", e.Name)
+		}
+	}
+}
+
+func TestReadRecorded(t *testing.T) {
+	dir := t.TempDir()
+	lines := filepath.Join(dir, "events.jsonl")
+	os.WriteFile(lines, []byte("{\"object\":\"a\"}\n\n{\"object\":\"b\"}\n"), 0o644)
+	array := filepath.Join(dir, "events.json")
+	os.WriteFile(array, []byte(`[{"object":"a"},{"object":"b"},{"object":"c"}]`), 0o644)
+	broken := filepath.Join(dir, "broken.jsonl")
+	os.WriteFile(broken, []byte("{\"object\":\"a\"}\n{nope\n"), 0o644)
+
+	if got, err := ReadRecorded(lines); err != nil || len(got) != 2 {
+		t.Errorf("JSON Lines: %d payloads, err %v", len(got), err)
+	}
+	if got, err := ReadRecorded(array); err != nil || len(got) != 3 {
+		t.Errorf("JSON array: %d payloads, err %v", len(got), err)
+	}
+	if _, err := ReadRecorded(broken); err == nil {
+		t.Error("expected error for invalid line")
+	}
+}
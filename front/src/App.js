@@ -5,6 +5,8 @@ const CONFIG = {
   CONFIG_ID: "your_app_config_here",
   BACKEND_URL: "http://localhost:8081",
   REDIRECT_URI: "https://482e8d84cfc0.ngrok-free.app",
+  // API key or session token for the backend's /api/* routes
+  API_TOKEN: process.env.REACT_APP_API_TOKEN || "",
 };
 
 export default function App() {
@@ -228,7 +230,10 @@ export default function App() {
 
       const res = await fetch(`${CONFIG.BACKEND_URL}/api/whatsapp/setup`, {
         method: "POST",
-        headers: { "Content-Type": "application/json" },
+        headers: {
+          "Content-Type": "application/json",
+          Authorization: `Bearer ${CONFIG.API_TOKEN}`,
+        },
         body: JSON.stringify(requestPayload),
       });
 
@@ -242,7 +247,13 @@ export default function App() {
         setNextSteps(result.next_steps || []);
         setTokenInfo(result.token_info || null);
       } else {
-        throw new Error(result.error || "Setup failed");
+        // Errors use the API envelope: { error: { code, message, request_id } }
+        const apiError = result.error || {};
+        throw new Error(
+          apiError.message
+            ? `${apiError.message} (${apiError.code}, request ${apiError.request_id})`
+            : "Setup failed"
+        );
       }
     } catch (err) {
       setStatus("error");
@@ -500,48 +511,51 @@ export default function App() {
                   <strong>Preview:</strong> {tokenInfo.access_token_preview}
                 </div>
 
-                <div
-                  style={{
-                    backgroundColor: "#343a40",
-                    color: "#f8f9fa",
-                    padding: "15px",
-                    borderRadius: "6px",
-                    position: "relative",
-                  }}
-                >
-                  <div style={{ marginBottom: "8px" }}>
-                    <strong>Full Access Token:</strong>
-                  </div>
+                {/* Only returned to owners, who may view tokens */}
+                {businessInfo?.access_token && (
                   <div
                     style={{
-                      wordBreak: "break-all",
-                      fontSize: "12px",
-                      lineHeight: "1.4",
-                      backgroundColor: "#495057",
-                      padding: "10px",
-                      borderRadius: "4px",
+                      backgroundColor: "#343a40",
+                      color: "#f8f9fa",
+                      padding: "15px",
+                      borderRadius: "6px",
+                      position: "relative",
                     }}
                   >
-                    {tokenInfo.full_access_token}
+                    <div style={{ marginBottom: "8px" }}>
+                      <strong>Full Access Token:</strong>
+                    </div>
+                    <div
+                      style={{
+                        wordBreak: "break-all",
+                        fontSize: "12px",
+                        lineHeight: "1.4",
+                        backgroundColor: "#495057",
+                        padding: "10px",
+                        borderRadius: "4px",
+                      }}
+                    >
+                      {businessInfo.access_token}
+                    </div>
+                    <button
+                      onClick={() => copyToClipboard(businessInfo.access_token)}
+                      style={{
+                        position: "absolute",
+                        top: "10px",
+                        right: "10px",
+                        padding: "4px 8px",
+                        backgroundColor: "#007bff",
+                        color: "white",
+                        border: "none",
+                        borderRadius: "4px",
+                        fontSize: "11px",
+                        cursor: "pointer",
+                      }}
+                    >
+                      📋 Copy
+                    </button>
                   </div>
-                  <button
-                    onClick={() => copyToClipboard(tokenInfo.full_access_token)}
-                    style={{
-                      position: "absolute",
-                      top: "10px",
-                      right: "10px",
-                      padding: "4px 8px",
-                      backgroundColor: "#007bff",
-                      color: "white",
-                      border: "none",
-                      borderRadius: "4px",
-                      fontSize: "11px",
-                      cursor: "pointer",
-                    }}
-                  >
-                    📋 Copy
-                  </button>
-                </div>
+                )}
               </div>
             </div>
           )}